@@ -2,22 +2,41 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/giovannigabriele/go-todo-bot/internal/access"
+	"github.com/giovannigabriele/go-todo-bot/internal/api"
+	"github.com/giovannigabriele/go-todo-bot/internal/chains"
 	"github.com/giovannigabriele/go-todo-bot/internal/config"
+	"github.com/giovannigabriele/go-todo-bot/internal/corrections"
+	"github.com/giovannigabriele/go-todo-bot/internal/cron"
+	"github.com/giovannigabriele/go-todo-bot/internal/health"
+	"github.com/giovannigabriele/go-todo-bot/internal/limits"
 	"github.com/giovannigabriele/go-todo-bot/internal/llm"
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+	"github.com/giovannigabriele/go-todo-bot/internal/parsecache"
+	"github.com/giovannigabriele/go-todo-bot/internal/pipeline"
 	"github.com/giovannigabriele/go-todo-bot/internal/queue"
 	"github.com/giovannigabriele/go-todo-bot/internal/sheets"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
 	"github.com/giovannigabriele/go-todo-bot/internal/telegram"
+	"github.com/giovannigabriele/go-todo-bot/internal/tracing"
+	"github.com/giovannigabriele/go-todo-bot/internal/usage"
 )
 
+// maxPendingAge is how long a queued task may wait before readiness fails
+const maxPendingAge = 10 * time.Minute
+
 func main() {
 	// Configure logging
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339})
@@ -27,60 +46,270 @@ func main() {
 		zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	}
 
-	log.Info().Msg("Starting TODO Bot")
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flag.Parse()
+
+	if *printConfig {
+		os.Exit(runPrintConfig(*configPath))
+	}
+
+	log.Info().Interface("build", health.Build()).Msg("Starting TODO Bot")
 
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.Load(*configPath)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load configuration")
 	}
+	components := cfg.Components()
+	logComponents(cfg, components)
 
-	// Create LLM client
-	llmClient := llm.NewClient(cfg.OpenRouterAPIKey)
+	// Set up tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		FilePath:    cfg.Tracing.File,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up tracing")
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to flush traces")
+		}
+	}()
 
-	// Create Google Sheets client
-	sheetsClient := sheets.NewClient(cfg.GoogleScriptURL)
+	// Parse the todo tab column layout
+	schema, err := sheets.ParseSchema(cfg.Sheets.Columns)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid SHEET_COLUMNS")
+	}
+
+	// Days for the digest and the LLM spend caps start at midnight here
+	location, err := time.LoadLocation(cfg.Cron.Timezone)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid cron time zone")
+	}
 
 	// Create queue manager
-	queueManager, err := queue.NewManager(cfg.DatabasePath)
+	queueManager, err := queue.NewManager(cfg.Queue.DatabasePath)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create queue manager")
 	}
 	defer queueManager.Close()
 
-	// Create batch-capable Telegram handler
-	handler, err := telegram.NewBatchHandler(cfg.TelegramToken, llmClient, sheetsClient, queueManager)
+	// Create LLM client
+	var llmClient *llm.Client
+	var usageLedger *usage.Ledger
+	var budget *limits.Budget
+	var parseCache *parsecache.Cache
+	if components.LLM {
+		llmClient = llm.NewClient(cfg.LLM.APIKey)
+		llmClient.SetBaseURL(cfg.LLM.BaseURL)
+		llmClient.SetModel(cfg.LLM.Model)
+		llmClient.SetCustomFields(schema.CustomFields())
+		llmClient.SetMaxConcurrency(cfg.LLM.MaxConcurrency)
+		llmClient.SetFallbacks(llmTargets(cfg.LLM.Fallbacks))
+		llmClient.SetCircuitBreaker(cfg.LLM.BreakerThreshold, time.Duration(cfg.LLM.BreakerCooldown))
+		llmClient.SetHedgeAfter(time.Duration(cfg.LLM.HedgeAfter))
+		prompt, chatTeams, err := loadPrompt(&cfg.LLM)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load prompt")
+		}
+		llmClient.SetPrompt(prompt)
+		llmClient.SetChatTeams(chatTeams)
+
+		usageLedger, err = usage.NewLedger(queueManager.DB(), location)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create LLM usage ledger")
+		}
+		llmClient.SetRecorder(usageLedger)
+		budget = limits.NewBudget(usageLedger, cfg.LLM.DailyCapUSD, cfg.LLM.MonthlyCapUSD)
+		llmClient.SetBudget(budget)
+
+		// The cache is kept even with a TTL of 0 so a reload can turn it on
+		parseCache, err = parsecache.NewCache(queueManager.DB(), time.Duration(cfg.LLM.CacheTTL), location)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create parse cache")
+		}
+		llmClient.SetCache(parseCache)
+	}
+
+	// Create task store
+	taskStore, err := newTaskStore(cfg, schema, queueManager)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to create Telegram handler")
+		log.Fatal().Err(err).Msg("Failed to create task store")
+	}
+
+	// Create the parsing pipeline shared by the bot and the API
+	taskPipeline := pipeline.New(llmClient, taskStore, queueManager)
+	taskPipeline.SetWorkers(cfg.Queue.Workers)
+	taskPipeline.SetPollInterval(time.Duration(cfg.Queue.PollInterval))
+	taskPipeline.SetOutboxLimits(time.Duration(cfg.Queue.OutboxMaxAge), time.Duration(cfg.Queue.OutboxRetention))
+	taskPipeline.SetLocation(location)
+
+	// Learn from people's fixes to parsed rows
+	var correctionStore *corrections.Store
+	if llmClient != nil && cfg.LLM.CorrectionExamples > 0 {
+		correctionStore, err = corrections.NewStore(queueManager.DB(), cfg.LLM.CorrectionExamples)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create corrections store")
+		}
+		llmClient.SetExamples(correctionStore)
+		taskPipeline.SetCorrections(correctionStore)
+	}
+
+	// Keep the links between the steps of task chains
+	chainStore, err := chains.NewStore(queueManager.DB())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create chain store")
+	}
+	taskPipeline.SetChains(chainStore)
+
+	// Keep recurring series and create their next rows
+	recurring, err := cron.NewRecurring(queueManager.DB(), taskPipeline.Store(), cfg.Cron.Recurring, location)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create recurring series store")
+	}
+	taskPipeline.SetRecurring(recurring)
+
+	// Remind linked assignees of their due dates
+	var reminders *cron.Reminders
+	if cfg.Cron.Reminders && components.Telegram {
+		quietHours, err := cron.ParseQuietHours(cfg.Cron.QuietHours)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid quiet hours")
+		}
+		reminders, err = cron.NewReminders(queueManager.DB(), taskPipeline.Store(), location, quietHours,
+			time.Duration(cfg.Cron.ReminderSnooze))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create reminder store")
+		}
+	}
+
+	// Create batch-capable Telegram handler
+	var handler *telegram.BatchHandler
+	var limiter *limits.MessageLimiter
+	if components.Telegram {
+		accessStore, err := access.NewStore(queueManager.DB(), cfg.Telegram.AdminTelegramID)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create access store")
+		}
+		handler, err = telegram.NewBatchHandler(cfg.Telegram.Token, taskPipeline, accessStore)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create Telegram handler")
+		}
+		handler.SetUsage(usageLedger)
+		handler.SetRecurring(recurring)
+		if reminders != nil {
+			handler.SetReminders(reminders)
+			reminders.SetSender(handler.SendReminder)
+		}
+		limiter = limits.NewMessageLimiter(
+			cfg.Telegram.UserRatePerMinute, cfg.Telegram.UserBurst,
+			cfg.Telegram.ChatRatePerMinute, cfg.Telegram.ChatBurst,
+		)
+		handler.SetLimiter(limiter)
 	}
 
 	// Create context that can be cancelled
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Start the queue workers and the outbox flusher
+	taskPipeline.Start(ctx)
+	defer taskPipeline.Stop()
+
+	if correctionStore != nil {
+		watcher := corrections.NewWatcher(correctionStore, taskPipeline.Events(), taskPipeline.Store(),
+			time.Duration(cfg.LLM.CorrectionSweep))
+		go watcher.Run(ctx)
+	}
+
+	// Tell people when the step before theirs is complete
+	var notifyUnblocked chains.Notifier
+	if handler != nil {
+		notifyUnblocked = handler.NotifyUnblocked
+	}
+	go chains.NewWatcher(chainStore, taskPipeline.Events(), taskPipeline.Store(), notifyUnblocked).Run(ctx)
+	go recurring.Run(ctx, taskPipeline.Events())
+
+	// Start scheduled jobs
+	digestSchedule := ""
+	if components.Email {
+		digestSchedule = cfg.Cron.DigestSchedule
+	}
+	cronManager := cron.NewManager(digestSchedule, location)
+	cronManager.SetRecurring(recurring)
+	if reminders != nil {
+		cronManager.SetReminders(reminders)
+	}
+	cronManager.Start()
+	defer cronManager.Stop()
+
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Start health check server
+	// Reload non-secret settings on SIGHUP
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
 	go func() {
-		mux := http.NewServeMux()
-		mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("OK"))
-		})
+		current := *cfg
+		targets := reloadTargets{
+			pipeline:   taskPipeline,
+			llmClient:  llmClient,
+			budget:     budget,
+			parseCache: parseCache,
+			limiter:    limiter,
+			reminders:  reminders,
+			cron:       cronManager,
+		}
+		for range hupChan {
+			reloadConfig(*configPath, &current, targets)
+		}
+	}()
 
-		port := os.Getenv("PORT")
-		if port == "" {
-			port = "10000"
+	// Export queue depth on every metrics scrape
+	metrics.RegisterQueueCollector(func(ctx context.Context) (map[string]int, int, error) {
+		stats, err := queueManager.GetTaskStats(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		outbox, err := queueManager.CountPendingOutbox(ctx, "")
+		if err != nil {
+			return nil, 0, err
 		}
 
+		depth := make(map[string]int)
+		for _, status := range []queue.TaskStatus{queue.StatusPending, queue.StatusRunning, queue.StatusComplete, queue.StatusFailed} {
+			depth[string(status)] = stats[status]
+		}
+		return depth, outbox, nil
+	})
+
+	// Start the HTTP server for health checks, metrics and the API
+	checker := newHealthChecker(cfg, components, queueManager, taskStore)
+	go func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/healthz", health.Handler())
+		mux.HandleFunc("/readyz", checker.ReadyHandler())
+		mux.Handle("/metrics", metrics.Handler())
+		if components.API {
+			apiServer := api.NewServer(taskPipeline, cfg.API.Keys)
+			apiServer.SetUsage(usageLedger)
+			mux.Handle(api.Prefix, apiServer.Handler())
+		}
+
+		port := cfg.Server.Port
 		server := &http.Server{
 			Addr:    ":" + port,
 			Handler: mux,
 		}
 
-		log.Info().Str("port", port).Msg("Starting health check server")
+		log.Info().Str("port", port).Msg("Starting HTTP server")
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Error().Err(err).Msg("Health check server error")
 		}
@@ -92,15 +321,271 @@ func main() {
 		cancel()
 	}()
 
-	// Start the bot
-	log.Info().Msg("Starting TODO bot...")
-	if err := handler.Start(ctx); err != nil && err != context.Canceled {
-		log.Fatal().Err(err).Msg("Bot error")
+	// Start the bot, or just wait for shutdown when Telegram ingest is off
+	if handler != nil {
+		log.Info().Msg("Starting TODO bot...")
+		if err := handler.Start(ctx); err != nil && err != context.Canceled {
+			log.Fatal().Err(err).Msg("Bot error")
+		}
+	} else {
+		<-ctx.Done()
 	}
 
 	log.Info().Msg("Bot shutdown complete")
 }
 
+// logComponents logs which subsystems this instance runs, and warns about
+// combinations that degrade behaviour
+func logComponents(cfg *config.Config, components config.Components) {
+	state := func(enabled bool) string {
+		if enabled {
+			return "on"
+		}
+		return "off"
+	}
+	log.Info().
+		Str("telegram", state(components.Telegram)).
+		Str("llm", state(components.LLM)).
+		Str("sheets", state(components.Sheets)).
+		Str("store", cfg.Store.Backend).
+		Str("email", state(components.Email)).
+		Str("api", state(components.API)).
+		Msg("Components")
+
+	if !components.LLM && (components.Telegram || components.API) {
+		log.Warn().Msg("LLM is disabled, incoming messages will be parsed with simple rules")
+	}
+}
+
+// runPrintConfig prints the effective configuration with secrets redacted,
+// followed by any validation problems, and returns the exit code
+func runPrintConfig(path string) int {
+	cfg, err := config.Read(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.Redacted().WriteYAML(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// reloadTargets are the running components reloadable settings are applied
+// to. Components that are switched off are nil.
+type reloadTargets struct {
+	pipeline   *pipeline.Pipeline
+	llmClient  *llm.Client
+	budget     *limits.Budget
+	parseCache *parsecache.Cache
+	limiter    *limits.MessageLimiter
+	reminders  *cron.Reminders
+	cron       *cron.Manager
+}
+
+// reloadConfig re-reads the configuration and applies the settings that can
+// change without a restart. An invalid configuration is logged and ignored.
+func reloadConfig(path string, current *config.Config, targets reloadTargets) {
+	log.Info().Str("config_file", path).Msg("Received SIGHUP, reloading configuration")
+
+	next, err := config.Load(path)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to reload configuration, keeping current settings")
+		return
+	}
+
+	reloadable, restart := current.Diff(next)
+	if len(restart) > 0 {
+		log.Warn().Strs("sections", restart).Msg("Some changed settings only take effect after a restart")
+	}
+	if len(reloadable) == 0 {
+		log.Info().Msg("No reloadable settings changed")
+		return
+	}
+
+	var prompt *llm.Prompt
+	var chatTeams map[int64]string
+	if targets.llmClient != nil {
+		if prompt, chatTeams, err = loadPrompt(&next.LLM); err != nil {
+			log.Error().Err(err).Msg("Failed to load prompt, keeping current settings")
+			return
+		}
+	}
+	var quietHours cron.QuietHours
+	if targets.reminders != nil {
+		if quietHours, err = cron.ParseQuietHours(next.Cron.QuietHours); err != nil {
+			log.Error().Err(err).Msg("Invalid quiet hours, keeping current settings")
+			return
+		}
+	}
+	if current.Email.Enabled {
+		if err := targets.cron.SetDigestSchedule(next.Cron.DigestSchedule); err != nil {
+			log.Error().Err(err).Msg("Failed to apply digest schedule, keeping current settings")
+			return
+		}
+	}
+	if targets.llmClient != nil {
+		targets.llmClient.SetModel(next.LLM.Model)
+		targets.llmClient.SetPrompt(prompt)
+		targets.llmClient.SetChatTeams(chatTeams)
+		targets.llmClient.SetCircuitBreaker(next.LLM.BreakerThreshold, time.Duration(next.LLM.BreakerCooldown))
+		targets.llmClient.SetHedgeAfter(time.Duration(next.LLM.HedgeAfter))
+		targets.budget.SetCaps(next.LLM.DailyCapUSD, next.LLM.MonthlyCapUSD)
+		targets.parseCache.SetTTL(time.Duration(next.LLM.CacheTTL))
+	}
+	if targets.limiter != nil {
+		targets.limiter.SetRates(
+			next.Telegram.UserRatePerMinute, next.Telegram.UserBurst,
+			next.Telegram.ChatRatePerMinute, next.Telegram.ChatBurst,
+		)
+	}
+	if targets.reminders != nil {
+		targets.reminders.SetDefaults(quietHours, time.Duration(next.Cron.ReminderSnooze))
+	}
+	targets.pipeline.SetWorkers(next.Queue.Workers)
+	targets.pipeline.SetPollInterval(time.Duration(next.Queue.PollInterval))
+	targets.pipeline.SetOutboxLimits(time.Duration(next.Queue.OutboxMaxAge), time.Duration(next.Queue.OutboxRetention))
+
+	current.ApplyReloadable(next)
+	log.Info().
+		Strs("changed", reloadable).
+		Int("workers", current.Queue.Workers).
+		Dur("poll_interval", time.Duration(current.Queue.PollInterval)).
+		Str("model", current.LLM.Model).
+		Str("prompt_version", current.LLM.PromptVersion).
+		Str("digest_schedule", current.Cron.DigestSchedule).
+		Msg("Configuration reloaded")
+}
+
+// loadPrompt loads the configured prompt version and maps chat IDs to their
+// teams
+func loadPrompt(cfg *config.LLMConfig) (*llm.Prompt, map[int64]string, error) {
+	prompt, err := llm.LoadPrompt(cfg.PromptDir, cfg.PromptVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	teams := make(map[string]bool)
+	for _, team := range prompt.Teams() {
+		teams[team] = true
+	}
+	chatTeams := make(map[int64]string)
+	for chat, team := range cfg.ChatTeams {
+		id, err := strconv.ParseInt(chat, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid chat ID %q in chat teams: %w", chat, err)
+		}
+		if !teams[team] {
+			log.Warn().Str("team", team).Int64("chat_id", id).Msg("Team has no prompt examples, using the default ones")
+		}
+		chatTeams[id] = team
+	}
+
+	log.Info().Str("prompt_version", prompt.Version).Strs("teams", prompt.Teams()).Msg("Loaded LLM prompt")
+	return prompt, chatTeams, nil
+}
+
+// llmTargets converts the configured fallback models for the LLM client
+func llmTargets(fallbacks []config.LLMTarget) []llm.Target {
+	var targets []llm.Target
+	for _, fallback := range fallbacks {
+		targets = append(targets, llm.Target{
+			Model:   fallback.Model,
+			BaseURL: fallback.BaseURL,
+			APIKey:  fallback.APIKey,
+		})
+	}
+	return targets
+}
+
+// newTaskStore creates the task storage backend selected by TASK_STORE
+func newTaskStore(cfg *config.Config, schema sheets.Schema, queueManager *queue.Manager) (store.TaskStore, error) {
+	team := store.TeamFromMap(cfg.Store.Team)
+
+	switch cfg.Store.Backend {
+	case "sqlite":
+		sqliteStore, err := store.NewSQLiteStore(queueManager.DB())
+		if err != nil {
+			return nil, err
+		}
+		if err := sqliteStore.SetTeam(context.Background(), team); err != nil {
+			return nil, err
+		}
+		return sqliteStore, nil
+	case "file":
+		return store.NewFileStore(cfg.Store.Path, team)
+	case "sheets_api":
+		key, err := os.ReadFile(cfg.Sheets.ServiceAccountFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account key: %w", err)
+		}
+		apiClient, err := sheets.NewAPIClient(cfg.Sheets.SpreadsheetID, key, cfg.Sheets.APIURL, schema)
+		if err != nil {
+			return nil, err
+		}
+		return store.NewSheetsStore(apiClient), nil
+	default:
+		return store.NewSheetsStore(sheets.NewClient(cfg.Sheets.ScriptURL, schema)), nil
+	}
+}
+
+// newHealthChecker registers the readiness checks for the enabled components
+func newHealthChecker(cfg *config.Config, components config.Components, queueManager *queue.Manager, taskStore store.TaskStore) *health.Checker {
+	checker := health.NewChecker(3*time.Second, 10*time.Second)
+
+	checker.Register("sqlite", func(ctx context.Context) (map[string]interface{}, error) {
+		var one int
+		if err := queueManager.DB().QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+			return nil, fmt.Errorf("failed to query database: %w", err)
+		}
+		return map[string]interface{}{"path": cfg.Queue.DatabasePath}, nil
+	})
+
+	checker.Register("queue", func(ctx context.Context) (map[string]interface{}, error) {
+		pending, oldest, err := queueManager.GetBacklog(ctx)
+		if err != nil {
+			return nil, err
+		}
+		outbox, err := queueManager.CountPendingOutbox(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+
+		details := map[string]interface{}{
+			"pending":       pending,
+			"outboxPending": outbox,
+		}
+		if oldest != nil {
+			age := time.Since(*oldest)
+			details["oldestPendingAgeSeconds"] = int(age.Seconds())
+			if age > maxPendingAge {
+				return details, fmt.Errorf("oldest pending task has waited %s", age.Round(time.Second))
+			}
+		}
+		return details, nil
+	})
+
+	if components.Telegram {
+		checker.Register("telegram", health.RecentSuccess(health.ComponentTelegram, 3*time.Minute))
+	}
+	if components.LLM {
+		checker.Register("llm", health.LastCallSucceeded(health.ComponentLLM, nil))
+	}
+	if components.Sheets {
+		checker.Register("sheets", health.LastCallSucceeded(health.ComponentSheets, func(ctx context.Context) error {
+			_, err := taskStore.GetTeam(ctx)
+			return err
+		}))
+	}
+
+	return checker
+}
+
 // setupLogging configures the logger
 func setupLogging() {
 	// Configure zerolog
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/fakesheet"
+	"github.com/giovannigabriele/go-todo-bot/internal/sheets"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "address to listen on")
+	team := flag.String("team", "alice:alice@example.com,bob:bob@example.com,sarah:sarah@example.com",
+		"comma-separated name:email pairs for the team tab")
+	keyOut := flag.String("key-out", "", "write a service account key for the fake Sheets API to this file")
+	columns := flag.String("columns", "", "todo tab header row as a SHEET_COLUMNS spec (default: the standard layout)")
+	debug := flag.Bool("debug", false, "enable debug logging")
+	flag.Parse()
+
+	// Configure logging
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339})
+	if *debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	} else {
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	}
+
+	server := fakesheet.NewServer(parseTeam(*team))
+	if *columns != "" {
+		schema, err := sheets.ParseSchema(*columns)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid -columns")
+		}
+		header := make([]string, len(schema))
+		for i, column := range schema {
+			header[i] = column.Header
+		}
+		server.SetTodoHeader(header, schema)
+	}
+
+	baseURL := "http://" + *addr
+	if strings.HasPrefix(*addr, ":") {
+		baseURL = "http://localhost" + *addr
+	}
+
+	if *keyOut != "" {
+		key, err := fakesheet.ServiceAccountKey(baseURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to generate service account key")
+		}
+		if err := os.WriteFile(*keyOut, key, 0o600); err != nil {
+			log.Fatal().Err(err).Msg("Failed to write service account key")
+		}
+		log.Info().
+			Str("key_file", *keyOut).
+			Msg("Wrote service account key; set TASK_STORE=sheets_api, GOOGLE_SHEETS_API_URL=" + baseURL +
+				" and GOOGLE_SERVICE_ACCOUNT_FILE=" + *keyOut)
+	}
+
+	log.Info().
+		Str("addr", *addr).
+		Msg("Fake sheet webhook listening; set GOOGLE_SCRIPT_URL=" + baseURL)
+	if err := http.ListenAndServe(*addr, server); err != nil && err != http.ErrServerClosed {
+		log.Fatal().Err(err).Msg("Fake sheet server error")
+	}
+}
+
+// parseTeam parses name:email pairs from the -team flag
+func parseTeam(value string) []sheets.TeamMember {
+	var team []sheets.TeamMember
+	for _, pair := range strings.Split(value, ",") {
+		name, email, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || name == "" || email == "" {
+			if pair != "" {
+				log.Warn().Str("entry", pair).Msg("Ignoring malformed team entry")
+			}
+			continue
+		}
+		team = append(team, sheets.TeamMember{Name: name, Email: email})
+	}
+	return team
+}
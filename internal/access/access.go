@@ -0,0 +1,314 @@
+// Package access decides who may use the bot. Approved Telegram users and
+// chats are kept in SQLite alongside an audit log of refused attempts and
+// admin changes.
+package access
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Kind distinguishes allowlisted users from allowlisted chats
+type Kind string
+
+const (
+	// KindUser approves a Telegram user in any chat
+	KindUser Kind = "user"
+	// KindChat approves every member of a Telegram chat
+	KindChat Kind = "chat"
+)
+
+// ParseKind parses "user" or "chat"
+func ParseKind(s string) (Kind, bool) {
+	switch Kind(strings.ToLower(s)) {
+	case KindUser:
+		return KindUser, true
+	case KindChat:
+		return KindChat, true
+	}
+	return "", false
+}
+
+// Audit event names
+const (
+	EventDenied      = "denied"
+	EventAdminDenied = "admin_denied"
+	EventApproved    = "approved"
+	EventRevoked     = "revoked"
+)
+
+// maxDetail bounds how much of a refused message is kept in the audit log
+const maxDetail = 200
+
+// Entry is an allowlisted user or chat
+type Entry struct {
+	Kind    Kind
+	ID      int64
+	Label   string
+	AddedBy string
+	AddedAt time.Time
+}
+
+// Actor identifies who sent a message
+type Actor struct {
+	UserID   int64
+	Username string
+	ChatID   int64
+}
+
+// Attempt summarises the refused messages from one user in one chat
+type Attempt struct {
+	Actor
+	Count int
+	Last  time.Time
+}
+
+// Store keeps the allowlist and the audit log
+type Store struct {
+	db      *sql.DB
+	adminID int64
+}
+
+// NewStore creates an access store in db, creating its tables if needed.
+// adminID is the configured admin's numeric Telegram user ID.
+func NewStore(db *sql.DB, adminID int64) (*Store, error) {
+	s := &Store{db: db, adminID: adminID}
+
+	if err := s.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize access schema: %w", err)
+	}
+	return s, nil
+}
+
+// initSchema creates the access_list and access_audit tables
+func (s *Store) initSchema() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS access_list (
+			kind TEXT NOT NULL,
+			id INTEGER NOT NULL,
+			label TEXT NOT NULL DEFAULT '',
+			added_by TEXT NOT NULL,
+			added_at DATETIME NOT NULL,
+			PRIMARY KEY (kind, id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create access_list table: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS access_audit (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			event TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			username TEXT NOT NULL,
+			chat_id INTEGER NOT NULL,
+			detail TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_access_audit_event ON access_audit(event, created_at);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create access_audit table: %w", err)
+	}
+	return nil
+}
+
+// AdminChatID returns the admin's private chat ID, which is their user ID
+func (s *Store) AdminChatID() int64 {
+	return s.adminID
+}
+
+// IsAdmin reports whether the user is the configured admin. Only the user ID
+// counts: a username can be given up and claimed by someone else.
+func (s *Store) IsAdmin(userID int64) bool {
+	return s.adminID != 0 && userID == s.adminID
+}
+
+// Allowed reports whether actor may use the bot: the admin always may, other
+// users need their own approval or one for the chat they write in
+func (s *Store) Allowed(ctx context.Context, actor Actor) (bool, error) {
+	if s.IsAdmin(actor.UserID) {
+		return true, nil
+	}
+
+	var count int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM access_list
+		WHERE (kind = ? AND id = ?) OR (kind = ? AND id = ?)
+	`, KindUser, actor.UserID, KindChat, actor.ChatID).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check allowlist: %w", err)
+	}
+	return count > 0, nil
+}
+
+// Allow approves a user or chat. Approving an entry twice updates its label.
+func (s *Store) Allow(ctx context.Context, admin Actor, kind Kind, id int64, label string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO access_list (kind, id, label, added_by, added_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (kind, id) DO UPDATE SET label = excluded.label
+	`, kind, id, label, describe(admin), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to allow %s %d: %w", kind, id, err)
+	}
+
+	s.audit(ctx, EventApproved, admin, fmt.Sprintf("%s %d", kind, id))
+	return nil
+}
+
+// Revoke removes a user or chat from the allowlist, reporting whether it was
+// there
+func (s *Store) Revoke(ctx context.Context, admin Actor, kind Kind, id int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM access_list WHERE kind = ? AND id = ?", kind, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke %s %d: %w", kind, id, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected > 0 {
+		s.audit(ctx, EventRevoked, admin, fmt.Sprintf("%s %d", kind, id))
+	}
+	return affected > 0, nil
+}
+
+// List returns the allowlist, users first
+func (s *Store) List(ctx context.Context) ([]Entry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT kind, id, label, added_by, added_at FROM access_list
+		ORDER BY kind DESC, added_at ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list allowlist: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		if err := rows.Scan(&entry.Kind, &entry.ID, &entry.Label, &entry.AddedBy, &entry.AddedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan allowlist entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating allowlist: %w", err)
+	}
+	return entries, nil
+}
+
+// RecordDenied audits a refused message and reports whether it is the first
+// refusal for this user in this chat, so the admin can be told once
+func (s *Store) RecordDenied(ctx context.Context, actor Actor, detail string) (bool, error) {
+	var previous int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM access_audit
+		WHERE event = ? AND user_id = ? AND chat_id = ?
+	`, EventDenied, actor.UserID, actor.ChatID).Scan(&previous)
+	if err != nil {
+		return false, fmt.Errorf("failed to count refusals: %w", err)
+	}
+
+	if runes := []rune(detail); len(runes) > maxDetail {
+		detail = string(runes[:maxDetail]) + "…"
+	}
+	s.audit(ctx, EventDenied, actor, detail)
+	return previous == 0, nil
+}
+
+// RecordAdminDenied audits a non-admin trying an admin command
+func (s *Store) RecordAdminDenied(ctx context.Context, actor Actor, command string) {
+	s.audit(ctx, EventAdminDenied, actor, command)
+}
+
+// RecentDenied returns the users refused within since who are still not
+// approved, most recent first
+func (s *Store) RecentDenied(ctx context.Context, since time.Duration, limit int) ([]Attempt, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.user_id, MAX(a.username), a.chat_id, COUNT(*), MAX(a.created_at)
+		FROM access_audit a
+		WHERE a.event = ? AND a.created_at >= ?
+			AND NOT EXISTS (
+				SELECT 1 FROM access_list l
+				WHERE (l.kind = ? AND l.id = a.user_id) OR (l.kind = ? AND l.id = a.chat_id)
+			)
+		GROUP BY a.user_id, a.chat_id
+		ORDER BY MAX(a.created_at) DESC
+		LIMIT ?
+	`, EventDenied, time.Now().Add(-since), KindUser, KindChat, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query refusals: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []Attempt
+	for rows.Next() {
+		var attempt Attempt
+		var last string
+		if err := rows.Scan(&attempt.UserID, &attempt.Username, &attempt.ChatID, &attempt.Count, &last); err != nil {
+			return nil, fmt.Errorf("failed to scan refusal: %w", err)
+		}
+		attempt.Last = parseTime(last)
+		attempts = append(attempts, attempt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating refusals: %w", err)
+	}
+	return attempts, nil
+}
+
+// audit writes an audit event to the log and the access_audit table. A
+// failed insert is logged rather than returned so it never blocks a reply.
+func (s *Store) audit(ctx context.Context, event string, actor Actor, detail string) {
+	entry := log.Info()
+	if event == EventDenied || event == EventAdminDenied {
+		entry = log.Warn()
+	}
+	entry.
+		Str("audit", event).
+		Int64("user_id", actor.UserID).
+		Str("username", actor.Username).
+		Int64("chat_id", actor.ChatID).
+		Str("detail", detail).
+		Msg("Access audit event")
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO access_audit (event, user_id, username, chat_id, detail, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, event, actor.UserID, actor.Username, actor.ChatID, detail, time.Now())
+	if err != nil {
+		log.Error().Err(err).Str("audit", event).Msg("Failed to record audit event")
+	}
+}
+
+// describe names an actor for the added_by column
+func describe(actor Actor) string {
+	if actor.Username != "" {
+		return "@" + actor.Username
+	}
+	return strconv.FormatInt(actor.UserID, 10)
+}
+
+// parseTime parses a timestamp returned by an aggregate, which the SQLite
+// driver hands back as text
+func parseTime(value string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999-07:00", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
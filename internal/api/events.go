@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/events"
+)
+
+// heartbeatInterval is how often an idle stream sends a comment, so proxies
+// keep the connection open
+const heartbeatInterval = 15 * time.Second
+
+// streamEvents streams queue transitions and row changes as server-sent
+// events, filtered by the batch and person query parameters. Clients that
+// reconnect with Last-Event-ID get the recent events they missed.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := events.Filter{
+		BatchID: strings.TrimSpace(query.Get("batch")),
+		Person:  strings.TrimSpace(query.Get("person")),
+	}
+
+	var lastID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid Last-Event-ID")
+			return
+		}
+		lastID = id
+	}
+
+	stream, unsubscribe := s.pipeline.Events().Subscribe(filter, lastID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	log.Debug().Str("batch_id", filter.BatchID).Str("person", filter.Person).Msg("Event stream opened")
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Debug().Msg("Event stream closed")
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case event := <-stream:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to encode event")
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Package api serves the versioned JSON API under /api/v1. It submits free
+// text through the same pipeline as the Telegram bot and reads and updates
+// tasks through the same task store, so both front ends see the same data.
+package api
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/pipeline"
+	"github.com/giovannigabriele/go-todo-bot/internal/tracing"
+	"github.com/giovannigabriele/go-todo-bot/internal/usage"
+)
+
+// Prefix is the path every API route lives under
+const Prefix = "/api/v1/"
+
+// maxBodyBytes bounds request bodies
+const maxBodyBytes = 64 << 10
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// Server serves the REST API
+type Server struct {
+	pipeline *pipeline.Pipeline
+	keys     [][]byte
+	usage    *usage.Ledger
+}
+
+// NewServer creates an API server that accepts the given API keys
+func NewServer(p *pipeline.Pipeline, apiKeys []string) *Server {
+	s := &Server{pipeline: p}
+	for _, key := range apiKeys {
+		s.keys = append(s.keys, []byte(key))
+	}
+	return s
+}
+
+// SetUsage serves LLM usage summaries from ledger
+func (s *Server) SetUsage(ledger *usage.Ledger) {
+	s.usage = ledger
+}
+
+// Handler returns the HTTP handler for everything under Prefix
+func (s *Server) Handler() http.Handler {
+	return tracing.Handler(http.HandlerFunc(s.route), "api")
+}
+
+// route dispatches a request by path and method. Go 1.21's ServeMux has no
+// path parameters, so the path is matched here.
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, Prefix), "/"), "/")
+
+	// The OpenAPI document is public so clients can be generated from it
+	if len(parts) == 1 && parts[0] == "openapi.json" {
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPIDocument)
+		return
+	}
+
+	// Browsers' EventSource cannot set headers, so the stream also takes the
+	// key as a query parameter
+	isStream := len(parts) == 1 && parts[0] == "events"
+	if !s.authorized(r, isStream) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		writeError(w, http.StatusUnauthorized, "missing or invalid API key")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "tasks":
+		if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+			return
+		}
+		if r.Method == http.MethodPost {
+			s.createTasks(w, r)
+		} else {
+			s.listTasks(w, r)
+		}
+	case len(parts) == 2 && parts[0] == "tasks" && parts[1] != "":
+		if !allowMethods(w, r, http.MethodGet, http.MethodPatch) {
+			return
+		}
+		if r.Method == http.MethodPatch {
+			s.updateTask(w, r, parts[1])
+		} else {
+			s.getTask(w, r, parts[1])
+		}
+	case isStream:
+		if allowMethods(w, r, http.MethodGet) {
+			s.streamEvents(w, r)
+		}
+	case len(parts) == 1 && parts[0] == "team":
+		if allowMethods(w, r, http.MethodGet) {
+			s.getTeam(w, r)
+		}
+	case len(parts) == 2 && parts[0] == "batches" && parts[1] != "":
+		if allowMethods(w, r, http.MethodGet) {
+			s.getBatch(w, r, parts[1])
+		}
+	case len(parts) == 1 && parts[0] == "usage":
+		if allowMethods(w, r, http.MethodGet) {
+			s.getUsage(w, r)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// authorized reports whether the request carries a known key, either in the
+// X-API-Key header or as a bearer token, or in the api_key query parameter if
+// allowQuery is set
+func (s *Server) authorized(r *http.Request, allowQuery bool) bool {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		auth := r.Header.Get("Authorization")
+		if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+			key = strings.TrimSpace(auth[len("Bearer "):])
+		}
+	}
+	if key == "" && allowQuery {
+		key = r.URL.Query().Get("api_key")
+	}
+	if key == "" {
+		return false
+	}
+
+	for _, valid := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(key), valid) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// allowMethods reports whether the request method is one of methods, writing
+// a 405 response if not
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+// errorResponse is the body of every error response
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// decodeBody decodes a JSON request body into v, rejecting unknown fields
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return errors.New("invalid request body: " + err.Error())
+	}
+	return nil
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode API response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// writeError writes an error response
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, errorResponse{Error: message})
+}
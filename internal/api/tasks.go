@@ -0,0 +1,266 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/pipeline"
+	"github.com/giovannigabriele/go-todo-bot/internal/queue"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// createRequest is the body of POST /tasks
+type createRequest struct {
+	Text string `json:"text"`
+}
+
+// createResponse is returned by POST /tasks. Single tasks are parsed straight
+// away; messages holding several tasks are queued as a batch.
+type createResponse struct {
+	Tasks      []store.Task `json:"tasks,omitempty"`
+	Delivered  *bool        `json:"delivered,omitempty"`
+	ParseError string       `json:"parseError,omitempty"`
+	BatchID    string       `json:"batchId,omitempty"`
+	Queued     int          `json:"queued,omitempty"`
+}
+
+// updateRequest is the body of PATCH /tasks/{id}. Omitted fields are left
+// untouched.
+type updateRequest struct {
+	People   []string          `json:"people"`
+	Client   *string           `json:"client"`
+	Summary  *string           `json:"summary"`
+	Status   *string           `json:"status"`
+	DueDate  *string           `json:"dueDate"`
+	BotNotes *string           `json:"botNotes"`
+	Fields   map[string]string `json:"fields"`
+}
+
+// taskListResponse is returned by GET /tasks
+type taskListResponse struct {
+	Tasks []store.Task `json:"tasks"`
+}
+
+// teamResponse is returned by GET /team
+type teamResponse struct {
+	Team []store.TeamMember `json:"team"`
+}
+
+// batchItem is one queued part of a batch
+type batchItem struct {
+	ID            int64      `json:"id"`
+	Message       string     `json:"message"`
+	Status        string     `json:"status"`
+	Error         *string    `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	ProcessedAt   *time.Time `json:"processedAt,omitempty"`
+	PromptVersion string     `json:"promptVersion,omitempty"`
+}
+
+// batchResponse is returned by GET /batches/{id}
+type batchResponse struct {
+	ID            string         `json:"id"`
+	Total         int            `json:"total"`
+	Complete      bool           `json:"complete"`
+	Progress      map[string]int `json:"progress"`
+	OutboxPending int            `json:"outboxPending"`
+	Items         []batchItem    `json:"items"`
+}
+
+// createTasks parses free text into tasks
+func (s *Server) createTasks(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+
+	result, err := s.pipeline.Submit(r.Context(), 0, req.Text)
+	if errors.Is(err, pipeline.ErrNoTasks) {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create tasks from API request")
+		writeError(w, http.StatusBadGateway, "failed to save tasks")
+		return
+	}
+
+	resp := createResponse{
+		Tasks:   result.Tasks,
+		BatchID: result.BatchID,
+		Queued:  result.Queued,
+	}
+	if result.BatchID == "" {
+		resp.Delivered = &result.Delivered
+	}
+	if result.ParseError != nil {
+		resp.ParseError = result.ParseError.Error()
+	}
+
+	// Queued batches and rows waiting in the outbox are accepted, not created
+	code := http.StatusCreated
+	if result.BatchID != "" || !result.Delivered {
+		code = http.StatusAccepted
+	}
+	writeJSON(w, code, resp)
+}
+
+// listTasks lists tasks, filtered by the status, excludeStatus, person and
+// client query parameters
+func (s *Server) listTasks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := store.Filter{
+		Person: strings.TrimSpace(query.Get("person")),
+		Client: strings.TrimSpace(query.Get("client")),
+	}
+
+	var ok bool
+	if status := query.Get("status"); status != "" {
+		if filter.Status, ok = store.NormalizeStatus(status); !ok {
+			writeError(w, http.StatusBadRequest, "invalid status "+status)
+			return
+		}
+	}
+	if status := query.Get("excludeStatus"); status != "" {
+		if filter.ExcludeStatus, ok = store.NormalizeStatus(status); !ok {
+			writeError(w, http.StatusBadRequest, "invalid excludeStatus "+status)
+			return
+		}
+	}
+
+	tasks, err := s.pipeline.Store().ListTasks(r.Context(), filter)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list tasks")
+		writeError(w, http.StatusBadGateway, "failed to list tasks")
+		return
+	}
+	if tasks == nil {
+		tasks = []store.Task{}
+	}
+
+	writeJSON(w, http.StatusOK, taskListResponse{Tasks: tasks})
+}
+
+// getTask returns a single task
+func (s *Server) getTask(w http.ResponseWriter, r *http.Request, id string) {
+	task, err := s.pipeline.Store().GetTask(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "failed to get task")
+		return
+	}
+	writeJSON(w, http.StatusOK, task)
+}
+
+// updateTask changes the fields of a task, typically its status
+func (s *Server) updateTask(w http.ResponseWriter, r *http.Request, id string) {
+	var req updateRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Status != nil {
+		status, ok := store.NormalizeStatus(*req.Status)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "status must be one of "+strings.Join(store.Statuses, ", "))
+			return
+		}
+		req.Status = &status
+	}
+
+	task, err := s.pipeline.Store().UpdateTask(r.Context(), id, store.Update{
+		People:   req.People,
+		Client:   req.Client,
+		Summary:  req.Summary,
+		Status:   req.Status,
+		DueDate:  req.DueDate,
+		BotNotes: req.BotNotes,
+		Fields:   req.Fields,
+	})
+	if err != nil {
+		writeStoreError(w, err, "failed to update task")
+		return
+	}
+	writeJSON(w, http.StatusOK, task)
+}
+
+// getTeam returns the team roster
+func (s *Server) getTeam(w http.ResponseWriter, r *http.Request) {
+	team, err := s.pipeline.Store().GetTeam(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get team")
+		writeError(w, http.StatusBadGateway, "failed to get team")
+		return
+	}
+	if team == nil {
+		team = []store.TeamMember{}
+	}
+	writeJSON(w, http.StatusOK, teamResponse{Team: team})
+}
+
+// getBatch reports the progress of a queued batch
+func (s *Server) getBatch(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+
+	tasks, err := s.pipeline.Queue().GetBatchTasks(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Str("batch_id", id).Msg("Failed to get batch")
+		writeError(w, http.StatusInternalServerError, "failed to get batch")
+		return
+	}
+	if len(tasks) == 0 {
+		writeError(w, http.StatusNotFound, "batch not found")
+		return
+	}
+
+	outboxPending, err := s.pipeline.Queue().CountPendingOutbox(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Str("batch_id", id).Msg("Failed to count pending outbox entries")
+		writeError(w, http.StatusInternalServerError, "failed to get batch")
+		return
+	}
+
+	resp := batchResponse{
+		ID:            id,
+		Total:         len(tasks),
+		Complete:      true,
+		Progress:      make(map[string]int),
+		OutboxPending: outboxPending,
+	}
+	for _, task := range tasks {
+		resp.Progress[string(task.Status)]++
+		if task.Status != queue.StatusComplete && task.Status != queue.StatusFailed {
+			resp.Complete = false
+		}
+		resp.Items = append(resp.Items, batchItem{
+			ID:            task.ID,
+			Message:       task.MessageText,
+			Status:        string(task.Status),
+			Error:         task.Error,
+			CreatedAt:     task.CreatedAt,
+			ProcessedAt:   task.ProcessedAt,
+			PromptVersion: task.PromptVersion,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// writeStoreError maps a task store error to a response
+func writeStoreError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "task not found")
+		return
+	}
+	log.Error().Err(err).Msg(message)
+	writeError(w, http.StatusBadGateway, message)
+}
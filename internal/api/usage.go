@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/usage"
+)
+
+// defaultUsageDays is the span of a usage summary when no from is given
+const defaultUsageDays = 30
+
+// getUsage summarises LLM spend between the from and to query parameters
+// (YYYY-MM-DD, inclusive), by default the last 30 days
+func (s *Server) getUsage(w http.ResponseWriter, r *http.Request) {
+	if s.usage == nil {
+		writeError(w, http.StatusServiceUnavailable, "usage accounting is disabled because the LLM is off")
+		return
+	}
+
+	query := r.URL.Query()
+	to := query.Get("to")
+	if to == "" {
+		to = s.usage.Today()
+	}
+	toDay, err := time.Parse(usage.DayFormat, to)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "to must be a date in YYYY-MM-DD format")
+		return
+	}
+	from := query.Get("from")
+	if from == "" {
+		from = toDay.AddDate(0, 0, 1-defaultUsageDays).Format(usage.DayFormat)
+	}
+	if _, err := time.Parse(usage.DayFormat, from); err != nil {
+		writeError(w, http.StatusBadRequest, "from must be a date in YYYY-MM-DD format")
+		return
+	}
+	if from > to {
+		writeError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+
+	chats := 20
+	if value := query.Get("chats"); value != "" {
+		chats, err = strconv.Atoi(value)
+		if err != nil || chats < 1 {
+			writeError(w, http.StatusBadRequest, "chats must be a positive integer")
+			return
+		}
+	}
+
+	summary, err := s.usage.Summarize(r.Context(), from, to, chats)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
@@ -0,0 +1,155 @@
+// Package chains follows tasks that wait on others. When a message describes
+// a chain ("Gemma to ask oxccu for the brief, then Lilly to draft it") each
+// step's row is blocked by the one before; the link is kept here with the
+// chat the message came from, so that when the blocking task is completed the
+// people on the next step can be told they are unblocked.
+package chains
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// retention is how long a link is kept after it was created
+const retention = 90 * 24 * time.Hour
+
+// Link is a task waiting on another
+type Link struct {
+	TaskID    string
+	BlockedBy string
+	// ChatID is the chat the tasks came from, or 0
+	ChatID int64
+}
+
+// Store keeps the links between tasks
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore creates a chain store in db, creating its table if needed
+func NewStore(db *sql.DB) (*Store, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS task_links (
+			task_id TEXT PRIMARY KEY,
+			blocked_by TEXT NOT NULL,
+			chat_id INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			notified_at DATETIME
+		);
+		CREATE INDEX IF NOT EXISTS idx_task_links_blocked_by ON task_links(blocked_by);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create task_links table: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Record keeps the links of rows saved from chatID. Rows that are not blocked
+// lose any link they had, as when an edited message no longer has a chain.
+func (s *Store) Record(ctx context.Context, chatID int64, rows []store.Task) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for _, row := range rows {
+		if row.BlockedBy == "" {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM task_links WHERE task_id = ?`, row.ID); err != nil {
+				return fmt.Errorf("failed to delete link of task %s: %w", row.ID, err)
+			}
+			continue
+		}
+
+		// A link that changes is waited on afresh
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO task_links (task_id, blocked_by, chat_id, created_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(task_id) DO UPDATE SET
+				blocked_by = excluded.blocked_by,
+				notified_at = CASE WHEN task_links.blocked_by = excluded.blocked_by THEN task_links.notified_at END
+		`, row.ID, row.BlockedBy, chatID, now)
+		if err != nil {
+			return fmt.Errorf("failed to record link of task %s: %w", row.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Waiting returns the links still waiting on blockedBy
+func (s *Store) Waiting(ctx context.Context, blockedBy string) ([]Link, error) {
+	return s.query(ctx, `
+		SELECT task_id, blocked_by, chat_id FROM task_links
+		WHERE blocked_by = ? AND notified_at IS NULL
+		ORDER BY created_at ASC
+	`, blockedBy)
+}
+
+// Pending returns every link still waiting on its blocking task
+func (s *Store) Pending(ctx context.Context) ([]Link, error) {
+	return s.query(ctx, `
+		SELECT task_id, blocked_by, chat_id FROM task_links
+		WHERE notified_at IS NULL
+		ORDER BY created_at ASC
+	`)
+}
+
+// Done marks the link of taskID as no longer waiting
+func (s *Store) Done(ctx context.Context, taskID string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE task_links SET notified_at = ? WHERE task_id = ?`, time.Now().UTC(), taskID)
+	if err != nil {
+		return fmt.Errorf("failed to mark link of task %s done: %w", taskID, err)
+	}
+	return nil
+}
+
+// Remove deletes the link of taskID
+func (s *Store) Remove(ctx context.Context, taskID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM task_links WHERE task_id = ?`, taskID); err != nil {
+		return fmt.Errorf("failed to delete link of task %s: %w", taskID, err)
+	}
+	return nil
+}
+
+// Prune deletes links older than the retention period
+func (s *Store) Prune(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM task_links WHERE created_at < ?`, time.Now().UTC().Add(-retention))
+	if err != nil {
+		return fmt.Errorf("failed to prune task links: %w", err)
+	}
+	return nil
+}
+
+// query reads links
+func (s *Store) query(ctx context.Context, query string, args ...interface{}) ([]Link, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []Link
+	for rows.Next() {
+		var link Link
+		if err := rows.Scan(&link.TaskID, &link.BlockedBy, &link.ChatID); err != nil {
+			return nil, fmt.Errorf("failed to scan task link: %w", err)
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating task links: %w", err)
+	}
+	return links, nil
+}
@@ -0,0 +1,137 @@
+package chains
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/events"
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// sweepInterval is how often tasks completed in the task store directly, such
+// as in the sheet, are looked for
+const sweepInterval = 5 * time.Minute
+
+// Notifier tells the people on task that blocker is complete. chatID is the
+// chat the tasks came from, or 0.
+type Notifier func(ctx context.Context, chatID int64, task, blocker store.Task)
+
+// Watcher notices blocking tasks being completed. Completions made through
+// the bot arrive as events; the rest are found by a periodic sweep.
+type Watcher struct {
+	store     *Store
+	bus       *events.Bus
+	taskStore store.TaskStore
+	notify    Notifier
+}
+
+// NewWatcher creates a watcher of bus and taskStore that calls notify for
+// every task unblocked. A nil notify only logs them.
+func NewWatcher(chains *Store, bus *events.Bus, taskStore store.TaskStore, notify Notifier) *Watcher {
+	return &Watcher{
+		store:     chains,
+		bus:       bus,
+		taskStore: taskStore,
+		notify:    notify,
+	}
+}
+
+// Run watches until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	updates, unsubscribe := w.bus.Subscribe(events.Filter{}, 0)
+	defer unsubscribe()
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-updates:
+			if event.Type != events.TypeTaskUpdated || event.Task == nil || event.Task.Status != store.StatusComplete {
+				continue
+			}
+			w.unblock(ctx, *event.Task)
+		case <-ticker.C:
+			w.sweep(ctx)
+		}
+	}
+}
+
+// sweep looks for completed tasks that others are still waiting on
+func (w *Watcher) sweep(ctx context.Context) {
+	if err := w.store.Prune(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to prune task links")
+	}
+
+	links, err := w.store.Pending(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list pending task links")
+		return
+	}
+	if len(links) == 0 {
+		return
+	}
+
+	completed, err := w.taskStore.ListTasks(ctx, store.Filter{Status: store.StatusComplete})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to list completed tasks for chains")
+		return
+	}
+
+	waitedOn := make(map[string]bool, len(links))
+	for _, link := range links {
+		waitedOn[link.BlockedBy] = true
+	}
+	for _, task := range completed {
+		if waitedOn[task.ID] {
+			w.unblock(ctx, task)
+		}
+	}
+}
+
+// unblock notifies the people on every task waiting on blocker, which is
+// complete
+func (w *Watcher) unblock(ctx context.Context, blocker store.Task) {
+	links, err := w.store.Waiting(ctx, blocker.ID)
+	if err != nil {
+		log.Error().Err(err).Str("task_id", blocker.ID).Msg("Failed to list tasks waiting on task")
+		return
+	}
+
+	for _, link := range links {
+		task, err := w.taskStore.GetTask(ctx, link.TaskID)
+		if errors.Is(err, store.ErrNotFound) {
+			if err := w.store.Remove(ctx, link.TaskID); err != nil {
+				log.Error().Err(err).Msg("Failed to remove task link")
+			}
+			continue
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("task_id", link.TaskID).Msg("Failed to get unblocked task")
+			continue
+		}
+
+		// The task may have been finished already or given another blocker
+		// since. Sheets without a Blocked By column don't keep the blocker.
+		if (task.BlockedBy == "" || task.BlockedBy == blocker.ID) && task.Status != store.StatusComplete {
+			log.Info().
+				Str("task_id", task.ID).
+				Str("blocked_by", blocker.ID).
+				Strs("people", task.People).
+				Msg("Task unblocked")
+			metrics.TasksUnblocked.Inc()
+			if w.notify != nil {
+				w.notify(ctx, link.ChatID, *task, blocker)
+			}
+		}
+		if err := w.store.Done(ctx, link.TaskID); err != nil {
+			log.Error().Err(err).Msg("Failed to mark task link done")
+		}
+	}
+}
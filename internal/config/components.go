@@ -0,0 +1,27 @@
+package config
+
+// Components reports which subsystems an instance runs
+type Components struct {
+	Telegram bool
+	LLM      bool
+	Sheets   bool
+	Email    bool
+	API      bool
+}
+
+// Components returns the enabled subsystems. Sheets is in use when the task
+// store is one of the Google Sheets backends.
+func (c *Config) Components() Components {
+	return Components{
+		Telegram: c.Telegram.Enabled,
+		LLM:      c.LLM.Enabled,
+		Sheets:   c.UsesSheets(),
+		Email:    c.Email.Enabled,
+		API:      c.API.Enabled,
+	}
+}
+
+// UsesSheets reports whether the task store is backed by Google Sheets
+func (c *Config) UsesSheets() bool {
+	return c.Store.Backend == "sheets" || c.Store.Backend == "sheets_api"
+}
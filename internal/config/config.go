@@ -1,120 +1,490 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog/log"
 )
 
-// Config holds all configuration for the application
+// Config holds all configuration for the application. Values come from the
+// defaults below, then the optional config file, then environment variables.
 type Config struct {
-	// Telegram configuration
-	TelegramToken string
+	Telegram TelegramConfig `yaml:"telegram" toml:"telegram"`
+	LLM      LLMConfig      `yaml:"llm" toml:"llm"`
+	Store    StoreConfig    `yaml:"store" toml:"store"`
+	Sheets   SheetsConfig   `yaml:"sheets" toml:"sheets"`
+	Queue    QueueConfig    `yaml:"queue" toml:"queue"`
+	Email    EmailConfig    `yaml:"email" toml:"email"`
+	Cron     CronConfig     `yaml:"cron" toml:"cron"`
+	Server   ServerConfig   `yaml:"server" toml:"server"`
+	API      APIConfig      `yaml:"api" toml:"api"`
+	Tracing  TracingConfig  `yaml:"tracing" toml:"tracing"`
+}
+
+// TelegramConfig configures the Telegram bot
+type TelegramConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled"` // ingest messages from Telegram
+	Token   string `yaml:"token" toml:"token"`
+	// AdminTelegramID is the numeric user ID of the admin, who manages the
+	// allowlist. Usernames can be changed or taken over, so they aren't used.
+	AdminTelegramID int64 `yaml:"admin_id" toml:"admin_id"`
 
-	// OpenRouter configuration
-	OpenRouterAPIKey string
+	// Task messages per minute and burst size, per user and per chat. Messages
+	// over the limit skip the LLM. A rate of 0 disables the limit. Reloadable.
+	UserRatePerMinute float64 `yaml:"user_rate_per_minute" toml:"user_rate_per_minute"`
+	UserBurst         int     `yaml:"user_burst" toml:"user_burst"`
+	ChatRatePerMinute float64 `yaml:"chat_rate_per_minute" toml:"chat_rate_per_minute"`
+	ChatBurst         int     `yaml:"chat_burst" toml:"chat_burst"`
+}
 
-	// Google Sheets configuration
-	GoogleScriptURL string
+// LLMConfig configures the OpenRouter client
+type LLMConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled"` // without it messages are saved unparsed
+	APIKey  string `yaml:"api_key" toml:"api_key"`
+	Model   string `yaml:"model" toml:"model"` // reloadable
+	BaseURL string `yaml:"base_url" toml:"base_url"`
 
-	// SendGrid configuration
-	SendGridKey string
+	MaxConcurrency int     `yaml:"max_concurrency" toml:"max_concurrency"` // requests in flight at once
+	DailyCapUSD    float64 `yaml:"daily_cap_usd" toml:"daily_cap_usd"`     // 0 for no cap, reloadable
+	MonthlyCapUSD  float64 `yaml:"monthly_cap_usd" toml:"monthly_cap_usd"` // 0 for no cap, reloadable
 
-	// Admin configuration
-	AdminTelegramID string
+	// Models tried in order when the primary fails, and how failures are
+	// handled. A model's circuit opens after BreakerThreshold consecutive
+	// failures for BreakerCooldown. HedgeAfter, when set, also sends a slow
+	// request to the next model. The breaker and hedge settings are
+	// reloadable.
+	Fallbacks        []LLMTarget `yaml:"fallbacks" toml:"fallbacks"`
+	BreakerThreshold int         `yaml:"breaker_threshold" toml:"breaker_threshold"`
+	BreakerCooldown  Duration    `yaml:"breaker_cooldown" toml:"breaker_cooldown"`
+	HedgeAfter       Duration    `yaml:"hedge_after" toml:"hedge_after"` // 0 disables hedging
 
-	// Test mode configuration
-	TestMode  bool
-	TestEmail string
+	CacheTTL Duration `yaml:"cache_ttl" toml:"cache_ttl"` // how long parses are reused, 0 disables the cache; reloadable
 
-	// Database configuration
-	DatabasePath string
+	// How many past corrections similar to a message are shown to the model
+	// (0 stops learning from corrections), and how often the task store is
+	// checked for rows edited outside the bot (0 to only learn from the bot)
+	CorrectionExamples int      `yaml:"correction_examples" toml:"correction_examples"`
+	CorrectionSweep    Duration `yaml:"correction_sweep" toml:"correction_sweep"`
 
-	// Server configuration
-	Port        string
-	Environment string
+	// Prompt version to use, from PromptDir or the built-in prompts when it
+	// is empty, and the team whose examples each chat ID gets. Reloadable.
+	PromptVersion string            `yaml:"prompt_version" toml:"prompt_version"`
+	PromptDir     string            `yaml:"prompt_dir" toml:"prompt_dir"`
+	ChatTeams     map[string]string `yaml:"chat_teams" toml:"chat_teams"`
 }
 
-// Load reads configuration from environment variables
-func Load() (*Config, error) {
-	// Try to load .env file if it exists
-	if err := godotenv.Load(); err != nil {
-		log.Debug().Msg("No .env file found, using system environment variables")
+// LLMTarget is a fallback model. An empty BaseURL or APIKey means the
+// primary's.
+type LLMTarget struct {
+	Model   string `yaml:"model" toml:"model"`
+	BaseURL string `yaml:"base_url,omitempty" toml:"base_url,omitempty"`
+	APIKey  string `yaml:"api_key,omitempty" toml:"api_key,omitempty"`
+}
+
+// StoreConfig selects where tasks are kept
+type StoreConfig struct {
+	Backend string            `yaml:"backend" toml:"backend"` // "sheets", "sheets_api", "sqlite" or "file"
+	Path    string            `yaml:"path" toml:"path"`       // CSV/JSONL file for the "file" backend
+	Team    map[string]string `yaml:"team" toml:"team"`       // roster for backends without a team tab
+}
+
+// SheetsConfig configures the Google Sheets backends
+type SheetsConfig struct {
+	ScriptURL          string `yaml:"script_url" toml:"script_url"`
+	SpreadsheetID      string `yaml:"spreadsheet_id" toml:"spreadsheet_id"`             // for the "sheets_api" backend
+	ServiceAccountFile string `yaml:"service_account_file" toml:"service_account_file"` // service account JSON key
+	APIURL             string `yaml:"api_url" toml:"api_url"`                           // Sheets API base URL, overridable for local stand-ins
+	Columns            string `yaml:"columns" toml:"columns"`                           // todo tab column spec, see sheets.ParseSchema
+}
+
+// QueueConfig configures the SQLite queue and its workers
+type QueueConfig struct {
+	DatabasePath string   `yaml:"database_path" toml:"database_path"`
+	Workers      int      `yaml:"workers" toml:"workers"`             // reloadable
+	PollInterval Duration `yaml:"poll_interval" toml:"poll_interval"` // reloadable
+
+	// How long an outbox entry that keeps failing is retried before it is
+	// marked dead, and how long delivered entries are kept (0 keeps them).
+	// Reloadable.
+	OutboxMaxAge    Duration `yaml:"outbox_max_age" toml:"outbox_max_age"`
+	OutboxRetention Duration `yaml:"outbox_retention" toml:"outbox_retention"`
+}
+
+// EmailConfig configures the digest e-mails
+type EmailConfig struct {
+	Enabled     bool   `yaml:"enabled" toml:"enabled"` // send the daily digest
+	SendGridKey string `yaml:"sendgrid_key" toml:"sendgrid_key"`
+	TestMode    bool   `yaml:"test_mode" toml:"test_mode"`
+	TestEmail   string `yaml:"test_email" toml:"test_email"`
+}
+
+// CronConfig configures scheduled jobs
+type CronConfig struct {
+	DigestSchedule string   `yaml:"digest_schedule" toml:"digest_schedule"` // reloadable
+	Timezone       string   `yaml:"timezone" toml:"timezone"`
+	Recurring      string   `yaml:"recurring" toml:"recurring"`             // "completion", "schedule" or "off"
+	Reminders      bool     `yaml:"reminders" toml:"reminders"`             // DM linked assignees about due dates
+	QuietHours     string   `yaml:"quiet_hours" toml:"quiet_hours"`         // default for users without their own, such as "21:00-09:00"; reloadable
+	ReminderSnooze Duration `yaml:"reminder_snooze" toml:"reminder_snooze"` // how long the snooze button holds a reminder back; reloadable
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Port        string `yaml:"port" toml:"port"`
+	Environment string `yaml:"environment" toml:"environment"`
+}
+
+// APIConfig configures the REST API under /api/v1
+type APIConfig struct {
+	Enabled bool     `yaml:"enabled" toml:"enabled"`
+	Keys    []string `yaml:"keys" toml:"keys"`
+}
+
+// TracingConfig configures OpenTelemetry tracing
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter"` // "none", "otlp", "stdout" or "file"
+	File        string  `yaml:"file" toml:"file"`         // output file for the "file" exporter
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		Telegram: TelegramConfig{
+			Enabled:           true,
+			UserRatePerMinute: 6,
+			UserBurst:         5,
+			ChatRatePerMinute: 20,
+			ChatBurst:         10,
+		},
+		LLM: LLMConfig{
+			Enabled:            true,
+			Model:              "openai/gpt-4o-mini",
+			BaseURL:            "https://openrouter.ai/api/v1/chat/completions",
+			MaxConcurrency:     4,
+			BreakerThreshold:   3,
+			BreakerCooldown:    Duration(30 * time.Second),
+			CacheTTL:           Duration(24 * time.Hour),
+			CorrectionExamples: 3,
+			CorrectionSweep:    Duration(15 * time.Minute),
+			PromptVersion:      "v2",
+		},
+		Store: StoreConfig{
+			Backend: "sheets",
+			Path:    "./tasks.jsonl",
+		},
+		Queue: QueueConfig{
+			DatabasePath:    "./cache.db",
+			Workers:         2,
+			PollInterval:    Duration(500 * time.Millisecond),
+			OutboxMaxAge:    Duration(72 * time.Hour),
+			OutboxRetention: Duration(7 * 24 * time.Hour),
+		},
+		Cron: CronConfig{
+			DigestSchedule: "0 6 * * *",
+			Timezone:       "UTC",
+			Recurring:      "completion",
+			Reminders:      true,
+			QuietHours:     "21:00-09:00",
+			ReminderSnooze: Duration(3 * time.Hour),
+		},
+		Server: ServerConfig{
+			Port:        "8080",
+			Environment: "development",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			File:        "./traces.jsonl",
+			SampleRatio: 1,
+		},
 	}
+}
 
-	cfg := &Config{
-		TelegramToken:    getEnvRequired("TELEGRAM_TOKEN"),
-		OpenRouterAPIKey: getEnvRequired("OPENROUTER_API_KEY"),
-		GoogleScriptURL:  getEnvRequired("GOOGLE_SCRIPT_URL"),
-		SendGridKey:      getEnvRequired("SENDGRID_KEY"),
-		AdminTelegramID:  getEnv("ADMIN_TELEGRAM_ID", "@defibeats"),
-		TestMode:         getEnvBool("TEST_MODE", false),
-		TestEmail:        getEnv("TEST_EMAIL", ""),
-		DatabasePath:     getEnv("DATABASE_PATH", "./cache.db"),
-		Port:             getEnv("PORT", "8080"),
-		Environment:      getEnv("ENVIRONMENT", "development"),
+// Load reads the configuration from the optional config file at path and the
+// environment, and validates it
+func Load(path string) (*Config, error) {
+	cfg, err := Read(path)
+	if err != nil {
+		return nil, err
 	}
 
 	// Validate configuration
-	if err := cfg.validate(); err != nil {
+	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
 	// Log non-sensitive configuration
 	log.Info().
-		Str("environment", cfg.Environment).
-		Str("port", cfg.Port).
-		Bool("test_mode", cfg.TestMode).
-		Str("database_path", cfg.DatabasePath).
+		Str("config_file", path).
+		Str("environment", cfg.Server.Environment).
+		Str("port", cfg.Server.Port).
+		Bool("test_mode", cfg.Email.TestMode).
+		Str("database_path", cfg.Queue.DatabasePath).
+		Str("task_store", cfg.Store.Backend).
+		Str("model", cfg.LLM.Model).
+		Int("workers", cfg.Queue.Workers).
+		Str("tracing_exporter", cfg.Tracing.Exporter).
 		Msg("Configuration loaded")
 
 	return cfg, nil
 }
 
-// validate checks that all required configuration is present
-func (c *Config) validate() error {
-	if c.TelegramToken == "" {
-		return fmt.Errorf("TELEGRAM_TOKEN is required")
+// Read builds the configuration from the defaults, the optional config file
+// at path and the environment, without validating it
+func Read(path string) (*Config, error) {
+	// Try to load .env file if it exists
+	if err := godotenv.Load(); err != nil {
+		log.Debug().Msg("No .env file found, using system environment variables")
+	}
+
+	cfg := Default()
+	if path != "" {
+		if err := readFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides settings with the environment variables that are set
+func (c *Config) applyEnv() error {
+	setBool(&c.Telegram.Enabled, "TELEGRAM_ENABLED")
+	setString(&c.Telegram.Token, "TELEGRAM_TOKEN")
+	if err := setInt64(&c.Telegram.AdminTelegramID, "ADMIN_TELEGRAM_ID"); err != nil {
+		return err
+	}
+
+	setBool(&c.LLM.Enabled, "LLM_ENABLED")
+	setString(&c.LLM.APIKey, "OPENROUTER_API_KEY")
+	setString(&c.LLM.Model, "LLM_MODEL")
+	setString(&c.LLM.BaseURL, "LLM_BASE_URL")
+
+	setString(&c.Store.Backend, "TASK_STORE")
+	setString(&c.Store.Path, "TASK_STORE_PATH")
+
+	setString(&c.Sheets.ScriptURL, "GOOGLE_SCRIPT_URL")
+	setString(&c.Sheets.SpreadsheetID, "GOOGLE_SPREADSHEET_ID")
+	setString(&c.Sheets.ServiceAccountFile, "GOOGLE_SERVICE_ACCOUNT_FILE")
+	setString(&c.Sheets.APIURL, "GOOGLE_SHEETS_API_URL")
+	setString(&c.Sheets.Columns, "SHEET_COLUMNS")
+
+	setString(&c.Queue.DatabasePath, "DATABASE_PATH")
+
+	setBool(&c.Email.Enabled, "EMAIL_ENABLED")
+	setString(&c.Email.SendGridKey, "SENDGRID_KEY")
+	setBool(&c.Email.TestMode, "TEST_MODE")
+	setString(&c.Email.TestEmail, "TEST_EMAIL")
+
+	setString(&c.Cron.DigestSchedule, "DIGEST_SCHEDULE")
+	setString(&c.Cron.Timezone, "CRON_TIMEZONE")
+	setString(&c.Cron.Recurring, "RECURRING_TASKS")
+	setBool(&c.Cron.Reminders, "REMINDERS_ENABLED")
+	setString(&c.Cron.QuietHours, "REMINDER_QUIET_HOURS")
+
+	setString(&c.Server.Port, "PORT")
+	setString(&c.Server.Environment, "ENVIRONMENT")
+
+	setBool(&c.API.Enabled, "API_ENABLED")
+	setList(&c.API.Keys, "API_KEYS")
+
+	setString(&c.Tracing.Exporter, "TRACING_EXPORTER")
+	setString(&c.Tracing.File, "TRACING_FILE")
+
+	if err := setFloat(&c.Telegram.UserRatePerMinute, "TELEGRAM_USER_RATE"); err != nil {
+		return err
 	}
-	if c.OpenRouterAPIKey == "" {
-		return fmt.Errorf("OPENROUTER_API_KEY is required")
+	if err := setInt(&c.Telegram.UserBurst, "TELEGRAM_USER_BURST"); err != nil {
+		return err
 	}
-	if c.GoogleScriptURL == "" {
-		return fmt.Errorf("GOOGLE_SCRIPT_URL is required")
+	if err := setFloat(&c.Telegram.ChatRatePerMinute, "TELEGRAM_CHAT_RATE"); err != nil {
+		return err
 	}
-	if c.SendGridKey == "" {
-		return fmt.Errorf("SENDGRID_KEY is required")
+	if err := setInt(&c.Telegram.ChatBurst, "TELEGRAM_CHAT_BURST"); err != nil {
+		return err
 	}
-	if c.TestMode && c.TestEmail == "" {
-		return fmt.Errorf("TEST_EMAIL is required when TEST_MODE is enabled")
+	if err := setInt(&c.LLM.MaxConcurrency, "LLM_MAX_CONCURRENCY"); err != nil {
+		return err
 	}
-	return nil
+	if err := setFloat(&c.LLM.DailyCapUSD, "LLM_DAILY_CAP_USD"); err != nil {
+		return err
+	}
+	if err := setFloat(&c.LLM.MonthlyCapUSD, "LLM_MONTHLY_CAP_USD"); err != nil {
+		return err
+	}
+	setFallbackModels(&c.LLM.Fallbacks, "LLM_FALLBACK_MODELS")
+	setString(&c.LLM.PromptVersion, "LLM_PROMPT_VERSION")
+	setString(&c.LLM.PromptDir, "LLM_PROMPT_DIR")
+	if err := setJSONMap(&c.LLM.ChatTeams, "LLM_CHAT_TEAMS"); err != nil {
+		return err
+	}
+	if err := setInt(&c.LLM.BreakerThreshold, "LLM_BREAKER_THRESHOLD"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.LLM.BreakerCooldown, "LLM_BREAKER_COOLDOWN"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.LLM.HedgeAfter, "LLM_HEDGE_AFTER"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.LLM.CacheTTL, "LLM_CACHE_TTL"); err != nil {
+		return err
+	}
+	if err := setInt(&c.LLM.CorrectionExamples, "LLM_CORRECTION_EXAMPLES"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.LLM.CorrectionSweep, "LLM_CORRECTION_SWEEP"); err != nil {
+		return err
+	}
+	if err := setInt(&c.Queue.Workers, "QUEUE_WORKERS"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Queue.PollInterval, "QUEUE_POLL_INTERVAL"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Queue.OutboxMaxAge, "OUTBOX_MAX_AGE"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Queue.OutboxRetention, "OUTBOX_RETENTION"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Cron.ReminderSnooze, "REMINDER_SNOOZE"); err != nil {
+		return err
+	}
+	if err := setFloat(&c.Tracing.SampleRatio, "TRACING_SAMPLE_RATIO"); err != nil {
+		return err
+	}
+	return setJSONMap(&c.Store.Team, "TEAM_EMAIL_MAP")
 }
 
-// getEnv gets an environment variable with a default value
-func getEnv(key, defaultValue string) string {
+// setString overrides *dst with the environment variable key, if set
+func setString(dst *string, key string) {
 	if value := os.Getenv(key); value != "" {
-		return value
+		*dst = value
+	}
+}
+
+// setBool overrides *dst with the boolean environment variable key, if set
+func setBool(dst *bool, key string) {
+	if value := os.Getenv(key); value != "" {
+		*dst = value == "true" || value == "1" || value == "yes"
+	}
+}
+
+// setInt overrides *dst with the integer environment variable key, if set
+func setInt(dst *int, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
 	}
-	return defaultValue
+
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s must be an integer: %w", key, err)
+	}
+	*dst = result
+	return nil
 }
 
-// getEnvRequired gets a required environment variable
-func getEnvRequired(key string) string {
+// setInt64 overrides *dst with the integer environment variable key, if set
+func setInt64(dst *int64, key string) error {
 	value := os.Getenv(key)
 	if value == "" {
-		log.Warn().Str("key", key).Msg("Required environment variable not set")
+		return nil
 	}
-	return value
+
+	result, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s must be an integer: %w", key, err)
+	}
+	*dst = result
+	return nil
 }
 
-// getEnvBool gets a boolean environment variable
-func getEnvBool(key string, defaultValue bool) bool {
+// setFloat overrides *dst with the floating point environment variable key,
+// if set
+func setFloat(dst *float64, key string) error {
 	value := os.Getenv(key)
 	if value == "" {
-		return defaultValue
+		return nil
 	}
-	return value == "true" || value == "1" || value == "yes"
+
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%s must be a number: %w", key, err)
+	}
+	*dst = result
+	return nil
+}
+
+// setDuration overrides *dst with the duration environment variable key, if
+// set
+func setDuration(dst *Duration, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s must be a duration such as 500ms or 2s: %w", key, err)
+	}
+	*dst = Duration(result)
+	return nil
+}
+
+// setList overrides *dst with the comma-separated environment variable key,
+// dropping empty entries, if set
+func setList(dst *[]string, key string) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	*dst = result
+}
+
+// setFallbackModels replaces *dst with the comma-separated models in the
+// environment variable key, if set, all on the primary provider
+func setFallbackModels(dst *[]LLMTarget, key string) {
+	var models []string
+	setList(&models, key)
+	if models == nil {
+		return
+	}
+
+	*dst = nil
+	for _, model := range models {
+		*dst = append(*dst, LLMTarget{Model: model})
+	}
+}
+
+// setJSONMap overrides *dst with a JSON object of strings from the
+// environment variable key, if set
+func setJSONMap(dst *map[string]string, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	var result map[string]string
+	if err := json.Unmarshal([]byte(value), &result); err != nil {
+		return fmt.Errorf("%s must be a JSON object of strings: %w", key, err)
+	}
+	*dst = result
+	return nil
 }
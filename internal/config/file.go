@@ -0,0 +1,110 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration written as a string such as "500ms" or "2s" in
+// config files
+type Duration time.Duration
+
+// UnmarshalText parses a duration string
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expected a value such as 500ms or 2s", text)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration as a string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// readFile decodes the YAML or TOML config file at path over cfg, chosen by
+// its extension. Unknown keys are rejected so typos don't go unnoticed.
+func readFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			sort.Strings(keys)
+			return fmt.Errorf("failed to parse %s: unknown keys %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+
+	return nil
+}
+
+// redacted replaces a secret with a marker, keeping empty values visible
+func redacted(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// Redacted returns a copy of the configuration with secrets masked
+func (c *Config) Redacted() *Config {
+	out := *c
+	out.Telegram.Token = redacted(c.Telegram.Token)
+	out.LLM.APIKey = redacted(c.LLM.APIKey)
+	out.Email.SendGridKey = redacted(c.Email.SendGridKey)
+
+	out.LLM.Fallbacks = nil
+	for _, target := range c.LLM.Fallbacks {
+		if target.APIKey != "" {
+			target.APIKey = redacted(target.APIKey)
+		}
+		out.LLM.Fallbacks = append(out.LLM.Fallbacks, target)
+	}
+
+	out.API.Keys = nil
+	for _, key := range c.API.Keys {
+		out.API.Keys = append(out.API.Keys, redacted(key))
+	}
+	return &out
+}
+
+// WriteYAML writes the configuration as YAML, in the same layout as a config
+// file
+func (c *Config) WriteYAML(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"reflect"
+)
+
+// Diff compares c with next, as loaded after a SIGHUP. It returns the
+// reloadable settings that changed and the sections whose other changes only
+// take effect after a restart.
+func (c *Config) Diff(next *Config) (reloadable, restart []string) {
+	settings := []struct {
+		name    string
+		changed bool
+	}{
+		{"queue.workers", c.Queue.Workers != next.Queue.Workers},
+		{"queue.poll_interval", c.Queue.PollInterval != next.Queue.PollInterval},
+		{"queue.outbox_max_age", c.Queue.OutboxMaxAge != next.Queue.OutboxMaxAge},
+		{"queue.outbox_retention", c.Queue.OutboxRetention != next.Queue.OutboxRetention},
+		{"llm.model", c.LLM.Model != next.LLM.Model},
+		{"llm.prompt_version", c.LLM.PromptVersion != next.LLM.PromptVersion},
+		{"llm.prompt_dir", c.LLM.PromptDir != next.LLM.PromptDir},
+		{"llm.chat_teams", !reflect.DeepEqual(c.LLM.ChatTeams, next.LLM.ChatTeams)},
+		{"llm.daily_cap_usd", c.LLM.DailyCapUSD != next.LLM.DailyCapUSD},
+		{"llm.monthly_cap_usd", c.LLM.MonthlyCapUSD != next.LLM.MonthlyCapUSD},
+		{"llm.breaker_threshold", c.LLM.BreakerThreshold != next.LLM.BreakerThreshold},
+		{"llm.breaker_cooldown", c.LLM.BreakerCooldown != next.LLM.BreakerCooldown},
+		{"llm.hedge_after", c.LLM.HedgeAfter != next.LLM.HedgeAfter},
+		{"llm.cache_ttl", c.LLM.CacheTTL != next.LLM.CacheTTL},
+		{"telegram.user_rate_per_minute", c.Telegram.UserRatePerMinute != next.Telegram.UserRatePerMinute},
+		{"telegram.user_burst", c.Telegram.UserBurst != next.Telegram.UserBurst},
+		{"telegram.chat_rate_per_minute", c.Telegram.ChatRatePerMinute != next.Telegram.ChatRatePerMinute},
+		{"telegram.chat_burst", c.Telegram.ChatBurst != next.Telegram.ChatBurst},
+		{"cron.digest_schedule", c.Cron.DigestSchedule != next.Cron.DigestSchedule},
+		{"cron.quiet_hours", c.Cron.QuietHours != next.Cron.QuietHours},
+		{"cron.reminder_snooze", c.Cron.ReminderSnooze != next.Cron.ReminderSnooze},
+	}
+	for _, setting := range settings {
+		if setting.changed {
+			reloadable = append(reloadable, setting.name)
+		}
+	}
+
+	// Compare everything else with the reloadable settings blanked out
+	before, after := c.withoutReloadable(), next.withoutReloadable()
+	sections := []struct {
+		name          string
+		before, after interface{}
+	}{
+		{"telegram", before.Telegram, after.Telegram},
+		{"llm", before.LLM, after.LLM},
+		{"store", before.Store, after.Store},
+		{"sheets", before.Sheets, after.Sheets},
+		{"queue", before.Queue, after.Queue},
+		{"email", before.Email, after.Email},
+		{"cron", before.Cron, after.Cron},
+		{"server", before.Server, after.Server},
+		{"api", before.API, after.API},
+		{"tracing", before.Tracing, after.Tracing},
+	}
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.before, section.after) {
+			restart = append(restart, section.name)
+		}
+	}
+
+	return reloadable, restart
+}
+
+// ApplyReloadable copies the reloadable settings from next onto c
+func (c *Config) ApplyReloadable(next *Config) {
+	c.Queue.Workers = next.Queue.Workers
+	c.Queue.PollInterval = next.Queue.PollInterval
+	c.LLM.Model = next.LLM.Model
+	c.LLM.PromptVersion = next.LLM.PromptVersion
+	c.LLM.PromptDir = next.LLM.PromptDir
+	c.LLM.ChatTeams = next.LLM.ChatTeams
+	c.Cron.DigestSchedule = next.Cron.DigestSchedule
+	c.Telegram.UserRatePerMinute = next.Telegram.UserRatePerMinute
+	c.Telegram.UserBurst = next.Telegram.UserBurst
+	c.Telegram.ChatRatePerMinute = next.Telegram.ChatRatePerMinute
+	c.Telegram.ChatBurst = next.Telegram.ChatBurst
+	c.LLM.DailyCapUSD = next.LLM.DailyCapUSD
+	c.LLM.MonthlyCapUSD = next.LLM.MonthlyCapUSD
+	c.LLM.BreakerThreshold = next.LLM.BreakerThreshold
+	c.LLM.BreakerCooldown = next.LLM.BreakerCooldown
+	c.LLM.HedgeAfter = next.LLM.HedgeAfter
+	c.LLM.CacheTTL = next.LLM.CacheTTL
+	c.Queue.OutboxMaxAge = next.Queue.OutboxMaxAge
+	c.Queue.OutboxRetention = next.Queue.OutboxRetention
+	c.Cron.QuietHours = next.Cron.QuietHours
+	c.Cron.ReminderSnooze = next.Cron.ReminderSnooze
+}
+
+// withoutReloadable returns a copy of c with the reloadable settings zeroed
+func (c *Config) withoutReloadable() Config {
+	out := *c
+	out.ApplyReloadable(&Config{})
+	return out
+}
@@ -0,0 +1,237 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	scheduler "github.com/giovannigabriele/go-todo-bot/internal/cron"
+)
+
+const (
+	// maxWorkers bounds queue.workers
+	maxWorkers = 32
+	// maxLLMConcurrency bounds llm.max_concurrency
+	maxLLMConcurrency = 64
+)
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+// Error implements error
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// problems collects validation failures, each naming the setting and the
+// environment variable that overrides it
+type problems []string
+
+// add records a problem with the setting field, overridden by env
+func (p *problems) add(field, env, format string, args ...interface{}) {
+	name := field
+	if env != "" {
+		name = fmt.Sprintf("%s (%s)", field, env)
+	}
+	*p = append(*p, name+": "+fmt.Sprintf(format, args...))
+}
+
+// Validate checks the configuration and reports every problem at once
+func (c *Config) Validate() error {
+	var p problems
+
+	if c.Telegram.Enabled {
+		if c.Telegram.Token == "" {
+			p.add("telegram.token", "TELEGRAM_TOKEN", "is required when telegram is enabled")
+		}
+		if c.Telegram.AdminTelegramID <= 0 {
+			p.add("telegram.admin_id", "ADMIN_TELEGRAM_ID", "is required when telegram is enabled, as the admin's numeric user ID")
+		}
+		if c.Telegram.UserRatePerMinute < 0 {
+			p.add("telegram.user_rate_per_minute", "TELEGRAM_USER_RATE", "must not be negative")
+		}
+		if c.Telegram.ChatRatePerMinute < 0 {
+			p.add("telegram.chat_rate_per_minute", "TELEGRAM_CHAT_RATE", "must not be negative")
+		}
+		if c.Telegram.UserBurst < 1 {
+			p.add("telegram.user_burst", "TELEGRAM_USER_BURST", "must be at least 1, got %d", c.Telegram.UserBurst)
+		}
+		if c.Telegram.ChatBurst < 1 {
+			p.add("telegram.chat_burst", "TELEGRAM_CHAT_BURST", "must be at least 1, got %d", c.Telegram.ChatBurst)
+		}
+	}
+
+	if c.LLM.Enabled {
+		if c.LLM.APIKey == "" {
+			p.add("llm.api_key", "OPENROUTER_API_KEY", "is required when llm is enabled")
+		}
+		if strings.TrimSpace(c.LLM.Model) == "" {
+			p.add("llm.model", "LLM_MODEL", "must not be empty")
+		}
+		if !isHTTPURL(c.LLM.BaseURL) {
+			p.add("llm.base_url", "LLM_BASE_URL", "must be an http(s) URL, got %q", c.LLM.BaseURL)
+		}
+		if c.LLM.MaxConcurrency < 1 || c.LLM.MaxConcurrency > maxLLMConcurrency {
+			p.add("llm.max_concurrency", "LLM_MAX_CONCURRENCY", "must be between 1 and %d, got %d", maxLLMConcurrency, c.LLM.MaxConcurrency)
+		}
+		if c.LLM.DailyCapUSD < 0 {
+			p.add("llm.daily_cap_usd", "LLM_DAILY_CAP_USD", "must not be negative")
+		}
+		if c.LLM.MonthlyCapUSD < 0 {
+			p.add("llm.monthly_cap_usd", "LLM_MONTHLY_CAP_USD", "must not be negative")
+		}
+		for i, target := range c.LLM.Fallbacks {
+			field := fmt.Sprintf("llm.fallbacks[%d]", i)
+			if strings.TrimSpace(target.Model) == "" {
+				p.add(field+".model", "LLM_FALLBACK_MODELS", "must not be empty")
+			}
+			if target.BaseURL != "" && !isHTTPURL(target.BaseURL) {
+				p.add(field+".base_url", "", "must be an http(s) URL, got %q", target.BaseURL)
+			}
+		}
+		if c.LLM.BreakerThreshold < 1 {
+			p.add("llm.breaker_threshold", "LLM_BREAKER_THRESHOLD", "must be at least 1, got %d", c.LLM.BreakerThreshold)
+		}
+		if c.LLM.BreakerCooldown <= 0 {
+			p.add("llm.breaker_cooldown", "LLM_BREAKER_COOLDOWN", "must be positive")
+		}
+		if c.LLM.HedgeAfter < 0 {
+			p.add("llm.hedge_after", "LLM_HEDGE_AFTER", "must not be negative")
+		}
+		if c.LLM.CacheTTL < 0 {
+			p.add("llm.cache_ttl", "LLM_CACHE_TTL", "must not be negative")
+		}
+		if c.LLM.CorrectionExamples < 0 || c.LLM.CorrectionExamples > 10 {
+			p.add("llm.correction_examples", "LLM_CORRECTION_EXAMPLES", "must be between 0 and 10, got %d", c.LLM.CorrectionExamples)
+		}
+		if c.LLM.CorrectionSweep < 0 {
+			p.add("llm.correction_sweep", "LLM_CORRECTION_SWEEP", "must not be negative")
+		}
+		if strings.TrimSpace(c.LLM.PromptVersion) == "" {
+			p.add("llm.prompt_version", "LLM_PROMPT_VERSION", "must not be empty")
+		}
+		if c.LLM.PromptDir != "" {
+			if info, err := os.Stat(c.LLM.PromptDir); err != nil || !info.IsDir() {
+				p.add("llm.prompt_dir", "LLM_PROMPT_DIR", "must be a directory, got %q", c.LLM.PromptDir)
+			}
+		}
+		for chat := range c.LLM.ChatTeams {
+			if _, err := strconv.ParseInt(chat, 10, 64); err != nil {
+				p.add("llm.chat_teams", "LLM_CHAT_TEAMS", "keys must be chat IDs, got %q", chat)
+			}
+		}
+	}
+
+	switch c.Store.Backend {
+	case "sheets":
+		if c.Sheets.ScriptURL == "" {
+			p.add("sheets.script_url", "GOOGLE_SCRIPT_URL", "is required when store.backend is sheets")
+		} else if !isHTTPURL(c.Sheets.ScriptURL) {
+			p.add("sheets.script_url", "GOOGLE_SCRIPT_URL", "must be an http(s) URL, got %q", c.Sheets.ScriptURL)
+		}
+	case "sheets_api":
+		if c.Sheets.SpreadsheetID == "" {
+			p.add("sheets.spreadsheet_id", "GOOGLE_SPREADSHEET_ID", "is required when store.backend is sheets_api")
+		}
+		if c.Sheets.ServiceAccountFile == "" {
+			p.add("sheets.service_account_file", "GOOGLE_SERVICE_ACCOUNT_FILE", "is required when store.backend is sheets_api")
+		}
+		if c.Sheets.APIURL != "" && !isHTTPURL(c.Sheets.APIURL) {
+			p.add("sheets.api_url", "GOOGLE_SHEETS_API_URL", "must be an http(s) URL, got %q", c.Sheets.APIURL)
+		}
+	case "sqlite":
+	case "file":
+		if c.Store.Path == "" {
+			p.add("store.path", "TASK_STORE_PATH", "is required when store.backend is file")
+		}
+	default:
+		p.add("store.backend", "TASK_STORE", "must be one of sheets, sheets_api, sqlite or file, got %q", c.Store.Backend)
+	}
+
+	if c.Queue.DatabasePath == "" {
+		p.add("queue.database_path", "DATABASE_PATH", "is required")
+	}
+	if c.Queue.Workers < 1 || c.Queue.Workers > maxWorkers {
+		p.add("queue.workers", "QUEUE_WORKERS", "must be between 1 and %d, got %d", maxWorkers, c.Queue.Workers)
+	}
+	if time.Duration(c.Queue.PollInterval) < 10*time.Millisecond {
+		p.add("queue.poll_interval", "QUEUE_POLL_INTERVAL", "must be at least 10ms, got %s", time.Duration(c.Queue.PollInterval))
+	}
+	if time.Duration(c.Queue.OutboxMaxAge) < time.Hour {
+		p.add("queue.outbox_max_age", "OUTBOX_MAX_AGE", "must be at least 1h, got %s", time.Duration(c.Queue.OutboxMaxAge))
+	}
+	if c.Queue.OutboxRetention < 0 {
+		p.add("queue.outbox_retention", "OUTBOX_RETENTION", "must not be negative, got %s", time.Duration(c.Queue.OutboxRetention))
+	}
+
+	if c.Email.Enabled {
+		if c.Email.SendGridKey == "" {
+			p.add("email.sendgrid_key", "SENDGRID_KEY", "is required when email is enabled")
+		}
+		if c.Email.TestMode && c.Email.TestEmail == "" {
+			p.add("email.test_email", "TEST_EMAIL", "is required when email.test_mode is enabled")
+		}
+		if _, err := cron.ParseStandard(c.Cron.DigestSchedule); err != nil {
+			p.add("cron.digest_schedule", "DIGEST_SCHEDULE", "invalid cron expression %q: %v", c.Cron.DigestSchedule, err)
+		}
+	}
+	if _, err := time.LoadLocation(c.Cron.Timezone); err != nil {
+		p.add("cron.timezone", "CRON_TIMEZONE", "unknown time zone %q", c.Cron.Timezone)
+	}
+	switch c.Cron.Recurring {
+	case "completion", "schedule", "off":
+	default:
+		p.add("cron.recurring", "RECURRING_TASKS", "must be one of completion, schedule or off, got %q", c.Cron.Recurring)
+	}
+	if c.Cron.Reminders {
+		if _, err := scheduler.ParseQuietHours(c.Cron.QuietHours); err != nil {
+			p.add("cron.quiet_hours", "REMINDER_QUIET_HOURS", "%v", err)
+		}
+		if time.Duration(c.Cron.ReminderSnooze) < time.Minute {
+			p.add("cron.reminder_snooze", "REMINDER_SNOOZE", "must be at least 1m, got %s", time.Duration(c.Cron.ReminderSnooze))
+		}
+	}
+
+	if c.Server.Port == "" {
+		p.add("server.port", "PORT", "is required")
+	}
+
+	if c.API.Enabled && len(c.API.Keys) == 0 {
+		p.add("api.keys", "API_KEYS", "at least one key is required when api is enabled")
+	}
+	for i, key := range c.API.Keys {
+		if len(key) < 16 {
+			p.add(fmt.Sprintf("api.keys[%d]", i), "API_KEYS", "must be at least 16 characters")
+		}
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout", "file":
+	default:
+		p.add("tracing.exporter", "TRACING_EXPORTER", "must be one of none, otlp, stdout or file, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.Exporter == "file" && c.Tracing.File == "" {
+		p.add("tracing.file", "TRACING_FILE", "is required when tracing.exporter is file")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		p.add("tracing.sample_ratio", "TRACING_SAMPLE_RATIO", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+
+	if len(p) > 0 {
+		return &ValidationError{Problems: p}
+	}
+	return nil
+}
+
+// isHTTPURL reports whether value is an absolute http or https URL
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
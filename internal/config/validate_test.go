@@ -0,0 +1,183 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns the defaults with the secrets a valid config needs
+func validConfig() *Config {
+	c := Default()
+	c.Telegram.Token = "token"
+	c.Telegram.AdminTelegramID = 42
+	c.LLM.APIKey = "key"
+	c.Sheets.ScriptURL = "https://script.google.com/macros/s/id/exec"
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string
+	}{
+		{
+			"missing telegram secrets",
+			func(c *Config) { c.Telegram.Token, c.Telegram.AdminTelegramID = "", 0 },
+			[]string{
+				"telegram.token (TELEGRAM_TOKEN): is required when telegram is enabled",
+				"telegram.admin_id (ADMIN_TELEGRAM_ID): is required when telegram is enabled, as the admin's numeric user ID",
+			},
+		},
+		{
+			"telegram disabled skips its settings",
+			func(c *Config) { c.Telegram.Enabled, c.Telegram.Token, c.Telegram.UserBurst = false, "", 0 },
+			nil,
+		},
+		{
+			"rate limits",
+			func(c *Config) { c.Telegram.UserRatePerMinute, c.Telegram.ChatBurst = -1, 0 },
+			[]string{
+				"telegram.user_rate_per_minute (TELEGRAM_USER_RATE): must not be negative",
+				"telegram.chat_burst (TELEGRAM_CHAT_BURST): must be at least 1, got 0",
+			},
+		},
+		{
+			"llm settings",
+			func(c *Config) {
+				c.LLM.BaseURL = "openrouter.ai"
+				c.LLM.MaxConcurrency = 0
+				c.LLM.BreakerThreshold = 0
+				c.LLM.Fallbacks = []LLMTarget{{Model: " "}}
+			},
+			[]string{
+				`llm.base_url (LLM_BASE_URL): must be an http(s) URL, got "openrouter.ai"`,
+				"llm.max_concurrency (LLM_MAX_CONCURRENCY): must be between 1 and 64, got 0",
+				"llm.fallbacks[0].model (LLM_FALLBACK_MODELS): must not be empty",
+				"llm.breaker_threshold (LLM_BREAKER_THRESHOLD): must be at least 1, got 0",
+			},
+		},
+		{
+			"unknown store backend",
+			func(c *Config) { c.Store.Backend = "postgres" },
+			[]string{`store.backend (TASK_STORE): must be one of sheets, sheets_api, sqlite or file, got "postgres"`},
+		},
+		{
+			"file backend without a path",
+			func(c *Config) { c.Store.Backend, c.Store.Path = "file", "" },
+			[]string{"store.path (TASK_STORE_PATH): is required when store.backend is file"},
+		},
+		{
+			"queue bounds",
+			func(c *Config) {
+				c.Queue.Workers = 33
+				c.Queue.PollInterval = Duration(time.Millisecond)
+				c.Queue.OutboxMaxAge = Duration(30 * time.Minute)
+			},
+			[]string{
+				"queue.workers (QUEUE_WORKERS): must be between 1 and 32, got 33",
+				"queue.poll_interval (QUEUE_POLL_INTERVAL): must be at least 10ms, got 1ms",
+				"queue.outbox_max_age (OUTBOX_MAX_AGE): must be at least 1h, got 30m0s",
+			},
+		},
+		{
+			"cron settings",
+			func(c *Config) {
+				c.Cron.Timezone = "Mars/Olympus"
+				c.Cron.Recurring = "weekly"
+				c.Cron.ReminderSnooze = Duration(time.Second)
+			},
+			[]string{
+				`cron.timezone (CRON_TIMEZONE): unknown time zone "Mars/Olympus"`,
+				`cron.recurring (RECURRING_TASKS): must be one of completion, schedule or off, got "weekly"`,
+				"cron.reminder_snooze (REMINDER_SNOOZE): must be at least 1m, got 1s",
+			},
+		},
+		{
+			"short api key",
+			func(c *Config) { c.API.Enabled, c.API.Keys = true, []string{"short"} },
+			[]string{"api.keys[0] (API_KEYS): must be at least 16 characters"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.modify(c)
+
+			err := c.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate = %v, want a ValidationError", err)
+			}
+			if !reflect.DeepEqual(verr.Problems, tt.want) {
+				t.Errorf("problems:\n  %s\nwant:\n  %s", strings.Join(verr.Problems, "\n  "), strings.Join(tt.want, "\n  "))
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(c *Config)
+		reloadable []string
+		restart    []string
+	}{
+		{"nothing changed", func(c *Config) {}, nil, nil},
+		{
+			"reloadable settings",
+			func(c *Config) {
+				c.Queue.Workers = 4
+				c.LLM.HedgeAfter = Duration(5 * time.Second)
+				c.LLM.CacheTTL = 0
+				c.Telegram.UserBurst = 2
+				c.Cron.QuietHours = "off"
+			},
+			[]string{"queue.workers", "llm.hedge_after", "llm.cache_ttl", "telegram.user_burst", "cron.quiet_hours"},
+			nil,
+		},
+		{
+			"restart-only settings",
+			func(c *Config) {
+				c.LLM.MaxConcurrency = 8
+				c.Server.Port = "9090"
+			},
+			nil,
+			[]string{"llm", "server"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, next := validConfig(), validConfig()
+			tt.modify(next)
+
+			reloadable, restart := current.Diff(next)
+			if !reflect.DeepEqual(reloadable, tt.reloadable) {
+				t.Errorf("reloadable = %v, want %v", reloadable, tt.reloadable)
+			}
+			if !reflect.DeepEqual(restart, tt.restart) {
+				t.Errorf("restart = %v, want %v", restart, tt.restart)
+			}
+
+			current.ApplyReloadable(next)
+			if reloadable, _ := current.Diff(next); reloadable != nil {
+				t.Errorf("settings still differ after ApplyReloadable: %v", reloadable)
+			}
+		})
+	}
+}
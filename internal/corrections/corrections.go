@@ -0,0 +1,413 @@
+// Package corrections learns from people fixing the bot's parses. Every row
+// parsed by the LLM is logged with the message it came from; when a row is
+// later changed (through the API, a command, the sheet, or by editing the
+// Telegram message) the message and its corrected tasks are kept as a pair.
+// The pairs most similar to a new message in the same chat are shown to the
+// LLM as few-shot examples.
+package corrections
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/llm"
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// Correction sources
+const (
+	SourceEdit   = "edit"   // the Telegram message was edited
+	SourceUpdate = "update" // a row was changed through the bot or the API
+	SourceSheet  = "sheet"  // a row was changed in the task store directly
+)
+
+const (
+	// logRetention is how long parsed rows are watched for corrections
+	logRetention = 30 * 24 * time.Hour
+	// maxCandidates bounds how many of a chat's corrections are compared with
+	// a new message
+	maxCandidates = 500
+	// minSimilarity is the lowest TF-IDF cosine similarity a correction
+	// needs to be used as an example
+	minSimilarity = 0.2
+)
+
+// partSuffix matches the " (1/3)" appended to the summaries of multi-task
+// messages
+var partSuffix = regexp.MustCompile(`\s*\(\d+/\d+\)$`)
+
+// ErrNotParsed is returned when a message has no logged parse
+var ErrNotParsed = errors.New("message has no parsed tasks")
+
+// Parsed is a logged parse of one chat message
+type Parsed struct {
+	ID      string
+	Message string
+	TaskIDs []string
+}
+
+// Store keeps the parse log and the corrections
+type Store struct {
+	db       *sql.DB
+	examples int
+}
+
+// NewStore creates a corrections store in db, creating its tables if needed.
+// Up to examples similar corrections are offered for each message.
+func NewStore(db *sql.DB, examples int) (*Store, error) {
+	s := &Store{db: db, examples: examples}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS parse_log (
+			task_id TEXT PRIMARY KEY,
+			parse_id TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			chat_id INTEGER NOT NULL,
+			message_id INTEGER NOT NULL DEFAULT 0,
+			message TEXT NOT NULL,
+			people TEXT NOT NULL,
+			client TEXT NOT NULL,
+			summary TEXT NOT NULL,
+			due_date TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_parse_log_parse ON parse_log(parse_id);
+		CREATE INDEX IF NOT EXISTS idx_parse_log_message ON parse_log(chat_id, message_id);
+		CREATE TABLE IF NOT EXISTS corrections (
+			parse_id TEXT PRIMARY KEY,
+			chat_id INTEGER NOT NULL,
+			message TEXT NOT NULL,
+			tasks TEXT NOT NULL,
+			source TEXT NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_corrections_chat ON corrections(chat_id, updated_at);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create corrections tables: %w", err)
+	}
+	return s, nil
+}
+
+// Record logs the rows parsed from a message so later changes to them can be
+// recognised as corrections. messageID is the Telegram message ID, or 0.
+func (s *Store) Record(ctx context.Context, chatID int64, messageID int, message string, rows []store.Task) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertRows(ctx, tx, uuid.New().String(), chatID, messageID, message, rows); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit parse log: %w", err)
+	}
+	return nil
+}
+
+// insertRows writes rows to the parse log under parseID
+func insertRows(ctx context.Context, tx *sql.Tx, parseID string, chatID int64, messageID int, message string, rows []store.Task) error {
+	now := time.Now()
+	for i, row := range rows {
+		_, err := tx.ExecContext(ctx, `
+			INSERT OR REPLACE INTO parse_log (task_id, parse_id, position, chat_id, message_id, message, people,
+				client, summary, due_date, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, row.ID, parseID, i, chatID, messageID, message, joinPeople(row.People), row.Client, row.Summary,
+			normalizeDue(row.DueDate), now)
+		if err != nil {
+			return fmt.Errorf("failed to log parsed row: %w", err)
+		}
+	}
+	return nil
+}
+
+// Parsed returns the logged parse of a Telegram message, or ErrNotParsed
+func (s *Store) Parsed(ctx context.Context, chatID int64, messageID int) (*Parsed, error) {
+	if messageID == 0 {
+		return nil, ErrNotParsed
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT parse_id, message, task_id FROM parse_log
+		WHERE chat_id = ? AND message_id = ?
+		ORDER BY position ASC
+	`, chatID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query parse log: %w", err)
+	}
+	defer rows.Close()
+
+	var parsed *Parsed
+	for rows.Next() {
+		var parseID, message, taskID string
+		if err := rows.Scan(&parseID, &message, &taskID); err != nil {
+			return nil, fmt.Errorf("failed to scan parse log: %w", err)
+		}
+		if parsed == nil {
+			parsed = &Parsed{ID: parseID, Message: message}
+		}
+		parsed.TaskIDs = append(parsed.TaskIDs, taskID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating parse log: %w", err)
+	}
+	if parsed == nil {
+		return nil, ErrNotParsed
+	}
+	return parsed, nil
+}
+
+// Replace records the rows parsed from an edited message as the correction of
+// its original text, and logs them in place of the old rows
+func (s *Store) Replace(ctx context.Context, chatID int64, messageID int, parsed *Parsed, rows []store.Task) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM parse_log WHERE parse_id = ?", parsed.ID); err != nil {
+		return fmt.Errorf("failed to clear parse log: %w", err)
+	}
+	if err := insertRows(ctx, tx, parsed.ID, chatID, messageID, parsed.Message, rows); err != nil {
+		return err
+	}
+	if err := saveCorrection(ctx, tx, parsed.ID, chatID, parsed.Message, rows, SourceEdit); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit correction: %w", err)
+	}
+
+	metrics.Corrections.WithLabelValues(SourceEdit).Inc()
+	log.Info().Int64("chat_id", chatID).Int("message_id", messageID).Msg("Recorded correction from an edited message")
+	return nil
+}
+
+// Observe compares a row's current values with what was parsed. If the
+// people, client, summary or due date changed, the message and all its rows
+// as they now stand are saved as a correction. It reports whether it did.
+func (s *Store) Observe(ctx context.Context, task store.Task, source string) (bool, error) {
+	var parseID, message, people, client, summary, due string
+	var chatID int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT parse_id, chat_id, message, people, client, summary, due_date FROM parse_log WHERE task_id = ?
+	`, task.ID).Scan(&parseID, &chatID, &message, &people, &client, &summary, &due)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read parse log: %w", err)
+	}
+
+	current := store.Task{
+		ID:      task.ID,
+		People:  task.People,
+		Client:  task.Client,
+		Summary: task.Summary,
+		DueDate: task.DueDate,
+	}
+	if joinPeople(current.People) == people && current.Client == client && current.Summary == summary &&
+		normalizeDue(current.DueDate) == due {
+		return false, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE parse_log SET people = ?, client = ?, summary = ?, due_date = ? WHERE task_id = ?
+	`, joinPeople(current.People), current.Client, current.Summary, normalizeDue(current.DueDate), task.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update parse log: %w", err)
+	}
+
+	rows, err := loggedRows(ctx, tx, parseID)
+	if err != nil {
+		return false, err
+	}
+	if err := saveCorrection(ctx, tx, parseID, chatID, message, rows, source); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit correction: %w", err)
+	}
+
+	metrics.Corrections.WithLabelValues(source).Inc()
+	log.Info().Str("task_id", task.ID).Int64("chat_id", chatID).Str("source", source).Msg("Recorded parse correction")
+	return true, nil
+}
+
+// loggedRows returns the current values of a parse's rows, in order
+func loggedRows(ctx context.Context, tx *sql.Tx, parseID string) ([]store.Task, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT task_id, people, client, summary, due_date FROM parse_log
+		WHERE parse_id = ? ORDER BY position ASC
+	`, parseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query parse log: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []store.Task
+	for rows.Next() {
+		var task store.Task
+		var people string
+		if err := rows.Scan(&task.ID, &people, &task.Client, &task.Summary, &task.DueDate); err != nil {
+			return nil, fmt.Errorf("failed to scan parse log: %w", err)
+		}
+		task.People = strings.Split(people, ",")
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating parse log: %w", err)
+	}
+	return tasks, nil
+}
+
+// saveCorrection stores message with the tasks it should have produced
+func saveCorrection(ctx context.Context, tx *sql.Tx, parseID string, chatID int64, message string, rows []store.Task, source string) error {
+	output := struct {
+		Tasks []llm.Task `json:"tasks"`
+	}{}
+	for _, row := range rows {
+		output.Tasks = append(output.Tasks, llm.Task{
+			People:     splitPeople(row.People),
+			Client:     row.Client,
+			Summary:    partSuffix.ReplaceAllString(row.Summary, ""),
+			DueDate:    normalizeDue(row.DueDate),
+			Confidence: 1,
+		})
+	}
+	tasks, err := json.Marshal(output)
+	if err != nil {
+		return fmt.Errorf("failed to encode correction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO corrections (parse_id, chat_id, message, tasks, source, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (parse_id) DO UPDATE SET
+			tasks = excluded.tasks, source = excluded.source, updated_at = excluded.updated_at
+	`, parseID, chatID, message, string(tasks), source, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save correction: %w", err)
+	}
+	return nil
+}
+
+// Examples implements llm.ExampleSource. It returns the chat's past
+// corrections most similar to message, most similar first.
+func (s *Store) Examples(ctx context.Context, chatID int64, message string) []llm.PromptExample {
+	if s.examples <= 0 {
+		return nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT message, tasks FROM corrections
+		WHERE chat_id = ?
+		ORDER BY updated_at DESC
+		LIMIT ?
+	`, chatID, maxCandidates)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to query corrections")
+		return nil
+	}
+	defer rows.Close()
+
+	var candidates []llm.PromptExample
+	for rows.Next() {
+		var example llm.PromptExample
+		if err := rows.Scan(&example.Input, &example.Output); err != nil {
+			log.Error().Err(err).Msg("Failed to scan correction")
+			return nil
+		}
+		candidates = append(candidates, example)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error().Err(err).Msg("Error iterating corrections")
+		return nil
+	}
+
+	var docs []string
+	for _, candidate := range candidates {
+		docs = append(docs, candidate.Input)
+	}
+	scores := similarity(message, docs)
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	var examples []llm.PromptExample
+	for _, i := range order {
+		if len(examples) == s.examples || scores[i] < minSimilarity {
+			break
+		}
+		examples = append(examples, candidates[i])
+	}
+	return examples
+}
+
+// Prune forgets parsed rows too old to be watched for corrections
+func (s *Store) Prune(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM parse_log WHERE created_at < ?", time.Now().Add(-logRetention)); err != nil {
+		return fmt.Errorf("failed to prune parse log: %w", err)
+	}
+	return nil
+}
+
+// joinPeople canonicalises a people list for comparison: lower case, sorted
+// and comma-separated
+func joinPeople(people []string) string {
+	return strings.Join(splitPeople(people), ",")
+}
+
+// splitPeople lower-cases and sorts people, splitting entries such as
+// "gemma, lilly" that some stores return as one
+func splitPeople(people []string) []string {
+	var result []string
+	for _, entry := range people {
+		for _, person := range strings.Split(entry, ",") {
+			if person = strings.ToLower(strings.TrimSpace(person)); person != "" {
+				result = append(result, person)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// normalizeDue treats a missing due date like "Unsure"
+func normalizeDue(due string) string {
+	if due = strings.TrimSpace(due); due == "" {
+		return "Unsure"
+	}
+	return due
+}
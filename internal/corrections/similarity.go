@@ -0,0 +1,73 @@
+package corrections
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// stopWords are too common in task messages to say whether two are alike
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "to": true, "of": true, "for": true, "in": true,
+	"on": true, "at": true, "by": true, "with": true, "is": true, "it": true, "be": true, "please": true,
+	"can": true, "we": true, "you": true, "i": true, "me": true, "our": true, "this": true, "that": true,
+	"needs": true, "need": true, "should": true, "will": true, "do": true,
+}
+
+// similarity scores each doc against query by the cosine of their TF-IDF
+// vectors, with document frequencies taken from docs and query together
+func similarity(query string, docs []string) []float64 {
+	scores := make([]float64, len(docs))
+	if len(docs) == 0 {
+		return scores
+	}
+
+	terms := make([]map[string]float64, len(docs)+1)
+	df := make(map[string]int)
+	for i, text := range append([]string{query}, docs...) {
+		terms[i] = termCounts(text)
+		for term := range terms[i] {
+			df[term]++
+		}
+	}
+
+	n := float64(len(terms))
+	vectors := make([]map[string]float64, len(terms))
+	for i, counts := range terms {
+		vector := make(map[string]float64, len(counts))
+		var norm float64
+		for term, count := range counts {
+			weight := count * (math.Log((n+1)/float64(df[term]+1)) + 1)
+			vector[term] = weight
+			norm += weight * weight
+		}
+		norm = math.Sqrt(norm)
+		for term := range vector {
+			vector[term] /= norm
+		}
+		vectors[i] = vector
+	}
+
+	for i := range docs {
+		var dot float64
+		for term, weight := range vectors[0] {
+			dot += weight * vectors[i+1][term]
+		}
+		scores[i] = dot
+	}
+	return scores
+}
+
+// termCounts counts the lower-cased words of text, leaving out stop words
+func termCounts(text string) map[string]float64 {
+	counts := make(map[string]float64)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if len(word) > 1 && !stopWords[word] {
+			counts[word]++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,87 @@
+package corrections
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/events"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// Watcher looks for corrections in updated rows. Changes made through the bot
+// arrive as events; changes made in the task store directly, such as in the
+// sheet, are found by comparing every row with the log at an interval.
+type Watcher struct {
+	store     *Store
+	bus       *events.Bus
+	taskStore store.TaskStore
+	interval  time.Duration
+}
+
+// NewWatcher creates a watcher of bus and taskStore. An interval of zero
+// turns off the sweep of the task store.
+func NewWatcher(corrections *Store, bus *events.Bus, taskStore store.TaskStore, interval time.Duration) *Watcher {
+	return &Watcher{
+		store:     corrections,
+		bus:       bus,
+		taskStore: taskStore,
+		interval:  interval,
+	}
+}
+
+// Run watches until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	updates, unsubscribe := w.bus.Subscribe(events.Filter{}, 0)
+	defer unsubscribe()
+
+	var sweep <-chan time.Time
+	if w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		sweep = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-updates:
+			if event.Type != events.TypeTaskUpdated || event.Task == nil {
+				continue
+			}
+			if _, err := w.store.Observe(ctx, *event.Task, SourceUpdate); err != nil {
+				log.Error().Err(err).Str("task_id", event.Task.ID).Msg("Failed to check task for a correction")
+			}
+		case <-sweep:
+			w.sweep(ctx)
+		}
+	}
+}
+
+// sweep compares every row in the task store with the log
+func (w *Watcher) sweep(ctx context.Context) {
+	if err := w.store.Prune(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to prune parse log")
+	}
+
+	tasks, err := w.taskStore.ListTasks(ctx, store.Filter{})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to list tasks for corrections")
+		return
+	}
+
+	found := 0
+	for _, task := range tasks {
+		corrected, err := w.store.Observe(ctx, task, SourceSheet)
+		if err != nil {
+			log.Error().Err(err).Str("task_id", task.ID).Msg("Failed to check task for a correction")
+			continue
+		}
+		if corrected {
+			found++
+		}
+	}
+	log.Debug().Int("tasks", len(tasks)).Int("corrections", found).Msg("Swept tasks for corrections")
+}
@@ -1,6 +1,9 @@
 package cron
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/robfig/cron/v3"
@@ -10,12 +13,22 @@ import (
 // Manager handles scheduled tasks
 type Manager struct {
 	cron *cron.Cron
+
+	mu             sync.Mutex
+	digestSchedule string
+	digestEntry    cron.EntryID
+
+	recurring *Recurring
+	reminders *Reminders
 }
 
-// NewManager creates a new cron manager
-func NewManager() *Manager {
+// NewManager creates a new cron manager that sends the daily digest on
+// digestSchedule, a standard five-field cron expression, in location. An
+// empty schedule leaves the digest off.
+func NewManager(digestSchedule string, location *time.Location) *Manager {
 	return &Manager{
-		cron: cron.New(cron.WithLocation(time.UTC)),
+		cron:           cron.New(cron.WithLocation(location)),
+		digestSchedule: digestSchedule,
 	}
 }
 
@@ -23,16 +36,59 @@ func NewManager() *Manager {
 func (m *Manager) Start() {
 	log.Info().Msg("Starting cron scheduler...")
 
-	// Schedule daily digest email at 06:00 GMT
-	_, err := m.cron.AddFunc("0 6 * * *", m.sendDailyDigest)
-	if err != nil {
+	// Schedule daily digest email
+	if m.digestSchedule == "" {
+		log.Info().Msg("Daily digest disabled")
+	} else if err := m.SetDigestSchedule(m.digestSchedule); err != nil {
 		log.Error().Err(err).Msg("Failed to schedule daily digest")
 	}
 
+	if m.recurring != nil {
+		if _, err := m.cron.AddFunc(recurringSpec, m.checkRecurring); err != nil {
+			log.Error().Err(err).Msg("Failed to schedule recurring tasks")
+		}
+	}
+
+	if m.reminders != nil {
+		if _, err := m.cron.AddFunc(reminderSpec, m.sendReminders); err != nil {
+			log.Error().Err(err).Msg("Failed to schedule reminders")
+		}
+	}
+
 	m.cron.Start()
 	log.Info().Msg("Cron scheduler started")
 }
 
+// SetDigestSchedule replaces the daily digest schedule
+func (m *Manager) SetDigestSchedule(spec string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.cron.AddFunc(spec, m.sendDailyDigest)
+	if err != nil {
+		return fmt.Errorf("failed to schedule daily digest: %w", err)
+	}
+	if m.digestEntry != 0 {
+		m.cron.Remove(m.digestEntry)
+	}
+
+	m.digestSchedule = spec
+	m.digestEntry = entry
+	log.Info().Str("schedule", spec).Msg("Daily digest scheduled")
+	return nil
+}
+
+// SetRecurring checks recurring series for rows to create. It must be called
+// before Start.
+func (m *Manager) SetRecurring(recurring *Recurring) {
+	m.recurring = recurring
+}
+
+// SetReminders sends due-date reminders. It must be called before Start.
+func (m *Manager) SetReminders(reminders *Reminders) {
+	m.reminders = reminders
+}
+
 // Stop halts the cron scheduler
 func (m *Manager) Stop() {
 	log.Info().Msg("Stopping cron scheduler...")
@@ -46,3 +102,17 @@ func (m *Manager) sendDailyDigest() {
 	log.Info().Msg("Sending daily digest...")
 	// TODO: Implement email sending logic in Phase 2
 }
+
+// checkRecurring creates the rows of recurring series that are due
+func (m *Manager) checkRecurring() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	m.recurring.Check(ctx)
+}
+
+// sendReminders sends the due-date reminders that are due
+func (m *Manager) sendReminders() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	m.reminders.Check(ctx)
+}
@@ -0,0 +1,420 @@
+package cron
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/events"
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+	"github.com/giovannigabriele/go-todo-bot/internal/rrule"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// Recurring modes: when the next row of a series is created
+const (
+	RecurOnCompletion = "completion" // when the previous row is completed
+	RecurOnSchedule   = "schedule"   // on the day of every occurrence
+	RecurOff          = "off"        // never; recurrence rules are only stored
+)
+
+// recurringSpec is how often series are checked for rows to create
+const recurringSpec = "*/15 * * * *"
+
+// dateLayout is how due dates are written
+const dateLayout = "2006-01-02"
+
+// minSeriesPrefix is the shortest series ID prefix /stop accepts
+const minSeriesPrefix = 4
+
+// seriesPrefix matches what a prefix of a series ID, a UUID, can hold
+var seriesPrefix = regexp.MustCompile(`^[0-9a-f-]+$`)
+
+// partSuffix matches the " (1/3)" appended to the summaries of multi-task
+// messages, which later rows of a series don't carry
+var partSuffix = regexp.MustCompile(`\s*\(\d+/\d+\)$`)
+
+// ErrSeriesNotFound is returned when no active series matches an ID
+var ErrSeriesNotFound = errors.New("recurring series not found")
+
+// Series is a recurring task
+type Series struct {
+	ID     string
+	ChatID int64
+	Rule   rrule.Rule
+	// Start is the date of the first occurrence, from which intervals count
+	Start time.Time
+	// Template is the row each occurrence is copied from
+	Template store.Task
+	// LastTaskID and LastDue are the latest row created and its due date,
+	// which is empty if it has none
+	LastTaskID string
+	LastDue    string
+	CreatedAt  time.Time
+}
+
+// Recurring keeps recurring series and creates the next row of each, either
+// when the previous row is completed or on a schedule
+type Recurring struct {
+	db        *sql.DB
+	taskStore store.TaskStore
+	mode      string
+	location  *time.Location
+
+	mu sync.Mutex // serialises row creation
+}
+
+// NewRecurring creates a series store in db, creating its table if needed.
+// Rows are written to taskStore, and dates are days in location.
+func NewRecurring(db *sql.DB, taskStore store.TaskStore, mode string, location *time.Location) (*Recurring, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS recurring_series (
+			id TEXT PRIMARY KEY,
+			chat_id INTEGER NOT NULL,
+			rule TEXT NOT NULL,
+			start_date TEXT NOT NULL,
+			template TEXT NOT NULL,
+			last_task_id TEXT NOT NULL,
+			last_due TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			stopped_at DATETIME
+		);
+		CREATE INDEX IF NOT EXISTS idx_recurring_series_last_task ON recurring_series(last_task_id);
+		CREATE INDEX IF NOT EXISTS idx_recurring_series_chat ON recurring_series(chat_id, created_at);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recurring_series table: %w", err)
+	}
+
+	return &Recurring{db: db, taskStore: taskStore, mode: mode, location: location}, nil
+}
+
+// Add starts a series for every row saved from chatID with a recurrence
+// rule. Rows that already belong to a series, as when an edited message is
+// parsed again, are skipped.
+func (r *Recurring) Add(ctx context.Context, chatID int64, rows []store.Task) error {
+	for _, row := range rows {
+		if row.Recurrence == "" {
+			continue
+		}
+		rule, err := rrule.Parse(row.Recurrence)
+		if err != nil {
+			log.Warn().Err(err).Str("task_id", row.ID).Str("recurrence", row.Recurrence).Msg("Ignored invalid recurrence rule")
+			continue
+		}
+
+		var exists bool
+		err = r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM recurring_series WHERE last_task_id = ?)`, row.ID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to look up series of task %s: %w", row.ID, err)
+		}
+		if exists {
+			continue
+		}
+
+		start := r.today()
+		lastDue := ""
+		if due, err := time.ParseInLocation(dateLayout, row.DueDate, r.location); err == nil {
+			start, lastDue = due, row.DueDate
+		}
+
+		template := store.Task{
+			People:      row.People,
+			Client:      row.Client,
+			Summary:     partSuffix.ReplaceAllString(row.Summary, ""),
+			FullMessage: row.FullMessage,
+			Fields:      row.Fields,
+		}
+		data, err := json.Marshal(template)
+		if err != nil {
+			return fmt.Errorf("failed to encode series template: %w", err)
+		}
+
+		id := uuid.New().String()
+		_, err = r.db.ExecContext(ctx, `
+			INSERT INTO recurring_series (id, chat_id, rule, start_date, template, last_task_id, last_due, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, id, chatID, rule.String(), start.Format(dateLayout), string(data), row.ID, lastDue, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("failed to save series of task %s: %w", row.ID, err)
+		}
+		log.Info().Str("series_id", id).Str("task_id", row.ID).Str("rule", rule.String()).Msg("Recurring series started")
+	}
+	return nil
+}
+
+// List returns the active series of chatID, oldest first
+func (r *Recurring) List(ctx context.Context, chatID int64) ([]Series, error) {
+	return r.query(ctx, `WHERE chat_id = ? AND stopped_at IS NULL ORDER BY created_at ASC`, chatID)
+}
+
+// Stop ends the active series of chatID whose ID starts with prefix. The
+// latest row stays, without its recurrence rule. Prefixes holding anything
+// but hex digits and dashes match nothing.
+func (r *Recurring) Stop(ctx context.Context, chatID int64, prefix string) (*Series, error) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if len(prefix) < minSeriesPrefix || !seriesPrefix.MatchString(prefix) {
+		return nil, ErrSeriesNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matches, err := r.query(ctx, `WHERE chat_id = ? AND stopped_at IS NULL AND substr(id, 1, ?) = ? ORDER BY created_at ASC`,
+		chatID, len(prefix), prefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) != 1 {
+		return nil, ErrSeriesNotFound
+	}
+	series := matches[0]
+
+	if _, err := r.db.ExecContext(ctx, `UPDATE recurring_series SET stopped_at = ? WHERE id = ?`, time.Now().UTC(), series.ID); err != nil {
+		return nil, fmt.Errorf("failed to stop series %s: %w", series.ID, err)
+	}
+
+	none := ""
+	_, err = r.taskStore.UpdateTask(ctx, series.LastTaskID, store.Update{Recurrence: &none})
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Warn().Err(err).Str("task_id", series.LastTaskID).Msg("Failed to clear recurrence of stopped series")
+	}
+
+	log.Info().Str("series_id", series.ID).Msg("Recurring series stopped")
+	return &series, nil
+}
+
+// Next returns the due date of the row after the latest one of series, or
+// the zero time if there is none
+func (r *Recurring) Next(series Series) time.Time {
+	return series.Rule.Next(series.Start, r.after(series, time.Time{}))
+}
+
+// Run creates the next row of a series as soon as its latest row is
+// completed through the bot or the API, until ctx is cancelled. Rows
+// completed in the sheet are found by Check.
+func (r *Recurring) Run(ctx context.Context, bus *events.Bus) {
+	if r.mode != RecurOnCompletion {
+		return
+	}
+
+	updates, unsubscribe := bus.Subscribe(events.Filter{}, 0)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-updates:
+			if event.Type != events.TypeTaskUpdated || event.Task == nil || event.Task.Status != store.StatusComplete {
+				continue
+			}
+			if err := r.completed(ctx, event.Task.ID); err != nil {
+				log.Error().Err(err).Str("task_id", event.Task.ID).Msg("Failed to create next recurring task")
+			}
+		}
+	}
+}
+
+// Check creates the rows that are due: in schedule mode one for every series
+// whose next occurrence is today or earlier, in completion mode one for
+// every series whose latest row has been completed
+func (r *Recurring) Check(ctx context.Context) {
+	switch r.mode {
+	case RecurOnSchedule:
+		r.checkSchedule(ctx)
+	case RecurOnCompletion:
+		r.checkCompleted(ctx)
+	}
+}
+
+// checkSchedule creates today's occurrences. Occurrences missed while the
+// bot was down are skipped in favour of the latest.
+func (r *Recurring) checkSchedule(ctx context.Context) {
+	active, err := r.query(ctx, `WHERE stopped_at IS NULL`)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list recurring series")
+		return
+	}
+
+	today := r.today()
+	for _, series := range active {
+		next := r.Next(series)
+		if next.IsZero() || next.After(today) {
+			continue
+		}
+		for {
+			later := series.Rule.Next(series.Start, next)
+			if later.IsZero() || later.After(today) {
+				break
+			}
+			next = later
+		}
+		if err := r.create(ctx, series, next); err != nil {
+			log.Error().Err(err).Str("series_id", series.ID).Msg("Failed to create recurring task")
+		}
+	}
+}
+
+// checkCompleted continues the series whose latest row was completed in the
+// task store directly
+func (r *Recurring) checkCompleted(ctx context.Context) {
+	active, err := r.query(ctx, `WHERE stopped_at IS NULL`)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list recurring series")
+		return
+	}
+	if len(active) == 0 {
+		return
+	}
+
+	completed, err := r.taskStore.ListTasks(ctx, store.Filter{Status: store.StatusComplete})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to list completed tasks for recurring series")
+		return
+	}
+	done := make(map[string]bool, len(completed))
+	for _, task := range completed {
+		done[task.ID] = true
+	}
+
+	for _, series := range active {
+		if !done[series.LastTaskID] {
+			continue
+		}
+		if err := r.completed(ctx, series.LastTaskID); err != nil {
+			log.Error().Err(err).Str("series_id", series.ID).Msg("Failed to create next recurring task")
+		}
+	}
+}
+
+// completed creates the row after taskID in its series, if it is the latest
+// row of an active one. The next row is due on the first occurrence after
+// the completed row's due date, or from today if that has passed.
+func (r *Recurring) completed(ctx context.Context, taskID string) error {
+	matches, err := r.query(ctx, `WHERE last_task_id = ? AND stopped_at IS NULL`, taskID)
+	if err != nil {
+		return err
+	}
+
+	for _, series := range matches {
+		yesterday := r.today().AddDate(0, 0, -1)
+		next := series.Rule.Next(series.Start, r.after(series, yesterday))
+		if next.IsZero() {
+			log.Info().Str("series_id", series.ID).Msg("Recurring series has no further occurrences")
+			continue
+		}
+		if err := r.create(ctx, series, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// create adds the row of series due on due and makes it the latest. A series
+// whose latest row changed meanwhile is left alone.
+func (r *Recurring) create(ctx context.Context, series Series, due time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var current string
+	err := r.db.QueryRowContext(ctx, `SELECT last_task_id FROM recurring_series WHERE id = ? AND stopped_at IS NULL`, series.ID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && current != series.LastTaskID) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read series %s: %w", series.ID, err)
+	}
+
+	t := series.Template
+	row := store.NewTask(t.People, t.Client, t.Summary, t.FullMessage, due.Format(dateLayout),
+		"Repeats "+series.Rule.Describe())
+	row.Fields = t.Fields
+	row.Recurrence = series.Rule.String()
+
+	if err := r.taskStore.AddTasks(ctx, []store.Task{row}); err != nil {
+		return fmt.Errorf("failed to add next task of series %s: %w", series.ID, err)
+	}
+
+	_, err = r.db.ExecContext(ctx, `UPDATE recurring_series SET last_task_id = ?, last_due = ? WHERE id = ?`,
+		row.ID, row.DueDate, series.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update series %s: %w", series.ID, err)
+	}
+
+	metrics.RecurringTasksCreated.WithLabelValues(r.mode).Inc()
+	log.Info().
+		Str("series_id", series.ID).
+		Str("task_id", row.ID).
+		Str("due_date", row.DueDate).
+		Msg("Created next recurring task")
+	return nil
+}
+
+// after returns the day after which the next occurrence of series falls:
+// the due date of its latest row, or floor if that is later, or the day
+// before the series started if the latest row has no due date
+func (r *Recurring) after(series Series, floor time.Time) time.Time {
+	after := series.Start.AddDate(0, 0, -1)
+	if due, err := time.ParseInLocation(dateLayout, series.LastDue, r.location); err == nil {
+		after = due
+	}
+	if floor.After(after) {
+		after = floor
+	}
+	return after
+}
+
+// today returns midnight at the start of today
+func (r *Recurring) today() time.Time {
+	now := time.Now().In(r.location)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, r.location)
+}
+
+// query reads series matching a WHERE clause
+func (r *Recurring) query(ctx context.Context, where string, args ...interface{}) ([]Series, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, chat_id, rule, start_date, template, last_task_id, last_due, created_at
+		FROM recurring_series
+	`+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recurring series: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Series
+	for rows.Next() {
+		var series Series
+		var rule, start, template string
+		err := rows.Scan(&series.ID, &series.ChatID, &rule, &start, &template, &series.LastTaskID, &series.LastDue, &series.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recurring series: %w", err)
+		}
+		if series.Rule, err = rrule.Parse(rule); err != nil {
+			return nil, fmt.Errorf("series %s has an invalid rule: %w", series.ID, err)
+		}
+		if series.Start, err = time.ParseInLocation(dateLayout, start, r.location); err != nil {
+			return nil, fmt.Errorf("series %s has an invalid start date: %w", series.ID, err)
+		}
+		if err := json.Unmarshal([]byte(template), &series.Template); err != nil {
+			return nil, fmt.Errorf("failed to decode template of series %s: %w", series.ID, err)
+		}
+		list = append(list, series)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating recurring series: %w", err)
+	}
+	return list, nil
+}
@@ -0,0 +1,57 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+func TestStopMatchesLiteralPrefix(t *testing.T) {
+	ctx := context.Background()
+	_, db, taskStore := newTestReminders(t)
+	recurring, err := NewRecurring(db, taskStore, "completion", time.UTC)
+	if err != nil {
+		t.Fatalf("NewRecurring: %v", err)
+	}
+
+	rows := []store.Task{
+		{ID: "t1", Summary: "Send the weekly report", DueDate: "2025-01-06", Recurrence: "FREQ=WEEKLY;BYDAY=MO"},
+		{ID: "t2", Summary: "Pay the rent", DueDate: "2025-01-31", Recurrence: "FREQ=MONTHLY;BYMONTHDAY=-1"},
+	}
+	if err := taskStore.AddTasks(ctx, rows); err != nil {
+		t.Fatalf("AddTasks: %v", err)
+	}
+	if err := recurring.Add(ctx, 1, rows); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	series, err := recurring.List(ctx, 1)
+	if err != nil || len(series) != 2 {
+		t.Fatalf("List = %d series, %v, want 2", len(series), err)
+	}
+
+	for _, prefix := range []string{"%%%%", "____", "%", series[0].ID[:3], "zzzz", series[0].ID[:4] + "%"} {
+		if _, err := recurring.Stop(ctx, 1, prefix); !errors.Is(err, ErrSeriesNotFound) {
+			t.Errorf("Stop(%q) = %v, want ErrSeriesNotFound", prefix, err)
+		}
+	}
+	if _, err := recurring.Stop(ctx, 2, series[0].ID); !errors.Is(err, ErrSeriesNotFound) {
+		t.Errorf("Stop from another chat = %v, want ErrSeriesNotFound", err)
+	}
+
+	stopped, err := recurring.Stop(ctx, 1, " "+series[0].ID[:8]+" ")
+	if err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if stopped.ID != series[0].ID {
+		t.Errorf("stopped %s, want %s", stopped.ID, series[0].ID)
+	}
+	if task, err := taskStore.GetTask(ctx, "t1"); err != nil || task.Recurrence != "" {
+		t.Errorf("stopped series' row = %+v, %v, want it without a recurrence", task, err)
+	}
+	if active, _ := recurring.List(ctx, 1); len(active) != 1 || active[0].ID != series[1].ID {
+		t.Errorf("active series %+v, want only the other one", active)
+	}
+}
@@ -0,0 +1,649 @@
+package cron
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// Reminder kinds
+const (
+	ReminderBefore  = "before"  // the day before the task is due
+	ReminderDue     = "due"     // on the due date
+	ReminderOverdue = "overdue" // after the due date, escalating
+)
+
+// reminderSpec is how often reminders are checked for
+const reminderSpec = "*/5 * * * *"
+
+// reminderRetention is how long sent reminders are remembered
+const reminderRetention = 180 * 24 * time.Hour
+
+var (
+	// ErrNotLinked is returned for Telegram users not linked to a team member
+	ErrNotLinked = errors.New("user is not linked to a team member")
+	// ErrNotAssigned is returned when a user acts on a task they are not on
+	ErrNotAssigned = errors.New("task is not assigned to the user")
+	// ErrNameTaken is returned when a user links to a team member another
+	// user is already linked to
+	ErrNameTaken = errors.New("team member is linked to another user")
+)
+
+// QuietHours is a daily span, in minutes after midnight, in which no
+// reminders are sent. It may run past midnight; an empty span is never quiet.
+type QuietHours struct {
+	Start, End int
+}
+
+// ParseQuietHours reads quiet hours such as "22:00-08:00". "off" and the
+// empty string mean no quiet hours.
+func ParseQuietHours(s string) (QuietHours, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "" || s == "off" {
+		return QuietHours{}, nil
+	}
+
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return QuietHours{}, fmt.Errorf("invalid quiet hours %q, expected HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return QuietHours{}, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return QuietHours{}, err
+	}
+	return QuietHours{Start: start, End: end}, nil
+}
+
+// parseClock reads a time of day such as "8", "08:00" or "22:30" as minutes
+// after midnight
+func parseClock(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	hours, minutes, _ := strings.Cut(s, ":")
+	h, err := strconv.Atoi(hours)
+	if err != nil || h < 0 || h > 23 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	m := 0
+	if minutes != "" {
+		m, err = strconv.Atoi(minutes)
+		if err != nil || m < 0 || m > 59 || len(minutes) != 2 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+	}
+	return h*60 + m, nil
+}
+
+// Contains reports whether t's time of day falls in the quiet hours
+func (q QuietHours) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if q.Start <= q.End {
+		return minute >= q.Start && minute < q.End
+	}
+	return minute >= q.Start || minute < q.End
+}
+
+// String writes the quiet hours as "22:00-08:00", or "off"
+func (q QuietHours) String() string {
+	if q.Start == q.End {
+		return "off"
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", q.Start/60, q.Start%60, q.End/60, q.End%60)
+}
+
+// ReminderUser is a Telegram user linked to a team member. Reminders are
+// sent to the user's private chat, whose ID is the user ID.
+type ReminderUser struct {
+	UserID int64
+	// Name is the team member's name as it appears in People
+	Name string
+	// Timezone and Quiet are empty when the defaults apply
+	Timezone string
+	Quiet    string
+}
+
+// Reminder is a message about a task due soon or overdue
+type Reminder struct {
+	Kind string
+	Task store.Task
+	// Days is how many days the task is overdue
+	Days int
+	// Snoozed is set when the reminder follows a snooze
+	Snoozed bool
+}
+
+// ReminderSender delivers a reminder to a user's private chat
+type ReminderSender func(ctx context.Context, userID int64, reminder Reminder) error
+
+// Reminders keeps the team members Telegram users are linked to and sends
+// them reminders of their tasks' due dates
+type Reminders struct {
+	db        *sql.DB
+	taskStore store.TaskStore
+	location  *time.Location
+	send      ReminderSender
+
+	mu     sync.RWMutex // guards the defaults, which are reloadable
+	quiet  QuietHours
+	snooze time.Duration
+}
+
+// NewReminders creates a reminder store in db, creating its tables if needed.
+// Tasks are read from and completed in taskStore. Users without settings of
+// their own get location and quiet; a snooze lasts snooze.
+func NewReminders(db *sql.DB, taskStore store.TaskStore, location *time.Location, quiet QuietHours, snooze time.Duration) (*Reminders, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS reminder_users (
+			user_id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			timezone TEXT NOT NULL DEFAULT '',
+			quiet_hours TEXT NOT NULL DEFAULT '',
+			linked_at DATETIME NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS reminders_sent (
+			task_id TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			due_date TEXT NOT NULL,
+			sent_at DATETIME NOT NULL,
+			PRIMARY KEY (task_id, user_id, kind, due_date)
+		);
+		CREATE INDEX IF NOT EXISTS idx_reminders_sent_at ON reminders_sent(sent_at);
+		CREATE TABLE IF NOT EXISTS reminder_snoozes (
+			task_id TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			until DATETIME NOT NULL,
+			PRIMARY KEY (task_id, user_id)
+		);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reminder tables: %w", err)
+	}
+
+	// Each team member is linked to one user. Databases from before that was
+	// enforced keep the user who linked first.
+	result, err := db.ExecContext(ctx, `
+		DELETE FROM reminder_users WHERE EXISTS (
+			SELECT 1 FROM reminder_users first
+			WHERE first.name = reminder_users.name COLLATE NOCASE
+			AND (first.linked_at < reminder_users.linked_at
+				OR (first.linked_at = reminder_users.linked_at AND first.user_id < reminder_users.user_id))
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove duplicate reminder links: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Warn().Int64("removed", n).Msg("Removed reminder links to team members already linked to another user")
+	}
+	if _, err := db.ExecContext(ctx, `
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_reminder_users_name ON reminder_users(name COLLATE NOCASE)
+	`); err != nil {
+		return nil, fmt.Errorf("failed to create reminder link index: %w", err)
+	}
+
+	return &Reminders{
+		db:        db,
+		taskStore: taskStore,
+		location:  location,
+		quiet:     quiet,
+		snooze:    snooze,
+	}, nil
+}
+
+// SetSender delivers reminders with send. Without one, none are sent.
+func (r *Reminders) SetSender(send ReminderSender) {
+	r.send = send
+}
+
+// SetDefaults changes the quiet hours of users without their own and how
+// long a snooze lasts
+func (r *Reminders) SetDefaults(quiet QuietHours, snooze time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.quiet, r.snooze = quiet, snooze
+}
+
+// SnoozeFor returns how long a snooze lasts
+func (r *Reminders) SnoozeFor() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.snooze
+}
+
+// Link links userID to the team member name, keeping the user's settings.
+// It returns ErrNameTaken if another user is linked to name; only Assign
+// can take a name over.
+func (r *Reminders) Link(ctx context.Context, userID int64, name string) error {
+	owner, err := r.Owner(ctx, name)
+	if err != nil && !errors.Is(err, ErrNotLinked) {
+		return err
+	}
+	if owner != nil && owner.UserID != userID {
+		return ErrNameTaken
+	}
+	return r.link(ctx, r.db, userID, name)
+}
+
+// Assign links userID to the team member name, unlinking any other user
+// linked to it. It returns the ID of that user, or 0.
+func (r *Reminders) Assign(ctx context.Context, userID int64, name string) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var previous int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id FROM reminder_users WHERE name = ? COLLATE NOCASE AND user_id != ?
+	`, name, userID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to find link to %s: %w", name, err)
+	}
+	if previous != 0 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM reminder_users WHERE user_id = ?`, previous); err != nil {
+			return 0, fmt.Errorf("failed to unlink user %d: %w", previous, err)
+		}
+	}
+
+	if err := r.link(ctx, tx, userID, name); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit link: %w", err)
+	}
+	return previous, nil
+}
+
+// execer is a *sql.DB or *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// link writes the link of userID to name
+func (r *Reminders) link(ctx context.Context, db execer, userID int64, name string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO reminder_users (user_id, name, linked_at) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET name = excluded.name, linked_at = excluded.linked_at
+	`, userID, name, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to link user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// Unlink removes the link of userID and its settings
+func (r *Reminders) Unlink(ctx context.Context, userID int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM reminder_users WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to unlink user %d: %w", userID, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotLinked
+	}
+	return nil
+}
+
+// User returns the link of userID, or ErrNotLinked
+func (r *Reminders) User(ctx context.Context, userID int64) (*ReminderUser, error) {
+	var user ReminderUser
+	err := r.db.QueryRowContext(ctx, `
+		SELECT user_id, name, timezone, quiet_hours FROM reminder_users WHERE user_id = ?
+	`, userID).Scan(&user.UserID, &user.Name, &user.Timezone, &user.Quiet)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotLinked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", userID, err)
+	}
+	return &user, nil
+}
+
+// Owner returns the user linked to the team member name, or ErrNotLinked
+func (r *Reminders) Owner(ctx context.Context, name string) (*ReminderUser, error) {
+	var user ReminderUser
+	err := r.db.QueryRowContext(ctx, `
+		SELECT user_id, name, timezone, quiet_hours FROM reminder_users WHERE name = ? COLLATE NOCASE
+	`, name).Scan(&user.UserID, &user.Name, &user.Timezone, &user.Quiet)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotLinked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user linked to %s: %w", name, err)
+	}
+	return &user, nil
+}
+
+// SetTimezone sets the time zone reminders to userID are timed in. An empty
+// zone restores the default.
+func (r *Reminders) SetTimezone(ctx context.Context, userID int64, zone string) error {
+	if zone != "" {
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			return fmt.Errorf("unknown time zone %q", zone)
+		}
+		zone = location.String()
+	}
+	return r.setting(ctx, userID, "timezone", zone)
+}
+
+// SetQuietHours sets the quiet hours of userID, such as "22:00-08:00" or
+// "off". An empty spec restores the default.
+func (r *Reminders) SetQuietHours(ctx context.Context, userID int64, spec string) error {
+	if spec != "" {
+		quiet, err := ParseQuietHours(spec)
+		if err != nil {
+			return err
+		}
+		spec = quiet.String()
+	}
+	return r.setting(ctx, userID, "quiet_hours", spec)
+}
+
+// setting updates one column of the link of userID
+func (r *Reminders) setting(ctx context.Context, userID int64, column, value string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE reminder_users SET `+column+` = ? WHERE user_id = ?`, value, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update %s of user %d: %w", column, userID, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotLinked
+	}
+	return nil
+}
+
+// Settings returns the time zone and quiet hours in effect for user
+func (r *Reminders) Settings(user *ReminderUser) (*time.Location, QuietHours) {
+	location := r.location
+	if user.Timezone != "" {
+		if l, err := time.LoadLocation(user.Timezone); err == nil {
+			location = l
+		}
+	}
+	r.mu.RLock()
+	quiet := r.quiet
+	r.mu.RUnlock()
+	if user.Quiet != "" {
+		if q, err := ParseQuietHours(user.Quiet); err == nil {
+			quiet = q
+		}
+	}
+	return location, quiet
+}
+
+// Snooze holds back reminders of taskID to userID for the snooze period,
+// after which the reminder is sent again. It returns when that will be.
+func (r *Reminders) Snooze(ctx context.Context, userID int64, taskID string) (time.Time, error) {
+	if _, err := r.assigned(ctx, userID, taskID); err != nil {
+		return time.Time{}, err
+	}
+
+	until := time.Now().UTC().Add(r.SnoozeFor())
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO reminder_snoozes (task_id, user_id, until) VALUES (?, ?, ?)
+		ON CONFLICT(task_id, user_id) DO UPDATE SET until = excluded.until
+	`, taskID, userID, until)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to snooze task %s: %w", taskID, err)
+	}
+	return until, nil
+}
+
+// Done marks taskID complete for userID, who must be on it
+func (r *Reminders) Done(ctx context.Context, userID int64, taskID string) (*store.Task, error) {
+	if _, err := r.assigned(ctx, userID, taskID); err != nil {
+		return nil, err
+	}
+
+	complete := store.StatusComplete
+	task, err := r.taskStore.UpdateTask(ctx, taskID, store.Update{Status: &complete})
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete task %s: %w", taskID, err)
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM reminder_snoozes WHERE task_id = ?`, taskID); err != nil {
+		log.Warn().Err(err).Str("task_id", taskID).Msg("Failed to clear snoozes of completed task")
+	}
+	return task, nil
+}
+
+// assigned returns taskID if userID is linked to one of its people
+func (r *Reminders) assigned(ctx context.Context, userID int64, taskID string) (*store.Task, error) {
+	user, err := r.User(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	task, err := r.taskStore.GetTask(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if !(store.Filter{Person: user.Name}).Matches(*task) {
+		return nil, ErrNotAssigned
+	}
+	return task, nil
+}
+
+// Check sends the reminders that are due: the day before a task is due, on
+// its due date, and escalating nudges once it is overdue, each at most once,
+// as well as reminders whose snooze has ended. Users in their quiet hours
+// are reminded once those end.
+func (r *Reminders) Check(ctx context.Context) {
+	if r.send == nil {
+		return
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM reminders_sent WHERE sent_at < ?`, time.Now().UTC().Add(-reminderRetention)); err != nil {
+		log.Error().Err(err).Msg("Failed to prune sent reminders")
+	}
+
+	users, err := r.users(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list linked users")
+		return
+	}
+	if len(users) == 0 {
+		return
+	}
+
+	tasks, err := r.taskStore.ListTasks(ctx, store.Filter{ExcludeStatus: store.StatusComplete})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to list open tasks for reminders")
+		return
+	}
+
+	snoozes, err := r.snoozes(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list snoozed reminders")
+		return
+	}
+
+	now := time.Now()
+	for _, user := range users {
+		location, quiet := r.Settings(&user)
+		local := now.In(location)
+		if quiet.Contains(local) {
+			continue
+		}
+		today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+
+		for _, task := range tasks {
+			if !(store.Filter{Person: user.Name}).Matches(task) {
+				continue
+			}
+			due, err := time.ParseInLocation(dateLayout, task.DueDate, location)
+			if err != nil {
+				continue
+			}
+
+			reminder := Reminder{Task: task}
+			reminder.Kind, reminder.Days = reminderKind(today, due)
+
+			key := snoozeKey{task.ID, user.UserID}
+			if until, ok := snoozes[key]; ok {
+				if until.After(now) {
+					continue
+				}
+				reminder.Snoozed = true
+				if err := r.unsnooze(ctx, key); err != nil {
+					log.Error().Err(err).Str("task_id", task.ID).Msg("Failed to clear snooze")
+					continue
+				}
+			}
+			if reminder.Kind == "" {
+				continue
+			}
+
+			r.remind(ctx, user, task.DueDate, reminder)
+		}
+	}
+}
+
+// remind sends reminder to user unless the same reminder was sent before.
+// The reminder is recorded before it is sent, so a send that fails is
+// forgotten again to be retried.
+func (r *Reminders) remind(ctx context.Context, user ReminderUser, dueDate string, reminder Reminder) {
+	kind := reminder.Kind
+	if kind == ReminderOverdue {
+		kind = fmt.Sprintf("%s-%d", ReminderOverdue, overdueLevel(reminder.Days))
+	}
+
+	result, err := r.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO reminders_sent (task_id, user_id, kind, due_date, sent_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, reminder.Task.ID, user.UserID, kind, dueDate, time.Now().UTC())
+	if err != nil {
+		log.Error().Err(err).Str("task_id", reminder.Task.ID).Msg("Failed to record reminder")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 && !reminder.Snoozed {
+		return
+	}
+
+	if err := r.send(ctx, user.UserID, reminder); err != nil {
+		log.Warn().Err(err).Int64("user_id", user.UserID).Str("task_id", reminder.Task.ID).Msg("Failed to send reminder")
+		_, err := r.db.ExecContext(ctx, `
+			DELETE FROM reminders_sent WHERE task_id = ? AND user_id = ? AND kind = ? AND due_date = ?
+		`, reminder.Task.ID, user.UserID, kind, dueDate)
+		if err != nil {
+			log.Error().Err(err).Str("task_id", reminder.Task.ID).Msg("Failed to forget unsent reminder")
+		}
+		return
+	}
+
+	label := reminder.Kind
+	if reminder.Snoozed {
+		label = "snoozed"
+	}
+	metrics.RemindersSent.WithLabelValues(label).Inc()
+	log.Info().
+		Int64("user_id", user.UserID).
+		Str("task_id", reminder.Task.ID).
+		Str("kind", kind).
+		Msg("Reminder sent")
+}
+
+// reminderKind returns the reminder due today for a task due on due, if any,
+// and how many days overdue it is
+func reminderKind(today, due time.Time) (string, int) {
+	// Round to whole days, as daylight saving changes make some 23 or 25 hours
+	days := int(math.Round(today.Sub(due).Hours() / 24))
+	switch {
+	case days == -1:
+		return ReminderBefore, 0
+	case days == 0:
+		return ReminderDue, 0
+	case days > 0:
+		return ReminderOverdue, days
+	}
+	return "", 0
+}
+
+// overdueLevel escalates overdue nudges: the first the day after the due
+// date, the second after three days, then one a week from the seventh day
+func overdueLevel(days int) int {
+	switch {
+	case days < 3:
+		return 1
+	case days < 7:
+		return 2
+	}
+	return 3 + (days-7)/7
+}
+
+// users lists the linked users
+func (r *Reminders) users(ctx context.Context) ([]ReminderUser, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT user_id, name, timezone, quiet_hours FROM reminder_users`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query linked users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []ReminderUser
+	for rows.Next() {
+		var user ReminderUser
+		if err := rows.Scan(&user.UserID, &user.Name, &user.Timezone, &user.Quiet); err != nil {
+			return nil, fmt.Errorf("failed to scan linked user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating linked users: %w", err)
+	}
+	return users, nil
+}
+
+// snoozeKey identifies the reminders of a task to a user
+type snoozeKey struct {
+	taskID string
+	userID int64
+}
+
+// snoozes returns when each snooze ends
+func (r *Reminders) snoozes(ctx context.Context) (map[snoozeKey]time.Time, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT task_id, user_id, until FROM reminder_snoozes`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snoozes: %w", err)
+	}
+	defer rows.Close()
+
+	snoozes := make(map[snoozeKey]time.Time)
+	for rows.Next() {
+		var key snoozeKey
+		var until time.Time
+		if err := rows.Scan(&key.taskID, &key.userID, &until); err != nil {
+			return nil, fmt.Errorf("failed to scan snooze: %w", err)
+		}
+		snoozes[key] = until
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating snoozes: %w", err)
+	}
+	return snoozes, nil
+}
+
+// unsnooze deletes an ended snooze
+func (r *Reminders) unsnooze(ctx context.Context, key snoozeKey) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM reminder_snoozes WHERE task_id = ? AND user_id = ?`, key.taskID, key.userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete snooze of task %s: %w", key.taskID, err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package cron
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+func newTestReminders(t *testing.T) (*Reminders, *sql.DB, store.TaskStore) {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "reminders.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	taskStore, err := store.NewFileStore(filepath.Join(dir, "tasks.jsonl"), nil)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	reminders, err := NewReminders(db, taskStore, time.UTC, QuietHours{}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewReminders: %v", err)
+	}
+	return reminders, db, taskStore
+}
+
+func TestLinkAllowsOneUserPerName(t *testing.T) {
+	ctx := context.Background()
+	reminders, _, taskStore := newTestReminders(t)
+	if err := taskStore.AddTasks(ctx, []store.Task{{ID: "t1", Summary: "Book the venue", People: []string{"Gemma"}}}); err != nil {
+		t.Fatalf("AddTasks: %v", err)
+	}
+
+	if err := reminders.Link(ctx, 1, "Gemma"); err != nil {
+		t.Fatalf("first link: %v", err)
+	}
+	if err := reminders.Link(ctx, 1, "Gemma"); err != nil {
+		t.Errorf("relinking the same user: %v", err)
+	}
+	if err := reminders.Link(ctx, 2, "gemma"); !errors.Is(err, ErrNameTaken) {
+		t.Fatalf("second user's link = %v, want ErrNameTaken", err)
+	}
+	if _, err := reminders.Done(ctx, 2, "t1"); !errors.Is(err, ErrNotLinked) {
+		t.Errorf("Done by the refused user = %v, want ErrNotLinked", err)
+	}
+
+	previous, err := reminders.Assign(ctx, 2, "Gemma")
+	if err != nil {
+		t.Fatalf("Assign: %v", err)
+	}
+	if previous != 1 {
+		t.Errorf("Assign replaced user %d, want 1", previous)
+	}
+	if _, err := reminders.User(ctx, 1); !errors.Is(err, ErrNotLinked) {
+		t.Errorf("replaced user is still linked: %v", err)
+	}
+	if _, err := reminders.Snooze(ctx, 1, "t1"); !errors.Is(err, ErrNotLinked) {
+		t.Errorf("Snooze by the replaced user = %v, want ErrNotLinked", err)
+	}
+	if _, err := reminders.Snooze(ctx, 2, "t1"); err != nil {
+		t.Errorf("Snooze by the assigned user: %v", err)
+	}
+}
+
+func TestNewRemindersKeepsFirstOfDuplicateLinks(t *testing.T) {
+	ctx := context.Background()
+	_, db, taskStore := newTestReminders(t)
+
+	// Links made before names were unique
+	if _, err := db.Exec(`DROP INDEX idx_reminder_users_name`); err != nil {
+		t.Fatalf("failed to drop index: %v", err)
+	}
+	now := time.Now().UTC()
+	for i, name := range []string{"Gemma", "gemma", "Lilly"} {
+		if _, err := db.Exec(`INSERT INTO reminder_users (user_id, name, linked_at) VALUES (?, ?, ?)`,
+			i+1, name, now.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("failed to insert link: %v", err)
+		}
+	}
+
+	reminders, err := NewReminders(db, taskStore, time.UTC, QuietHours{}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewReminders: %v", err)
+	}
+	owner, err := reminders.Owner(ctx, "GEMMA")
+	if err != nil {
+		t.Fatalf("Owner: %v", err)
+	}
+	if owner.UserID != 1 {
+		t.Errorf("Gemma is linked to user %d, want the first, 1", owner.UserID)
+	}
+	if _, err := reminders.User(ctx, 2); !errors.Is(err, ErrNotLinked) {
+		t.Errorf("duplicate link kept: %v", err)
+	}
+	if _, err := reminders.User(ctx, 3); err != nil {
+		t.Errorf("unrelated link lost: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Package events fans out live updates about queued batches and task rows to
+// subscribers such as the /api/v1/events stream. Publishing never blocks: a
+// subscriber that falls behind loses events rather than slowing the workers.
+package events
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// Event types
+const (
+	TypeQueue       = "queue.status" // a queued part of a batch changed state
+	TypeTaskCreated = "task.created" // a row reached the task store
+	TypeTaskUpdated = "task.updated" // a row was changed, e.g. its status
+	TypeTaskDeleted = "task.deleted" // a row was removed
+)
+
+// historySize is how many recent events are kept for reconnecting subscribers
+const historySize = 256
+
+// subscriberBuffer is how many events a subscriber may fall behind by
+const subscriberBuffer = 64
+
+// QueueUpdate describes a queued part of a batch
+type QueueUpdate struct {
+	ID      int64   `json:"id"`
+	Message string  `json:"message"`
+	Status  string  `json:"status"`
+	Error   *string `json:"error,omitempty"`
+}
+
+// Event is a single update
+type Event struct {
+	ID      uint64       `json:"id"`
+	Type    string       `json:"type"`
+	Time    time.Time    `json:"time"`
+	BatchID string       `json:"batchId,omitempty"`
+	Queue   *QueueUpdate `json:"queue,omitempty"`
+	Task    *store.Task  `json:"task,omitempty"`
+	TaskID  string       `json:"taskId,omitempty"` // set for deletions
+}
+
+// Filter narrows the events a subscriber receives. Empty fields match
+// everything; a person filter only matches task events.
+type Filter struct {
+	BatchID string
+	Person  string
+}
+
+// Matches reports whether event satisfies the filter
+func (f Filter) Matches(event Event) bool {
+	if f.BatchID != "" && event.BatchID != f.BatchID {
+		return false
+	}
+	if f.Person != "" {
+		if event.Task == nil {
+			return false
+		}
+		return store.Filter{Person: f.Person}.Matches(*event.Task)
+	}
+	return true
+}
+
+// subscriber is a registered event channel
+type subscriber struct {
+	filter Filter
+	ch     chan Event
+}
+
+// Bus delivers published events to subscribers
+type Bus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []Event
+	subscribers map[*subscriber]struct{}
+}
+
+// NewBus creates an event bus
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Publish assigns the event an ID and timestamp and sends it to every
+// matching subscriber
+func (b *Bus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event.ID = b.nextID
+	event.Time = time.Now().UTC()
+
+	b.history = append(b.history, event)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			// Subscriber is behind; drop rather than block the publisher
+		}
+	}
+}
+
+// Subscribe returns a channel of events matching filter, starting with any
+// kept events published after lastID (0 for none), and a function that ends
+// the subscription
+func (b *Bus) Subscribe(filter Filter, lastID uint64) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &subscriber{
+		filter: filter,
+		ch:     make(chan Event, subscriberBuffer+historySize),
+	}
+	if lastID > 0 {
+		for _, event := range b.history {
+			if event.ID > lastID && filter.Matches(event) {
+				sub.ch <- event
+			}
+		}
+	}
+	b.subscribers[sub] = struct{}{}
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, sub)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// batchKey is the context key for the batch a store call belongs to
+type batchKey struct{}
+
+// WithBatch records on ctx the batch that rows written with it came from
+func WithBatch(ctx context.Context, batchID string) context.Context {
+	if batchID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, batchKey{}, batchID)
+}
+
+// batchFrom returns the batch recorded on ctx, if any
+func batchFrom(ctx context.Context) string {
+	batchID, _ := ctx.Value(batchKey{}).(string)
+	return strings.TrimSpace(batchID)
+}
@@ -0,0 +1,55 @@
+package events
+
+import (
+	"context"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// ObservedStore wraps a task store and publishes an event for every row that
+// is added, updated or deleted through it
+type ObservedStore struct {
+	store.TaskStore
+	bus *Bus
+}
+
+// ObserveStore wraps taskStore so its writes are published on bus
+func ObserveStore(taskStore store.TaskStore, bus *Bus) *ObservedStore {
+	return &ObservedStore{TaskStore: taskStore, bus: bus}
+}
+
+// AddTasks stores tasks and publishes a created event for each
+func (s *ObservedStore) AddTasks(ctx context.Context, tasks []store.Task) error {
+	if err := s.TaskStore.AddTasks(ctx, tasks); err != nil {
+		return err
+	}
+
+	batchID := batchFrom(ctx)
+	for i := range tasks {
+		task := tasks[i]
+		s.bus.Publish(Event{Type: TypeTaskCreated, BatchID: batchID, Task: &task})
+	}
+	return nil
+}
+
+// UpdateTask applies update and publishes the updated task
+func (s *ObservedStore) UpdateTask(ctx context.Context, id string, update store.Update) (*store.Task, error) {
+	task, err := s.TaskStore.UpdateTask(ctx, id, update)
+	if err != nil {
+		return nil, err
+	}
+
+	published := *task
+	s.bus.Publish(Event{Type: TypeTaskUpdated, Task: &published})
+	return task, nil
+}
+
+// DeleteTask removes a task and publishes its ID
+func (s *ObservedStore) DeleteTask(ctx context.Context, id string) error {
+	if err := s.TaskStore.DeleteTask(ctx, id); err != nil {
+		return err
+	}
+
+	s.bus.Publish(Event{Type: TypeTaskDeleted, TaskID: id})
+	return nil
+}
@@ -0,0 +1,365 @@
+package fakesheet
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TokenPath is the OAuth token endpoint served by the fake. Service account
+// keys from ServiceAccountKey point their token_uri here.
+const TokenPath = "/token"
+
+// apiPrefix is the path prefix of the Sheets API v4 spreadsheet resource
+const apiPrefix = "/v4/spreadsheets/"
+
+// a1Regex matches the cell part of an A1 range such as A1, A5:I5, 1:1 or I:I
+var a1Regex = regexp.MustCompile(`^([A-Z]*)(\d*)(?::([A-Z]*)(\d*))?$`)
+
+// a1Range is a parsed A1 range. Zero-based bounds; an end of -1 means open-ended.
+type a1Range struct {
+	tab      string
+	startRow int
+	endRow   int
+	startCol int
+	endCol   int
+}
+
+// ServiceAccountKey returns a freshly generated service account JSON key whose
+// token_uri points at baseURL+TokenPath, for use with sheets.NewAPIClient
+// against the fake.
+func ServiceAccountKey(baseURL string) ([]byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	return json.MarshalIndent(map[string]string{
+		"type":           "service_account",
+		"project_id":     "fakesheet",
+		"private_key_id": "fakesheet",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "bot@fakesheet.iam.gserviceaccount.com",
+		"client_id":      "fakesheet",
+		"token_uri":      strings.TrimRight(baseURL, "/") + TokenPath,
+	}, "", "  ")
+}
+
+// handleToken issues a bearer token for any JWT assertion
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"access_token": "fakesheet-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+// serveAPI implements the Sheets API v4 endpoints used by sheets.APIClient:
+// spreadsheets.get, values.get, values.append, values.batchUpdate and
+// spreadsheets.batchUpdate (deleteDimension only).
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeAPIError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Request is missing a bearer token")
+		return
+	}
+
+	// Strip the spreadsheet ID; any ID is accepted
+	rest := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	if i := strings.IndexAny(rest, "/:"); i >= 0 {
+		rest = rest[i:]
+	} else {
+		rest = ""
+	}
+
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		s.handleSpreadsheetGet(w)
+	case rest == ":batchUpdate" && r.Method == http.MethodPost:
+		s.handleSpreadsheetBatchUpdate(w, r)
+	case rest == "/values:batchUpdate" && r.Method == http.MethodPost:
+		s.handleValuesBatchUpdate(w, r)
+	case strings.HasPrefix(rest, "/values/") && strings.HasSuffix(rest, ":append") && r.Method == http.MethodPost:
+		s.handleValuesAppend(w, r, strings.TrimSuffix(strings.TrimPrefix(rest, "/values/"), ":append"))
+	case strings.HasPrefix(rest, "/values/") && r.Method == http.MethodGet:
+		s.handleValuesGet(w, strings.TrimPrefix(rest, "/values/"))
+	default:
+		writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "Unsupported endpoint: "+r.Method+" "+r.URL.Path)
+	}
+}
+
+// handleSpreadsheetGet returns the tab properties
+func (s *Server) handleSpreadsheetGet(w http.ResponseWriter) {
+	type properties struct {
+		SheetID int64  `json:"sheetId"`
+		Title   string `json:"title"`
+	}
+	type sheet struct {
+		Properties properties `json:"properties"`
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"sheets": []sheet{
+			{Properties: properties{SheetID: 0, Title: todoTab}},
+			{Properties: properties{SheetID: 1, Title: teamTab}},
+		},
+	})
+}
+
+// handleValuesGet returns the cells in the requested range
+func (s *Server) handleValuesGet(w http.ResponseWriter, rangeText string) {
+	rng, err := parseA1(rangeText)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, ok := s.tabs[rng.tab]
+	if !ok {
+		writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Unable to parse range: "+rangeText)
+		return
+	}
+
+	values := [][]string{}
+	for i, row := range rows {
+		if i < rng.startRow || (rng.endRow >= 0 && i > rng.endRow) {
+			continue
+		}
+
+		var cells []string
+		for j, cell := range row {
+			if j < rng.startCol || (rng.endCol >= 0 && j > rng.endCol) {
+				continue
+			}
+			cells = append(cells, cell)
+		}
+		values = append(values, cells)
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"range":          rangeText,
+		"majorDimension": "ROWS",
+		"values":         values,
+	})
+}
+
+// handleValuesAppend appends rows after the last row of the tab
+func (s *Server) handleValuesAppend(w http.ResponseWriter, r *http.Request, rangeText string) {
+	rng, err := parseA1(rangeText)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	var body struct {
+		Values [][]interface{} `json:"values"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tabs[rng.tab]; !ok {
+		writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Unable to parse range: "+rangeText)
+		return
+	}
+
+	for _, row := range body.Values {
+		s.tabs[rng.tab] = append(s.tabs[rng.tab], stringCells(row))
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"updates": map[string]interface{}{
+			"updatedRange": rangeText,
+			"updatedRows":  len(body.Values),
+		},
+	})
+}
+
+// handleValuesBatchUpdate writes every range in one locked step, so the update
+// is atomic from the point of view of other requests
+func (s *Server) handleValuesBatchUpdate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Data []struct {
+			Range  string          `json:"range"`
+			Values [][]interface{} `json:"values"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := 0
+	for _, data := range body.Data {
+		rng, err := parseA1(data.Range)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+			return
+		}
+
+		for i, values := range data.Values {
+			rowIndex := rng.startRow + i
+			for len(s.tabs[rng.tab]) <= rowIndex {
+				s.tabs[rng.tab] = append(s.tabs[rng.tab], nil)
+			}
+
+			row := s.tabs[rng.tab][rowIndex]
+			for j, cell := range stringCells(values) {
+				colIndex := rng.startCol + j
+				for len(row) <= colIndex {
+					row = append(row, "")
+				}
+				row[colIndex] = cell
+			}
+			s.tabs[rng.tab][rowIndex] = row
+			updated++
+		}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"totalUpdatedRows": updated,
+	})
+}
+
+// handleSpreadsheetBatchUpdate supports deleteDimension requests on rows
+func (s *Server) handleSpreadsheetBatchUpdate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Requests []struct {
+			DeleteDimension *struct {
+				Range struct {
+					SheetID    int64  `json:"sheetId"`
+					Dimension  string `json:"dimension"`
+					StartIndex int    `json:"startIndex"`
+					EndIndex   int    `json:"endIndex"`
+				} `json:"range"`
+			} `json:"deleteDimension"`
+		} `json:"requests"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, req := range body.Requests {
+		if req.DeleteDimension == nil || req.DeleteDimension.Range.Dimension != "ROWS" {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Only deleteDimension on ROWS is supported")
+			return
+		}
+
+		rng := req.DeleteDimension.Range
+		tab := todoTab
+		if rng.SheetID == 1 {
+			tab = teamTab
+		}
+
+		rows := s.tabs[tab]
+		if rng.StartIndex < 0 || rng.EndIndex > len(rows) || rng.StartIndex >= rng.EndIndex {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Row range out of bounds")
+			return
+		}
+		s.tabs[tab] = append(rows[:rng.StartIndex], rows[rng.EndIndex:]...)
+	}
+
+	writeJSON(w, map[string]interface{}{"replies": []interface{}{}})
+}
+
+// parseA1 parses ranges such as "todo", "todo!1:1", "todo!A5:I5" and "todo!I:I"
+func parseA1(text string) (a1Range, error) {
+	tab, cells, _ := strings.Cut(text, "!")
+	rng := a1Range{tab: strings.Trim(tab, "'"), endRow: -1, endCol: -1}
+	if cells == "" {
+		return rng, nil
+	}
+
+	m := a1Regex.FindStringSubmatch(cells)
+	if m == nil {
+		return rng, fmt.Errorf("unable to parse range: %s", text)
+	}
+
+	if m[1] != "" {
+		rng.startCol = columnIndex(m[1])
+	}
+	if m[2] != "" {
+		n, _ := strconv.Atoi(m[2])
+		rng.startRow = n - 1
+	}
+
+	if !strings.Contains(cells, ":") {
+		// A single cell, or a whole row/column written without a colon
+		if m[1] != "" && m[2] != "" {
+			rng.endRow, rng.endCol = rng.startRow, rng.startCol
+		}
+		return rng, nil
+	}
+
+	if m[3] != "" {
+		rng.endCol = columnIndex(m[3])
+	}
+	if m[4] != "" {
+		n, _ := strconv.Atoi(m[4])
+		rng.endRow = n - 1
+	}
+	return rng, nil
+}
+
+// columnIndex converts A1 column letters to a zero-based index
+func columnIndex(letters string) int {
+	index := 0
+	for _, r := range letters {
+		index = index*26 + int(r-'A'+1)
+	}
+	return index - 1
+}
+
+// stringCells converts JSON cell values to strings
+func stringCells(values []interface{}) []string {
+	cells := make([]string, len(values))
+	for i, v := range values {
+		if v != nil {
+			cells[i] = fmt.Sprint(v)
+		}
+	}
+	return cells
+}
+
+// writeAPIError writes a Google API error body with the given HTTP status
+func writeAPIError(w http.ResponseWriter, code int, status, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"status":  status,
+		},
+	})
+}
@@ -0,0 +1,352 @@
+// Package fakesheet provides an in-memory stand-in for the Google Apps Script
+// webhook in scripts/deploy_webhook.gs. It speaks the same JSON protocol, so it
+// can back sheets.Client in tests (via httptest) and in local development.
+// The same data is also exposed through the subset of the Sheets API v4 used
+// by sheets.APIClient.
+package fakesheet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/sheets"
+)
+
+const (
+	todoTab = "todo"
+	teamTab = "team"
+)
+
+// todoHeaders mirrors the header row written by initializeSheets
+var todoHeaders = []string{"Timestamp", "People", "Client", "Summary", "FullMessage", "Status", "DueDate", "BotNotes", "ID"}
+
+// teamHeaders mirrors the team tab header row
+var teamHeaders = []string{"Name", "Email"}
+
+// Server is an in-memory implementation of the Apps Script webhook
+type Server struct {
+	mu     sync.Mutex
+	tabs   map[string][][]string
+	schema sheets.Schema // how Tasks reads the todo tab
+	now    func() time.Time
+}
+
+// request is the union of all action payloads accepted by the webhook
+type request struct {
+	Action  string            `json:"action"`
+	Columns sheets.Schema     `json:"columns"`
+	Tasks   []sheets.TaskRow  `json:"tasks"`
+	Status  string            `json:"status"`
+	ID      string            `json:"id"`
+	Updates sheets.TaskUpdate `json:"updates"`
+}
+
+// errorResponse mirrors createErrorResponse in the Apps Script
+type errorResponse struct {
+	Status    string `json:"status"`
+	Error     string `json:"error"`
+	Message   string `json:"message"`
+	ErrorType string `json:"errorType"`
+	Timestamp string `json:"timestamp"`
+}
+
+// NewServer creates a fake webhook with an empty todo tab and the given team
+func NewServer(team []sheets.TeamMember) *Server {
+	s := &Server{
+		tabs: map[string][][]string{
+			todoTab: {append([]string(nil), todoHeaders...)},
+			teamTab: {append([]string(nil), teamHeaders...)},
+		},
+		schema: sheets.DefaultSchema,
+		now:    time.Now,
+	}
+
+	for _, member := range team {
+		s.tabs[teamTab] = append(s.tabs[teamTab], []string{member.Name, member.Email})
+	}
+
+	return s
+}
+
+// SetTodoHeader replaces the todo tab with an empty tab using the given header
+// row, for exercising custom column layouts. Tasks reads the tab with schema.
+func (s *Server) SetTodoHeader(header []string, schema sheets.Schema) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tabs[todoTab] = [][]string{append([]string(nil), header...)}
+	s.schema = schema
+}
+
+// ServeHTTP implements http.Handler. Requests under /v4/spreadsheets/ and
+// TokenPath are served as the Sheets API; everything else mirrors the Apps
+// Script doGet and doPost.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == TokenPath:
+		s.handleToken(w, r)
+		return
+	case strings.HasPrefix(r.URL.Path, apiPrefix):
+		s.serveAPI(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("Script is reachable via GET. Hello from doGet!"))
+	case http.MethodPost:
+		s.handlePost(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Tasks returns a snapshot of the rows in the todo tab
+func (s *Server) Tasks() []sheets.TaskRow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	header := s.tabs[todoTab][0]
+	tasks := []sheets.TaskRow{}
+	for _, row := range s.tabs[todoTab][1:] {
+		tasks = append(tasks, s.schema.Decode(row, header))
+	}
+	return tasks
+}
+
+// handlePost dispatches a webhook request to the matching action
+func (s *Server) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, "Failed to read request body: "+err.Error(), "Error")
+		return
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		writeError(w, "No request data found", "NO_DATA")
+		return
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, "Unable to parse request data as JSON: "+err.Error(), "Error")
+		return
+	}
+
+	if req.Action == "" {
+		writeError(w, "No action specified", "MISSING_ACTION")
+		return
+	}
+
+	log.Debug().Str("action", req.Action).Msg("Fake sheet received request")
+
+	if req.Action == "get_team" {
+		s.handleGetTeam(w)
+		return
+	}
+
+	// Task actions need the column schema to match the todo header
+	schema := req.Columns
+	if len(schema) == 0 {
+		schema = sheets.DefaultSchema
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	header := s.tabs[todoTab][0]
+	if err := schema.Validate(header); err != nil {
+		writeError(w, err.Error(), "HEADER_MISMATCH")
+		return
+	}
+
+	switch req.Action {
+	case "add_tasks":
+		s.handleAddTasks(w, schema, header, req.Tasks)
+	case "get_tasks":
+		s.handleGetTasks(w, schema, header, req.Status)
+	case "update_task":
+		s.handleUpdateTask(w, schema, header, req.ID, req.Updates)
+	case "delete_task":
+		s.handleDeleteTask(w, schema, header, req.ID)
+	default:
+		writeError(w, "Unknown action: "+req.Action, "UNKNOWN_ACTION")
+	}
+}
+
+// handleAddTasks appends rows the same way handleAddTasks does in the Apps
+// Script. The caller must hold s.mu.
+func (s *Server) handleAddTasks(w http.ResponseWriter, schema sheets.Schema, header []string, tasks []sheets.TaskRow) {
+	for _, task := range tasks {
+		task.Timestamp = s.now().UTC().Format(time.RFC3339)
+		task.Status = "Not Started"
+		if task.Client == "" {
+			task.Client = "unclear"
+		}
+		if task.ID == "" {
+			task.ID = uuid.New().String()
+		}
+
+		s.tabs[todoTab] = append(s.tabs[todoTab], schema.Encode(task, header, nil))
+	}
+
+	writeJSON(w, sheets.AddTasksResponse{
+		Status:    "success",
+		RowsAdded: len(tasks),
+		Message:   fmt.Sprintf("Added %d task(s)", len(tasks)),
+	})
+}
+
+// handleGetTeam returns every team row that has both a name and an email
+func (s *Server) handleGetTeam(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team := []sheets.TeamMember{}
+	for _, row := range s.tabs[teamTab][1:] {
+		if len(row) < 2 || row[0] == "" || row[1] == "" {
+			continue
+		}
+		team = append(team, sheets.TeamMember{
+			Name:  strings.ToLower(strings.TrimSpace(row[0])),
+			Email: strings.TrimSpace(row[1]),
+		})
+	}
+
+	writeJSON(w, sheets.GetTeamResponse{
+		Status: "success",
+		Team:   team,
+	})
+}
+
+// handleGetTasks returns the todo rows, skipping those whose status equals
+// statusFilter, which matches the Apps Script behaviour. The caller must hold
+// s.mu.
+func (s *Server) handleGetTasks(w http.ResponseWriter, schema sheets.Schema, header []string, statusFilter string) {
+	tasks := []sheets.TaskRow{}
+	for _, row := range s.tabs[todoTab][1:] {
+		task := schema.Decode(row, header)
+		if statusFilter != "" && task.Status == statusFilter {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+
+	writeJSON(w, sheets.GetTasksResponse{
+		Status: "success",
+		Tasks:  tasks,
+	})
+}
+
+// handleUpdateTask changes the given fields on the row with the given ID. The
+// caller must hold s.mu.
+func (s *Server) handleUpdateTask(w http.ResponseWriter, schema sheets.Schema, header []string, id string, update sheets.TaskUpdate) {
+	index := s.findRow(schema, header, id)
+	if index < 0 {
+		writeError(w, "Task not found: "+id, "NOT_FOUND")
+		return
+	}
+
+	existing := s.tabs[todoTab][index]
+	task := schema.Decode(existing, header)
+
+	if update.People != nil {
+		task.People = update.People
+	}
+	if update.Client != nil {
+		task.Client = *update.Client
+	}
+	if update.Summary != nil {
+		task.Summary = *update.Summary
+	}
+	if update.Status != nil {
+		task.Status = *update.Status
+	}
+	if update.DueDate != nil {
+		task.DueDate = *update.DueDate
+	}
+	if update.BotNotes != nil {
+		task.BotNotes = *update.BotNotes
+	}
+	if update.BlockedBy != nil {
+		task.BlockedBy = *update.BlockedBy
+	}
+	if update.Recurrence != nil {
+		task.Recurrence = *update.Recurrence
+	}
+	for field, value := range update.Fields {
+		if task.Fields == nil {
+			task.Fields = make(map[string]string)
+		}
+		task.Fields[field] = value
+	}
+
+	row := schema.Encode(task, header, existing)
+	s.tabs[todoTab][index] = row
+
+	writeJSON(w, sheets.UpdateTaskResponse{
+		Status: "success",
+		Task:   schema.Decode(row, header),
+	})
+}
+
+// handleDeleteTask removes the row with the given ID. The caller must hold s.mu.
+func (s *Server) handleDeleteTask(w http.ResponseWriter, schema sheets.Schema, header []string, id string) {
+	index := s.findRow(schema, header, id)
+	if index < 0 {
+		writeError(w, "Task not found: "+id, "NOT_FOUND")
+		return
+	}
+
+	rows := s.tabs[todoTab]
+	s.tabs[todoTab] = append(rows[:index], rows[index+1:]...)
+
+	writeJSON(w, sheets.DeleteTaskResponse{
+		Status:  "success",
+		Message: "Deleted task " + id,
+	})
+}
+
+// findRow returns the index in the todo tab of the row with the given ID, or
+// -1. The caller must hold s.mu.
+func (s *Server) findRow(schema sheets.Schema, header []string, id string) int {
+	if id == "" {
+		return -1
+	}
+	for i, row := range s.tabs[todoTab] {
+		if i > 0 && schema.Decode(row, header).ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeError writes the Apps Script error envelope. Like ContentService, it
+// always answers with HTTP 200 and signals failure through the status field.
+func writeError(w http.ResponseWriter, message, errorType string) {
+	log.Debug().Str("error_type", errorType).Str("error", message).Msg("Fake sheet returning error")
+
+	writeJSON(w, errorResponse{
+		Status:    "error",
+		Error:     message,
+		Message:   message,
+		ErrorType: errorType,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// writeJSON writes v as a JSON response body
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Msg("Failed to encode fake sheet response")
+	}
+}
@@ -0,0 +1,55 @@
+package health
+
+import (
+	"os"
+	"runtime/debug"
+)
+
+// Build metadata, set at link time with
+// -ldflags "-X github.com/giovannigabriele/go-todo-bot/internal/health.Version=..."
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Build returns the build metadata. When the commit was not set at link time
+// it falls back to the VCS stamp in the binary, then to Render's
+// RENDER_GIT_COMMIT.
+func Build() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.GoVersion = bi.GoVersion
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = os.Getenv("RENDER_GIT_COMMIT")
+	}
+
+	return info
+}
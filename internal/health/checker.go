@@ -0,0 +1,172 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CheckFunc checks a dependency. It returns details to include in the
+// readiness report and an error if the dependency is not usable.
+type CheckFunc func(ctx context.Context) (map[string]interface{}, error)
+
+// Result is the outcome of a single check
+type Result struct {
+	Status     string                 `json:"status"`
+	Error      string                 `json:"error,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	CheckedAt  time.Time              `json:"checkedAt"`
+	DurationMS int64                  `json:"durationMs"`
+}
+
+// ReadyResponse is the body of the readiness endpoint
+type ReadyResponse struct {
+	Status    string            `json:"status"`
+	Uptime    time.Duration     `json:"uptime"`
+	Timestamp time.Time         `json:"timestamp"`
+	Build     BuildInfo         `json:"build"`
+	Checks    map[string]Result `json:"checks"`
+}
+
+// Checker runs the registered readiness checks. Results are cached for ttl so
+// frequent probes do not hammer dependencies, and each run is bounded by
+// timeout.
+type Checker struct {
+	timeout time.Duration
+	ttl     time.Duration
+	mu      sync.Mutex
+	checks  []*check
+}
+
+// check is a registered check with its cached result
+type check struct {
+	name    string
+	fn      CheckFunc
+	mu      sync.Mutex
+	result  Result
+	expires time.Time
+}
+
+// NewChecker creates a checker with the given per-check timeout and cache TTL
+func NewChecker(timeout, ttl time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+		ttl:     ttl,
+	}
+}
+
+// Register adds a named check
+func (c *Checker) Register(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, &check{name: name, fn: fn})
+}
+
+// Run runs every check concurrently, reusing cached results that have not
+// expired. It reports whether all checks passed.
+func (c *Checker) Run(ctx context.Context) (bool, map[string]Result) {
+	c.mu.Lock()
+	checks := append([]*check(nil), c.checks...)
+	c.mu.Unlock()
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].name < checks[j].name })
+
+	results := make(map[string]Result, len(checks))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, chk := range checks {
+		wg.Add(1)
+		go func(chk *check) {
+			defer wg.Done()
+			result := c.runCheck(ctx, chk)
+
+			resultsMu.Lock()
+			results[chk.name] = result
+			resultsMu.Unlock()
+		}(chk)
+	}
+	wg.Wait()
+
+	ok := true
+	for _, result := range results {
+		if result.Status != "ok" {
+			ok = false
+		}
+	}
+	return ok, results
+}
+
+// runCheck returns the cached result of chk, refreshing it if it has expired.
+// Concurrent probes share one refresh.
+func (c *Checker) runCheck(ctx context.Context, chk *check) Result {
+	chk.mu.Lock()
+	defer chk.mu.Unlock()
+
+	if time.Now().Before(chk.expires) {
+		return chk.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	type outcome struct {
+		details map[string]interface{}
+		err     error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		details, err := chk.fn(ctx)
+		done <- outcome{details, err}
+	}()
+
+	var out outcome
+	select {
+	case out = <-done:
+	case <-ctx.Done():
+		out.err = ctx.Err()
+	}
+
+	result := Result{
+		Status:     "ok",
+		Details:    out.details,
+		CheckedAt:  start.UTC(),
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if out.err != nil {
+		result.Status = "fail"
+		result.Error = out.err.Error()
+	}
+
+	chk.result = result
+	chk.expires = time.Now().Add(c.ttl)
+	return result
+}
+
+// ReadyHandler returns an HTTP handler for the readiness endpoint. It answers
+// 200 when every check passes and 503 otherwise.
+func (c *Checker) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, results := c.Run(r.Context())
+
+		response := ReadyResponse{
+			Status:    "ok",
+			Uptime:    time.Since(startTime).Round(time.Second),
+			Timestamp: time.Now(),
+			Build:     Build(),
+			Checks:    results,
+		}
+
+		code := http.StatusOK
+		if !ok {
+			response.Status = "fail"
+			code = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, code, response)
+	}
+}
@@ -0,0 +1,112 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Components whose calls are tracked for readiness
+const (
+	ComponentTelegram = "telegram"
+	ComponentLLM      = "llm"
+	ComponentSheets   = "sheets"
+)
+
+// CallStatus records the outcome of the most recent calls to a component
+type CallStatus struct {
+	LastSuccess time.Time
+	LastFailure time.Time
+	LastError   string
+}
+
+var (
+	callsMu sync.Mutex
+	calls   = make(map[string]CallStatus)
+)
+
+// RecordSuccess notes a successful call to component
+func RecordSuccess(component string) {
+	callsMu.Lock()
+	defer callsMu.Unlock()
+
+	status := calls[component]
+	status.LastSuccess = time.Now()
+	calls[component] = status
+}
+
+// RecordFailure notes a failed call to component
+func RecordFailure(component string, err error) {
+	callsMu.Lock()
+	defer callsMu.Unlock()
+
+	status := calls[component]
+	status.LastFailure = time.Now()
+	status.LastError = err.Error()
+	calls[component] = status
+}
+
+// Calls returns the recorded call status of component
+func Calls(component string) CallStatus {
+	callsMu.Lock()
+	defer callsMu.Unlock()
+
+	return calls[component]
+}
+
+// RecentSuccess returns a check that fails when component has not had a
+// successful call within maxAge. The process start counts as a success, so a
+// freshly started bot gets maxAge to make its first call.
+func RecentSuccess(component string, maxAge time.Duration) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		status := Calls(component)
+		details := callDetails(status)
+
+		last := status.LastSuccess
+		if last.IsZero() {
+			last = startTime
+		}
+		if age := time.Since(last); age > maxAge {
+			return details, fmt.Errorf("no successful %s call for %s", component, age.Round(time.Second))
+		}
+		return details, nil
+	}
+}
+
+// LastCallSucceeded returns a check that fails when the most recent call to
+// component failed. Components that are only called on demand (the LLM, the
+// sheet) are not expected to be called regularly, so age alone is not a
+// failure. If probe is not nil it is run after a failure, so the check can
+// recover without waiting for real traffic; probe should record its own
+// outcome.
+func LastCallSucceeded(component string, probe func(ctx context.Context) error) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		status := Calls(component)
+		if status.LastFailure.After(status.LastSuccess) && probe != nil {
+			if err := probe(ctx); err == nil {
+				status = Calls(component)
+			}
+		}
+
+		details := callDetails(status)
+		if status.LastFailure.After(status.LastSuccess) {
+			return details, fmt.Errorf("last %s call failed: %s", component, status.LastError)
+		}
+		return details, nil
+	}
+}
+
+// callDetails reports a call status in check details
+func callDetails(status CallStatus) map[string]interface{} {
+	details := make(map[string]interface{})
+	if !status.LastSuccess.IsZero() {
+		details["lastSuccess"] = status.LastSuccess.UTC().Format(time.RFC3339)
+		details["lastSuccessAgeSeconds"] = int(time.Since(status.LastSuccess).Seconds())
+	}
+	if !status.LastFailure.IsZero() {
+		details["lastFailure"] = status.LastFailure.UTC().Format(time.RFC3339)
+		details["lastError"] = status.LastError
+	}
+	return details
+}
@@ -1,3 +1,7 @@
+// Package health serves the liveness (/healthz) and readiness (/readyz)
+// endpoints. Readiness runs registered dependency checks, each cached and
+// bounded by a timeout, and also reports when the bot last talked to
+// Telegram, the LLM and the task sheet successfully.
 package health
 
 import (
@@ -14,22 +18,34 @@ type HealthResponse struct {
 	Status    string        `json:"status"`
 	Uptime    time.Duration `json:"uptime"`
 	Timestamp time.Time     `json:"timestamp"`
+	Build     BuildInfo     `json:"build"`
 }
 
-// Handler returns an HTTP handler for the health check endpoint
+// Handler returns an HTTP handler for the liveness endpoint. It only reports
+// that the process is up; dependency checks live in Checker.ReadyHandler.
 func Handler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		response := HealthResponse{
 			Status:    "ok",
 			Uptime:    time.Since(startTime).Round(time.Second),
 			Timestamp: time.Now(),
+			Build:     Build(),
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Error().Err(err).Msg("Failed to encode health check response")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		writeJSON(w, http.StatusOK, response)
 	}
 }
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode health check response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
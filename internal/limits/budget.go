@@ -0,0 +1,73 @@
+package limits
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/llm"
+)
+
+var (
+	// ErrDailyCap is returned when the daily LLM spend cap has been reached
+	ErrDailyCap = fmt.Errorf("daily %w", llm.ErrBudgetExceeded)
+	// ErrMonthlyCap is returned when the monthly LLM spend cap has been reached
+	ErrMonthlyCap = fmt.Errorf("monthly %w", llm.ErrBudgetExceeded)
+)
+
+// SpendSource reports the LLM spend so far today and this month
+type SpendSource interface {
+	Spent(ctx context.Context) (day, month float64, err error)
+}
+
+// Budget enforces daily and monthly caps on LLM spend. Concurrent calls may
+// overshoot a cap by the cost of the calls already in flight when it is
+// reached.
+type Budget struct {
+	spend SpendSource
+
+	mu      sync.RWMutex
+	daily   float64
+	monthly float64
+}
+
+// NewBudget creates a budget with caps in US dollars over the spend reported
+// by spend. A cap of zero disables it.
+func NewBudget(spend SpendSource, daily, monthly float64) *Budget {
+	return &Budget{spend: spend, daily: daily, monthly: monthly}
+}
+
+// SetCaps changes the daily and monthly caps. A cap of zero disables it.
+func (b *Budget) SetCaps(daily, monthly float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.daily, b.monthly = daily, monthly
+}
+
+// Check returns ErrDailyCap or ErrMonthlyCap, wrapped with the amounts, when
+// a cap has been reached
+func (b *Budget) Check(ctx context.Context) error {
+	b.mu.RLock()
+	daily, monthly := b.daily, b.monthly
+	b.mu.RUnlock()
+	if daily <= 0 && monthly <= 0 {
+		return nil
+	}
+
+	day, month, err := b.spend.Spent(ctx)
+	if err != nil {
+		// Don't stop parsing because the ledger is unreadable
+		log.Error().Err(err).Msg("Failed to read LLM spend, skipping cap check")
+		return nil
+	}
+
+	if daily > 0 && day >= daily {
+		return fmt.Errorf("%w: $%.2f spent of $%.2f", ErrDailyCap, day, daily)
+	}
+	if monthly > 0 && month >= monthly {
+		return fmt.Errorf("%w: $%.2f spent of $%.2f", ErrMonthlyCap, month, monthly)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package limits
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/llm"
+)
+
+// fixedSpend reports the same spend on every call
+type fixedSpend struct {
+	day, month float64
+	err        error
+	calls      int
+}
+
+func (s *fixedSpend) Spent(ctx context.Context) (float64, float64, error) {
+	s.calls++
+	return s.day, s.month, s.err
+}
+
+func TestBudgetCheck(t *testing.T) {
+	tests := []struct {
+		name           string
+		day, month     float64
+		daily, monthly float64
+		want           error
+		message        string
+	}{
+		{"below both caps", 0.99, 9.99, 1, 10, nil, ""},
+		{"at the daily cap", 1, 5, 1, 10, ErrDailyCap, "daily LLM spend cap reached: $1.00 spent of $1.00"},
+		{"above the daily cap", 1.5, 5, 1, 10, ErrDailyCap, "daily LLM spend cap reached: $1.50 spent of $1.00"},
+		{"at the monthly cap", 0.5, 10, 1, 10, ErrMonthlyCap, "monthly LLM spend cap reached: $10.00 spent of $10.00"},
+		{"daily cap checked first", 2, 20, 1, 10, ErrDailyCap, "daily LLM spend cap reached: $2.00 spent of $1.00"},
+		{"daily cap disabled", 5, 5, 0, 10, nil, ""},
+		{"monthly cap disabled", 0.5, 50, 1, 0, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spend := &fixedSpend{day: tt.day, month: tt.month}
+			err := NewBudget(spend, tt.daily, tt.monthly).Check(context.Background())
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Check: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) || !errors.Is(err, llm.ErrBudgetExceeded) {
+				t.Fatalf("Check = %v, want %v", err, tt.want)
+			}
+			if err.Error() != tt.message {
+				t.Errorf("Check = %q, want %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestBudgetWithoutCapsSkipsLedger(t *testing.T) {
+	spend := &fixedSpend{day: 100, month: 100}
+	b := NewBudget(spend, 0, 0)
+	if err := b.Check(context.Background()); err != nil || spend.calls != 0 {
+		t.Fatalf("Check = %v after %d ledger reads, want nil after none", err, spend.calls)
+	}
+
+	b.SetCaps(50, 0)
+	if err := b.Check(context.Background()); !errors.Is(err, ErrDailyCap) {
+		t.Errorf("Check after SetCaps = %v, want ErrDailyCap", err)
+	}
+}
+
+func TestBudgetAllowsWhenLedgerFails(t *testing.T) {
+	spend := &fixedSpend{day: 100, err: errors.New("database is locked")}
+	if err := NewBudget(spend, 1, 0).Check(context.Background()); err != nil {
+		t.Errorf("Check = %v, want nil when the spend can't be read", err)
+	}
+}
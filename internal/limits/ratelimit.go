@@ -0,0 +1,130 @@
+// Package limits keeps chatty users and runaway spend in check: token
+// buckets for incoming messages and daily and monthly caps on LLM spend.
+package limits
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// idleBucket is how long an unused bucket is kept. A bucket idle this long
+// has refilled, so dropping it loses nothing.
+const idleBucket = time.Hour
+
+// KeyedLimiter keeps a token bucket per key, such as a user or chat ID
+type KeyedLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	buckets   map[int64]*bucket
+	lastPrune time.Time
+}
+
+// bucket is one key's token bucket and when it was last used
+type bucket struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// NewKeyedLimiter creates a limiter allowing perMinute messages per key on
+// average, in bursts of up to burst. A perMinute of zero or less disables it.
+func NewKeyedLimiter(perMinute float64, burst int) *KeyedLimiter {
+	l := &KeyedLimiter{
+		buckets:   make(map[int64]*bucket),
+		lastPrune: time.Now(),
+	}
+	l.SetRate(perMinute, burst)
+	return l
+}
+
+// SetRate changes the rate and burst, keeping the tokens each key has left
+func (l *KeyedLimiter) SetRate(perMinute float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	limit := rate.Inf
+	if perMinute > 0 {
+		limit = rate.Limit(perMinute / 60)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit, l.burst = limit, burst
+	now := time.Now()
+	for _, b := range l.buckets {
+		b.limiter.SetLimitAt(now, limit)
+		b.limiter.SetBurstAt(now, burst)
+	}
+}
+
+// Allow takes a token from key's bucket, reporting whether one was available
+func (l *KeyedLimiter) Allow(key int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit == rate.Inf {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(l.lastPrune) > idleBucket {
+		for k, b := range l.buckets {
+			if now.Sub(b.seen) > idleBucket {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.seen = now
+	return b.limiter.AllowN(now, 1)
+}
+
+var (
+	// ErrUserRate is returned when a user sends messages faster than allowed
+	ErrUserRate = errors.New("user rate limit reached")
+	// ErrChatRate is returned when a chat sends messages faster than allowed
+	ErrChatRate = errors.New("chat rate limit reached")
+)
+
+// MessageLimiter applies the per-user and per-chat limits to incoming
+// messages
+type MessageLimiter struct {
+	users *KeyedLimiter
+	chats *KeyedLimiter
+}
+
+// NewMessageLimiter creates a limiter with the given per-minute rates and
+// bursts for users and chats
+func NewMessageLimiter(userPerMinute float64, userBurst int, chatPerMinute float64, chatBurst int) *MessageLimiter {
+	return &MessageLimiter{
+		users: NewKeyedLimiter(userPerMinute, userBurst),
+		chats: NewKeyedLimiter(chatPerMinute, chatBurst),
+	}
+}
+
+// SetRates changes the per-minute rates and bursts for users and chats
+func (l *MessageLimiter) SetRates(userPerMinute float64, userBurst int, chatPerMinute float64, chatBurst int) {
+	l.users.SetRate(userPerMinute, userBurst)
+	l.chats.SetRate(chatPerMinute, chatBurst)
+}
+
+// Allow takes a token for the user and for the chat, returning ErrUserRate
+// or ErrChatRate when either is out of tokens
+func (l *MessageLimiter) Allow(userID, chatID int64) error {
+	if !l.users.Allow(userID) {
+		return ErrUserRate
+	}
+	if !l.chats.Allow(chatID) {
+		return ErrChatRate
+	}
+	return nil
+}
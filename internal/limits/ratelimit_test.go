@@ -0,0 +1,88 @@
+package limits
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKeyedLimiter(t *testing.T) {
+	tests := []struct {
+		name      string
+		perMinute float64
+		burst     int
+		allowed   int // messages let through out of 10 from one key
+	}{
+		{"burst of three", 1, 3, 3},
+		{"burst below one counts as one", 1, 0, 1},
+		{"zero rate is unlimited", 0, 1, 10},
+		{"negative rate is unlimited", -5, 1, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewKeyedLimiter(tt.perMinute, tt.burst)
+			allowed := 0
+			for i := 0; i < 10; i++ {
+				if l.Allow(1) {
+					allowed++
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("allowed %d of 10, want %d", allowed, tt.allowed)
+			}
+			if !l.Allow(2) {
+				t.Error("another key was refused")
+			}
+		})
+	}
+}
+
+func TestKeyedLimiterSetRate(t *testing.T) {
+	l := NewKeyedLimiter(1, 1)
+	if !l.Allow(1) || l.Allow(1) {
+		t.Fatal("want one message through, then a refusal")
+	}
+
+	// A bigger burst doesn't refill a bucket that is already empty
+	l.SetRate(1, 3)
+	if l.Allow(1) {
+		t.Error("allowed with no tokens left after the burst was raised")
+	}
+	for i := 0; i < 3; i++ {
+		if !l.Allow(2) {
+			t.Fatalf("new key refused message %d of its burst of 3", i+1)
+		}
+	}
+
+	l.SetRate(0, 1)
+	if !l.Allow(1) {
+		t.Error("refused after the limit was disabled")
+	}
+}
+
+func TestMessageLimiter(t *testing.T) {
+	const user, otherUser, thirdUser, chat, otherChat = 1, 2, 3, -100, -200
+	l := NewMessageLimiter(1, 2, 1, 3)
+
+	steps := []struct {
+		userID, chatID int64
+		want           error
+	}{
+		{user, chat, nil},
+		{user, chat, nil},
+		{user, chat, ErrUserRate},
+		{otherUser, chat, nil},
+		{otherUser, chat, ErrChatRate},
+		{thirdUser, otherChat, nil},
+	}
+	for i, step := range steps {
+		if err := l.Allow(step.userID, step.chatID); !errors.Is(err, step.want) {
+			t.Fatalf("message %d from user %d in chat %d: %v, want %v", i+1, step.userID, step.chatID, err, step.want)
+		}
+	}
+
+	l.SetRates(0, 1, 0, 1)
+	if err := l.Allow(user, chat); err != nil {
+		t.Errorf("after disabling the limits: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+)
+
+// breakers holds a circuit breaker per model at each provider, so one model's
+// failures don't take the provider's other models out of the chain. A breaker
+// opens after
+// threshold consecutive failures and rejects requests for cooldown. It then
+// lets a single trial request through: success closes it, failure opens it
+// again. A 429 pauses the model for its Retry-After without counting as a
+// failure.
+type breakers struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	states    map[circuit]*breakerState
+}
+
+// circuit identifies a breaker: a model at a provider
+type circuit struct {
+	provider string
+	model    string
+}
+
+// breakerState is one circuit's breaker
+type breakerState struct {
+	failures  int
+	openUntil time.Time
+	trial     bool // a half-open trial request is in flight
+}
+
+// newBreakers creates breakers that open after threshold failures for
+// cooldown
+func newBreakers(threshold int, cooldown time.Duration) *breakers {
+	return &breakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		states:    make(map[circuit]*breakerState),
+	}
+}
+
+// configure changes the threshold and cooldown
+func (b *breakers) configure(threshold int, cooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.threshold = threshold
+	b.cooldown = cooldown
+}
+
+// state returns c's breaker, creating it closed. Callers hold mu.
+func (b *breakers) state(c circuit) *breakerState {
+	s, ok := b.states[c]
+	if !ok {
+		s = &breakerState{}
+		b.states[c] = s
+	}
+	return s
+}
+
+// allow reports whether a request to c may be made now
+func (b *breakers) allow(c circuit) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.state(c)
+	if time.Now().Before(s.openUntil) {
+		return false
+	}
+	if s.failures >= b.threshold {
+		// Half-open: one trial at a time
+		if s.trial {
+			return false
+		}
+		s.trial = true
+	}
+	return true
+}
+
+// success closes c's breaker
+func (b *breakers) success(c circuit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.state(c)
+	if s.failures >= b.threshold {
+		log.Info().Str("provider", c.provider).Str("model", c.model).Msg("LLM model recovered, circuit closed")
+	}
+	s.failures = 0
+	s.trial = false
+	metrics.LLMCircuitOpen.WithLabelValues(c.provider, c.model).Set(0)
+}
+
+// failure counts a failed request, opening the breaker at the threshold
+func (b *breakers) failure(c circuit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.state(c)
+	s.failures++
+	s.trial = false
+	if s.failures >= b.threshold {
+		s.openUntil = time.Now().Add(b.cooldown)
+		metrics.LLMCircuitOpen.WithLabelValues(c.provider, c.model).Set(1)
+		log.Warn().
+			Str("provider", c.provider).
+			Str("model", c.model).
+			Int("failures", s.failures).
+			Dur("cooldown", b.cooldown).
+			Msg("LLM model failing, circuit open")
+	}
+}
+
+// pause keeps requests away from c for d, as asked by Retry-After
+func (b *breakers) pause(c circuit, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.state(c)
+	s.trial = false
+	if until := time.Now().Add(d); until.After(s.openUntil) {
+		s.openUntil = until
+	}
+}
+
+// release ends a request that neither succeeded nor failed, such as a hedged
+// request cancelled because another won
+func (b *breakers) release(c circuit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state(c).trial = false
+}
+
+// waitFor returns how long until c accepts requests again
+func (b *breakers) waitFor(c circuit) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Until(b.state(c).openUntil)
+}
@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAndHalfOpens(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	b := newBreakers(2, cooldown)
+	c := circuit{provider: "openrouter.ai", model: "openai/gpt-4o-mini"}
+
+	steps := []struct {
+		name   string
+		action func()
+		allow  bool
+	}{
+		{"closed", nil, true},
+		{"one failure", func() { b.failure(c) }, true},
+		{"threshold reached", func() { b.failure(c) }, false},
+		{"cooldown over", func() { time.Sleep(cooldown) }, true},
+		{"trial in flight", nil, false},
+		{"trial failed", func() { b.failure(c) }, false},
+		{"second cooldown over", func() { time.Sleep(cooldown) }, true},
+		{"trial succeeded", func() { b.success(c) }, true},
+		{"closed again", nil, true},
+		{"one failure after closing", func() { b.failure(c) }, true},
+	}
+	for _, step := range steps {
+		if step.action != nil {
+			step.action()
+		}
+		if got := b.allow(c); got != step.allow {
+			t.Fatalf("%s: allow = %v, want %v", step.name, got, step.allow)
+		}
+		if got := b.allow(circuit{provider: c.provider, model: "other"}); !got {
+			t.Fatalf("%s: another model at the provider was refused", step.name)
+		}
+	}
+}
+
+func TestBreakerPauseDoesNotCountAsFailure(t *testing.T) {
+	b := newBreakers(1, time.Hour)
+	c := circuit{provider: "openrouter.ai", model: "openai/gpt-4o-mini"}
+
+	b.pause(c, 10*time.Millisecond)
+	if b.allow(c) {
+		t.Fatal("paused circuit allowed a request")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if !b.allow(c) {
+		t.Fatal("circuit still closed to requests after the pause")
+	}
+	if !b.allow(c) {
+		t.Error("pause left the circuit half-open")
+	}
+}
+
+func TestFailingModelLeavesFallbackAtSameProvider(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request OpenRouterRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		mu.Lock()
+		requests[request.Model]++
+		mu.Unlock()
+
+		if request.Model == "retired-model" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenRouterResponse{
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: "{}"}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient("test-key")
+	client.SetBaseURL(server.URL)
+	client.SetModel("retired-model")
+	client.SetFallbacks([]Target{{Model: "fallback-model"}})
+	client.SetCircuitBreaker(3, time.Hour)
+
+	for i := 0; i < 5; i++ {
+		_, target, err := client.complete(context.Background(), []Message{{Role: "user", Content: "hi"}})
+		if err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+		if target.Model != "fallback-model" {
+			t.Fatalf("call %d served by %s, want the fallback", i+1, target.Model)
+		}
+	}
+	if requests["retired-model"] != 3 {
+		t.Errorf("failing model got %d requests, want 3 before its circuit opened", requests["retired-model"])
+	}
+	if requests["fallback-model"] != 5 {
+		t.Errorf("fallback got %d requests, want 5", requests["fallback-model"])
+	}
+}
@@ -1,24 +1,110 @@
 package llm
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/health"
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+	"github.com/giovannigabriele/go-todo-bot/internal/rrule"
+	"github.com/giovannigabriele/go-todo-bot/internal/tracing"
 )
 
+// ErrBudgetExceeded is returned, wrapped, when a spend cap stops an LLM call
+var ErrBudgetExceeded = errors.New("LLM spend cap reached")
+
+// ErrInvalidResponse is returned, wrapped, when the LLM's reply is not the
+// JSON asked for
+var ErrInvalidResponse = errors.New("LLM reply is not valid JSON")
+
+// Budget caps LLM spend. Check is called before each request.
+type Budget interface {
+	Check(ctx context.Context) error
+}
+
+// Call describes one completed LLM request for usage accounting
+type Call struct {
+	Time    time.Time
+	Model   string
+	ChatID  int64 // 0 when the message did not come from a chat
+	UserID  int64 // 0 when unknown
+	Usage   Usage // zero when the request failed
+	Latency time.Duration
+	Err     error
+}
+
+// Recorder receives every completed LLM request
+type Recorder interface {
+	Record(ctx context.Context, call Call)
+}
+
+// CacheKey identifies a parse: the message text, the prompt that parsed it
+// and the model asked
+type CacheKey struct {
+	Text          string
+	PromptVersion string
+	Model         string
+}
+
+// Cache stores parse results so repeated messages skip the LLM
+type Cache interface {
+	Get(ctx context.Context, key CacheKey) (*ParseResponse, bool)
+	Put(ctx context.Context, key CacheKey, resp *ParseResponse)
+}
+
+// ExampleSource supplies extra few-shot examples for a message, such as
+// corrections people made to earlier parses in the same chat
+type ExampleSource interface {
+	Examples(ctx context.Context, chatID int64, message string) []PromptExample
+}
+
+// callerKey is the context key for the chat and user a request is made for
+type callerKey struct{}
+
+// caller identifies who a request is made for
+type caller struct {
+	chatID, userID int64
+}
+
+// WithCaller returns a context whose LLM requests are accounted to chatID and
+// userID
+func WithCaller(ctx context.Context, chatID, userID int64) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller{chatID: chatID, userID: userID})
+}
+
 // Client handles LLM interactions
 type Client struct {
-	apiKey  string
-	baseURL string
-	model   string
-	client  *http.Client
+	apiKey       string
+	customFields []string
+	client       *http.Client
+	breakers     *breakers
+
+	mu         sync.RWMutex // guards the settings below, which can change on reload
+	baseURL    string
+	model      string
+	fallbacks  []Target
+	hedgeAfter time.Duration
+	prompt     *Prompt
+	chatTeams  map[int64]string
+
+	budget   Budget
+	recorder Recorder
+	cache    Cache
+	examples ExampleSource
+	slots    chan struct{} // limits concurrent requests when set
 }
 
 // Task represents a parsed task
@@ -28,18 +114,55 @@ type Task struct {
 	Summary    string   `json:"summary"`
 	DueDate    string   `json:"dueDate"`
 	Confidence float64  `json:"confidence"`
+
+	// Fields holds values for the custom sheet columns, keyed by field name
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// DependsOn is the index of an earlier task in the same response that
+	// must be done before this one can start, as in "Gemma to ask oxccu for
+	// the brief, then Lilly to draft it"
+	DependsOn *int `json:"dependsOn,omitempty"`
+
+	// Recurrence is the RRULE of a task that repeats, such as
+	// "FREQ=WEEKLY;BYDAY=MO" for "every Monday"
+	Recurrence string `json:"recurrence,omitempty"`
+
+	// Rejected lists people the model assigned who are neither named in the
+	// message nor on the team roster. They are removed from People.
+	Rejected []string `json:"-"`
 }
 
 // ParseResponse represents the LLM response
 type ParseResponse struct {
 	Tasks           []Task `json:"tasks"`
 	OriginalMessage string `json:"original_message"`
+
+	// Model is the model that produced the response, which may be a fallback
+	Model string `json:"-"`
+	// Cached is set when the response came from the parse cache
+	Cached bool `json:"-"`
+	// PromptVersion is the version of the prompt that produced the response
+	PromptVersion string `json:"-"`
+	// Corrections is the number of past corrections shown to the model as
+	// examples
+	Corrections int `json:"-"`
+}
+
+// modelOutput is the part of the model's reply that is used
+type modelOutput struct {
+	Tasks []Task `json:"tasks"`
 }
 
 // OpenRouterRequest represents the request to OpenRouter
 type OpenRouterRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model    string        `json:"model"`
+	Messages []Message     `json:"messages"`
+	Usage    *UsageRequest `json:"usage,omitempty"`
+}
+
+// UsageRequest asks OpenRouter to include token counts and cost in the response
+type UsageRequest struct {
+	Include bool `json:"include"`
 }
 
 // Message represents a chat message
@@ -51,6 +174,15 @@ type Message struct {
 // OpenRouterResponse represents the response from OpenRouter
 type OpenRouterResponse struct {
 	Choices []Choice `json:"choices"`
+	Usage   *Usage   `json:"usage,omitempty"`
+}
+
+// Usage is the token and cost accounting returned by OpenRouter
+type Usage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
 }
 
 // Choice represents a choice in the response
@@ -60,69 +192,223 @@ type Choice struct {
 
 // NewClient creates a new LLM client
 func NewClient(apiKey string) *Client {
+	prompt, err := LoadPrompt("", DefaultPromptVersion)
+	if err != nil {
+		panic(fmt.Sprintf("embedded prompt %s is invalid: %v", DefaultPromptVersion, err))
+	}
+
 	return &Client{
 		apiKey:  apiKey,
 		baseURL: "https://openrouter.ai/api/v1/chat/completions",
 		model:   "openai/gpt-4o-mini",
+		prompt:  prompt,
+		// Defaults match the llm section of the config
+		breakers: newBreakers(3, 30*time.Second),
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: tracing.Transport(nil),
 		},
 	}
 }
 
 // GetModel returns the current model being used
 func (c *Client) GetModel() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.model
 }
 
+// SetModel changes the model used for subsequent requests
+func (c *Client) SetModel(model string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.model = model
+}
+
+// SetBaseURL changes the chat completions endpoint
+func (c *Client) SetBaseURL(baseURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.baseURL = baseURL
+}
+
+// SetPrompt changes the prompt used for subsequent requests
+func (c *Client) SetPrompt(prompt *Prompt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prompt = prompt
+}
+
+// SetChatTeams maps chats to the teams whose few-shot examples their
+// messages are parsed with. Other chats get the default examples.
+func (c *Client) SetChatTeams(teams map[int64]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.chatTeams = teams
+}
+
+// PromptVersion returns the version of the current prompt
+func (c *Client) PromptVersion() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.prompt.Version
+}
+
+// promptFor returns the prompt and the team whose examples a request uses
+func (c *Client) promptFor(ctx context.Context) (*Prompt, string) {
+	who, _ := ctx.Value(callerKey{}).(caller)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	team, ok := c.chatTeams[who.chatID]
+	if !ok {
+		team = defaultTeam
+	}
+	return c.prompt, team
+}
+
+// SetCustomFields sets the extra sheet fields (such as priority or project)
+// the LLM should try to extract for each task
+func (c *Client) SetCustomFields(fields []string) {
+	c.customFields = fields
+}
+
+// SetBudget makes every request check budget first
+func (c *Client) SetBudget(budget Budget) {
+	c.budget = budget
+}
+
+// SetRecorder sends every completed request to recorder
+func (c *Client) SetRecorder(recorder Recorder) {
+	c.recorder = recorder
+}
+
+// SetCache reuses parses of previously seen messages from cache
+func (c *Client) SetCache(cache Cache) {
+	c.cache = cache
+}
+
+// SetExamples adds the examples source returns for each message to the
+// prompt's own
+func (c *Client) SetExamples(source ExampleSource) {
+	c.examples = source
+}
+
+// SetMaxConcurrency limits how many requests are in flight at once. Further
+// requests wait for a free slot. Zero or less removes the limit.
+func (c *Client) SetMaxConcurrency(n int) {
+	if n <= 0 {
+		c.slots = nil
+		return
+	}
+	c.slots = make(chan struct{}, n)
+}
+
+// acquire waits for a request slot, returning the function that frees it
+func (c *Client) acquire(ctx context.Context) (func(), error) {
+	if c.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		metrics.LLMWaiting.Inc()
+		defer metrics.LLMWaiting.Dec()
+		select {
+		case c.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to wait for an LLM slot: %w", ctx.Err())
+		}
+	}
+	return func() { <-c.slots }, nil
+}
+
 // ParseMessage parses a message using the LLM
 func (c *Client) ParseMessage(ctx context.Context, message string) (*ParseResponse, error) {
-	log.Debug().Str("message", message).Msg("Parsing message with LLM")
+	ctx, span := tracing.Start(ctx, "llm.ParseMessage", attribute.String("llm.model", c.GetModel()))
+
+	prompt, team := c.promptFor(ctx)
+	var extra []PromptExample
+	if c.examples != nil {
+		who, _ := ctx.Value(callerKey{}).(caller)
+		extra = c.examples.Examples(ctx, who.chatID, message)
+		span.SetAttributes(attribute.Int("llm.corrections", len(extra)))
+	}
 
-	prompt := c.buildPrompt(message)
-
-	request := OpenRouterRequest{
-		Model: c.model,
-		Messages: []Message{
-			{
-				Role:    "system",
-				Content: "You are a task parser that ONLY returns valid JSON. Never include explanations or additional text.",
-			},
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
+	key := CacheKey{Text: message, PromptVersion: c.cacheVersion(prompt, team, extra), Model: c.GetModel()}
+	if c.cache != nil {
+		if cached, ok := c.cache.Get(ctx, key); ok {
+			cached.Cached = true
+			cached.PromptVersion = prompt.Version
+			cached.Corrections = len(extra)
+			span.SetAttributes(attribute.Bool("llm.cache_hit", true), attribute.Int("llm.task_count", len(cached.Tasks)))
+			tracing.End(span, nil)
+			return cached, nil
+		}
 	}
 
-	reqBody, err := json.Marshal(request)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	parseResp, err := c.parseMessage(ctx, message, prompt, team, extra)
+	if err == nil {
+		span.SetAttributes(attribute.Int("llm.task_count", len(parseResp.Tasks)))
+		if c.cache != nil {
+			c.cache.Put(ctx, key, parseResp)
+		}
 	}
+	tracing.End(span, err)
+	return parseResp, err
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// cacheVersion identifies everything in the prompt besides the message: its
+// version, the team's examples, the extra examples and the custom fields it
+// asks for
+func (c *Client) cacheVersion(prompt *Prompt, team string, extra []PromptExample) string {
+	version := prompt.Version + "/" + team
+	if len(extra) > 0 {
+		hash := sha256.New()
+		for _, ex := range extra {
+			hash.Write([]byte(ex.Input + "\x00" + ex.Output + "\x00"))
+		}
+		version += "#" + hex.EncodeToString(hash.Sum(nil))[:8]
 	}
+	if len(c.customFields) > 0 {
+		version += "+" + strings.Join(c.customFields, ",")
+	}
+	return version
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+// parseMessage sends the message to the LLM and normalizes the parsed tasks
+func (c *Client) parseMessage(ctx context.Context, message string, prompt *Prompt, team string, extra []PromptExample) (*ParseResponse, error) {
+	log.Debug().Str("message", message).Msg("Parsing message with LLM")
 
-	resp, err := c.client.Do(req)
+	release, err := c.acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	defer release()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d", resp.StatusCode)
+	// Checked after waiting for a slot so calls queued behind the one that
+	// reached the cap see it
+	if c.budget != nil {
+		if err := c.budget.Check(ctx); err != nil {
+			return nil, err
+		}
 	}
 
-	var openRouterResp OpenRouterResponse
-	if err := json.NewDecoder(resp.Body).Decode(&openRouterResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	messages, err := prompt.Render(message, team, c.customFields, extra, time.Now())
+	if err != nil {
+		return nil, err
 	}
 
+	openRouterResp, target, err := c.complete(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("llm.served_model", target.Model),
+		attribute.String("llm.prompt_version", prompt.Version),
+	)
+
 	if len(openRouterResp.Choices) == 0 {
 		return nil, fmt.Errorf("no choices in response")
 	}
@@ -132,35 +418,43 @@ func (c *Client) ParseMessage(ctx context.Context, message string) (*ParseRespon
 	// Clean the content - remove any non-JSON text
 	content = regexp.MustCompile(`(?s)^.*?(\{.*\}).*?$`).ReplaceAllString(content, "$1")
 
-	// Try to parse the JSON response
-	var parseResp ParseResponse
-	if err := json.Unmarshal([]byte(content), &parseResp); err != nil {
-		log.Warn().Str("content", content).Err(err).Msg("Failed to parse LLM response as JSON, creating fallback")
-		// Create fallback response
-		parseResp = ParseResponse{
-			Tasks: []Task{
-				{
-					People:     []string{"team"},
-					Client:     "Internal",
-					Summary:    c.extractSummary(message),
-					DueDate:    "Unsure",
-					Confidence: 0.5,
-				},
-			},
-			OriginalMessage: message,
-		}
+	// Only the tasks are taken from the reply. Anything the model echoes
+	// back, such as the original message, is ignored in favour of what was
+	// actually sent.
+	var output modelOutput
+	if err := json.Unmarshal([]byte(content), &output); err != nil {
+		log.Warn().Str("content", content).Err(err).Msg("Failed to parse LLM response as JSON")
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
 	}
+	parseResp := ParseResponse{Tasks: output.Tasks, OriginalMessage: message}
 
 	// Normalize people names
 	for i := range parseResp.Tasks {
 		parseResp.Tasks[i].People = c.normalizeNames(parseResp.Tasks[i].People)
 		parseResp.Tasks[i].Summary = c.truncateSummary(parseResp.Tasks[i].Summary)
 
+		// Only earlier tasks can block a task, which keeps chains acyclic
+		if dep := parseResp.Tasks[i].DependsOn; dep != nil && (*dep < 0 || *dep >= i) {
+			log.Warn().Int("task", i).Int("depends_on", *dep).Msg("Dropped dependency on a task that does not come before it")
+			parseResp.Tasks[i].DependsOn = nil
+		}
+
+		// Keep only recurrence rules the scheduler can follow
+		if recurrence := parseResp.Tasks[i].Recurrence; recurrence != "" {
+			rule, err := rrule.Parse(recurrence)
+			if err != nil {
+				log.Warn().Err(err).Str("recurrence", recurrence).Msg("Dropped unsupported recurrence rule")
+				parseResp.Tasks[i].Recurrence = ""
+			} else {
+				parseResp.Tasks[i].Recurrence = rule.String()
+			}
+		}
+
 		// Ensure client field is set
 		if parseResp.Tasks[i].Client == "" || parseResp.Tasks[i].Client == "Internal" {
-			// For task chains, try to use the client from the first task
-			if i > 0 && parseResp.Tasks[0].Client != "Internal" && parseResp.Tasks[0].Client != "Unsure" {
-				parseResp.Tasks[i].Client = parseResp.Tasks[0].Client
+			// The steps of a chain are for the client of the step they wait on
+			if dep := parseResp.Tasks[i].DependsOn; dep != nil && parseResp.Tasks[*dep].Client != "Unsure" {
+				parseResp.Tasks[i].Client = parseResp.Tasks[*dep].Client
 			} else {
 				parseResp.Tasks[i].Client = "Unsure"
 			}
@@ -175,6 +469,16 @@ func (c *Client) ParseMessage(ctx context.Context, message string) (*ParseRespon
 		if parseResp.Tasks[i].Confidence == 0 {
 			parseResp.Tasks[i].Confidence = 0.8
 		}
+
+		parseResp.Tasks[i].Fields = c.filterFields(parseResp.Tasks[i].Fields)
+	}
+
+	metrics.TasksPerMessage.Observe(float64(len(parseResp.Tasks)))
+	for _, task := range parseResp.Tasks {
+		metrics.TasksParsed.Inc()
+		if task.Confidence < 0.7 {
+			metrics.LowConfidenceTasks.Inc()
+		}
 	}
 
 	log.Info().
@@ -182,56 +486,100 @@ func (c *Client) ParseMessage(ctx context.Context, message string) (*ParseRespon
 		Interface("tasks", parseResp.Tasks).
 		Msg("Successfully parsed message")
 
+	parseResp.Model = target.Model
+	parseResp.PromptVersion = prompt.Version
+	parseResp.Corrections = len(extra)
 	return &parseResp, nil
 }
 
-// buildPrompt creates the prompt for the LLM
-func (c *Client) buildPrompt(message string) string {
-	currentTime := time.Now()
-	return fmt.Sprintf(`Parse this message into tasks and return ONLY a JSON object, no other text.
-
-Current Date: %s
-Message: "%s"
-
-Rules:
-1. Split multi-task messages into separate tasks (look for bullet points, "AND", or clear task boundaries)
-2. For each task:
-   - people: array of who is DOING the task (lowercase) or ["team"] if unclear
-   - client: who the task is FOR. Important rules for client:
-     * If task is part of a chain/dependency, use the same client for all related tasks
-     * If someone is asking for something, they are the client
-     * If unclear, use "Unsure"
-   - summary: brief task description (max 80 chars)
-   - dueDate: ONLY if explicitly mentioned (YYYY-MM-DD format)
-   - confidence: 0.0-1.0
-
-Example Input: "Gemma to ask oxccu for press release, then Lilly to draft it by friday"
-Example Output:
-{
-  "tasks": [
-    {
-      "people": ["gemma"],
-      "client": "oxccu",
-      "summary": "Ask for press release",
-      "dueDate": "Unsure",
-      "confidence": 0.95
-    },
-    {
-      "people": ["lilly"],
-      "client": "oxccu",
-      "summary": "Draft press release",
-      "dueDate": "%s",
-      "confidence": 0.95
-    }
-  ],
-  "original_message": "%s"
-}
-
-Return ONLY the JSON for the given message, no other text:`,
-		currentTime.Format("2006-01-02"),
-		message,
-		currentTime.AddDate(0, 0, 5).Format("2006-01-02"), // Example future date
-		message)
+// send posts a chat completion request, recording latency, usage and the
+// outcome for health checks
+func (c *Client) send(req *http.Request, model string) (*OpenRouterResponse, error) {
+	start := time.Now()
+	resp, err := c.doSend(req)
+	metrics.LLMRequestDuration.WithLabelValues(model, metrics.Outcome(err)).Observe(metrics.Since(start))
+	c.record(req.Context(), model, start, resp, err)
+	if err != nil {
+		// A hedged request cancelled because another won is not a failure
+		if req.Context().Err() == nil {
+			health.RecordFailure(health.ComponentLLM, err)
+		}
+		return nil, err
+	}
+	health.RecordSuccess(health.ComponentLLM)
+
+	if resp.Usage != nil {
+		trace.SpanFromContext(req.Context()).SetAttributes(
+			attribute.Int("llm.prompt_tokens", resp.Usage.PromptTokens),
+			attribute.Int("llm.completion_tokens", resp.Usage.CompletionTokens),
+			attribute.Float64("llm.cost_usd", resp.Usage.Cost),
+		)
+		metrics.LLMTokens.WithLabelValues(model, "prompt").Add(float64(resp.Usage.PromptTokens))
+		metrics.LLMTokens.WithLabelValues(model, "completion").Add(float64(resp.Usage.CompletionTokens))
+		metrics.LLMCost.WithLabelValues(model).Add(resp.Usage.Cost)
+	}
+
+	return resp, nil
+}
+
+// record passes a completed request to the recorder, if any
+func (c *Client) record(ctx context.Context, model string, start time.Time, resp *OpenRouterResponse, err error) {
+	if c.recorder == nil {
+		return
+	}
+
+	who, _ := ctx.Value(callerKey{}).(caller)
+	call := Call{
+		Time:    start,
+		Model:   model,
+		ChatID:  who.chatID,
+		UserID:  who.userID,
+		Latency: time.Since(start),
+		Err:     err,
+	}
+	if resp != nil && resp.Usage != nil {
+		call.Usage = *resp.Usage
+	}
+	c.recorder.Record(context.WithoutCancel(ctx), call)
+}
+
+// doSend performs the HTTP round trip and decodes the response
+func (c *Client) doSend(req *http.Request) (*OpenRouterResponse, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	var openRouterResp OpenRouterResponse
+	if err := json.NewDecoder(resp.Body).Decode(&openRouterResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &openRouterResp, nil
+}
+
+// filterFields drops empty values and keys that are not configured custom fields
+func (c *Client) filterFields(fields map[string]string) map[string]string {
+	var filtered map[string]string
+	for _, name := range c.customFields {
+		value := strings.TrimSpace(fields[name])
+		if value == "" || strings.EqualFold(value, "unsure") {
+			continue
+		}
+		if filtered == nil {
+			filtered = make(map[string]string)
+		}
+		filtered[name] = value
+	}
+	return filtered
 }
 
 // normalizeNames normalizes person names
@@ -279,13 +627,3 @@ func (c *Client) getNextWeekday(weekday time.Weekday) time.Time {
 	}
 	return now.AddDate(0, 0, days)
 }
-
-// extractSummary creates a basic summary from the message
-func (c *Client) extractSummary(message string) string {
-	// Simple extraction - take first sentence or first 80 chars
-	sentences := strings.Split(message, ".")
-	if len(sentences) > 0 && len(sentences[0]) > 0 {
-		return c.truncateSummary(strings.TrimSpace(sentences[0]))
-	}
-	return c.truncateSummary(message)
-}
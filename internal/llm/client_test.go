@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseMessageBreaksChainCycles(t *testing.T) {
+	tests := []struct {
+		name      string
+		dependsOn []int // -1 for none
+		want      []int
+	}{
+		{"chain", []int{-1, 0, 1}, []int{-1, 0, 1}},
+		{"fan out", []int{-1, 0, 0}, []int{-1, 0, 0}},
+		{"self dependency", []int{0, 1}, []int{-1, -1}},
+		{"two-task cycle", []int{1, 0}, []int{-1, 0}},
+		{"three-task cycle", []int{2, 0, 1}, []int{-1, 0, 1}},
+		{"forward reference", []int{-1, 2, -1}, []int{-1, -1, -1}},
+		{"out of range", []int{-1, -2, 7}, []int{-1, -1, -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks := make([]map[string]interface{}, len(tt.dependsOn))
+			for i, dep := range tt.dependsOn {
+				tasks[i] = map[string]interface{}{"people": []string{"gemma"}, "summary": fmt.Sprintf("Step %d", i+1)}
+				if dep != -1 {
+					tasks[i]["dependsOn"] = dep
+				}
+			}
+			reply, err := json.Marshal(map[string]interface{}{"tasks": tasks})
+			if err != nil {
+				t.Fatalf("failed to encode reply: %v", err)
+			}
+
+			resp, err := fakeModel(t, string(reply)).ParseMessage(context.Background(), "gemma to do the steps")
+			if err != nil {
+				t.Fatalf("ParseMessage: %v", err)
+			}
+			got := make([]int, 0, len(resp.Tasks))
+			for _, task := range resp.Tasks {
+				dep := -1
+				if task.DependsOn != nil {
+					dep = *task.DependsOn
+				}
+				got = append(got, dep)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dependsOn = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMessageChainInheritsClient(t *testing.T) {
+	reply := `{"tasks": [
+		{"people": ["gemma"], "client": "Acme", "summary": "Ask for the brief"},
+		{"people": ["lilly"], "summary": "Draft the brief", "dependsOn": 0},
+		{"people": ["lilly"], "client": "Internal", "summary": "Send the draft", "dependsOn": 1},
+		{"people": ["anna"], "summary": "Book the venue", "dependsOn": 3}
+	]}`
+	resp, err := fakeModel(t, reply).ParseMessage(context.Background(), "Gemma to ask Acme for the brief, then Lilly to draft and send it")
+	if err != nil {
+		t.Fatalf("ParseMessage: %v", err)
+	}
+
+	var clients []string
+	for _, task := range resp.Tasks {
+		clients = append(clients, task.Client)
+	}
+	if want := []string{"Acme", "Acme", "Acme", "Unsure"}; !reflect.DeepEqual(clients, want) {
+		t.Errorf("clients = %v, want %v", clients, want)
+	}
+}
@@ -0,0 +1,284 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+)
+
+const (
+	// defaultRetryAfter is how long a provider is paused after a 429 without
+	// a usable Retry-After header
+	defaultRetryAfter = 10 * time.Second
+	// maxRetryWait is the longest a request waits for a paused provider
+	// before giving up
+	maxRetryWait = 10 * time.Second
+)
+
+// Target is one model at one provider in the fallback chain. An empty
+// BaseURL or APIKey means the primary's.
+type Target struct {
+	Model   string
+	BaseURL string
+	APIKey  string
+}
+
+// provider names the target's provider: the host of its endpoint
+func (t Target) provider() string {
+	if u, err := url.Parse(t.BaseURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return t.BaseURL
+}
+
+// circuit names the target's circuit breaker
+func (t Target) circuit() circuit {
+	return circuit{provider: t.provider(), model: t.Model}
+}
+
+// StatusError is returned for a non-200 response
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // from the Retry-After header of a 429
+}
+
+// Error implements error
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API request failed with status %d", e.StatusCode)
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// SetFallbacks sets the targets tried, in order, after the primary model
+func (c *Client) SetFallbacks(targets []Target) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fallbacks = append([]Target(nil), targets...)
+}
+
+// SetCircuitBreaker opens a provider's circuit after threshold consecutive
+// failures, for cooldown
+func (c *Client) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	c.breakers.configure(threshold, cooldown)
+}
+
+// SetHedgeAfter sends the request to the next target in the chain as well
+// when the current one has not answered within d. Zero disables hedging.
+func (c *Client) SetHedgeAfter(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hedgeAfter = d
+}
+
+// chain returns the primary target followed by the fallbacks
+func (c *Client) chain() ([]Target, time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	primary := Target{Model: c.model, BaseURL: c.baseURL, APIKey: c.apiKey}
+	targets := []Target{primary}
+	for _, t := range c.fallbacks {
+		if t.BaseURL == "" {
+			t.BaseURL = primary.BaseURL
+		}
+		if t.APIKey == "" {
+			t.APIKey = primary.APIKey
+		}
+		targets = append(targets, t)
+	}
+	return targets, c.hedgeAfter
+}
+
+// attemptResult is the outcome of one request in the chain
+type attemptResult struct {
+	target Target
+	resp   *OpenRouterResponse
+	err    error
+}
+
+// complete sends messages down the fallback chain and returns the first
+// successful response with the target that produced it. Providers whose
+// circuit is open, or that asked to be left alone with Retry-After, are
+// skipped; if that leaves nothing, it waits briefly for the first one to
+// come back.
+func (c *Client) complete(ctx context.Context, messages []Message) (*OpenRouterResponse, Target, error) {
+	targets, hedgeAfter := c.chain()
+
+	resp, target, err := c.tryChain(ctx, targets, messages, hedgeAfter)
+	if err == nil || ctx.Err() != nil {
+		return resp, target, err
+	}
+
+	// Everything failed or was unavailable: wait for the earliest provider to
+	// reopen if that is soon, then go round once more
+	wait := maxRetryWait + 1
+	for _, t := range targets {
+		if d := c.breakers.waitFor(t.circuit()); d < wait {
+			wait = d
+		}
+	}
+	if wait <= 0 || wait > maxRetryWait {
+		return nil, Target{}, err
+	}
+
+	log.Info().Dur("wait", wait).Msg("All LLM providers unavailable, waiting to retry")
+	select {
+	case <-time.After(wait):
+	case <-ctx.Done():
+		return nil, Target{}, fmt.Errorf("%w (gave up waiting: %v)", err, ctx.Err())
+	}
+	return c.tryChain(ctx, targets, messages, hedgeAfter)
+}
+
+// tryChain makes one pass down the chain. A target is tried when the previous
+// one fails, or alongside it once hedgeAfter has passed without an answer.
+func (c *Client) tryChain(ctx context.Context, targets []Target, messages []Message, hedgeAfter time.Duration) (*OpenRouterResponse, Target, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, len(targets))
+	var errs []error
+	next, inflight := 0, 0
+
+	// start launches the next available target, reporting whether there was one
+	start := func() bool {
+		for next < len(targets) {
+			target := targets[next]
+			next++
+			if !c.breakers.allow(target.circuit()) {
+				errs = append(errs, fmt.Errorf("%s: unavailable at %s", target.Model, target.provider()))
+				continue
+			}
+
+			inflight++
+			go func() {
+				resp, err := c.attempt(ctx, target, messages)
+				results <- attemptResult{target: target, resp: resp, err: err}
+			}()
+			return true
+		}
+		return false
+	}
+
+	var hedge *time.Timer
+	var hedgeC <-chan time.Time
+	armHedge := func() {
+		if hedgeAfter <= 0 || next >= len(targets) {
+			hedgeC = nil
+			return
+		}
+		if hedge == nil {
+			hedge = time.NewTimer(hedgeAfter)
+		} else {
+			hedge.Reset(hedgeAfter)
+		}
+		hedgeC = hedge.C
+	}
+	defer func() {
+		if hedge != nil {
+			hedge.Stop()
+		}
+	}()
+
+	if start() {
+		armHedge()
+	}
+	for inflight > 0 {
+		select {
+		case result := <-results:
+			inflight--
+			if result.err == nil {
+				if len(errs) > 0 || result.target != targets[0] {
+					metrics.LLMFallbacks.WithLabelValues(result.target.Model).Inc()
+					log.Warn().Str("model", result.target.Model).Errs("errors", errs).Msg("LLM request served by a fallback")
+				}
+				return result.resp, result.target, nil
+			}
+
+			errs = append(errs, fmt.Errorf("%s: %w", result.target.Model, result.err))
+			if inflight == 0 && start() {
+				armHedge()
+			}
+		case <-hedgeC:
+			if start() {
+				metrics.LLMHedgedRequests.Inc()
+				log.Info().Dur("after", hedgeAfter).Msg("LLM request slow, hedging with the next target")
+			}
+			armHedge()
+		}
+	}
+
+	if len(errs) == 0 {
+		errs = append(errs, errors.New("no LLM targets configured"))
+	}
+	return nil, Target{}, fmt.Errorf("all LLM targets failed: %w", errors.Join(errs...))
+}
+
+// attempt sends one request to target and updates its breaker
+func (c *Client) attempt(ctx context.Context, target Target, messages []Message) (*OpenRouterResponse, error) {
+	circuit := target.circuit()
+
+	request := OpenRouterRequest{
+		Model:    target.Model,
+		Messages: messages,
+		Usage:    &UsageRequest{Include: true},
+	}
+	reqBody, err := json.Marshal(request)
+	if err != nil {
+		c.breakers.release(circuit)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target.BaseURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		c.breakers.release(circuit)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+target.APIKey)
+
+	resp, err := c.send(req, target.Model)
+
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+		c.breakers.success(circuit)
+	case ctx.Err() != nil:
+		// Cancelled because another request won or the caller gave up
+		c.breakers.release(circuit)
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests:
+		wait := statusErr.RetryAfter
+		if wait <= 0 {
+			wait = defaultRetryAfter
+		}
+		log.Warn().Str("provider", circuit.provider).Str("model", circuit.model).Dur("retry_after", wait).Msg("LLM model rate limited")
+		c.breakers.pause(circuit, wait)
+	default:
+		c.breakers.failure(circuit)
+	}
+	return resp, err
+}
@@ -0,0 +1,85 @@
+package llm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// teamAssignee is the placeholder for tasks nobody in particular owns
+const teamAssignee = "team"
+
+// CheckPeople removes from each task the people who are neither named in
+// message nor on roster, so a message can't talk the model into assigning
+// work to someone it never mentions. A task left with nobody goes to the
+// team. The removed names are listed in each task's Rejected field and
+// returned.
+func CheckPeople(resp *ParseResponse, message string, roster []string) []string {
+	words := wordSet(message)
+
+	known := make(map[string]bool)
+	for _, name := range roster {
+		name = strings.Join(splitWords(name), " ")
+		if name == "" {
+			continue
+		}
+		known[name] = true
+		// A roster of full names still accepts first names
+		known[strings.Fields(name)[0]] = true
+	}
+
+	var rejected []string
+	for i := range resp.Tasks {
+		task := &resp.Tasks[i]
+		task.Rejected = nil
+
+		var people []string
+		for _, person := range task.People {
+			name := strings.Join(splitWords(person), " ")
+			if name == teamAssignee || known[name] || mentioned(words, name) {
+				people = append(people, person)
+				continue
+			}
+			task.Rejected = append(task.Rejected, person)
+			rejected = append(rejected, person)
+		}
+
+		if len(people) == 0 {
+			people = []string{teamAssignee}
+		}
+		task.People = people
+	}
+	return rejected
+}
+
+// mentioned reports whether every word of name appears in words
+func mentioned(words map[string]bool, name string) bool {
+	parts := strings.Fields(name)
+	if len(parts) == 0 {
+		return false
+	}
+	for _, part := range parts {
+		if !words[part] {
+			return false
+		}
+	}
+	return true
+}
+
+// wordSet returns the lower-cased words of text, with and without a
+// trailing possessive
+func wordSet(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range splitWords(text) {
+		words[word] = true
+		words[strings.TrimSuffix(strings.TrimSuffix(word, "'s"), "’s")] = true
+	}
+	return words
+}
+
+// splitWords lower-cases text and splits it into words of letters, digits,
+// apostrophes and hyphens
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '’' && r != '-'
+	})
+}
@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// injectionCorpus is test/data/prompt_injection.json
+type injectionCorpus struct {
+	Roster    []string `json:"roster"`
+	TestCases []struct {
+		ID          string `json:"id"`
+		Message     string `json:"message"`
+		ModelOutput string `json:"model_output"`
+		Expected    struct {
+			OriginalMessage string `json:"original_message"`
+			Tasks           []struct {
+				People []string `json:"people"`
+			} `json:"tasks"`
+			Rejected []string `json:"rejected"`
+		} `json:"expected"`
+	} `json:"test_cases"`
+}
+
+func loadInjectionCorpus(t *testing.T) injectionCorpus {
+	t.Helper()
+	data, err := os.ReadFile("../../test/data/prompt_injection.json")
+	if err != nil {
+		t.Fatalf("failed to read corpus: %v", err)
+	}
+	var corpus injectionCorpus
+	if err := json.Unmarshal(data, &corpus); err != nil {
+		t.Fatalf("failed to decode corpus: %v", err)
+	}
+	if len(corpus.TestCases) == 0 {
+		t.Fatal("corpus has no test cases")
+	}
+	return corpus
+}
+
+// fakeModel serves reply as the content of every chat completion
+func fakeModel(t *testing.T, reply string) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenRouterResponse{
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: reply}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient("test-key")
+	client.SetBaseURL(server.URL)
+	return client
+}
+
+func TestPromptInjectionMessageIsDelimited(t *testing.T) {
+	corpus := loadInjectionCorpus(t)
+	prompt, err := LoadPrompt("", DefaultPromptVersion)
+	if err != nil {
+		t.Fatalf("failed to load prompt: %v", err)
+	}
+
+	for _, tc := range corpus.TestCases {
+		t.Run(tc.ID, func(t *testing.T) {
+			messages, err := prompt.Render(tc.Message, "", nil, nil, time.Now())
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+
+			last := messages[len(messages)-1]
+			if last.Role != "user" {
+				t.Fatalf("message is sent as %q, want user", last.Role)
+			}
+			for _, m := range messages[:len(messages)-1] {
+				if strings.Contains(m.Content, tc.Message) {
+					t.Errorf("%s message contains the user text", m.Role)
+				}
+			}
+
+			lines := strings.Split(last.Content, "\n")
+			begin, end := lines[0], lines[len(lines)-1]
+			if !strings.HasPrefix(begin, "BEGIN MESSAGE ") {
+				t.Fatalf("first line is %q, want the opening delimiter", begin)
+			}
+			boundary := strings.TrimPrefix(begin, "BEGIN MESSAGE ")
+			if end != "END MESSAGE "+boundary {
+				t.Fatalf("last line is %q, want the closing delimiter with boundary %s", end, boundary)
+			}
+			if strings.Contains(tc.Message, boundary) {
+				t.Fatalf("boundary %s appears in the message", boundary)
+			}
+			if n := strings.Count(last.Content, "END MESSAGE "+boundary); n != 1 {
+				t.Errorf("closing delimiter appears %d times", n)
+			}
+			if got := strings.Join(lines[1:len(lines)-1], "\n"); got != strings.TrimSpace(tc.Message) {
+				t.Errorf("delimited text is %q, want %q", got, tc.Message)
+			}
+		})
+	}
+}
+
+func TestPromptInjectionOutputIsValidated(t *testing.T) {
+	corpus := loadInjectionCorpus(t)
+
+	for _, tc := range corpus.TestCases {
+		t.Run(tc.ID, func(t *testing.T) {
+			client := fakeModel(t, tc.ModelOutput)
+			resp, err := client.ParseMessage(context.Background(), tc.Message)
+			if err != nil {
+				t.Fatalf("ParseMessage: %v", err)
+			}
+			rejected := CheckPeople(resp, tc.Message, corpus.Roster)
+
+			if resp.OriginalMessage != tc.Message {
+				t.Errorf("original message is %q, want the message sent", resp.OriginalMessage)
+			}
+			if want := tc.Expected.OriginalMessage; want != "" && resp.OriginalMessage != want {
+				t.Errorf("original message is %q, want %q", resp.OriginalMessage, want)
+			}
+
+			if len(resp.Tasks) != len(tc.Expected.Tasks) {
+				t.Fatalf("got %d tasks, want %d", len(resp.Tasks), len(tc.Expected.Tasks))
+			}
+			var taskRejected []string
+			for i, task := range resp.Tasks {
+				if !reflect.DeepEqual(task.People, tc.Expected.Tasks[i].People) {
+					t.Errorf("task %d people are %v, want %v", i, task.People, tc.Expected.Tasks[i].People)
+				}
+				taskRejected = append(taskRejected, task.Rejected...)
+			}
+
+			if len(rejected) != len(tc.Expected.Rejected) || (len(rejected) > 0 && !reflect.DeepEqual(rejected, tc.Expected.Rejected)) {
+				t.Errorf("rejected %v, want %v", rejected, tc.Expected.Rejected)
+			}
+			// Rejected names come from the check, never from the reply
+			if len(taskRejected) != len(rejected) || (len(rejected) > 0 && !reflect.DeepEqual(taskRejected, rejected)) {
+				t.Errorf("tasks list rejected %v, want %v", taskRejected, rejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package llm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPromptVersion is the embedded prompt used unless configured otherwise
+const DefaultPromptVersion = "v2"
+
+// defaultTeam names the examples used for chats without a team of their own
+const defaultTeam = "default"
+
+// embeddedPrompts holds the built-in prompt versions, one directory each
+//
+//go:embed prompts
+var embeddedPrompts embed.FS
+
+// Prompt is one version of the parse prompt. A version is a directory with
+// system.tmpl, an examples directory of YAML files, one per team, and at
+// least one of parse.tmpl, an instructions message that may quote the chat
+// message, and message.tmpl, which carries the chat message on its own.
+type Prompt struct {
+	// Version is the directory name and a hash of its contents, such as
+	// "v1@3fa2c1d0", so an edited prompt gets a new version
+	Version string
+
+	system   *template.Template
+	parse    *template.Template // nil when the version has no parse.tmpl
+	message  *template.Template // nil when the version has no message.tmpl
+	examples map[string][]example
+}
+
+// example is a few-shot example whose output is a template
+type example struct {
+	input  string
+	output *template.Template
+}
+
+// exampleFile is the YAML layout of an examples file
+type exampleFile []struct {
+	Input  string `yaml:"input"`
+	Output string `yaml:"output"`
+}
+
+// PromptData is what the prompt templates are executed with
+type PromptData struct {
+	Message      string
+	Boundary     string // random per request, marks where the message starts and ends
+	Today        string
+	CustomFields []string
+	Examples     []PromptExample
+}
+
+// PromptExample is a rendered few-shot example
+type PromptExample struct {
+	Input  string
+	Output string
+}
+
+// LoadPrompt loads prompt version from dir, or from the embedded prompts
+// when dir is empty
+func LoadPrompt(dir, version string) (*Prompt, error) {
+	var fsys fs.FS
+	if dir == "" {
+		sub, err := fs.Sub(embeddedPrompts, "prompts")
+		if err != nil {
+			return nil, fmt.Errorf("failed to open embedded prompts: %w", err)
+		}
+		fsys = sub
+	} else {
+		fsys = os.DirFS(dir)
+	}
+
+	hash := sha256.New()
+	read := func(name string) (string, error) {
+		data, err := fs.ReadFile(fsys, path.Join(version, name))
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt %s: %w", path.Join(version, name), err)
+		}
+		hash.Write([]byte(name))
+		hash.Write(data)
+		return string(data), nil
+	}
+
+	p := &Prompt{examples: make(map[string][]example)}
+
+	text, err := read("system.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	if p.system, err = newTemplate("system", text); err != nil {
+		return nil, err
+	}
+
+	for _, optional := range []struct {
+		name string
+		dst  **template.Template
+	}{{"parse", &p.parse}, {"message", &p.message}} {
+		file := optional.name + ".tmpl"
+		if _, err := fs.Stat(fsys, path.Join(version, file)); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if text, err = read(file); err != nil {
+			return nil, err
+		}
+		if *optional.dst, err = newTemplate(optional.name, text); err != nil {
+			return nil, err
+		}
+	}
+	if p.parse == nil && p.message == nil {
+		return nil, fmt.Errorf("prompt %s needs parse.tmpl or message.tmpl", version)
+	}
+
+	files, err := fs.Glob(fsys, path.Join(version, "examples", "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt examples: %w", err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		name := path.Base(file)
+		if text, err = read(path.Join("examples", name)); err != nil {
+			return nil, err
+		}
+
+		var entries exampleFile
+		if err := yaml.Unmarshal([]byte(text), &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse prompt examples %s: %w", file, err)
+		}
+
+		team := strings.TrimSuffix(name, ".yaml")
+		for i, entry := range entries {
+			output, err := newTemplate(fmt.Sprintf("%s[%d]", file, i), strings.TrimSpace(entry.Output))
+			if err != nil {
+				return nil, err
+			}
+			p.examples[team] = append(p.examples[team], example{input: entry.Input, output: output})
+		}
+	}
+
+	p.Version = version + "@" + hex.EncodeToString(hash.Sum(nil))[:8]
+	return p, nil
+}
+
+// Teams returns the teams with their own examples
+func (p *Prompt) Teams() []string {
+	var teams []string
+	for team := range p.examples {
+		if team != defaultTeam {
+			teams = append(teams, team)
+		}
+	}
+	sort.Strings(teams)
+	return teams
+}
+
+// Render executes the prompt for a message, with team's examples or the
+// default ones followed by extra, returning the messages to send
+func (p *Prompt) Render(message, team string, customFields []string, extra []PromptExample, now time.Time) ([]Message, error) {
+	examples, ok := p.examples[team]
+	if !ok {
+		examples = p.examples[defaultTeam]
+	}
+
+	boundary := make([]byte, 8)
+	if _, err := rand.Read(boundary); err != nil {
+		return nil, fmt.Errorf("failed to generate message boundary: %w", err)
+	}
+
+	data := PromptData{
+		Message:      message,
+		Boundary:     hex.EncodeToString(boundary),
+		Today:        now.Format("2006-01-02"),
+		CustomFields: customFields,
+	}
+	for _, ex := range examples {
+		output, err := execute(ex.output, now, data)
+		if err != nil {
+			return nil, err
+		}
+		data.Examples = append(data.Examples, PromptExample{Input: ex.input, Output: output})
+	}
+	data.Examples = append(data.Examples, extra...)
+
+	var messages []Message
+	for _, part := range []struct {
+		role string
+		tmpl *template.Template
+	}{{"system", p.system}, {"user", p.parse}, {"user", p.message}} {
+		if part.tmpl == nil {
+			continue
+		}
+		content, err := execute(part.tmpl, now, data)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, Message{Role: part.role, Content: strings.TrimSpace(content)})
+	}
+	return messages, nil
+}
+
+// newTemplate parses a prompt template. The functions are placeholders
+// until execute binds them to the current time.
+func newTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs(time.Time{})).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// execute runs a template with its functions bound to now
+func execute(tmpl *template.Template, now time.Time, data PromptData) (string, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return "", fmt.Errorf("failed to clone prompt template %s: %w", tmpl.Name(), err)
+	}
+
+	var buf bytes.Buffer
+	if err := clone.Funcs(templateFuncs(now)).Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// templateFuncs are the functions available to prompt templates
+func templateFuncs(now time.Time) template.FuncMap {
+	return template.FuncMap{
+		// json quotes a string, so quotes in messages can't break the prompt
+		"json": func(s string) (string, error) {
+			data, err := json.Marshal(s)
+			return string(data), err
+		},
+		"join": strings.Join,
+		// inDays is the date n days from today
+		"inDays": func(n int) string {
+			return now.AddDate(0, 0, n).Format("2006-01-02")
+		},
+		// nextWeekday is the date of the first day after today that falls on
+		// the named weekday, such as "monday"
+		"nextWeekday": func(name string) (string, error) {
+			for day := 1; day <= 7; day++ {
+				date := now.AddDate(0, 0, day)
+				if strings.EqualFold(date.Weekday().String(), name) {
+					return date.Format("2006-01-02"), nil
+				}
+			}
+			return "", fmt.Errorf("unknown weekday %q", name)
+		},
+	}
+}
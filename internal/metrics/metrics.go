@@ -0,0 +1,287 @@
+// Package metrics defines the Prometheus metrics exported on /metrics. The
+// collectors are registered with the default registry when the package is
+// loaded, so instrumented packages only need to import it.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+const namespace = "todobot"
+
+var (
+	// MessagesReceived counts Telegram messages by kind ("task", "command" or
+	// "edit")
+	MessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "Telegram messages received.",
+	}, []string{"kind"})
+
+	// AccessDenied counts refused Telegram messages by reason ("not_allowed"
+	// or "not_admin")
+	AccessDenied = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "access_denied_total",
+		Help:      "Telegram messages refused by access control.",
+	}, []string{"reason"})
+
+	// DegradedMessages counts messages saved with the rule-based splitter
+	// instead of the LLM, by reason ("user_rate", "chat_rate", "daily_cap",
+	// "monthly_cap" or "other")
+	DegradedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "degraded_messages_total",
+		Help:      "Messages saved without the LLM because a limit was hit.",
+	}, []string{"reason"})
+
+	// LLMWaiting is the number of LLM calls waiting for a concurrency slot
+	LLMWaiting = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "llm_waiting_requests",
+		Help:      "LLM calls waiting for a free concurrency slot.",
+	})
+
+	// LLMCircuitOpen is 1 while a model's circuit breaker is open
+	LLMCircuitOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "llm_circuit_open",
+		Help:      "Whether the circuit breaker for an LLM model at a provider is open.",
+	}, []string{"provider", "model"})
+
+	// LLMFallbacks counts LLM calls answered by a model other than the primary
+	LLMFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_fallbacks_total",
+		Help:      "LLM calls served by a fallback model.",
+	}, []string{"model"})
+
+	// LLMHedgedRequests counts requests sent to a second target because the
+	// first was slow
+	LLMHedgedRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_hedged_requests_total",
+		Help:      "LLM requests hedged with the next target after the latency threshold.",
+	})
+
+	// ParseCache counts parse cache lookups by result ("hit", "miss", "stale"
+	// or "error")
+	ParseCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parse_cache_lookups_total",
+		Help:      "Parse cache lookups by result.",
+	}, []string{"result"})
+
+	// RejectedPeople counts people the LLM assigned who were neither named in
+	// the message nor on the team roster
+	RejectedPeople = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejected_people_total",
+		Help:      "Assignees dropped from parsed tasks for not being in the message or roster.",
+	})
+
+	// Corrections counts parses corrected by people, by source ("edit",
+	// "update" or "sheet")
+	Corrections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parse_corrections_total",
+		Help:      "Parsed tasks corrected after saving, by source.",
+	}, []string{"source"})
+
+	// TasksUnblocked counts tasks whose blocking task was completed
+	TasksUnblocked = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_unblocked_total",
+		Help:      "Tasks in a chain whose blocking task was completed.",
+	})
+
+	// RecurringTasksCreated counts rows created for recurring series, by mode
+	RecurringTasksCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "recurring_tasks_created_total",
+		Help:      "Rows created for the next occurrence of recurring tasks.",
+	}, []string{"mode"})
+
+	// OutboxDeadEntries counts outbox entries given up on after too many
+	// failed deliveries
+	OutboxDeadEntries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_dead_entries_total",
+		Help:      "Outbox entries marked dead after failing too many deliveries.",
+	})
+
+	// RemindersSent counts due-date reminders sent, by kind
+	RemindersSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reminders_sent_total",
+		Help:      "Due-date reminders sent to assignees, by kind (before, due, overdue or snoozed).",
+	}, []string{"kind"})
+
+	// TasksPerMessage observes how many tasks the LLM found in each message
+	TasksPerMessage = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tasks_per_message",
+		Help:      "Tasks parsed from each message sent to the LLM.",
+		Buckets:   []float64{0, 1, 2, 3, 4, 5, 7, 10, 15},
+	})
+
+	// TasksParsed counts parsed tasks
+	TasksParsed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_parsed_total",
+		Help:      "Tasks parsed by the LLM.",
+	})
+
+	// LowConfidenceTasks counts parsed tasks below the confidence threshold
+	LowConfidenceTasks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_low_confidence_total",
+		Help:      "Parsed tasks whose confidence was below 0.7.",
+	})
+
+	// ParseFallbacks counts messages saved without a usable LLM parse, by
+	// reason ("invalid_json", "llm_error" or "llm_disabled")
+	ParseFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parse_fallbacks_total",
+		Help:      "Messages that fell back to a placeholder task.",
+	}, []string{"reason"})
+
+	// LLMRequestDuration observes OpenRouter request latency by outcome
+	LLMRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_request_duration_seconds",
+		Help:      "Latency of LLM requests.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 4, 8, 15, 30, 60},
+	}, []string{"model", "outcome"})
+
+	// LLMTokens counts tokens reported by OpenRouter, by type ("prompt" or
+	// "completion")
+	LLMTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "LLM tokens used.",
+	}, []string{"model", "type"})
+
+	// LLMCost counts the cost reported by OpenRouter in US dollars
+	LLMCost = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_cost_usd_total",
+		Help:      "LLM spend reported by OpenRouter, in USD.",
+	}, []string{"model"})
+
+	// SheetsRequestDuration observes Google Sheets request latency by backend
+	// ("webhook" or "api") and outcome
+	SheetsRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sheets_request_duration_seconds",
+		Help:      "Latency of Google Sheets requests.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 15, 30},
+	}, []string{"backend", "outcome"})
+
+	// SheetsErrors counts failed Google Sheets requests by backend
+	SheetsErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sheets_errors_total",
+		Help:      "Failed Google Sheets requests.",
+	}, []string{"backend"})
+
+	// WorkerBusy counts the time queue workers spend processing tasks
+	WorkerBusy = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_busy_seconds_total",
+		Help:      "Time queue workers spent processing tasks.",
+	})
+
+	// QueueTasksProcessed counts processed queue tasks by outcome
+	QueueTasksProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_tasks_processed_total",
+		Help:      "Queued tasks processed by the workers.",
+	}, []string{"outcome"})
+
+	// DigestEmailsSent counts daily digest e-mails by outcome
+	DigestEmailsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "digest_emails_sent_total",
+		Help:      "Daily digest e-mails sent.",
+	}, []string{"outcome"})
+)
+
+// Outcome returns the outcome label for err
+func Outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// Since returns the seconds elapsed since start, for histogram observations
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// Handler returns the HTTP handler serving the metrics in Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// QueueStatsFunc returns the number of queued tasks by status, and the number
+// of outbox entries waiting for the task store
+type QueueStatsFunc func(ctx context.Context) (map[string]int, int, error)
+
+// queueCollector reads the queue depth from SQLite on every scrape
+type queueCollector struct {
+	stats  QueueStatsFunc
+	depth  *prometheus.Desc
+	outbox *prometheus.Desc
+}
+
+// RegisterQueueCollector exports queue depth by status and the outbox backlog,
+// read through stats on every scrape
+func RegisterQueueCollector(stats QueueStatsFunc) {
+	prometheus.MustRegister(&queueCollector{
+		stats: stats,
+		depth: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "queue", "tasks"),
+			"Queued tasks by status.",
+			[]string{"status"}, nil,
+		),
+		outbox: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "outbox", "pending"),
+			"Outbox entries waiting for the task store.",
+			nil, nil,
+		),
+	})
+}
+
+// Describe implements prometheus.Collector
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.depth
+	ch <- c.outbox
+}
+
+// Collect implements prometheus.Collector
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	byStatus, outbox, err := c.stats(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read queue stats for metrics")
+		ch <- prometheus.NewInvalidMetric(c.depth, err)
+		return
+	}
+
+	for status, count := range byStatus {
+		ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue, float64(count), status)
+	}
+	ch <- prometheus.MustNewConstMetric(c.outbox, prometheus.GaugeValue, float64(outbox))
+}
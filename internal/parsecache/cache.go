@@ -0,0 +1,225 @@
+// Package parsecache keeps LLM parse results in SQLite, keyed by the
+// normalized message text, prompt version and model, so forwarded and
+// re-sent messages don't call the LLM again.
+package parsecache
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/llm"
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+)
+
+// dayFormat is the layout of reference days
+const dayFormat = "2006-01-02"
+
+// relativeDate matches wording whose meaning depends on the day the message
+// was parsed
+var relativeDate = regexp.MustCompile(`(?i)\b(today|tonight|tomorrow|tmrw|yesterday|eod|eow|eom|asap|weekend|` +
+	`mon(day)?|tue(s|sday)?|wed(nesday)?|thu(rs|rsday)?|fri(day)?|sat(urday)?|sun(day)?|` +
+	`(this|next|last|coming) (week|month|year)|end of (the )?(day|week|month)|in \d+ (days?|weeks?|months?))\b`)
+
+// Cache stores parse responses in the parse_cache table
+type Cache struct {
+	db       *sql.DB
+	location *time.Location
+
+	mu  sync.RWMutex
+	ttl time.Duration
+}
+
+// NewCache creates a cache in db whose entries live for ttl, creating its
+// table if needed. Reference days are taken in location. A ttl of zero
+// turns the cache off until SetTTL turns it on.
+func NewCache(db *sql.DB, ttl time.Duration, location *time.Location) (*Cache, error) {
+	c := &Cache{db: db, ttl: ttl, location: location}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS parse_cache (
+			key TEXT PRIMARY KEY,
+			prompt_version TEXT NOT NULL,
+			model TEXT NOT NULL,
+			served_model TEXT NOT NULL,
+			response TEXT NOT NULL,
+			reference_day TEXT NOT NULL,
+			date_relative INTEGER NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_parse_cache_expires ON parse_cache(expires_at);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create parse_cache table: %w", err)
+	}
+
+	if err := c.prune(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetTTL changes how long new entries live. Zero turns the cache off.
+func (c *Cache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// TTL returns how long new entries live, or zero while the cache is off
+func (c *Cache) TTL() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ttl
+}
+
+// Get implements llm.Cache. Expired entries, and date-relative entries parsed
+// on another day, are misses, as is everything while the cache is off.
+func (c *Cache) Get(ctx context.Context, key llm.CacheKey) (*llm.ParseResponse, bool) {
+	if c.TTL() <= 0 {
+		return nil, false
+	}
+	id := Key(key)
+
+	var response, servedModel, referenceDay string
+	var dateRelative bool
+	var expiresAt time.Time
+	err := c.db.QueryRowContext(ctx, `
+		SELECT response, served_model, reference_day, date_relative, expires_at
+		FROM parse_cache WHERE key = ?
+	`, id).Scan(&response, &servedModel, &referenceDay, &dateRelative, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		metrics.ParseCache.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read parse cache")
+		metrics.ParseCache.WithLabelValues("error").Inc()
+		return nil, false
+	}
+
+	if time.Now().After(expiresAt) || (dateRelative && referenceDay != c.today()) {
+		metrics.ParseCache.WithLabelValues("stale").Inc()
+		return nil, false
+	}
+
+	var parseResp llm.ParseResponse
+	if err := json.Unmarshal([]byte(response), &parseResp); err != nil {
+		log.Error().Err(err).Msg("Failed to decode cached parse")
+		metrics.ParseCache.WithLabelValues("error").Inc()
+		return nil, false
+	}
+	parseResp.Model = servedModel
+
+	if _, err := c.db.ExecContext(ctx, "UPDATE parse_cache SET hits = hits + 1 WHERE key = ?", id); err != nil {
+		log.Warn().Err(err).Msg("Failed to count parse cache hit")
+	}
+	metrics.ParseCache.WithLabelValues("hit").Inc()
+	log.Debug().Str("key", id).Msg("Parse cache hit")
+	return &parseResp, true
+}
+
+// Put implements llm.Cache. Failures are logged, never returned, so caching
+// can't break parsing. Nothing is stored while the cache is off.
+func (c *Cache) Put(ctx context.Context, key llm.CacheKey, resp *llm.ParseResponse) {
+	ttl := c.TTL()
+	if ttl <= 0 {
+		return
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode parse for the cache")
+		return
+	}
+
+	now := time.Now()
+	_, err = c.db.ExecContext(ctx, `
+		INSERT INTO parse_cache (key, prompt_version, model, served_model, response, reference_day,
+			date_relative, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			served_model = excluded.served_model,
+			response = excluded.response,
+			reference_day = excluded.reference_day,
+			date_relative = excluded.date_relative,
+			hits = 0,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at
+	`,
+		Key(key),
+		key.PromptVersion,
+		key.Model,
+		resp.Model,
+		string(response),
+		c.today(),
+		DateRelative(key.Text, resp),
+		now,
+		now.Add(ttl),
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to write parse cache")
+		return
+	}
+
+	if err := c.prune(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to prune parse cache")
+	}
+}
+
+// prune deletes expired entries
+func (c *Cache) prune(ctx context.Context) error {
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM parse_cache WHERE expires_at < ?", time.Now()); err != nil {
+		return fmt.Errorf("failed to prune parse cache: %w", err)
+	}
+	return nil
+}
+
+// today returns the current reference day
+func (c *Cache) today() string {
+	return time.Now().In(c.location).Format(dayFormat)
+}
+
+// Normalize reduces a message to the form it is cached under: lower case,
+// with runs of whitespace collapsed and surrounding whitespace removed, so a
+// reformatted or forwarded copy shares its original's entry
+func Normalize(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// Key returns the cache key for a parse: a SHA-256 of the normalized text,
+// prompt version and model
+func Key(key llm.CacheKey) string {
+	sum := sha256.Sum256([]byte(Normalize(key.Text) + "\x00" + key.PromptVersion + "\x00" + key.Model))
+	return hex.EncodeToString(sum[:])
+}
+
+// DateRelative reports whether a parse depends on the day it was made: the
+// message uses relative wording such as "tomorrow" or "friday", or a task has
+// a due date the message does not spell out
+func DateRelative(text string, resp *llm.ParseResponse) bool {
+	if relativeDate.MatchString(text) {
+		return true
+	}
+	for _, task := range resp.Tasks {
+		if task.DueDate != "" && task.DueDate != "Unsure" && !strings.Contains(text, task.DueDate) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package parsecache
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/llm"
+)
+
+// newTestCache opens a cache with an hour's TTL in a fresh database
+func newTestCache(t *testing.T) (*Cache, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	c, err := NewCache(db, time.Hour, time.UTC)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+	return c, db
+}
+
+func TestCacheInvalidatesOnReferenceDay(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		dueDate string
+		hit     bool // after reference_day moves to yesterday
+	}{
+		{"relative wording", "Gemma to call Acme tomorrow", "2025-03-06", false},
+		{"weekday", "Lilly to send the deck by Friday", "2025-03-07", false},
+		{"due date not in the message", "Anna to book the venue", "2025-03-10", false},
+		{"explicit due date", "Anna to book the venue by 2025-03-10", "2025-03-10", true},
+		{"no due date", "Gemma to review the contract", "Unsure", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c, db := newTestCache(t)
+			key := llm.CacheKey{Text: tt.text, PromptVersion: "v1", Model: "openai/gpt-4o-mini"}
+			c.Put(ctx, key, &llm.ParseResponse{
+				Tasks: []llm.Task{{Summary: "Task", DueDate: tt.dueDate}},
+				Model: "openai/gpt-4o-mini",
+			})
+
+			if _, ok := c.Get(ctx, key); !ok {
+				t.Fatal("miss on the day the entry was stored")
+			}
+
+			yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(dayFormat)
+			if _, err := db.Exec("UPDATE parse_cache SET reference_day = ?", yesterday); err != nil {
+				t.Fatalf("failed to age entry: %v", err)
+			}
+			if _, ok := c.Get(ctx, key); ok != tt.hit {
+				t.Errorf("hit = %v the day after, want %v", ok, tt.hit)
+			}
+		})
+	}
+}
+
+func TestCacheKeysAndTTL(t *testing.T) {
+	ctx := context.Background()
+	c, db := newTestCache(t)
+	key := llm.CacheKey{Text: "Gemma to review the contract", PromptVersion: "v1", Model: "openai/gpt-4o-mini"}
+	c.Put(ctx, key, &llm.ParseResponse{Tasks: []llm.Task{{Summary: "Review the contract"}}, Model: "fallback-model"})
+
+	resp, ok := c.Get(ctx, llm.CacheKey{Text: "  gemma to REVIEW\nthe contract ", PromptVersion: "v1", Model: "openai/gpt-4o-mini"})
+	if !ok || resp.Model != "fallback-model" || len(resp.Tasks) != 1 {
+		t.Fatalf("reformatted text: Get = %+v, %v, want the stored response", resp, ok)
+	}
+	for _, other := range []llm.CacheKey{
+		{Text: key.Text, PromptVersion: "v2", Model: key.Model},
+		{Text: key.Text, PromptVersion: key.PromptVersion, Model: "other-model"},
+	} {
+		if _, ok := c.Get(ctx, other); ok {
+			t.Errorf("hit for %+v", other)
+		}
+	}
+
+	if _, err := db.Exec("UPDATE parse_cache SET expires_at = ?", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("failed to expire entry: %v", err)
+	}
+	if _, ok := c.Get(ctx, key); ok {
+		t.Error("hit on an expired entry")
+	}
+
+	c.SetTTL(0)
+	c.Put(ctx, key, &llm.ParseResponse{})
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM parse_cache WHERE expires_at > ?", time.Now()).Scan(&count); err != nil {
+		t.Fatalf("failed to count entries: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("%d live entries stored with the cache off", count)
+	}
+
+	c.SetTTL(time.Hour)
+	c.Put(ctx, key, &llm.ParseResponse{})
+	c.SetTTL(0)
+	if _, ok := c.Get(ctx, key); ok {
+		t.Error("hit with the cache off")
+	}
+}
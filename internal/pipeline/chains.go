@@ -0,0 +1,26 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/chains"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// SetChains keeps the links between rows of a chain in chains, so the people
+// on a step hear when the step before it is complete
+func (p *Pipeline) SetChains(chains *chains.Store) {
+	p.chains = chains
+}
+
+// link records which rows are blocked by which, if chains are kept
+func (p *Pipeline) link(ctx context.Context, chatID int64, rows []store.Task) {
+	if p.chains == nil {
+		return
+	}
+	if err := p.chains.Record(ctx, chatID, rows); err != nil {
+		log.Warn().Err(err).Int64("chat_id", chatID).Msg("Failed to record task chain")
+	}
+}
@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/corrections"
+	"github.com/giovannigabriele/go-todo-bot/internal/llm"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// messageIDKey is the context key for the chat message being parsed
+type messageIDKey struct{}
+
+// WithMessageID records on ctx the Telegram message a parse is for, so an
+// edit of the message can find the rows parsed from it
+func WithMessageID(ctx context.Context, messageID int) context.Context {
+	return context.WithValue(ctx, messageIDKey{}, messageID)
+}
+
+// SetCorrections logs every LLM parse in corrections so later fixes to the
+// rows are learned from
+func (p *Pipeline) SetCorrections(corrections *corrections.Store) {
+	p.corrections = corrections
+}
+
+// record logs rows parsed by the LLM, if corrections are kept
+func (p *Pipeline) record(ctx context.Context, chatID int64, text string, rows []store.Task) {
+	if p.corrections == nil {
+		return
+	}
+	messageID, _ := ctx.Value(messageIDKey{}).(int)
+	if err := p.corrections.Record(ctx, chatID, messageID, text, rows); err != nil {
+		log.Warn().Err(err).Int64("chat_id", chatID).Msg("Failed to log parsed rows")
+	}
+}
+
+// ErrPending is returned by Reparse when rows saved from the message are still
+// waiting in the outbox, so they can't be updated yet
+var ErrPending = errors.New("tasks are still waiting to be saved")
+
+// Reparse parses the edited text of a chat message and updates the rows saved
+// from it in place, adding or deleting rows if the number of tasks changed.
+// The new rows are kept as the correction of the original text. If the LLM
+// fails the edit is parsed by the rule-based parser instead, as in Parse.
+// Messages whose rows were not logged, including the parts of a batch, return
+// corrections.ErrNotParsed; messages whose rows are still in the outbox return
+// ErrPending.
+func (p *Pipeline) Reparse(ctx context.Context, chatID int64, messageID int, text string) (*Result, error) {
+	parsed, err := p.parsedRows(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	parseResp, err := p.parse(ctx, text)
+	if errors.Is(err, llm.ErrBudgetExceeded) {
+		return p.ReparseRuleBased(ctx, chatID, messageID, text, err)
+	}
+	if err != nil {
+		if err != ErrLLMDisabled {
+			log.Error().Err(err).Msg("Failed to parse edited message with LLM")
+		}
+		result := &Result{ParseError: err}
+		return p.reparse(ctx, chatID, messageID, parsed, p.fallbackRows(ctx, text, "", err), result)
+	}
+	return p.reparse(ctx, chatID, messageID, parsed, buildRows(parseResp, text, ""), &Result{})
+}
+
+// ReparseRuleBased is Reparse without calling the LLM. reason says why, such
+// as a rate limit or spend cap, and is returned in the result's Degraded field.
+func (p *Pipeline) ReparseRuleBased(ctx context.Context, chatID int64, messageID int, text string, reason error) (*Result, error) {
+	parsed, err := p.parsedRows(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Warn().Err(reason).Int64("chat_id", chatID).Msg("Updating edited message without the LLM")
+	result := &Result{Degraded: reason}
+	return p.reparse(ctx, chatID, messageID, parsed, p.degradedRows(ctx, text, "", reason), result)
+}
+
+// parsedRows returns the logged parse of a message, or ErrPending if any of
+// its rows have not reached the task store yet
+func (p *Pipeline) parsedRows(ctx context.Context, chatID int64, messageID int) (*corrections.Parsed, error) {
+	if p.corrections == nil {
+		return nil, corrections.ErrNotParsed
+	}
+	parsed, err := p.corrections.Parsed(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := p.queueManager.HasPendingOutboxTask(ctx, parsed.TaskIDs)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrPending
+	}
+	return parsed, nil
+}
+
+// reparse replaces the rows saved from a message with rows and fills in result
+func (p *Pipeline) reparse(ctx context.Context, chatID int64, messageID int, parsed *corrections.Parsed, rows []store.Task, result *Result) (*Result, error) {
+	// Rows updated in place keep their IDs, so chains must point at those
+	ids := make(map[string]string, len(rows))
+	for i := range rows {
+		if i < len(parsed.TaskIDs) {
+			ids[rows[i].ID] = parsed.TaskIDs[i]
+		}
+	}
+	for i := range rows {
+		if id, ok := ids[rows[i].BlockedBy]; ok {
+			rows[i].BlockedBy = id
+		}
+		if id, ok := ids[rows[i].ID]; ok {
+			rows[i].ID = id
+		}
+	}
+
+	result.Delivered = true
+	var added []store.Task
+	var updatedRows []store.Task
+	for i, row := range rows {
+		if i >= len(parsed.TaskIDs) {
+			added = append(added, row)
+			continue
+		}
+
+		notes := joinNotes(row.BotNotes, "Edited")
+		updated, err := p.taskStore.UpdateTask(ctx, row.ID, store.Update{
+			People:     row.People,
+			Client:     &row.Client,
+			Summary:    &row.Summary,
+			DueDate:    &row.DueDate,
+			BotNotes:   &notes,
+			BlockedBy:  &row.BlockedBy,
+			Recurrence: &row.Recurrence,
+			Fields:     row.Fields,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update task %s: %w", row.ID, err)
+		}
+		result.Tasks = append(result.Tasks, *updated)
+		updatedRows = append(updatedRows, row)
+	}
+	p.link(ctx, chatID, updatedRows)
+	p.repeat(ctx, chatID, updatedRows)
+
+	if len(added) > 0 {
+		delivered, err := p.Save(ctx, chatID, "", added)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save tasks: %w", err)
+		}
+		result.Tasks = append(result.Tasks, added...)
+		result.Delivered = delivered
+	}
+
+	for i := len(result.Tasks); i < len(parsed.TaskIDs); i++ {
+		if err := p.taskStore.DeleteTask(ctx, parsed.TaskIDs[i]); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, fmt.Errorf("failed to delete task %s: %w", parsed.TaskIDs[i], err)
+		}
+	}
+
+	if err := p.corrections.Replace(ctx, chatID, messageID, parsed, result.Tasks); err != nil {
+		log.Warn().Err(err).Int64("chat_id", chatID).Msg("Failed to record correction")
+	}
+	return result, nil
+}
@@ -0,0 +1,489 @@
+// Package pipeline turns free text into stored tasks. The Telegram bot and the
+// REST API both submit messages here, so parsing, batch splitting and the
+// outbox behave the same whichever way a task arrives.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/chains"
+	"github.com/giovannigabriele/go-todo-bot/internal/corrections"
+	"github.com/giovannigabriele/go-todo-bot/internal/cron"
+	"github.com/giovannigabriele/go-todo-bot/internal/events"
+	"github.com/giovannigabriele/go-todo-bot/internal/limits"
+	"github.com/giovannigabriele/go-todo-bot/internal/llm"
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+	"github.com/giovannigabriele/go-todo-bot/internal/queue"
+	"github.com/giovannigabriele/go-todo-bot/internal/rrule"
+	"github.com/giovannigabriele/go-todo-bot/internal/rules"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// ErrNoTasks is returned when a multi-task message splits into nothing
+var ErrNoTasks = errors.New("no tasks could be identified in the message")
+
+// ErrLLMDisabled is the parse error of messages saved while the LLM is
+// switched off
+var ErrLLMDisabled = errors.New("LLM is disabled")
+
+// lowConfidence is the confidence below which rows get a note
+const lowConfidence = 0.7
+
+// Result describes what happened to a submitted message
+type Result struct {
+	// Tasks are the rows created from a single-task message
+	Tasks []store.Task
+	// Delivered reports whether Tasks reached the task store; if not they are
+	// waiting in the outbox
+	Delivered bool
+	// ParseError is set when the LLM failed and the rule-based parser was
+	// used instead
+	ParseError error
+	// Degraded is set when a rate limit or spend cap kept the message from the
+	// LLM and the rule-based parser was used instead
+	Degraded error
+
+	// BatchID is set when the message was split and queued for the workers
+	BatchID string
+	// Queued is the number of queued parts of a batch
+	Queued int
+}
+
+// Pipeline parses messages and writes the resulting rows to the task store
+type Pipeline struct {
+	llmClient    *llm.Client
+	taskStore    store.TaskStore
+	queueManager *queue.Manager
+	worker       *queue.Worker
+	outbox       *queue.Outbox
+	events       *events.Bus
+	roster       *roster
+	corrections  *corrections.Store
+	chains       *chains.Store
+	recurring    *cron.Recurring
+	location     *time.Location
+
+	mu        sync.Mutex
+	notifiers []queue.OutboxNotifier
+}
+
+// New creates a pipeline with its queue workers and outbox. Call Start to
+// begin processing queued batches. A nil llmClient parses every message with
+// the rule-based parser.
+func New(llmClient *llm.Client, taskStore store.TaskStore, queueManager *queue.Manager) *Pipeline {
+	bus := events.NewBus()
+	p := &Pipeline{
+		llmClient:    llmClient,
+		taskStore:    events.ObserveStore(taskStore, bus),
+		queueManager: queueManager,
+		events:       bus,
+		location:     time.Local,
+	}
+	p.roster = &roster{taskStore: taskStore}
+
+	p.worker = queue.NewWorker(queueManager, p.ProcessQueued, 2, 500*time.Millisecond)
+	p.worker.OnStatusChange(p.publishQueueStatus)
+
+	// Buffer parsed rows locally so they survive task store outages
+	p.outbox = queue.NewOutbox(queueManager, p.taskStore, p.notifyDelivered, 30*time.Second)
+
+	return p
+}
+
+// Store returns the task store rows are written to. Writes through it are
+// published as events.
+func (p *Pipeline) Store() store.TaskStore {
+	return p.taskStore
+}
+
+// Events returns the bus queue transitions and row changes are published on
+func (p *Pipeline) Events() *events.Bus {
+	return p.events
+}
+
+// publishQueueStatus publishes a queued task's new status
+func (p *Pipeline) publishQueueStatus(ctx context.Context, task *queue.QueuedTask) {
+	p.events.Publish(events.Event{
+		Type:    events.TypeQueue,
+		BatchID: task.BatchID,
+		Queue: &events.QueueUpdate{
+			ID:      task.ID,
+			Message: task.MessageText,
+			Status:  string(task.Status),
+			Error:   task.Error,
+		},
+	})
+}
+
+// Queue returns the queue manager batches are queued in
+func (p *Pipeline) Queue() *queue.Manager {
+	return p.queueManager
+}
+
+// OnDelivered registers fn to be called when buffered rows finally reach the
+// task store, or are given up on
+func (p *Pipeline) OnDelivered(fn queue.OutboxNotifier) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.notifiers = append(p.notifiers, fn)
+}
+
+// notifyDelivered fans an outbox delivery out to the registered notifiers
+func (p *Pipeline) notifyDelivered(ctx context.Context, entry *queue.OutboxEntry) {
+	p.mu.Lock()
+	notifiers := append([]queue.OutboxNotifier(nil), p.notifiers...)
+	p.mu.Unlock()
+
+	for _, notify := range notifiers {
+		notify(ctx, entry)
+	}
+}
+
+// SetWorkers changes the number of queue workers
+func (p *Pipeline) SetWorkers(n int) {
+	p.worker.SetWorkers(n)
+}
+
+// SetPollInterval changes how often idle queue workers look for pending tasks
+func (p *Pipeline) SetPollInterval(interval time.Duration) {
+	p.worker.SetInterval(interval)
+}
+
+// SetOutboxLimits sets how long an outbox entry that keeps failing is retried
+// before it is marked dead, and how long delivered entries are kept
+func (p *Pipeline) SetOutboxLimits(maxAge, retention time.Duration) {
+	p.outbox.SetMaxAge(maxAge)
+	p.outbox.SetRetention(retention)
+}
+
+// SetLocation sets the time zone relative dates are resolved in when
+// messages are parsed without the LLM
+func (p *Pipeline) SetLocation(location *time.Location) {
+	p.location = location
+}
+
+// Start starts the queue workers and the outbox flusher
+func (p *Pipeline) Start(ctx context.Context) {
+	p.worker.Start(ctx)
+	p.outbox.Start(ctx)
+}
+
+// Stop stops the queue workers and the outbox flusher
+func (p *Pipeline) Stop() {
+	p.worker.Stop()
+	p.outbox.Stop()
+}
+
+// Submit handles a message from chatID (0 when it did not come from a chat).
+// Single tasks are parsed straight away; messages holding several tasks are
+// split and queued, and the result carries the batch ID.
+func (p *Pipeline) Submit(ctx context.Context, chatID int64, text string) (*Result, error) {
+	format := queue.DetectMessageFormat(text)
+	if format == queue.FormatSingleTask {
+		// Fast path for single tasks
+		return p.Parse(ctx, chatID, text)
+	}
+
+	// Split message into individual tasks
+	parts := queue.SplitMessage(text, format)
+	if len(parts) == 0 {
+		return nil, ErrNoTasks
+	}
+
+	var queueTasks []struct {
+		MessageText string
+		FormatType  queue.FormatType
+	}
+	for _, part := range parts {
+		queueTasks = append(queueTasks, struct {
+			MessageText string
+			FormatType  queue.FormatType
+		}{
+			MessageText: part,
+			FormatType:  queue.FormatSingleTask, // Each split task is treated as single
+		})
+	}
+
+	queued, err := p.queueManager.EnqueueBatchTasks(ctx, chatID, queueTasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue batch tasks: %w", err)
+	}
+	for i := range queued {
+		p.publishQueueStatus(ctx, &queued[i])
+	}
+
+	return &Result{
+		BatchID: queued[0].BatchID, // All tasks in batch have same ID
+		Queued:  len(queued),
+	}, nil
+}
+
+// Parse parses a single message and saves the rows. If the LLM fails the
+// message is parsed by the rule-based parser instead and the result carries
+// the parse error. When saving fails the result still holds the rows that were parsed.
+func (p *Pipeline) Parse(ctx context.Context, chatID int64, text string) (*Result, error) {
+	parseResp, err := p.parse(ctx, text)
+	if errors.Is(err, llm.ErrBudgetExceeded) {
+		return p.SaveRuleBased(ctx, chatID, text, err)
+	}
+	if err != nil {
+		if err != ErrLLMDisabled {
+			log.Error().Err(err).Msg("Failed to parse message with LLM")
+		}
+		return p.saveFallback(ctx, chatID, text, err)
+	}
+
+	result := &Result{Tasks: buildRows(parseResp, text, "")}
+	delivered, err := p.Save(ctx, chatID, "", result.Tasks)
+	if err != nil {
+		return result, fmt.Errorf("failed to save tasks: %w", err)
+	}
+	result.Delivered = delivered
+	p.record(ctx, chatID, text, result.Tasks)
+	return result, nil
+}
+
+// SaveRuleBased saves a message parsed by the rule-based parser without
+// calling the LLM. reason says why, such as a rate limit or spend cap, and is
+// returned in the result's Degraded field.
+func (p *Pipeline) SaveRuleBased(ctx context.Context, chatID int64, text string, reason error) (*Result, error) {
+	log.Warn().Err(reason).Int64("chat_id", chatID).Msg("Saving message without the LLM")
+
+	result := &Result{Tasks: p.degradedRows(ctx, text, "", reason), Degraded: reason}
+	delivered, err := p.Save(ctx, chatID, "", result.Tasks)
+	if err != nil {
+		return result, fmt.Errorf("failed to save tasks: %w", err)
+	}
+	result.Delivered = delivered
+	return result, nil
+}
+
+// parse sends text to the LLM, or returns ErrLLMDisabled without one. People
+// the LLM assigns who are neither in the message nor on the team are dropped.
+func (p *Pipeline) parse(ctx context.Context, text string) (*llm.ParseResponse, error) {
+	if p.llmClient == nil {
+		return nil, ErrLLMDisabled
+	}
+
+	parseResp, err := p.llmClient.ParseMessage(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	if rejected := llm.CheckPeople(parseResp, text, p.roster.Names(ctx)); len(rejected) > 0 {
+		metrics.RejectedPeople.Add(float64(len(rejected)))
+		log.Warn().Strs("people", rejected).Str("message", text).Msg("Dropped people not named in the message or on the team")
+	}
+	return parseResp, nil
+}
+
+// saveFallback saves a message the LLM could not parse, parsed by the
+// rule-based parser
+func (p *Pipeline) saveFallback(ctx context.Context, chatID int64, text string, parseErr error) (*Result, error) {
+	// The request context may already be done if the LLM call timed out
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	result := &Result{Tasks: p.fallbackRows(ctx, text, "", parseErr), ParseError: parseErr}
+	delivered, err := p.Save(ctx, chatID, "", result.Tasks)
+	if err != nil {
+		return result, fmt.Errorf("failed to save fallback task: %w", err)
+	}
+	result.Delivered = delivered
+	return result, nil
+}
+
+// ProcessQueued parses and saves one part of a queued batch. It is the queue
+// worker's task processor.
+func (p *Pipeline) ProcessQueued(ctx context.Context, task *queue.QueuedTask) error {
+	ctx = llm.WithCaller(ctx, task.ChatID, 0)
+
+	var taskRows []store.Task
+	var parsed bool
+	parseResp, err := p.parse(ctx, task.MessageText)
+	switch {
+	case errors.Is(err, llm.ErrBudgetExceeded):
+		taskRows = p.degradedRows(ctx, task.MessageText, task.BatchID, err)
+	case err != nil:
+		// As in Parse, any LLM failure falls back to the rule-based parser
+		if err != ErrLLMDisabled {
+			log.Error().Err(err).Int64("task_id", task.ID).Msg("Failed to parse batch part with LLM")
+		}
+		taskRows = p.fallbackRows(ctx, task.MessageText, task.BatchID, err)
+	default:
+		taskRows = buildRows(parseResp, task.MessageText, task.BatchID)
+		parsed = true
+		if err := p.queueManager.SetPromptVersion(ctx, task.ID, parseResp.PromptVersion); err != nil {
+			log.Warn().Err(err).Int64("task_id", task.ID).Msg("Failed to record prompt version")
+		}
+	}
+
+	// Rows left in the outbox still count as processed; the chat hears about
+	// them when they land
+	delivered, err := p.Save(ctx, task.ChatID, task.BatchID, taskRows)
+	if err != nil {
+		return fmt.Errorf("failed to save tasks: %w", err)
+	}
+	if !delivered {
+		log.Warn().Int64("task_id", task.ID).Str("batch_id", task.BatchID).Msg("Tasks kept in the outbox")
+	}
+	if parsed {
+		p.record(ctx, task.ChatID, task.MessageText, taskRows)
+	}
+
+	return nil
+}
+
+// Save writes rows through the outbox, reporting whether they reached the
+// task store. Rows that did not are kept in the outbox and delivered later.
+func (p *Pipeline) Save(ctx context.Context, chatID int64, batchID string, taskRows []store.Task) (bool, error) {
+	delivered, err := p.outbox.Save(ctx, chatID, batchID, taskRows)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to write tasks to the outbox, saving directly")
+
+		if err := p.taskStore.AddTasks(events.WithBatch(ctx, batchID), taskRows); err != nil {
+			return false, err
+		}
+		delivered = true
+	}
+	p.link(ctx, chatID, taskRows)
+	p.repeat(ctx, chatID, taskRows)
+	return delivered, nil
+}
+
+// BatchProgress returns the number of queued parts of a batch by status
+func (p *Pipeline) BatchProgress(ctx context.Context, batchID string) (map[queue.TaskStatus]int, error) {
+	return p.worker.GetBatchProgress(ctx, batchID)
+}
+
+// IsBatchComplete reports whether every part of a batch has been processed
+func (p *Pipeline) IsBatchComplete(ctx context.Context, batchID string) (bool, error) {
+	return p.worker.IsBatchComplete(ctx, batchID)
+}
+
+// fallbackRows parses a message the LLM could not parse with the rule-based
+// parser, noting the parse error
+func (p *Pipeline) fallbackRows(ctx context.Context, text, batchID string, parseErr error) []store.Task {
+	reason := "llm_error"
+	switch {
+	case parseErr == ErrLLMDisabled:
+		reason = "llm_disabled"
+	case errors.Is(parseErr, llm.ErrInvalidResponse):
+		reason = "invalid_json"
+	}
+	if parseErr != ErrLLMDisabled {
+		log.Warn().Err(parseErr).Str("message", text).Msg("Parse error, using the rule-based parser")
+	}
+	metrics.ParseFallbacks.WithLabelValues(reason).Inc()
+
+	return p.ruleRows(ctx, text, batchID, fmt.Sprintf("Parse error: %s", parseErr.Error()))
+}
+
+// degradedRows parses a message kept from the LLM with the rule-based parser,
+// noting why the LLM was skipped
+func (p *Pipeline) degradedRows(ctx context.Context, text, batchID string, reason error) []store.Task {
+	metrics.DegradedMessages.WithLabelValues(degradeLabel(reason)).Inc()
+	return p.ruleRows(ctx, text, batchID, fmt.Sprintf("Saved without LLM: %s", reason))
+}
+
+// ruleRows parses text with the rule-based parser and adds note to each row
+func (p *Pipeline) ruleRows(ctx context.Context, text, batchID, note string) []store.Task {
+	parseResp := rules.Parse(text, p.roster.Names(ctx), time.Now().In(p.location))
+
+	taskRows := buildRows(parseResp, text, batchID)
+	for i := range taskRows {
+		taskRows[i].BotNotes = joinNotes(taskRows[i].BotNotes, note)
+	}
+	return taskRows
+}
+
+// degradeLabel names a degrade reason for metrics
+func degradeLabel(reason error) string {
+	switch {
+	case errors.Is(reason, limits.ErrUserRate):
+		return "user_rate"
+	case errors.Is(reason, limits.ErrChatRate):
+		return "chat_rate"
+	case errors.Is(reason, limits.ErrDailyCap):
+		return "daily_cap"
+	case errors.Is(reason, limits.ErrMonthlyCap):
+		return "monthly_cap"
+	}
+	return "other"
+}
+
+// buildRows converts a parse response into task rows. Rows from a batch note
+// the batch ID and confidence, and every row notes the model and prompt
+// version that parsed it, whether the parse came from the cache and how many
+// past corrections the model was shown. A task that depends on another is
+// blocked by that task's row, and a recurring task notes how it repeats.
+func buildRows(parseResp *llm.ParseResponse, fullMessage, batchID string) []store.Task {
+	var taskRows []store.Task
+
+	for i, task := range parseResp.Tasks {
+		summary := task.Summary
+		if len(parseResp.Tasks) > 1 {
+			summary = fmt.Sprintf("%s (%d/%d)", task.Summary, i+1, len(parseResp.Tasks))
+		}
+
+		var botNotes string
+		if batchID != "" {
+			botNotes = fmt.Sprintf("Batch ID: %s, Confidence: %.2f", batchID, task.Confidence)
+			if task.Confidence < lowConfidence {
+				botNotes += " (Low confidence)"
+			}
+		} else if task.Confidence < lowConfidence {
+			botNotes = fmt.Sprintf("Low confidence parse (%.2f)", task.Confidence)
+		}
+		if parseResp.Model != "" {
+			botNotes = joinNotes(botNotes, "Model: "+parseResp.Model)
+		}
+		if parseResp.PromptVersion != "" {
+			botNotes = joinNotes(botNotes, "Prompt: "+parseResp.PromptVersion)
+		}
+		if parseResp.Cached {
+			botNotes = joinNotes(botNotes, "Cached parse")
+		}
+		if parseResp.Corrections > 0 {
+			botNotes = joinNotes(botNotes, fmt.Sprintf("Learned from %d correction(s)", parseResp.Corrections))
+		}
+		if len(task.Rejected) > 0 {
+			botNotes = joinNotes(botNotes, "Ignored unknown people: "+strings.Join(task.Rejected, "/"))
+		}
+		if rule, err := rrule.Parse(task.Recurrence); err == nil {
+			botNotes = joinNotes(botNotes, "Repeats "+rule.Describe())
+		}
+
+		taskRow := store.NewTask(
+			task.People,
+			task.Client,
+			summary,
+			fullMessage,
+			task.DueDate,
+			botNotes,
+		)
+		taskRow.Fields = task.Fields
+		taskRow.Recurrence = task.Recurrence
+		if task.DependsOn != nil && *task.DependsOn >= 0 && *task.DependsOn < i {
+			taskRow.BlockedBy = taskRows[*task.DependsOn].ID
+		}
+		taskRows = append(taskRows, taskRow)
+	}
+
+	return taskRows
+}
+
+// joinNotes appends a note to the existing bot notes
+func joinNotes(notes, note string) string {
+	if notes == "" {
+		return note
+	}
+	return notes + ", " + note
+}
@@ -0,0 +1,26 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/cron"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// SetRecurring starts a recurring series in recurring for every saved row
+// with a recurrence rule
+func (p *Pipeline) SetRecurring(recurring *cron.Recurring) {
+	p.recurring = recurring
+}
+
+// repeat starts the series of rows that recur, if series are kept
+func (p *Pipeline) repeat(ctx context.Context, chatID int64, rows []store.Task) {
+	if p.recurring == nil {
+		return
+	}
+	if err := p.recurring.Add(ctx, chatID, rows); err != nil {
+		log.Warn().Err(err).Int64("chat_id", chatID).Msg("Failed to start recurring series")
+	}
+}
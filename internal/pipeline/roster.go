@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+const (
+	// rosterTTL is how long the team roster is reused before it is fetched again
+	rosterTTL = 5 * time.Minute
+	// rosterRetry is how long after a failed fetch the last roster is used
+	// before the store is tried again
+	rosterRetry = 30 * time.Second
+)
+
+// roster caches the team member names from the task store, which may be a
+// remote sheet, for checking who parsed tasks are assigned to
+type roster struct {
+	taskStore store.TaskStore
+
+	mu       sync.Mutex
+	names    []string
+	fetched  time.Time     // when names were fetched, zero before the first success
+	retryAt  time.Time     // no fetch before this, after a failure
+	fetching chan struct{} // closed when the fetch in flight ends, nil without one
+}
+
+// Names returns the team member names. The store is read without holding the
+// lock, so one slow fetch doesn't hold up other parses: they use the last
+// names fetched, and only wait if there are none yet. When the store can't be
+// read the last names are used, and the store isn't tried again for
+// rosterRetry.
+func (r *roster) Names(ctx context.Context) []string {
+	r.mu.Lock()
+	now := time.Now()
+	if (!r.fetched.IsZero() && now.Sub(r.fetched) < rosterTTL) || now.Before(r.retryAt) {
+		names := r.names
+		r.mu.Unlock()
+		return names
+	}
+	if done := r.fetching; done != nil {
+		names, fetched := r.names, !r.fetched.IsZero()
+		r.mu.Unlock()
+		if fetched {
+			return names
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.names
+	}
+	done := make(chan struct{})
+	r.fetching = done
+	r.mu.Unlock()
+
+	team, err := r.taskStore.GetTeam(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fetching = nil
+	close(done)
+
+	if err != nil {
+		log.Warn().Err(err).Dur("retry_in", rosterRetry).Msg("Failed to get team roster, using the last one")
+		r.retryAt = time.Now().Add(rosterRetry)
+		return r.names
+	}
+
+	names := make([]string, 0, len(team))
+	for _, member := range team {
+		names = append(names, member.Name)
+	}
+	r.names = names
+	r.fetched = time.Now()
+	return r.names
+}
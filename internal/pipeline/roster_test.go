@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// teamStore serves a team, or fails while down, and counts the reads
+type teamStore struct {
+	store.TaskStore
+	team  []store.TeamMember
+	down  bool
+	calls int
+}
+
+func (s *teamStore) GetTeam(ctx context.Context) ([]store.TeamMember, error) {
+	s.calls++
+	if s.down {
+		return nil, errors.New("sheet unreachable")
+	}
+	return s.team, nil
+}
+
+func TestRosterKeepsLastNamesAfterFailure(t *testing.T) {
+	ctx := context.Background()
+	taskStore := &teamStore{team: []store.TeamMember{{Name: "gemma"}, {Name: "lilly"}}}
+	r := &roster{taskStore: taskStore}
+
+	want := []string{"gemma", "lilly"}
+	if got := r.Names(ctx); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Names = %v, want %v", got, want)
+	}
+
+	// The roster goes stale while the store is down
+	taskStore.down = true
+	r.fetched = time.Now().Add(-rosterTTL)
+	for i := 0; i < 3; i++ {
+		if got := r.Names(ctx); !reflect.DeepEqual(got, want) {
+			t.Errorf("Names while the store is down = %v, want the last roster", got)
+		}
+	}
+	if taskStore.calls != 2 {
+		t.Errorf("store read %d times, want the failure cached after one retry", taskStore.calls)
+	}
+
+	// Once the retry time passes the store is read again
+	taskStore.down = false
+	taskStore.team = []store.TeamMember{{Name: "anna"}}
+	r.retryAt = time.Now()
+	if got := r.Names(ctx); !reflect.DeepEqual(got, []string{"anna"}) {
+		t.Errorf("Names after recovery = %v, want the new roster", got)
+	}
+}
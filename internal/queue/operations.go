@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/tracing"
 )
 
 // EnqueueTask adds a new task to the queue
@@ -14,9 +16,9 @@ func (m *Manager) EnqueueTask(ctx context.Context, messageText string, formatTyp
 	batchID := uuid.New().String()
 
 	result, err := m.db.ExecContext(ctx, `
-		INSERT INTO tasks_queue (batch_id, message_text, format_type, status)
-		VALUES (?, ?, ?, ?)
-	`, batchID, messageText, formatType, StatusPending)
+		INSERT INTO tasks_queue (batch_id, message_text, format_type, status, trace_context)
+		VALUES (?, ?, ?, ?, ?)
+	`, batchID, messageText, formatType, StatusPending, tracing.Inject(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to enqueue task: %w", err)
 	}
@@ -27,17 +29,19 @@ func (m *Manager) EnqueueTask(ctx context.Context, messageText string, formatTyp
 	}
 
 	return &QueuedTask{
-		ID:          id,
-		BatchID:     batchID,
-		MessageText: messageText,
-		FormatType:  formatType,
-		Status:      StatusPending,
-		CreatedAt:   time.Now(),
+		ID:           id,
+		BatchID:      batchID,
+		MessageText:  messageText,
+		FormatType:   formatType,
+		Status:       StatusPending,
+		CreatedAt:    time.Now(),
+		TraceContext: tracing.Inject(ctx),
 	}, nil
 }
 
-// EnqueueBatchTasks adds multiple tasks to the queue with the same batch ID
-func (m *Manager) EnqueueBatchTasks(ctx context.Context, tasks []struct {
+// EnqueueBatchTasks adds multiple tasks from one chat to the queue with the
+// same batch ID
+func (m *Manager) EnqueueBatchTasks(ctx context.Context, chatID int64, tasks []struct {
 	MessageText string
 	FormatType  FormatType
 }) ([]QueuedTask, error) {
@@ -55,8 +59,8 @@ func (m *Manager) EnqueueBatchTasks(ctx context.Context, tasks []struct {
 	defer tx.Rollback()
 
 	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO tasks_queue (batch_id, message_text, format_type, status)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO tasks_queue (batch_id, chat_id, message_text, format_type, status, trace_context)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare statement: %w", err)
@@ -64,8 +68,9 @@ func (m *Manager) EnqueueBatchTasks(ctx context.Context, tasks []struct {
 	defer stmt.Close()
 
 	now := time.Now()
+	traceContext := tracing.Inject(ctx)
 	for _, task := range tasks {
-		result, err := stmt.ExecContext(ctx, batchID, task.MessageText, task.FormatType, StatusPending)
+		result, err := stmt.ExecContext(ctx, batchID, chatID, task.MessageText, task.FormatType, StatusPending, traceContext)
 		if err != nil {
 			return nil, fmt.Errorf("failed to enqueue task: %w", err)
 		}
@@ -76,12 +81,14 @@ func (m *Manager) EnqueueBatchTasks(ctx context.Context, tasks []struct {
 		}
 
 		queuedTasks = append(queuedTasks, QueuedTask{
-			ID:          id,
-			BatchID:     batchID,
-			MessageText: task.MessageText,
-			FormatType:  task.FormatType,
-			Status:      StatusPending,
-			CreatedAt:   now,
+			ID:           id,
+			BatchID:      batchID,
+			ChatID:       chatID,
+			MessageText:  task.MessageText,
+			FormatType:   task.FormatType,
+			Status:       StatusPending,
+			CreatedAt:    now,
+			TraceContext: traceContext,
 		})
 	}
 
@@ -99,7 +106,7 @@ func (m *Manager) GetNextPendingTask(ctx context.Context) (*QueuedTask, error) {
 	var errorMsg sql.NullString
 
 	err := m.db.QueryRowContext(ctx, `
-		SELECT id, batch_id, message_text, format_type, status, created_at, processed_at, error
+		SELECT id, batch_id, chat_id, message_text, format_type, status, created_at, processed_at, error, trace_context, prompt_version
 		FROM tasks_queue
 		WHERE status = ?
 		ORDER BY created_at ASC
@@ -107,12 +114,15 @@ func (m *Manager) GetNextPendingTask(ctx context.Context) (*QueuedTask, error) {
 	`, StatusPending).Scan(
 		&task.ID,
 		&task.BatchID,
+		&task.ChatID,
 		&task.MessageText,
 		&task.FormatType,
 		&task.Status,
 		&task.CreatedAt,
 		&processedAt,
 		&errorMsg,
+		&task.TraceContext,
+		&task.PromptVersion,
 	)
 
 	if err == sql.ErrNoRows {
@@ -132,6 +142,37 @@ func (m *Manager) GetNextPendingTask(ctx context.Context) (*QueuedTask, error) {
 	return &task, nil
 }
 
+// ClaimNextPendingTask retrieves the next pending task and marks it running,
+// or returns nil if there is none. The status check in the update keeps two
+// workers from claiming the same task.
+func (m *Manager) ClaimNextPendingTask(ctx context.Context) (*QueuedTask, error) {
+	for {
+		task, err := m.GetNextPendingTask(ctx)
+		if err != nil || task == nil {
+			return task, err
+		}
+
+		result, err := m.db.ExecContext(ctx, `
+			UPDATE tasks_queue
+			SET status = ?
+			WHERE id = ? AND status = ?
+		`, StatusRunning, task.ID, StatusPending)
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim task: %w", err)
+		}
+
+		claimed, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim task: %w", err)
+		}
+		if claimed > 0 {
+			task.Status = StatusRunning
+			return task, nil
+		}
+		// Another worker got there first; try the next one
+	}
+}
+
 // UpdateTaskStatus updates the status of a task
 func (m *Manager) UpdateTaskStatus(ctx context.Context, taskID int64, status TaskStatus, errorMsg *string) error {
 	var err error
@@ -156,10 +197,19 @@ func (m *Manager) UpdateTaskStatus(ctx context.Context, taskID int64, status Tas
 	return nil
 }
 
+// SetPromptVersion records the version of the prompt that parsed a task
+func (m *Manager) SetPromptVersion(ctx context.Context, taskID int64, version string) error {
+	_, err := m.db.ExecContext(ctx, "UPDATE tasks_queue SET prompt_version = ? WHERE id = ?", version, taskID)
+	if err != nil {
+		return fmt.Errorf("failed to set prompt version: %w", err)
+	}
+	return nil
+}
+
 // GetBatchTasks retrieves all tasks in a batch
 func (m *Manager) GetBatchTasks(ctx context.Context, batchID string) ([]QueuedTask, error) {
 	rows, err := m.db.QueryContext(ctx, `
-		SELECT id, batch_id, message_text, format_type, status, created_at, processed_at, error
+		SELECT id, batch_id, chat_id, message_text, format_type, status, created_at, processed_at, error, trace_context, prompt_version
 		FROM tasks_queue
 		WHERE batch_id = ?
 		ORDER BY created_at ASC
@@ -178,12 +228,16 @@ func (m *Manager) GetBatchTasks(ctx context.Context, batchID string) ([]QueuedTa
 		err := rows.Scan(
 			&task.ID,
 			&task.BatchID,
+			&task.ChatID,
 			&task.MessageText,
 			&task.FormatType,
 			&task.Status,
 			&task.CreatedAt,
 			&processedAt,
 			&errorMsg,
+			&task.TraceContext,
+			&task.PromptVersion,
+			&task.PromptVersion,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan task row: %w", err)
@@ -251,3 +305,34 @@ func (m *Manager) GetTaskStats(ctx context.Context) (map[TaskStatus]int, error)
 
 	return stats, nil
 }
+
+// GetBacklog returns the number of pending tasks and when the oldest of them
+// was queued, or nil if nothing is pending
+func (m *Manager) GetBacklog(ctx context.Context) (int, *time.Time, error) {
+	var pending int
+	err := m.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM tasks_queue WHERE status = ?
+	`, StatusPending).Scan(&pending)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to count pending tasks: %w", err)
+	}
+	if pending == 0 {
+		return 0, nil, nil
+	}
+
+	var oldest time.Time
+	err = m.db.QueryRowContext(ctx, `
+		SELECT created_at FROM tasks_queue
+		WHERE status = ?
+		ORDER BY created_at ASC
+		LIMIT 1
+	`, StatusPending).Scan(&oldest)
+	if err == sql.ErrNoRows {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get oldest pending task: %w", err)
+	}
+
+	return pending, &oldest, nil
+}
@@ -0,0 +1,548 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/events"
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+	"github.com/giovannigabriele/go-todo-bot/internal/tracing"
+)
+
+// OutboxStatus represents the delivery status of an outbox entry
+type OutboxStatus string
+
+const (
+	OutboxPending   OutboxStatus = "pending"
+	OutboxDelivered OutboxStatus = "delivered"
+	OutboxDead      OutboxStatus = "dead" // gave up on after failing for too long
+)
+
+// Defaults for how long an entry is retried and how long delivered entries
+// are kept
+const (
+	DefaultOutboxMaxAge    = 72 * time.Hour
+	DefaultOutboxRetention = 7 * 24 * time.Hour
+)
+
+// maxOutboxBackoff caps the wait between attempts at the head entry
+const maxOutboxBackoff = 15 * time.Minute
+
+// errOutboxBackoff is returned by Flush while the head entry waits to be retried
+var errOutboxBackoff = errors.New("outbox is waiting to retry")
+
+// OutboxEntry is a group of parsed task rows waiting to be written to the
+// task store. Rows from one message are delivered together.
+type OutboxEntry struct {
+	ID          int64
+	ChatID      int64
+	BatchID     string
+	Tasks       []store.Task
+	Status      OutboxStatus
+	Attempts    int
+	Buffered    bool // the chat was told the rows are waiting
+	LastError   *string
+	CreatedAt   time.Time
+	DeliveredAt *time.Time
+	// NextAttemptAt is when a failed entry may be tried again
+	NextAttemptAt *time.Time
+
+	// TraceContext is the serialized trace context of the message the rows
+	// came from, so a later delivery joins the same trace
+	TraceContext string
+}
+
+// OutboxNotifier is called when an entry that could not be delivered straight
+// away finally reaches the task store, or is given up on, in which case its
+// Status is OutboxDead
+type OutboxNotifier func(ctx context.Context, entry *OutboxEntry)
+
+// Outbox writes parsed rows to SQLite before they are sent to the task store,
+// so nothing is lost while the store (usually Google Sheets) is unreachable.
+// Entries are delivered strictly in the order they were written, except that
+// one still failing maxAge after it was written is set aside as dead so it
+// can't hold up the rest for ever. Failed attempts back off, so an outage
+// costs a handful of requests rather than one per flush.
+type Outbox struct {
+	manager   *Manager
+	store     store.TaskStore
+	notify    OutboxNotifier
+	interval  time.Duration
+	maxAge    time.Duration
+	retention time.Duration
+	mu        sync.Mutex // serialises delivery so entries stay in order
+	wg        sync.WaitGroup
+	stopCh    chan struct{}
+}
+
+// NewOutbox creates an outbox that delivers to taskStore and retries pending
+// entries every interval
+func NewOutbox(manager *Manager, taskStore store.TaskStore, notify OutboxNotifier, interval time.Duration) *Outbox {
+	return &Outbox{
+		manager:   manager,
+		store:     taskStore,
+		notify:    notify,
+		interval:  interval,
+		maxAge:    DefaultOutboxMaxAge,
+		retention: DefaultOutboxRetention,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// SetMaxAge sets how long after it was written an entry that keeps failing
+// is retried before it is marked dead
+func (o *Outbox) SetMaxAge(maxAge time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.maxAge = maxAge
+}
+
+// SetRetention sets how long delivered entries are kept before they are
+// pruned. Zero keeps them.
+func (o *Outbox) SetRetention(retention time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.retention = retention
+}
+
+// Save writes tasks to the outbox and then tries to deliver everything
+// pending. It reports whether the tasks reached the task store; if not, they
+// stay in the outbox for the flusher and the notifier is called once they land.
+func (o *Outbox) Save(ctx context.Context, chatID int64, batchID string, tasks []store.Task) (bool, error) {
+	entry, err := o.manager.AddOutboxEntry(ctx, chatID, batchID, tasks)
+	if err != nil {
+		return false, err
+	}
+
+	if err := o.Flush(ctx); err != nil {
+		log.Warn().Err(err).Int64("outbox_id", entry.ID).Msg("Task store unavailable, keeping tasks in the outbox")
+	}
+
+	// Holding the lock keeps the flusher from delivering the entry between
+	// the check and the mark, which would lose the follow-up
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	buffered, err := o.manager.MarkOutboxBuffered(ctx, entry.ID)
+	if err != nil {
+		return false, err
+	}
+	return !buffered, nil
+}
+
+// Flush delivers pending entries oldest first, stopping at the first failure
+// so later rows never overtake earlier ones. It does nothing while the oldest
+// entry waits to be retried. An entry failing maxAge after it was written is
+// marked dead instead, its chat is told, and the next one is tried.
+func (o *Outbox) Flush(ctx context.Context) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for {
+		entry, err := o.manager.GetNextOutboxEntry(ctx)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			return nil
+		}
+		if entry.NextAttemptAt != nil && time.Now().Before(*entry.NextAttemptAt) {
+			return errOutboxBackoff
+		}
+
+		if err := o.deliverTraced(ctx, entry); err != nil {
+			errMsg := err.Error()
+			next := time.Now().Add(o.backoff(entry.Attempts + 1))
+			if err := o.manager.RecordOutboxFailure(ctx, entry.ID, errMsg, next); err != nil {
+				log.Error().Err(err).Int64("outbox_id", entry.ID).Msg("Failed to record outbox failure")
+			}
+			if time.Since(entry.CreatedAt) < o.maxAge {
+				return fmt.Errorf("failed to deliver outbox entry %d: %w", entry.ID, err)
+			}
+
+			if err := o.manager.MarkOutboxDead(ctx, entry.ID); err != nil {
+				return err
+			}
+			metrics.OutboxDeadEntries.Inc()
+			log.Error().
+				Int64("outbox_id", entry.ID).
+				Int64("chat_id", entry.ChatID).
+				Str("batch_id", entry.BatchID).
+				Int("tasks", len(entry.Tasks)).
+				Int("attempts", entry.Attempts+1).
+				Str("last_error", errMsg).
+				Msg("Gave up on outbox entry, marked dead")
+
+			if o.notify != nil {
+				entry.Status = OutboxDead
+				o.notify(ctx, entry)
+			}
+			continue
+		}
+
+		if err := o.manager.MarkOutboxDelivered(ctx, entry.ID); err != nil {
+			return err
+		}
+
+		log.Info().
+			Int64("outbox_id", entry.ID).
+			Int("tasks", len(entry.Tasks)).
+			Int("attempts", entry.Attempts+1).
+			Msg("Delivered outbox entry")
+
+		if entry.Buffered && o.notify != nil {
+			o.notify(ctx, entry)
+		}
+	}
+}
+
+// backoff returns how long to wait before the next attempt after the given
+// number of failures: the flush interval, doubling with each failure up to
+// maxOutboxBackoff
+func (o *Outbox) backoff(failures int) time.Duration {
+	wait := o.interval
+	for i := 1; i < failures && wait < maxOutboxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxOutboxBackoff {
+		wait = maxOutboxBackoff
+	}
+	return wait
+}
+
+// deliverTraced delivers an entry in a span that continues the trace of the
+// message the rows came from
+func (o *Outbox) deliverTraced(ctx context.Context, entry *OutboxEntry) error {
+	ctx, span := tracing.Start(tracing.Extract(ctx, entry.TraceContext), "outbox.deliver",
+		attribute.Int64("outbox.id", entry.ID),
+		attribute.Int("outbox.attempts", entry.Attempts),
+		attribute.Int("outbox.tasks", len(entry.Tasks)),
+	)
+	err := o.deliver(ctx, entry)
+	tracing.End(span, err)
+	return err
+}
+
+// deliver writes an entry's tasks to the task store. After a failed attempt
+// the store may have kept some rows anyway (for example when the response was
+// lost), so on retries the rows already stored, read in one listing, are
+// skipped.
+func (o *Outbox) deliver(ctx context.Context, entry *OutboxEntry) error {
+	ctx = events.WithBatch(ctx, entry.BatchID)
+
+	tasks := entry.Tasks
+	if entry.Attempts > 0 {
+		stored, err := o.store.ListTasks(ctx, store.Filter{})
+		if err != nil {
+			return err
+		}
+		ids := make(map[string]bool, len(stored))
+		for _, task := range stored {
+			ids[task.ID] = true
+		}
+
+		tasks = nil
+		for _, task := range entry.Tasks {
+			if !ids[task.ID] {
+				tasks = append(tasks, task)
+			}
+		}
+	}
+
+	if len(tasks) == 0 {
+		return nil
+	}
+	return o.store.AddTasks(ctx, tasks)
+}
+
+// Start begins retrying pending entries in the background
+func (o *Outbox) Start(ctx context.Context) {
+	log.Info().Dur("interval", o.interval).Msg("Starting outbox flusher...")
+
+	o.wg.Add(1)
+	go o.flushLoop(ctx)
+}
+
+// Stop gracefully stops the flusher
+func (o *Outbox) Stop() {
+	log.Info().Msg("Stopping outbox flusher...")
+	close(o.stopCh)
+	o.wg.Wait()
+	log.Info().Msg("Outbox flusher stopped")
+}
+
+// flushLoop periodically flushes the outbox until stopped
+func (o *Outbox) flushLoop(ctx context.Context) {
+	defer o.wg.Done()
+
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.stopCh:
+			return
+		case <-ticker.C:
+			if err := o.Flush(ctx); err != nil && !errors.Is(err, errOutboxBackoff) {
+				log.Warn().Err(err).Msg("Outbox flush failed, will retry")
+			}
+			o.prune(ctx)
+		}
+	}
+}
+
+// prune deletes delivered entries older than the retention period
+func (o *Outbox) prune(ctx context.Context) {
+	o.mu.Lock()
+	retention := o.retention
+	o.mu.Unlock()
+	if retention <= 0 {
+		return
+	}
+
+	pruned, err := o.manager.PruneOutbox(ctx, retention)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to prune delivered outbox entries")
+		return
+	}
+	if pruned > 0 {
+		log.Debug().Int64("pruned", pruned).Msg("Pruned delivered outbox entries")
+	}
+}
+
+// AddOutboxEntry stores tasks as a new pending outbox entry
+func (m *Manager) AddOutboxEntry(ctx context.Context, chatID int64, batchID string, tasks []store.Task) (*OutboxEntry, error) {
+	data, err := json.Marshal(tasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode outbox tasks: %w", err)
+	}
+
+	result, err := m.db.ExecContext(ctx, `
+		INSERT INTO outbox (chat_id, batch_id, tasks, status, trace_context)
+		VALUES (?, ?, ?, ?, ?)
+	`, chatID, batchID, string(data), OutboxPending, tracing.Inject(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add outbox entry: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbox entry ID: %w", err)
+	}
+
+	return &OutboxEntry{
+		ID:           id,
+		ChatID:       chatID,
+		BatchID:      batchID,
+		Tasks:        tasks,
+		Status:       OutboxPending,
+		CreatedAt:    time.Now(),
+		TraceContext: tracing.Inject(ctx),
+	}, nil
+}
+
+// GetNextOutboxEntry retrieves the oldest pending outbox entry, or nil
+func (m *Manager) GetNextOutboxEntry(ctx context.Context) (*OutboxEntry, error) {
+	row := m.db.QueryRowContext(ctx, `
+		SELECT id, chat_id, batch_id, tasks, status, attempts, buffered, last_error, created_at, delivered_at,
+			next_attempt_at, trace_context
+		FROM outbox
+		WHERE status = ?
+		ORDER BY id ASC
+		LIMIT 1
+	`, OutboxPending)
+
+	entry, err := scanOutboxEntry(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next outbox entry: %w", err)
+	}
+	return entry, nil
+}
+
+// MarkOutboxDelivered marks an outbox entry as delivered
+func (m *Manager) MarkOutboxDelivered(ctx context.Context, id int64) error {
+	_, err := m.db.ExecContext(ctx, `
+		UPDATE outbox
+		SET status = ?, delivered_at = CURRENT_TIMESTAMP, last_error = NULL
+		WHERE id = ?
+	`, OutboxDelivered, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox entry delivered: %w", err)
+	}
+	return nil
+}
+
+// MarkOutboxDead marks an outbox entry as given up on. It stays in the
+// table, with its last error, for an operator to look at.
+func (m *Manager) MarkOutboxDead(ctx context.Context, id int64) error {
+	_, err := m.db.ExecContext(ctx, `
+		UPDATE outbox
+		SET status = ?
+		WHERE id = ?
+	`, OutboxDead, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox entry dead: %w", err)
+	}
+	return nil
+}
+
+// PruneOutbox deletes entries delivered longer ago than olderThan and returns
+// how many were deleted
+func (m *Manager) PruneOutbox(ctx context.Context, olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().UTC().Add(-olderThan)
+
+	result, err := m.db.ExecContext(ctx, `
+		DELETE FROM outbox
+		WHERE status = ?
+		AND delivered_at < ?
+	`, OutboxDelivered, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", err)
+	}
+
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", err)
+	}
+	return pruned, nil
+}
+
+// MarkOutboxBuffered flags a pending entry as acknowledged to the chat as
+// waiting. It reports false if the entry was already delivered.
+func (m *Manager) MarkOutboxBuffered(ctx context.Context, id int64) (bool, error) {
+	result, err := m.db.ExecContext(ctx, `
+		UPDATE outbox
+		SET buffered = 1
+		WHERE id = ? AND status = ?
+	`, id, OutboxPending)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark outbox entry buffered: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark outbox entry buffered: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// RecordOutboxFailure counts a failed delivery attempt and sets when the
+// entry may be tried again
+func (m *Manager) RecordOutboxFailure(ctx context.Context, id int64, errorMsg string, nextAttempt time.Time) error {
+	_, err := m.db.ExecContext(ctx, `
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = ?, next_attempt_at = ?
+		WHERE id = ?
+	`, errorMsg, nextAttempt.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to record outbox failure: %w", err)
+	}
+	return nil
+}
+
+// CountPendingOutbox returns the number of undelivered outbox entries for a
+// batch, or for all batches if batchID is empty
+func (m *Manager) CountPendingOutbox(ctx context.Context, batchID string) (int, error) {
+	query := "SELECT COUNT(*) FROM outbox WHERE status = ?"
+	args := []interface{}{OutboxPending}
+	if batchID != "" {
+		query += " AND batch_id = ?"
+		args = append(args, batchID)
+	}
+
+	var count int
+	if err := m.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count pending outbox entries: %w", err)
+	}
+	return count, nil
+}
+
+// HasPendingOutboxTask reports whether any of the task IDs is in an
+// undelivered outbox entry
+func (m *Manager) HasPendingOutboxTask(ctx context.Context, ids []string) (bool, error) {
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT tasks FROM outbox WHERE status = ?", OutboxPending)
+	if err != nil {
+		return false, fmt.Errorf("failed to list pending outbox entries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return false, fmt.Errorf("failed to read outbox entry: %w", err)
+		}
+		var tasks []store.Task
+		if err := json.Unmarshal([]byte(data), &tasks); err != nil {
+			return false, fmt.Errorf("failed to decode outbox tasks: %w", err)
+		}
+		for _, task := range tasks {
+			if want[task.ID] {
+				return true, nil
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to list pending outbox entries: %w", err)
+	}
+	return false, nil
+}
+
+// scanOutboxEntry reads an outbox row
+func scanOutboxEntry(row *sql.Row) (*OutboxEntry, error) {
+	var entry OutboxEntry
+	var tasks string
+	var lastError sql.NullString
+	var deliveredAt, nextAttemptAt sql.NullTime
+
+	err := row.Scan(
+		&entry.ID,
+		&entry.ChatID,
+		&entry.BatchID,
+		&tasks,
+		&entry.Status,
+		&entry.Attempts,
+		&entry.Buffered,
+		&lastError,
+		&entry.CreatedAt,
+		&deliveredAt,
+		&nextAttemptAt,
+		&entry.TraceContext,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(tasks), &entry.Tasks); err != nil {
+		return nil, fmt.Errorf("failed to decode outbox tasks: %w", err)
+	}
+	if lastError.Valid {
+		entry.LastError = &lastError.String
+	}
+	if deliveredAt.Valid {
+		entry.DeliveredAt = &deliveredAt.Time
+	}
+	if nextAttemptAt.Valid {
+		entry.NextAttemptAt = &nextAttemptAt.Time
+	}
+
+	return &entry, nil
+}
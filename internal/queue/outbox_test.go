@@ -0,0 +1,315 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// flakyStore fails to add any batch holding a task in fail, or every batch
+// while down, and counts the calls it gets
+type flakyStore struct {
+	store.TaskStore
+	fail     map[string]bool
+	down     bool
+	attempts int // AddTasks calls
+	lists    int // ListTasks calls
+	added    int // rows added
+}
+
+func (s *flakyStore) AddTasks(ctx context.Context, tasks []store.Task) error {
+	s.attempts++
+	if s.down {
+		return errors.New("store unavailable")
+	}
+	for _, task := range tasks {
+		if s.fail[task.ID] {
+			return errors.New("store unavailable")
+		}
+	}
+	s.added += len(tasks)
+	return s.TaskStore.AddTasks(ctx, tasks)
+}
+
+func (s *flakyStore) ListTasks(ctx context.Context, filter store.Filter) ([]store.Task, error) {
+	s.lists++
+	return s.TaskStore.ListTasks(ctx, filter)
+}
+
+func newTestOutbox(t *testing.T) (*Outbox, *Manager, *flakyStore) {
+	t.Helper()
+	dir := t.TempDir()
+
+	manager, err := NewManager(filepath.Join(dir, "queue.db"))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	t.Cleanup(func() { manager.Close() })
+
+	fileStore, err := store.NewFileStore(filepath.Join(dir, "tasks.jsonl"), nil)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	taskStore := &flakyStore{TaskStore: fileStore, fail: map[string]bool{}}
+	return NewOutbox(manager, taskStore, nil, time.Minute), manager, taskStore
+}
+
+func outboxStatus(t *testing.T, manager *Manager, id int64) OutboxStatus {
+	t.Helper()
+	var status OutboxStatus
+	if err := manager.db.QueryRow("SELECT status FROM outbox WHERE id = ?", id).Scan(&status); err != nil {
+		t.Fatalf("failed to read outbox entry %d: %v", id, err)
+	}
+	return status
+}
+
+// endBackoff lets every entry be retried straight away, as if time had passed
+func endBackoff(t *testing.T, manager *Manager) {
+	t.Helper()
+	if _, err := manager.db.Exec("UPDATE outbox SET next_attempt_at = NULL"); err != nil {
+		t.Fatalf("failed to end backoff: %v", err)
+	}
+}
+
+func TestOutboxDeliversInOrderAfterOutage(t *testing.T) {
+	ctx := context.Background()
+	outbox, manager, taskStore := newTestOutbox(t)
+	taskStore.down = true
+
+	for _, id := range []string{"t1", "t2", "t3"} {
+		if _, err := manager.AddOutboxEntry(ctx, 1, id, []store.Task{{ID: id}}); err != nil {
+			t.Fatalf("AddOutboxEntry: %v", err)
+		}
+	}
+
+	// Far more failures than a short outage brings don't give up on anything
+	for i := 0; i < 30; i++ {
+		if err := outbox.Flush(ctx); err == nil {
+			t.Fatal("flush succeeded while the store was down")
+		}
+		endBackoff(t, manager)
+	}
+	if pending, err := manager.CountPendingOutbox(ctx, ""); err != nil || pending != 3 {
+		t.Fatalf("pending = %d, %v, want all 3", pending, err)
+	}
+
+	taskStore.down = false
+	if err := outbox.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	stored, err := taskStore.TaskStore.ListTasks(ctx, store.Filter{})
+	if err != nil {
+		t.Fatalf("ListTasks: %v", err)
+	}
+	var ids []string
+	for _, task := range stored {
+		ids = append(ids, task.ID)
+	}
+	if strings.Join(ids, ",") != "t1,t2,t3" {
+		t.Errorf("stored %v, want t1, t2 and t3 in order", ids)
+	}
+}
+
+func TestOutboxBacksOffAfterFailure(t *testing.T) {
+	ctx := context.Background()
+	outbox, manager, taskStore := newTestOutbox(t)
+	taskStore.down = true
+
+	if _, err := manager.AddOutboxEntry(ctx, 1, "b1", []store.Task{{ID: "t1"}}); err != nil {
+		t.Fatalf("AddOutboxEntry: %v", err)
+	}
+	outbox.Flush(ctx)
+	if err := outbox.Flush(ctx); !errors.Is(err, errOutboxBackoff) {
+		t.Errorf("second flush = %v, want the backoff error", err)
+	}
+	if taskStore.attempts != 1 {
+		t.Errorf("store was tried %d times, want once", taskStore.attempts)
+	}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, maxOutboxBackoff},
+		{40, maxOutboxBackoff},
+	}
+	for _, tt := range tests {
+		if got := outbox.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestOutboxMarksOldEntryDeadAndContinues(t *testing.T) {
+	ctx := context.Background()
+	outbox, manager, taskStore := newTestOutbox(t)
+	outbox.SetMaxAge(time.Hour)
+	taskStore.fail["bad"] = true
+
+	var notified []*OutboxEntry
+	outbox.notify = func(ctx context.Context, entry *OutboxEntry) {
+		notified = append(notified, entry)
+	}
+
+	bad, err := manager.AddOutboxEntry(ctx, 7, "b1", []store.Task{{ID: "bad", Summary: "never lands"}})
+	if err != nil {
+		t.Fatalf("AddOutboxEntry: %v", err)
+	}
+	good, err := manager.AddOutboxEntry(ctx, 7, "b2", []store.Task{{ID: "good", Summary: "lands"}})
+	if err != nil {
+		t.Fatalf("AddOutboxEntry: %v", err)
+	}
+
+	// A recent entry holds back the later one
+	if err := outbox.Flush(ctx); err == nil {
+		t.Fatal("first flush succeeded, want the delivery error")
+	}
+	if got := outboxStatus(t, manager, good.ID); got != OutboxPending {
+		t.Fatalf("later entry is %s after the first failure, want pending", got)
+	}
+
+	// Once it is older than the maximum age it is set aside
+	if _, err := manager.db.Exec("UPDATE outbox SET created_at = ? WHERE id = ?",
+		time.Now().UTC().Add(-2*time.Hour), bad.ID); err != nil {
+		t.Fatalf("failed to age entry: %v", err)
+	}
+	endBackoff(t, manager)
+	if err := outbox.Flush(ctx); err != nil {
+		t.Fatalf("second flush: %v", err)
+	}
+	if got := outboxStatus(t, manager, bad.ID); got != OutboxDead {
+		t.Errorf("failing entry is %s, want dead", got)
+	}
+	if got := outboxStatus(t, manager, good.ID); got != OutboxDelivered {
+		t.Errorf("later entry is %s, want delivered", got)
+	}
+	if len(notified) != 1 || notified[0].ID != bad.ID || notified[0].Status != OutboxDead || notified[0].ChatID != 7 {
+		t.Errorf("notified %+v, want the dead entry only", notified)
+	}
+}
+
+func TestOutboxSkipsStoredRowsOnRetry(t *testing.T) {
+	ctx := context.Background()
+	outbox, manager, taskStore := newTestOutbox(t)
+
+	if _, err := manager.AddOutboxEntry(ctx, 1, "b1", []store.Task{{ID: "t0"}}); err != nil {
+		t.Fatalf("AddOutboxEntry: %v", err)
+	}
+	if err := outbox.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if taskStore.lists != 0 {
+		t.Errorf("first delivery listed the store %d times, want none", taskStore.lists)
+	}
+
+	// The store kept one row of a failed attempt, as when a response is lost
+	entry, err := manager.AddOutboxEntry(ctx, 1, "b2", []store.Task{{ID: "t1"}, {ID: "t2"}})
+	if err != nil {
+		t.Fatalf("AddOutboxEntry: %v", err)
+	}
+	if err := taskStore.TaskStore.AddTasks(ctx, []store.Task{{ID: "t1"}}); err != nil {
+		t.Fatalf("AddTasks: %v", err)
+	}
+	if err := manager.RecordOutboxFailure(ctx, entry.ID, "timeout", time.Now()); err != nil {
+		t.Fatalf("RecordOutboxFailure: %v", err)
+	}
+	taskStore.added = 0
+
+	if err := outbox.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if taskStore.lists != 1 {
+		t.Errorf("retry listed the store %d times, want once", taskStore.lists)
+	}
+	if taskStore.added != 1 {
+		t.Errorf("retry added %d rows, want only the missing one", taskStore.added)
+	}
+}
+
+func TestPruneOutboxDeletesOldDeliveredEntries(t *testing.T) {
+	ctx := context.Background()
+	outbox, manager, taskStore := newTestOutbox(t)
+	taskStore.fail["stuck"] = true
+
+	old, err := manager.AddOutboxEntry(ctx, 1, "b1", []store.Task{{ID: "old"}})
+	if err != nil {
+		t.Fatalf("AddOutboxEntry: %v", err)
+	}
+	recent, err := manager.AddOutboxEntry(ctx, 1, "b2", []store.Task{{ID: "recent"}})
+	if err != nil {
+		t.Fatalf("AddOutboxEntry: %v", err)
+	}
+	stuck, err := manager.AddOutboxEntry(ctx, 1, "b3", []store.Task{{ID: "stuck"}})
+	if err != nil {
+		t.Fatalf("AddOutboxEntry: %v", err)
+	}
+	outbox.Flush(ctx)
+
+	if _, err := manager.db.Exec("UPDATE outbox SET delivered_at = ? WHERE id = ?",
+		time.Now().UTC().Add(-48*time.Hour), old.ID); err != nil {
+		t.Fatalf("failed to age entry: %v", err)
+	}
+
+	pruned, err := manager.PruneOutbox(ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("PruneOutbox: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("pruned %d entries, want 1", pruned)
+	}
+
+	var remaining []int64
+	rows, err := manager.db.Query("SELECT id FROM outbox ORDER BY id")
+	if err != nil {
+		t.Fatalf("failed to list outbox: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		rows.Scan(&id)
+		remaining = append(remaining, id)
+	}
+	if len(remaining) != 2 || remaining[0] != recent.ID || remaining[1] != stuck.ID {
+		t.Errorf("remaining entries %v, want %d and %d", remaining, recent.ID, stuck.ID)
+	}
+}
+
+func TestHasPendingOutboxTask(t *testing.T) {
+	ctx := context.Background()
+	outbox, manager, taskStore := newTestOutbox(t)
+	taskStore.fail["waiting"] = true
+
+	for _, id := range []string{"saved", "waiting"} {
+		if _, err := manager.AddOutboxEntry(ctx, 1, "", []store.Task{{ID: id}}); err != nil {
+			t.Fatalf("AddOutboxEntry: %v", err)
+		}
+	}
+	outbox.Flush(ctx)
+
+	tests := []struct {
+		ids  []string
+		want bool
+	}{
+		{[]string{"saved"}, false},
+		{[]string{"waiting"}, true},
+		{[]string{"saved", "waiting"}, true},
+		{[]string{"unknown"}, false},
+	}
+	for _, tt := range tests {
+		got, err := manager.HasPendingOutboxTask(ctx, tt.ids)
+		if err != nil {
+			t.Fatalf("HasPendingOutboxTask: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("HasPendingOutboxTask(%v) = %v, want %v", tt.ids, got, tt.want)
+		}
+	}
+}
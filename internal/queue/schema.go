@@ -11,7 +11,7 @@ import (
 )
 
 // Schema version for database migrations
-const schemaVersion = 1
+const schemaVersion = 4
 
 // TaskStatus represents the status of a queued task
 type TaskStatus string
@@ -37,12 +37,21 @@ const (
 type QueuedTask struct {
 	ID          int64
 	BatchID     string
+	ChatID      int64
 	MessageText string
 	FormatType  FormatType
 	Status      TaskStatus
 	CreatedAt   time.Time
 	ProcessedAt *time.Time
 	Error       *string
+
+	// TraceContext is the serialized trace context of the message that queued
+	// the task, so processing continues the same trace
+	TraceContext string
+
+	// PromptVersion is the version of the prompt that parsed the task, empty
+	// until it has been parsed by the LLM
+	PromptVersion string
 }
 
 // Manager handles queue operations
@@ -101,10 +110,53 @@ func (m *Manager) initSchema() error {
 		return fmt.Errorf("failed to create tasks_queue table: %w", err)
 	}
 
+	// Version 2: remember which chat a queued message came from
+	if err := m.ensureColumn(ctx, "tasks_queue", "chat_id", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Version 3: carry trace context from the handler to the worker
+	if err := m.ensureColumn(ctx, "tasks_queue", "trace_context", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// Version 4: record which prompt version parsed each task
+	if err := m.ensureColumn(ctx, "tasks_queue", "prompt_version", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// Create outbox table for parsed rows waiting to reach the task store
+	_, err = m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_id INTEGER NOT NULL,
+			batch_id TEXT NOT NULL DEFAULT '',
+			tasks TEXT NOT NULL,
+			status TEXT DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			buffered INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT,
+			trace_context TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP,
+			next_attempt_at TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create outbox table: %w", err)
+	}
+	if err := m.ensureColumn(ctx, "outbox", "trace_context", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := m.ensureColumn(ctx, "outbox", "next_attempt_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+
 	// Create indexes
 	_, err = m.db.ExecContext(ctx, `
 		CREATE INDEX IF NOT EXISTS idx_tasks_queue_status ON tasks_queue(status);
 		CREATE INDEX IF NOT EXISTS idx_tasks_queue_batch_id ON tasks_queue(batch_id);
+		CREATE INDEX IF NOT EXISTS idx_outbox_status ON outbox(status);
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to create indexes: %w", err)
@@ -120,12 +172,53 @@ func (m *Manager) initSchema() error {
 		}
 	} else if err != nil {
 		return fmt.Errorf("failed to check schema version: %w", err)
+	} else if version < schemaVersion {
+		_, err = m.db.ExecContext(ctx, "UPDATE schema_version SET version = ?", schemaVersion)
+		if err != nil {
+			return fmt.Errorf("failed to update schema version: %w", err)
+		}
 	}
 
 	log.Info().Int("version", schemaVersion).Msg("Queue database schema initialized")
 	return nil
 }
 
+// ensureColumn adds a column to an existing table if it is not there yet
+func (m *Manager) ensureColumn(ctx context.Context, table, column, definition string) error {
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s table: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan %s columns: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to inspect %s table: %w", table, err)
+	}
+
+	_, err = m.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add %s.%s column: %w", table, column, err)
+	}
+	return nil
+}
+
+// DB returns the underlying database so other components can keep their own
+// tables alongside the queue
+func (m *Manager) DB() *sql.DB {
+	return m.db
+}
+
 // Close closes the database connection
 func (m *Manager) Close() error {
 	return m.db.Close()
@@ -0,0 +1,427 @@
+package queue
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// listMarker matches a bullet ("-", "•", "*") or number ("1.", "2)") at the
+// start of a line
+var listMarker = regexp.MustCompile(`^\s*(?:[-•*–]|\d{1,2}[.)])\s+`)
+
+// Segment is the text of one task found in a message
+type Segment struct {
+	Text string
+	// Item is set for list items, which stand alone
+	Item bool
+	// Chained is set when the segment followed "then" or "after that",
+	// continuing the previous one
+	Chained bool
+}
+
+// tokenKind classifies tokens
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokComma
+	tokSemicolon
+	tokStop    // ".", "!" or "?" ending a sentence
+	tokNewline // a line break within a paragraph
+	tokOther   // "&", ":" and other punctuation between spaces
+)
+
+// token is a word or punctuation mark, with its byte offsets in the text
+type token struct {
+	kind       tokenKind
+	text       string
+	lower      string
+	start, end int
+}
+
+// markers follow a subject to make a clause, as in "Gemma to ..." or "Gemma
+// will ..."
+var markers = map[string]bool{
+	"to": true, "will": true, "should": true, "must": true, "can": true, "could": true,
+	"shall": true, "please": true,
+}
+
+// markerVerbs take "to" to make a marker, as in "Gemma needs to ..."
+var markerVerbs = map[string]bool{
+	"need": true, "needs": true, "has": true, "have": true, "is": true, "are": true, "got": true,
+}
+
+// subjectWords are subjects even though they are not capitalised names
+var subjectWords = map[string]bool{
+	"team": true, "everyone": true, "everybody": true, "we": true, "i": true, "someone": true,
+}
+
+// notSubjects are capitalised words that start sentences and take "to"
+// without being anyone, as in "Reply to Acme"
+var notSubjects = map[string]bool{
+	"reply": true, "respond": true, "talk": true, "speak": true, "go": true, "come": true, "write": true,
+	"send": true, "listen": true, "get": true, "add": true, "move": true, "need": true, "want": true,
+	"have": true, "try": true, "remember": true, "forward": true, "switch": true, "refer": true,
+	"return": true, "head": true, "up": true, "due": true, "back": true, "the": true, "and": true,
+	"then": true, "also": true, "remind": true, "ask": true, "tell": true, "how": true, "what": true,
+	"it": true, "this": true, "that": true,
+}
+
+// Segments splits a message into the texts of its tasks. List items ("-",
+// "•", "1.", "2)") are tasks of their own and any line ending in ":" before
+// them is a heading. Other text is split between sentences that each start a
+// clause, at "and" and commas that join clauses ("Sarah to review the budget
+// and Marcus to book the room") but not subjects ("Jemma, Lexi, and Johnny to
+// set up the meeting"), and always at semicolons, "then" and "after that",
+// the last two chaining the step to the one before.
+func Segments(message string) []Segment {
+	var segments []Segment
+
+	lines := strings.Split(message, "\n")
+	hasItems := false
+	for _, line := range lines {
+		if listMarker.MatchString(line) {
+			hasItems = true
+			break
+		}
+	}
+
+	// Consecutive narrative lines are segmented together as one paragraph
+	var paragraph []string
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(paragraph, "\n"))
+		paragraph = nil
+		if text == "" {
+			return
+		}
+		segments = append(segments, splitClauses(text, false)...)
+	}
+
+	for _, line := range lines {
+		if loc := listMarker.FindStringIndex(line); loc != nil {
+			flush()
+			segments = append(segments, splitClauses(strings.TrimSpace(line[loc[1]:]), true)...)
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if hasItems && strings.HasSuffix(trimmed, ":") && !startsClause(tokenize(trimmed), 0) {
+			// A heading such as "Tasks for this week:"
+			flush()
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	flush()
+
+	return segments
+}
+
+// splitClauses splits one paragraph or list item into segments
+func splitClauses(text string, item bool) []Segment {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	// Worked out once, so long lists of names take linear time
+	runs := subjectRuns(tokens)
+	startsAt := func(i int) bool { return clauseAt(tokens, runs, i) }
+	others := nonNames(tokens)
+
+	var segments []Segment
+	start := 0            // token the current segment starts at
+	chained := false      // whether the current segment follows a chain word
+	clause := startsAt(0) // whether a sentence in the current segment starts a clause
+	emit := func(end int) {
+		if seg := segmentText(text, tokens[start:end]); seg != "" {
+			segments = append(segments, Segment{Text: seg, Item: item, Chained: chained})
+		}
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		sepEnd, chain := separator(tokens, i)
+		if sepEnd == i {
+			continue
+		}
+		if sepEnd >= len(tokens) || i == start {
+			i = sepEnd - 1
+			continue
+		}
+
+		boundary := tokens[i].kind == tokStop || tokens[i].kind == tokNewline
+		split := false
+		switch {
+		case chain:
+			split = true
+		case boundary:
+			// A sentence starting a clause splits from the one before if that
+			// has a clause too; otherwise the earlier text is its context
+			next := startsAt(sepEnd)
+			split = clause && next
+			clause = clause || next
+		default:
+			// "and", "&" and commas split clauses, not lists of names, and
+			// not lead-ins such as "Also," that have no clause of their own
+			next := startsAt(sepEnd)
+			namesOnly := others[i] == others[start]
+			split = clause && next && !namesOnly
+			clause = clause || next
+		}
+		if !split {
+			i = sepEnd - 1
+			continue
+		}
+
+		end := i
+		if boundary {
+			end = i + 1 // keep the full stop with its sentence
+		}
+		emit(end)
+		start, chained, clause = sepEnd, chain, startsAt(sepEnd)
+		i = sepEnd - 1
+	}
+	emit(len(tokens))
+	return segments
+}
+
+// separator reports where a separator starting at tokens[i] ends, or i if
+// there is none, and whether it chains steps together
+func separator(tokens []token, i int) (int, bool) {
+	j := i
+	chain := false
+	switch t := tokens[i]; {
+	case t.kind == tokSemicolon:
+		j = i + 1
+	case t.kind == tokStop:
+		// A sentence ends where the next one starts with a capital
+		if i+1 < len(tokens) && startsUpper(tokens[i+1].text) {
+			j = i + 1
+		}
+		return j, false
+	case t.kind == tokNewline:
+		return i + 1, false
+	case t.kind == tokComma, t.lower == "and", t.kind == tokOther && t.text == "&":
+		j = i + 1
+		if t.kind == tokComma && j < len(tokens) && tokens[j].lower == "and" {
+			j++
+		}
+	case t.lower == "then", t.lower == "after" && i+1 < len(tokens) && tokens[i+1].lower == "that":
+		// Handled below
+	default:
+		return i, false
+	}
+
+	// "then" and "after that" make any separator a chain, and are one
+	// on their own
+	if j < len(tokens) && tokens[j].lower == "then" {
+		j, chain = j+1, true
+	} else if j+1 < len(tokens) && tokens[j].lower == "after" && tokens[j+1].lower == "that" {
+		j, chain = j+2, true
+	}
+	if j < len(tokens) && tokens[j].kind == tokComma && chain {
+		j++
+	}
+	return j, chain
+}
+
+// startsClause reports whether tokens from i start with a subject and a
+// marker, as in "Gemma to", "Jemma, Lexi and Johnny will", "The team needs
+// to" or "@sarah:"
+func startsClause(tokens []token, i int) bool {
+	return clauseAt(tokens, subjectRuns(tokens), i)
+}
+
+// subjectRuns returns, for each token, the index just past the run of
+// subjects joined by ",", "and", "&" or ", and" that starts there, or the
+// token itself if it isn't a subject
+func subjectRuns(tokens []token) []int {
+	runs := make([]int, len(tokens)+1)
+	runs[len(tokens)] = len(tokens)
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if !isSubject(tokens[i]) {
+			runs[i] = i
+			continue
+		}
+		j := i + 1
+		for j < len(tokens) && isJoiner(tokens[j]) {
+			j++
+		}
+		if j > i+1 && j < len(tokens) && isSubject(tokens[j]) {
+			runs[i] = runs[j]
+		} else {
+			runs[i] = i + 1
+		}
+	}
+	return runs
+}
+
+// clauseAt is startsClause with the subject runs worked out beforehand
+func clauseAt(tokens []token, runs []int, i int) bool {
+	if i >= len(tokens) {
+		return false
+	}
+	if strings.HasPrefix(tokens[i].text, "@") {
+		return true
+	}
+	if tokens[i].lower == "the" && i+1 < len(tokens) && subjectWords[tokens[i+1].lower] {
+		i++
+	}
+
+	end := runs[i]
+	if end == i || end >= len(tokens) {
+		return false
+	}
+
+	word := tokens[end].lower
+	if markers[word] {
+		return true
+	}
+	if markerVerbs[word] && end+1 < len(tokens) && tokens[end+1].lower == "to" {
+		return true
+	}
+	if (word == "is" || word == "are") && end+2 < len(tokens) && tokens[end+1].lower == "going" && tokens[end+2].lower == "to" {
+		return true
+	}
+	return false
+}
+
+// isJoiner reports whether a token joins two subjects
+func isJoiner(t token) bool {
+	return t.kind == tokComma || t.lower == "and" || t.text == "&"
+}
+
+// isSubject reports whether a token can name who does a task
+func isSubject(t token) bool {
+	if t.kind != tokWord {
+		return false
+	}
+	if subjectWords[t.lower] {
+		return true
+	}
+	if notSubjects[t.lower] {
+		return false
+	}
+	for _, r := range t.text {
+		if !unicode.IsLetter(r) && r != '\'' && r != '’' && r != '-' {
+			return false
+		}
+	}
+	return startsUpper(t.text)
+}
+
+// nonNames counts, for each token index, the tokens before it that are not
+// subjects or the words joining them, so that any span can be checked for
+// holding nothing but names
+func nonNames(tokens []token) []int {
+	counts := make([]int, len(tokens)+1)
+	for i, t := range tokens {
+		counts[i+1] = counts[i]
+		if !isSubject(t) && !isJoiner(t) && t.lower != "the" {
+			counts[i+1]++
+		}
+	}
+	return counts
+}
+
+// segmentText returns the text spanned by tokens, without separators left at
+// either end
+func segmentText(text string, tokens []token) string {
+	for len(tokens) > 0 && (tokens[0].kind != tokWord || tokens[0].lower == "and" || tokens[0].lower == "then") {
+		tokens = tokens[1:]
+	}
+	for len(tokens) > 0 && (tokens[len(tokens)-1].kind == tokComma || tokens[len(tokens)-1].kind == tokSemicolon ||
+		tokens[len(tokens)-1].kind == tokNewline || tokens[len(tokens)-1].lower == "and") {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(text[tokens[0].start:tokens[len(tokens)-1].end])
+}
+
+// tokenize splits text into words and punctuation. Full stops, colons and
+// commas inside words, as in "v2.1", "10:30" or "1,000", stay part of them.
+func tokenize(text string) []token {
+	var tokens []token
+	add := func(kind tokenKind, start, end int) {
+		s := text[start:end]
+		tokens = append(tokens, token{kind: kind, text: s, lower: strings.ToLower(s), start: start, end: end})
+	}
+
+	i := 0
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case r == '\n':
+			add(tokNewline, i, i+size)
+			i += size
+		case unicode.IsSpace(r):
+			i += size
+		case isBreak(text, i):
+			kind := tokOther
+			switch r {
+			case ',':
+				kind = tokComma
+			case ';':
+				kind = tokSemicolon
+			case '.', '!', '?':
+				kind = tokStop
+			}
+			// Runs such as "..." or "?!" are one token
+			end := i + size
+			for end < len(text) && text[end] == text[i] {
+				end++
+			}
+			add(kind, i, end)
+			i = end
+		default:
+			start := i
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if unicode.IsSpace(r) || isBreak(text, i) {
+					break
+				}
+				i += size
+			}
+			add(tokWord, start, i)
+		}
+	}
+	return tokens
+}
+
+// isBreak reports whether the punctuation at text[i] separates words rather
+// than being part of one
+func isBreak(text string, i int) bool {
+	switch text[i] {
+	case ',', ';', '.', '!', '?', ':':
+	case '&':
+		// "R&D" is a word; "review & merge" has a separator
+		return (i == 0 || text[i-1] == ' ') && (i+1 == len(text) || text[i+1] == ' ')
+	default:
+		return false
+	}
+	if text[i] == ';' {
+		return true
+	}
+	// Punctuation followed by more of the word ("v2.1", "10:30", "1,000",
+	// "example.com") is part of it
+	next := i + 1
+	for next < len(text) && text[next] == text[i] {
+		next++
+	}
+	if next < len(text) && i > 0 && !unicode.IsSpace(rune(text[i-1])) {
+		r, _ := utf8.DecodeRuneInString(text[next:])
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// startsUpper reports whether s starts with an upper-case letter
+func startsUpper(s string) bool {
+	r, _ := utf8.DecodeRuneInString(strings.TrimPrefix(s, "@"))
+	return unicode.IsUpper(r)
+}
@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// sampleCase is an entry of test/data/sample_messages.json
+type sampleCase struct {
+	ID       string `json:"id"`
+	Message  string `json:"message"`
+	Expected struct {
+		Format FormatType `json:"format"`
+		Tasks  []struct {
+			People    []string `json:"people"`
+			DependsOn *int     `json:"dependsOn"`
+		} `json:"tasks"`
+		Error bool `json:"error"`
+	} `json:"expected"`
+}
+
+func loadSamples(tb testing.TB) []sampleCase {
+	tb.Helper()
+	data, err := os.ReadFile("../../test/data/sample_messages.json")
+	if err != nil {
+		tb.Fatalf("failed to read sample messages: %v", err)
+	}
+	var corpus struct {
+		TestCases []sampleCase `json:"test_cases"`
+	}
+	if err := json.Unmarshal(data, &corpus); err != nil {
+		tb.Fatalf("failed to decode sample messages: %v", err)
+	}
+	return corpus.TestCases
+}
+
+// expectedFormat returns the format a sample should be detected as: the one
+// it names, or else a single task unless several unchained tasks are expected
+func expectedFormat(tc sampleCase) FormatType {
+	if tc.Expected.Format != "" {
+		return tc.Expected.Format
+	}
+	parts := 0
+	for _, task := range tc.Expected.Tasks {
+		if task.DependsOn == nil {
+			parts++
+		}
+	}
+	if parts < 2 {
+		return FormatSingleTask
+	}
+	return FormatNarrativeMulti
+}
+
+func TestSegments(t *testing.T) {
+	required := map[string]bool{
+		"multiple_people_task":        false,
+		"numbered_list":               false,
+		"semicolon_list":              false,
+		"task_splitting_then":         false,
+		"after_that_chain":            false,
+		"mixed_bullets_and_narrative": false,
+	}
+
+	for _, tc := range loadSamples(t) {
+		if tc.Expected.Error {
+			continue
+		}
+		if _, ok := required[tc.ID]; ok {
+			required[tc.ID] = true
+		}
+
+		t.Run(tc.ID, func(t *testing.T) {
+			segments := Segments(tc.Message)
+			if len(segments) != len(tc.Expected.Tasks) {
+				t.Fatalf("got %d segments %+v, want %d", len(segments), segments, len(tc.Expected.Tasks))
+			}
+
+			for i, segment := range segments {
+				task := tc.Expected.Tasks[i]
+				for _, person := range task.People {
+					if person == "team" {
+						continue
+					}
+					if !strings.Contains(strings.ToLower(segment.Text), person) {
+						t.Errorf("segment %d %q doesn't name %s", i, segment.Text, person)
+					}
+				}
+				if chained := task.DependsOn != nil; segment.Chained != chained {
+					t.Errorf("segment %d %q chained = %v, want %v", i, segment.Text, segment.Chained, chained)
+				}
+			}
+
+			if got, want := DetectMessageFormat(tc.Message), expectedFormat(tc); got != want {
+				t.Errorf("format = %s, want %s", got, want)
+			}
+		})
+	}
+
+	for id, found := range required {
+		if !found {
+			t.Errorf("sample corpus is missing %s", id)
+		}
+	}
+}
+
+func TestSplitMessageKeepsChainsTogether(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []string
+	}{
+		{
+			"Emma to finalize the contract terms and then Alex to send it to legal",
+			[]string{"Emma to finalize the contract terms, then Alex to send it to legal"},
+		},
+		{
+			"Gemma to book the venue; Lilly to order the catering",
+			[]string{"Gemma to book the venue", "Lilly to order the catering"},
+		},
+		{
+			"Gemma to book the venue; then Lilly to order the catering",
+			[]string{"Gemma to book the venue, then Lilly to order the catering"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := SplitMessage(tt.message, FormatNarrativeMulti)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("SplitMessage(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func FuzzSegments(f *testing.F) {
+	for _, tc := range loadSamples(f) {
+		f.Add(tc.Message)
+	}
+
+	f.Fuzz(func(t *testing.T, message string) {
+		for _, segment := range Segments(message) {
+			if strings.TrimSpace(segment.Text) == "" {
+				t.Fatalf("empty segment in %q", message)
+			}
+			if !strings.Contains(message, segment.Text) {
+				t.Fatalf("segment %q is not part of %q", segment.Text, message)
+			}
+		}
+
+		format := DetectMessageFormat(message)
+		for _, part := range SplitMessage(message, format) {
+			if strings.TrimSpace(part) == "" && strings.TrimSpace(message) != "" {
+				t.Fatalf("empty part in %q", message)
+			}
+		}
+	})
+}
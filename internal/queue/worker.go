@@ -7,19 +7,31 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+	"github.com/giovannigabriele/go-todo-bot/internal/tracing"
 )
 
 // TaskProcessor is a function that processes a single task
 type TaskProcessor func(ctx context.Context, task *QueuedTask) error
 
-// Worker handles task processing
+// StatusObserver is called after a queued task moves to a new status
+type StatusObserver func(ctx context.Context, task *QueuedTask)
+
+// Worker handles task processing. The number of loops and the poll interval
+// can be changed while it runs.
 type Worker struct {
 	manager    *Manager
 	processor  TaskProcessor
+	observer   StatusObserver
+	mu         sync.Mutex
 	numWorkers int
 	interval   time.Duration
+	ctx        context.Context // set by Start
+	loops      []chan struct{} // stop channel of each running loop
 	wg         sync.WaitGroup
-	stopCh     chan struct{}
 }
 
 // NewWorker creates a new task worker
@@ -29,57 +41,128 @@ func NewWorker(manager *Manager, processor TaskProcessor, numWorkers int, interv
 		processor:  processor,
 		numWorkers: numWorkers,
 		interval:   interval,
-		stopCh:     make(chan struct{}),
 	}
 }
 
+// OnStatusChange registers fn to be told about each status a task moves to.
+// Call it before Start.
+func (w *Worker) OnStatusChange(fn StatusObserver) {
+	w.observer = fn
+}
+
+// setStatus updates a task's status and tells the observer
+func (w *Worker) setStatus(ctx context.Context, task *QueuedTask, status TaskStatus, errorMsg *string) error {
+	if err := w.manager.UpdateTaskStatus(ctx, task.ID, status, errorMsg); err != nil {
+		return err
+	}
+
+	task.Status = status
+	task.Error = errorMsg
+	if w.observer != nil {
+		w.observer(ctx, task)
+	}
+	return nil
+}
+
 // Start begins task processing
 func (w *Worker) Start(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	log.Info().Int("workers", w.numWorkers).Msg("Starting task workers...")
 
-	for i := 0; i < w.numWorkers; i++ {
-		w.wg.Add(1)
-		go w.processLoop(ctx, i)
-	}
+	w.ctx = ctx
+	w.resize()
 }
 
 // Stop gracefully stops task processing
 func (w *Worker) Stop() {
 	log.Info().Msg("Stopping task workers...")
-	close(w.stopCh)
+
+	w.mu.Lock()
+	for _, stopCh := range w.loops {
+		close(stopCh)
+	}
+	w.loops = nil
+	w.ctx = nil
+	w.mu.Unlock()
+
 	w.wg.Wait()
 	log.Info().Msg("Task workers stopped")
 }
 
+// SetWorkers changes the number of processing loops, starting or stopping
+// loops if the worker is running. Stopped loops finish their current task.
+func (w *Worker) SetWorkers(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.numWorkers = n
+	if w.ctx != nil {
+		w.resize()
+	}
+}
+
+// SetInterval changes how often idle loops poll for pending tasks
+func (w *Worker) SetInterval(interval time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.interval = interval
+}
+
+// resize starts or stops loops until numWorkers are running. The caller must
+// hold mu.
+func (w *Worker) resize() {
+	for len(w.loops) < w.numWorkers {
+		stopCh := make(chan struct{})
+		w.loops = append(w.loops, stopCh)
+		w.wg.Add(1)
+		go w.processLoop(w.ctx, len(w.loops)-1, stopCh)
+	}
+	for len(w.loops) > w.numWorkers {
+		last := len(w.loops) - 1
+		close(w.loops[last])
+		w.loops = w.loops[:last]
+	}
+}
+
+// pollInterval returns the current poll interval
+func (w *Worker) pollInterval() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.interval
+}
+
 // processLoop runs the main processing loop for a worker
-func (w *Worker) processLoop(ctx context.Context, workerID int) {
+func (w *Worker) processLoop(ctx context.Context, workerID int, stopCh <-chan struct{}) {
 	defer w.wg.Done()
 
 	log.Info().Int("worker_id", workerID).Msg("Task worker started")
 
-	ticker := time.NewTicker(w.interval)
-	defer ticker.Stop()
+	timer := time.NewTimer(w.pollInterval())
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			log.Info().Int("worker_id", workerID).Msg("Task worker stopping due to context cancellation")
 			return
-		case <-w.stopCh:
+		case <-stopCh:
 			log.Info().Int("worker_id", workerID).Msg("Task worker stopping due to stop signal")
 			return
-		case <-ticker.C:
+		case <-timer.C:
 			if err := w.processPendingTask(ctx); err != nil {
 				log.Error().Err(err).Int("worker_id", workerID).Msg("Error processing pending task")
 			}
+			timer.Reset(w.pollInterval())
 		}
 	}
 }
 
 // processPendingTask processes a single pending task
 func (w *Worker) processPendingTask(ctx context.Context) error {
-	// Get next pending task
-	task, err := w.manager.GetNextPendingTask(ctx)
+	// Claim the next pending task; it comes back marked running
+	task, err := w.manager.ClaimNextPendingTask(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get next pending task: %w", err)
 	}
@@ -87,23 +170,34 @@ func (w *Worker) processPendingTask(ctx context.Context) error {
 		return nil // No pending tasks
 	}
 
-	// Update status to running
-	if err := w.manager.UpdateTaskStatus(ctx, task.ID, StatusRunning, nil); err != nil {
-		return fmt.Errorf("failed to update task status to running: %w", err)
+	// Continue the trace of the message that queued the task
+	ctx, span := tracing.Start(tracing.Extract(ctx, task.TraceContext), "queue.process",
+		attribute.Int64("queue.task_id", task.ID),
+		attribute.String("queue.batch_id", task.BatchID),
+	)
+	defer span.End()
+
+	if w.observer != nil {
+		w.observer(ctx, task)
 	}
 
 	// Process the task
+	start := time.Now()
 	err = w.processor(ctx, task)
+	metrics.WorkerBusy.Add(metrics.Since(start))
+	metrics.QueueTasksProcessed.WithLabelValues(metrics.Outcome(err)).Inc()
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		errMsg := err.Error()
-		if err := w.manager.UpdateTaskStatus(ctx, task.ID, StatusFailed, &errMsg); err != nil {
+		if err := w.setStatus(ctx, task, StatusFailed, &errMsg); err != nil {
 			log.Error().Err(err).Int64("task_id", task.ID).Msg("Failed to update task status to failed")
 		}
 		return fmt.Errorf("failed to process task: %w", err)
 	}
 
 	// Update status to complete
-	if err := w.manager.UpdateTaskStatus(ctx, task.ID, StatusComplete, nil); err != nil {
+	if err := w.setStatus(ctx, task, StatusComplete, nil); err != nil {
 		return fmt.Errorf("failed to update task status to complete: %w", err)
 	}
 
@@ -111,6 +205,7 @@ func (w *Worker) processPendingTask(ctx context.Context) error {
 		Int64("task_id", task.ID).
 		Str("batch_id", task.BatchID).
 		Str("format_type", string(task.FormatType)).
+		Str("trace_id", tracing.TraceID(ctx)).
 		Msg("Task processed successfully")
 
 	return nil
@@ -0,0 +1,357 @@
+// Package rrule reads and writes the subset of iCalendar recurrence rules
+// (RFC 5545 RRULE) that recurring tasks use: FREQ of DAILY, WEEKLY, MONTHLY
+// or YEARLY, with INTERVAL, BYDAY (with an ordinal for monthly rules, as in
+// "1MO" or "-1FR") and BYMONTHDAY. Rules repeat by date; the time of day is
+// not part of them.
+package rrule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is how often a rule repeats
+type Frequency string
+
+// Frequencies
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// maxYears bounds the search for the next occurrence
+const maxYears = 10
+
+var dayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Day is a BYDAY entry: a weekday, with an ordinal within the month (1 for
+// the first, -1 for the last) in monthly rules, or 0
+type Day struct {
+	Weekday time.Weekday
+	N       int
+}
+
+// Rule is a recurrence rule
+type Rule struct {
+	Freq       Frequency
+	Interval   int // 1 when not set
+	ByDay      []Day
+	ByMonthDay int // 0 when not set; negative counts from the end of the month
+}
+
+// Parse reads a rule such as "FREQ=WEEKLY;BYDAY=MO" or
+// "RRULE:FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=1"
+func Parse(s string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(strings.ToUpper(s)), "RRULE:")
+	if s == "" {
+		return Rule{}, fmt.Errorf("empty rule")
+	}
+
+	for _, part := range strings.Split(strings.Trim(s, ";"), ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return Rule{}, fmt.Errorf("invalid rule part %q", part)
+		}
+		switch key {
+		case "FREQ":
+			rule.Freq = Frequency(value)
+			switch rule.Freq {
+			case Daily, Weekly, Monthly, Yearly:
+			default:
+				return Rule{}, fmt.Errorf("unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 366 {
+				return Rule{}, fmt.Errorf("invalid interval %q", value)
+			}
+			rule.Interval = n
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day, err := parseDay(code)
+				if err != nil {
+					return Rule{}, err
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			n, err := strconv.Atoi(value)
+			if err != nil || n == 0 || n < -31 || n > 31 {
+				return Rule{}, fmt.Errorf("invalid month day %q", value)
+			}
+			rule.ByMonthDay = n
+		case "WKST":
+			// Weeks always start on Monday
+		default:
+			return Rule{}, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return Rule{}, fmt.Errorf("rule has no FREQ")
+	}
+	for _, day := range rule.ByDay {
+		if day.N != 0 && rule.Freq != Monthly {
+			return Rule{}, fmt.Errorf("ordinal days need a monthly rule")
+		}
+	}
+	if rule.ByMonthDay != 0 && rule.Freq != Monthly {
+		return Rule{}, fmt.Errorf("BYMONTHDAY needs a monthly rule")
+	}
+	if rule.ByMonthDay != 0 && len(rule.ByDay) > 0 {
+		return Rule{}, fmt.Errorf("BYDAY and BYMONTHDAY can't be combined")
+	}
+	return rule, nil
+}
+
+// parseDay reads a BYDAY entry such as "MO", "1MO" or "-1FR"
+func parseDay(code string) (Day, error) {
+	code = strings.TrimSpace(code)
+	if len(code) < 2 {
+		return Day{}, fmt.Errorf("invalid day %q", code)
+	}
+	prefix, name := code[:len(code)-2], code[len(code)-2:]
+
+	day := Day{Weekday: -1}
+	for i, c := range dayCodes {
+		if c == name {
+			day.Weekday = time.Weekday(i)
+		}
+	}
+	if day.Weekday < 0 {
+		return Day{}, fmt.Errorf("invalid day %q", code)
+	}
+	if prefix != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(prefix, "+"))
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return Day{}, fmt.Errorf("invalid day %q", code)
+		}
+		day.N = n
+	}
+	return day, nil
+}
+
+// String writes the rule in RRULE form, without the "RRULE:" prefix
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			codes[i] = dayCodes[day.Weekday]
+			if day.N != 0 {
+				codes[i] = strconv.Itoa(day.N) + codes[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if r.ByMonthDay != 0 {
+		parts = append(parts, fmt.Sprintf("BYMONTHDAY=%d", r.ByMonthDay))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first date after the day of after on which the rule
+// occurs. Intervals are counted from the day of start, which also stands in
+// for the parts the rule leaves out: the weekday of a weekly rule without
+// BYDAY, the day of the month of a monthly rule without BYDAY or BYMONTHDAY,
+// and the date of a yearly rule. Dates are midnight in after's location; the
+// zero time is returned if the rule never occurs again.
+func (r Rule) Next(start, after time.Time) time.Time {
+	loc := after.Location()
+	start = midnight(start.In(loc))
+	day := midnight(after).AddDate(0, 0, 1)
+	if day.Before(start) {
+		day = start
+	}
+
+	limit := day.AddDate(maxYears*max(r.Interval, 1), 0, 0)
+	for ; day.Before(limit); day = day.AddDate(0, 0, 1) {
+		if r.occurs(start, day) {
+			return day
+		}
+	}
+	return time.Time{}
+}
+
+// occurs reports whether the rule occurs on day
+func (r Rule) occurs(start, day time.Time) bool {
+	interval := max(r.Interval, 1)
+	switch r.Freq {
+	case Daily:
+		return r.onWeekday(day) && daysBetween(start, day)%interval == 0
+	case Weekly:
+		if daysBetween(monday(start), monday(day))/7%interval != 0 {
+			return false
+		}
+		if len(r.ByDay) == 0 {
+			return day.Weekday() == start.Weekday()
+		}
+		return r.onWeekday(day)
+	case Monthly:
+		months := (day.Year()-start.Year())*12 + int(day.Month()-start.Month())
+		if months%interval != 0 {
+			return false
+		}
+		switch {
+		case len(r.ByDay) > 0:
+			return r.onMonthWeekday(day)
+		case r.ByMonthDay > 0:
+			return day.Day() == r.ByMonthDay
+		case r.ByMonthDay < 0:
+			return day.Day() == daysIn(day)+r.ByMonthDay+1
+		default:
+			return day.Day() == start.Day()
+		}
+	case Yearly:
+		return (day.Year()-start.Year())%interval == 0 && day.Month() == start.Month() && day.Day() == start.Day()
+	}
+	return false
+}
+
+// onWeekday reports whether day falls on one of the BYDAY days, or on any
+// day without BYDAY
+func (r Rule) onWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, d := range r.ByDay {
+		if d.Weekday == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// onMonthWeekday reports whether day is one of the BYDAY days of its month,
+// such as its first Monday
+func (r Rule) onMonthWeekday(day time.Time) bool {
+	for _, d := range r.ByDay {
+		if d.Weekday != day.Weekday() {
+			continue
+		}
+		switch {
+		case d.N == 0:
+			return true
+		case d.N > 0 && (day.Day()-1)/7+1 == d.N:
+			return true
+		case d.N < 0 && (daysIn(day)-day.Day())/7+1 == -d.N:
+			return true
+		}
+	}
+	return false
+}
+
+// Describe writes the rule in words, such as "every Monday" or "every month
+// on the 1st"
+func (r Rule) Describe() string {
+	every := "every "
+	if r.Interval == 2 {
+		every = "every other "
+	} else if r.Interval > 2 {
+		every = fmt.Sprintf("every %d ", r.Interval)
+	}
+	unit := map[Frequency]string{Daily: "day", Weekly: "week", Monthly: "month", Yearly: "year"}[r.Freq]
+	if r.Interval > 2 {
+		unit += "s"
+	}
+
+	switch {
+	case (r.Freq == Weekly || r.Freq == Daily) && isWeekdays(r.ByDay):
+		if r.Interval == 1 {
+			return "every weekday"
+		}
+		return every + unit + " on weekdays"
+	case (r.Freq == Weekly || r.Freq == Daily) && len(r.ByDay) > 0:
+		if r.Interval == 1 {
+			return "every " + dayList(r.ByDay)
+		}
+		return every + unit + " on " + dayList(r.ByDay)
+	case r.Freq == Monthly && len(r.ByDay) > 0:
+		return every + unit + " on the " + dayList(r.ByDay)
+	case r.Freq == Monthly && r.ByMonthDay == -1:
+		return every + unit + " on the last day"
+	case r.Freq == Monthly && r.ByMonthDay != 0:
+		return every + unit + " on the " + ordinal(r.ByMonthDay)
+	}
+	return every + unit
+}
+
+// dayList names days, as in "Monday and Thursday" or "first Monday"
+func dayList(days []Day) string {
+	names := make([]string, len(days))
+	for i, d := range days {
+		names[i] = d.Weekday.String()
+		switch {
+		case d.N == -1:
+			names[i] = "last " + names[i]
+		case d.N > 0:
+			names[i] = []string{"", "first", "second", "third", "fourth", "fifth"}[d.N] + " " + names[i]
+		case d.N < 0:
+			names[i] = ordinal(-d.N) + " last " + names[i]
+		}
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// isWeekdays reports whether days are exactly Monday to Friday
+func isWeekdays(days []Day) bool {
+	if len(days) != 5 {
+		return false
+	}
+	seen := make(map[time.Weekday]bool)
+	for _, d := range days {
+		if d.N != 0 || d.Weekday == time.Saturday || d.Weekday == time.Sunday {
+			return false
+		}
+		seen[d.Weekday] = true
+	}
+	return len(seen) == 5
+}
+
+// ordinal writes n as "1st", "2nd", "23rd" and so on
+func ordinal(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// midnight returns the start of t's day
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// monday returns the Monday starting t's week
+func monday(t time.Time) time.Time {
+	return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+}
+
+// daysBetween counts the days from a to b, both midnight
+func daysBetween(a, b time.Time) int {
+	// Round to whole days, as daylight saving changes make some 23 or 25 hours
+	return int((b.Sub(a) + 12*time.Hour).Hours() / 24)
+}
+
+// daysIn returns the number of days in t's month
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
@@ -0,0 +1,112 @@
+package rrule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string // String of the parsed rule, or the start of the error
+		err  bool
+	}{
+		{"FREQ=WEEKLY;BYDAY=MO", "FREQ=WEEKLY;BYDAY=MO", false},
+		{"rrule:freq=monthly;interval=2;bymonthday=1", "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=1", false},
+		{"FREQ=MONTHLY;BYDAY=-1FR;", "FREQ=MONTHLY;BYDAY=-1FR", false},
+		{"FREQ=DAILY;INTERVAL=1;WKST=SU", "FREQ=DAILY", false},
+		{"", "empty rule", true},
+		{"FREQ=HOURLY", "unsupported frequency", true},
+		{"FREQ=DAILY;INTERVAL=0", "invalid interval", true},
+		{"FREQ=WEEKLY;BYDAY=XX", "invalid day", true},
+		{"FREQ=WEEKLY;BYDAY=1MO", "ordinal days need a monthly rule", true},
+		{"FREQ=WEEKLY;BYMONTHDAY=1", "BYMONTHDAY needs a monthly rule", true},
+		{"FREQ=MONTHLY;BYDAY=MO;BYMONTHDAY=1", "BYDAY and BYMONTHDAY can't be combined", true},
+		{"INTERVAL=2", "rule has no FREQ", true},
+		{"FREQ=DAILY;COUNT=3", "unsupported rule part", true},
+	}
+
+	for _, tt := range tests {
+		rule, err := Parse(tt.rule)
+		if tt.err {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("Parse(%q) error = %v, want %q", tt.rule, err, tt.want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.rule, err)
+			continue
+		}
+		if got := rule.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestNextExpandsRule(t *testing.T) {
+	tests := []struct {
+		rule  string
+		start string
+		want  []string
+	}{
+		{"FREQ=DAILY;INTERVAL=3", "2025-01-01", []string{"2025-01-01", "2025-01-04", "2025-01-07", "2025-01-10"}},
+		{"FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR", "2025-01-03", []string{"2025-01-03", "2025-01-06", "2025-01-07", "2025-01-08"}},
+		{"FREQ=WEEKLY;BYDAY=MO,TH", "2025-01-01", []string{"2025-01-02", "2025-01-06", "2025-01-09", "2025-01-13"}},
+		{"FREQ=WEEKLY;INTERVAL=2", "2025-01-01", []string{"2025-01-01", "2025-01-15", "2025-01-29", "2025-02-12"}},
+		{"FREQ=MONTHLY;BYDAY=1MO", "2025-01-01", []string{"2025-01-06", "2025-02-03", "2025-03-03", "2025-04-07"}},
+		{"FREQ=MONTHLY;BYDAY=-1FR", "2025-01-01", []string{"2025-01-31", "2025-02-28", "2025-03-28", "2025-04-25"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "2025-01-01", []string{"2025-01-31", "2025-02-28", "2025-03-31", "2025-04-30"}},
+		{"FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=15", "2025-01-01", []string{"2025-01-15", "2025-03-15", "2025-05-15", "2025-07-15"}},
+		// Months without the start's day are skipped
+		{"FREQ=MONTHLY", "2025-01-31", []string{"2025-01-31", "2025-03-31", "2025-05-31", "2025-07-31"}},
+		{"FREQ=YEARLY", "2024-02-29", []string{"2024-02-29", "2028-02-29", "2032-02-29"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			start, err := time.ParseInLocation("2006-01-02", tt.start, time.UTC)
+			if err != nil {
+				t.Fatalf("invalid start: %v", err)
+			}
+
+			var got []string
+			after := start.AddDate(0, 0, -1)
+			for range tt.want {
+				next := rule.Next(start, after)
+				if next.IsZero() {
+					break
+				}
+				got = append(got, next.Format("2006-01-02"))
+				after = next
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("occurrences %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextIsMidnightInLocation(t *testing.T) {
+	rule, err := Parse("FREQ=WEEKLY;BYDAY=MO")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+
+	// Late on Sunday in UTC is already Monday in Rome
+	after := time.Date(2025, 1, 5, 23, 30, 0, 0, time.UTC).In(rome)
+	next := rule.Next(after, after)
+	want := time.Date(2025, 1, 13, 0, 0, 0, 0, rome)
+	if !next.Equal(want) {
+		t.Errorf("Next = %s, want %s", next, want)
+	}
+}
@@ -0,0 +1,202 @@
+package rules
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayout is how due dates are written, as the LLM is asked to
+const dateLayout = "2006-01-02"
+
+// datePrefix is the optional word before a date, removed with it
+const datePrefix = `(?:(?:by|on|before|due|until|for|this|starting|from)\s+)?`
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+var numbers = map[string]int{"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7}
+
+const (
+	weekdayPattern = `(monday|mon|tuesday|tues|tue|wednesday|wed|thursday|thurs|thu|friday|fri|saturday|sat|sunday|sun)`
+	monthPattern   = `(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?`
+)
+
+// dateRule resolves the dates one pattern matches
+type dateRule struct {
+	pattern *regexp.Regexp
+	resolve func(m []string, now time.Time) (time.Time, bool)
+}
+
+// dateRules are tried in order; the first that matches wins
+var dateRules = []dateRule{
+	{rule(`(\d{4})-(\d{1,2})-(\d{1,2})`), func(m []string, now time.Time) (time.Time, bool) {
+		return calendarDate(atoi(m[1]), atoi(m[2]), atoi(m[3]), now)
+	}},
+	// Day first, as written in the UK and Europe
+	{rule(`(\d{1,2})/(\d{1,2})(?:/(\d{2}|\d{4}))?`), func(m []string, now time.Time) (time.Time, bool) {
+		return dayMonth(atoi(m[1]), time.Month(atoi(m[2])), m[3], now)
+	}},
+	{rule(`(\d{1,2})(?:st|nd|rd|th)?(?:\s+of)?\s+` + monthPattern), func(m []string, now time.Time) (time.Time, bool) {
+		return dayMonth(atoi(m[1]), months[m[2]], "", now)
+	}},
+	{rule(monthPattern + `\s+(\d{1,2})(?:st|nd|rd|th)?`), func(m []string, now time.Time) (time.Time, bool) {
+		return dayMonth(atoi(m[2]), months[m[1]], "", now)
+	}},
+	{rule(`(?:the\s+)?day\s+after\s+tomorrow`), func(m []string, now time.Time) (time.Time, bool) {
+		return now.AddDate(0, 0, 2), true
+	}},
+	{rule(`today|tonight|eod|end\s+of\s+(?:the\s+)?day`), func(m []string, now time.Time) (time.Time, bool) {
+		return now, true
+	}},
+	{rule(`tomorrow|tmrw|tmr`), func(m []string, now time.Time) (time.Time, bool) {
+		return now.AddDate(0, 0, 1), true
+	}},
+	{rule(`in\s+(\d+|an?|one|two|three|four|five|six|seven)\s+(day|week)s?`), func(m []string, now time.Time) (time.Time, bool) {
+		n, ok := numbers[m[1]]
+		if !ok {
+			n = atoi(m[1])
+		}
+		if m[2] == "week" {
+			n *= 7
+		}
+		return now.AddDate(0, 0, n), true
+	}},
+	{rule(`eow|end\s+of\s+(?:the\s+)?week`), func(m []string, now time.Time) (time.Time, bool) {
+		return nextWeekday(now, time.Friday, true), true
+	}},
+	{rule(`next\s+week`), func(m []string, now time.Time) (time.Time, bool) {
+		return nextWeekday(now, time.Monday, false), true
+	}},
+	{rule(`eom|end\s+of\s+(?:the\s+)?month`), func(m []string, now time.Time) (time.Time, bool) {
+		return time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, now.Location()), true
+	}},
+	{rule(`next\s+` + weekdayPattern), func(m []string, now time.Time) (time.Time, bool) {
+		day := nextWeekday(now, weekdays[m[1]], false)
+		// "next friday" said early in the week means the one after this week's
+		if sameWeek(day, now) {
+			day = day.AddDate(0, 0, 7)
+		}
+		return day, true
+	}},
+	{rule(weekdayPattern), func(m []string, now time.Time) (time.Time, bool) {
+		return nextWeekday(now, weekdays[m[1]], false), true
+	}},
+}
+
+// rule compiles a case-insensitive date pattern with its optional prefix,
+// matching whole words only
+func rule(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b` + datePrefix + `(?:` + pattern + `)\b`)
+}
+
+// resolveDate finds the first date in text, returning it formatted and the
+// text without it
+func resolveDate(text string, now time.Time) (string, string, bool) {
+	for _, r := range dateRules {
+		loc := r.pattern.FindStringSubmatchIndex(text)
+		if loc == nil {
+			continue
+		}
+
+		m := make([]string, len(loc)/2)
+		for i := range m {
+			if loc[2*i] >= 0 {
+				m[i] = strings.ToLower(text[loc[2*i]:loc[2*i+1]])
+			}
+		}
+		date, ok := r.resolve(m, now)
+		if !ok {
+			continue
+		}
+		return date.Format(dateLayout), text[:loc[0]] + text[loc[1]:], true
+	}
+	return "", text, false
+}
+
+// isDateWord reports whether word starts a date, such as "friday" or
+// "tomorrow"
+func isDateWord(word string) bool {
+	if _, ok := weekdays[word]; ok {
+		return true
+	}
+	if len(word) >= 3 {
+		if _, ok := months[word[:3]]; ok {
+			return true
+		}
+	}
+	switch word {
+	case "today", "tonight", "tomorrow", "next", "end", "eod", "eow", "eom":
+		return true
+	}
+	return false
+}
+
+// nextWeekday returns the first day after now, or from now if orToday is
+// set, that falls on weekday
+func nextWeekday(now time.Time, weekday time.Weekday, orToday bool) time.Time {
+	days := int(weekday - now.Weekday())
+	if days < 0 || (days == 0 && !orToday) {
+		days += 7
+	}
+	return now.AddDate(0, 0, days)
+}
+
+// sameWeek reports whether a and b fall in the same Monday-to-Sunday week
+func sameWeek(a, b time.Time) bool {
+	ay, aw := a.ISOWeek()
+	by, bw := b.ISOWeek()
+	return ay == by && aw == bw
+}
+
+// dayMonth resolves a day and month, in the given year or else the next time
+// that date comes round
+func dayMonth(day int, month time.Month, year string, now time.Time) (time.Time, bool) {
+	if year != "" {
+		y := atoi(year)
+		if y < 100 {
+			y += 2000
+		}
+		return calendarDate(y, int(month), day, now)
+	}
+
+	date, ok := calendarDate(now.Year(), int(month), day, now)
+	if ok && date.Before(truncateDay(now)) {
+		date, ok = calendarDate(now.Year()+1, int(month), day, now)
+	}
+	return date, ok
+}
+
+// calendarDate builds a date, rejecting ones that don't exist such as 31/02
+func calendarDate(year, month, day int, now time.Time) (time.Time, bool) {
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, now.Location())
+	if date.Year() != year || int(date.Month()) != month || date.Day() != day {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// truncateDay returns midnight at the start of t's day
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// atoi converts digits matched by a date pattern
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,144 @@
+package rules
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/rrule"
+)
+
+// ordinals name the week of the month in "the first Monday of every month"
+var ordinals = map[string]int{
+	"first": 1, "1st": 1, "second": 2, "2nd": 2, "third": 3, "3rd": 3, "fourth": 4, "4th": 4, "last": -1,
+}
+
+const (
+	every        = `(?:every|each)\s+`
+	ordinalWords = `(first|1st|second|2nd|third|3rd|fourth|4th|last)`
+	// weekdayList matches "monday", "mondays" or "monday and thursday"
+	weekdayList = weekdayPattern + `s?(?:\s*(?:,|and|&)\s*` + weekdayPattern + `s?)*`
+)
+
+// recurrenceRule turns the matches of one pattern into a rule
+type recurrenceRule struct {
+	pattern *regexp.Regexp
+	rule    func(m []string) rrule.Rule
+}
+
+// recurrenceRules are tried in order; the first that matches wins
+var recurrenceRules = []recurrenceRule{
+	{recurrence(every + ordinalWords + `\s+` + weekdayPattern + `\s+of\s+(?:the|every|each)\s+month`), func(m []string) rrule.Rule {
+		return rrule.Rule{Freq: rrule.Monthly, Interval: 1, ByDay: []rrule.Day{{Weekday: weekdays[m[2]], N: ordinals[m[1]]}}}
+	}},
+	{recurrence(`(?:on\s+)?the\s+(\d{1,2})(?:st|nd|rd|th)?\s+(?:day\s+)?of\s+(?:every|each|the)\s+month`), monthDay},
+	{recurrence(every + `month\s+on\s+the\s+(\d{1,2})(?:st|nd|rd|th)?`), monthDay},
+	{recurrence(every + `(?:week|working\s+)?day|on\s+weekdays`), func(m []string) rrule.Rule {
+		if strings.Contains(m[0], "week") || strings.Contains(m[0], "working") {
+			return weekly(1, "monday", "tuesday", "wednesday", "thursday", "friday")
+		}
+		return rrule.Rule{Freq: rrule.Daily, Interval: 1}
+	}},
+	{recurrence(`every\s+other\s+` + weekdayPattern), func(m []string) rrule.Rule {
+		return weekly(2, m[1])
+	}},
+	{recurrence(`every\s+(other|\d+)\s+(day|week|month|year)s?`), func(m []string) rrule.Rule {
+		n := 2
+		if m[1] != "other" {
+			n = atoi(m[1])
+		}
+		return rrule.Rule{Freq: frequencies[m[2]], Interval: max(n, 1)}
+	}},
+	{recurrence(`(?:` + every + `|weekly\s+on\s+)` + weekdayList), func(m []string) rrule.Rule {
+		return weekly(1, weekdaysIn(m[0])...)
+	}},
+	// "on Mondays" needs the plural to mean every Monday
+	{recurrence(`on\s+` + weekdayPattern + `s(?:\s*(?:,|and|&)\s*` + weekdayPattern + `s)*`), func(m []string) rrule.Rule {
+		return weekly(1, weekdaysIn(m[0])...)
+	}},
+	{recurrence(every + `(day|morning|evening|night|week|month|year)|(daily|weekly|monthly|yearly|annually)`), func(m []string) rrule.Rule {
+		unit := m[1] + m[2]
+		switch unit {
+		case "morning", "evening", "night", "daily":
+			unit = "day"
+		case "weekly":
+			unit = "week"
+		case "monthly":
+			unit = "month"
+		case "yearly", "annually":
+			unit = "year"
+		}
+		return rrule.Rule{Freq: frequencies[unit], Interval: 1}
+	}},
+}
+
+var frequencies = map[string]rrule.Frequency{
+	"day": rrule.Daily, "week": rrule.Weekly, "month": rrule.Monthly, "year": rrule.Yearly,
+}
+
+// weekdayNames matches each weekday in a list
+var weekdayNames = regexp.MustCompile(`(?i)\b` + weekdayPattern + `s?\b`)
+
+// recurrence compiles a case-insensitive recurrence pattern matching whole
+// words only
+func recurrence(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b(?:` + pattern + `)\b`)
+}
+
+// monthDay makes a monthly rule from a day of the month
+func monthDay(m []string) rrule.Rule {
+	day, _ := strconv.Atoi(m[1])
+	if day < 1 || day > 31 {
+		day = 1
+	}
+	return rrule.Rule{Freq: rrule.Monthly, Interval: 1, ByMonthDay: day}
+}
+
+// weekly makes a weekly rule on the named weekdays
+func weekly(interval int, names ...string) rrule.Rule {
+	rule := rrule.Rule{Freq: rrule.Weekly, Interval: interval}
+	for _, name := range names {
+		rule.ByDay = append(rule.ByDay, rrule.Day{Weekday: weekdays[strings.ToLower(name)]})
+	}
+	return rule
+}
+
+// weekdaysIn lists the weekdays named in text
+func weekdaysIn(text string) []string {
+	var names []string
+	for _, m := range weekdayNames.FindAllStringSubmatch(text, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// findRecurrence finds a phrase saying how a task repeats, such as "every
+// Monday" or "on the 1st of every month", returning its rule and the text
+// without it
+func findRecurrence(text string) (rrule.Rule, string, bool) {
+	for _, r := range recurrenceRules {
+		loc := r.pattern.FindStringSubmatchIndex(text)
+		if loc == nil {
+			continue
+		}
+
+		m := make([]string, len(loc)/2)
+		for i := range m {
+			if loc[2*i] >= 0 {
+				m[i] = strings.ToLower(text[loc[2*i]:loc[2*i+1]])
+			}
+		}
+		return r.rule(m), text[:loc[0]] + text[loc[1]:], true
+	}
+	return rrule.Rule{}, text, false
+}
+
+// firstOccurrence returns the first day on or after now's that rule falls on
+func firstOccurrence(rule rrule.Rule, now time.Time) string {
+	first := rule.Next(now, now.AddDate(0, 0, -1))
+	if first.IsZero() {
+		return unsure
+	}
+	return first.Format(dateLayout)
+}
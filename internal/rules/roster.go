@@ -0,0 +1,94 @@
+package rules
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// roster recognises team members by full or first name
+type roster struct {
+	// names maps lower-case full and first names to the name tasks use
+	names map[string]string
+	// longest is the most words in a name
+	longest int
+}
+
+// newRoster indexes team member names. A member is recorded by their
+// lower-case first name, like the LLM does, unless another member shares it.
+func newRoster(members []string) roster {
+	r := roster{names: make(map[string]string)}
+
+	firsts := make(map[string]int)
+	for _, member := range members {
+		if words := strings.Fields(strings.ToLower(member)); len(words) > 0 {
+			firsts[words[0]]++
+		}
+	}
+
+	for _, member := range members {
+		words := strings.Fields(strings.ToLower(member))
+		if len(words) == 0 {
+			continue
+		}
+		full := strings.Join(words, " ")
+		name := full
+		if firsts[words[0]] == 1 {
+			name = words[0]
+			r.names[words[0]] = name
+		}
+		r.names[full] = name
+		if len(words) > r.longest {
+			r.longest = len(words)
+		}
+	}
+	return r
+}
+
+// has reports whether word is a member's lower-case full or first name
+func (r roster) has(word string) bool {
+	_, ok := r.names[word]
+	return ok
+}
+
+// match reads a member's name, optionally as an @mention, from the start of
+// text, preferring the longest name, and returns it with the rest of text
+func (r roster) match(text string) (string, string, bool) {
+	text = strings.TrimLeft(text, " \t")
+	text = strings.TrimPrefix(text, "@")
+
+	words := leadingWords(text, r.longest)
+	for n := len(words); n > 0; n-- {
+		end := words[n-1]
+		candidate := strings.Join(strings.Fields(strings.ToLower(text[:end])), " ")
+		if name, ok := r.names[candidate]; ok {
+			return name, text[end:], true
+		}
+	}
+	return "", text, false
+}
+
+// leadingWords returns the end offsets of up to n leading words of text
+func leadingWords(text string, n int) []int {
+	var ends []int
+	i := 0
+	for len(ends) < n && i < len(text) {
+		// Skip the spaces between words
+		for i < len(text) && text[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(text) {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			if !unicode.IsLetter(r) && r != '\'' && r != '’' && r != '-' {
+				break
+			}
+			i += size
+		}
+		if i == start {
+			break
+		}
+		ends = append(ends, i)
+	}
+	return ends
+}
@@ -0,0 +1,252 @@
+// Package rules parses task messages without the LLM. It splits a message
+// with the queue's segmenter, then reads each part for "<Name> to <verb>"
+// assignees on the team roster, "for <Client>" phrases, due dates and how
+// the task repeats, and
+// scores how much of the task it recognised. The bot uses it whenever the LLM
+// can't be used, so outages still produce rows worth keeping.
+package rules
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/llm"
+	"github.com/giovannigabriele/go-todo-bot/internal/queue"
+)
+
+// Model is the model name recorded on parses made by this package
+const Model = "rules"
+
+const (
+	teamAssignee = "team"
+	unsure       = "Unsure"
+	maxSummary   = 80
+)
+
+// Confidence scores: what every rule-based task starts with, and what each
+// recognised part of it adds
+const (
+	baseConfidence      = 0.4
+	assigneeConfidence  = 0.3 // named before "to", "will", ...
+	inheritedConfidence = 0.1 // taken from the previous part of a chain
+	clientConfidence    = 0.1
+	dueConfidence       = 0.1
+)
+
+var (
+	// assignMarker ends the names at the start of "<Name> to ..." and
+	// "<Name> will ...", and is left out of the summary
+	assignMarker = regexp.MustCompile(`(?i)^(?:\s*[,:]\s*(?:please\s+)?|\s+(?:to|will|should|must|can|could|please|(?:needs?|has|have)\s+to|is\s+going\s+to)\b\s*)`)
+	// askPrefix starts "ask <Name> to ..." requests
+	askPrefix = regexp.MustCompile(`(?i)^(?:please\s+)?(?:ask|tell|get|remind)\s+`)
+	// nameSeparator joins names in "Gemma and Lilly to ..."
+	nameSeparator = regexp.MustCompile(`(?i)^(?:\s*,\s*|\s+and\s+|\s*&\s*)`)
+	// forClient matches "for Acme" and "for Acme Foods"
+	forClient = regexp.MustCompile(`\bfor\s+(?:the\s+)?([A-Z][\w&'.-]*(?:\s+[A-Z][\w&'.-]*){0,2})`)
+	// askClient matches the client asked in "ask oxccu for ..."
+	askClient = regexp.MustCompile(`(?i)\b(?:ask|chase|email|call|ping)\s+([\w&'.-]+)\s+for\b`)
+	// leadingWord is the first word of a part
+	leadingWord = regexp.MustCompile(`^\s*@?([\p{L}'’-]+)`)
+)
+
+// notClients are capitalised words that follow "for" without naming a client
+var notClients = map[string]bool{
+	"me": true, "us": true, "you": true, "him": true, "her": true, "them": true, "everyone": true,
+	"team": true, "the": true, "a": true, "an": true, "this": true, "that": true, "next": true,
+	"today": true, "tonight": true, "tomorrow": true, "now": true, "later": true, "review": true,
+	"approval": true,
+}
+
+// Parse splits message into tasks and parses each one, taking assignees from
+// roster and resolving dates relative to now. It never fails: what it can't
+// recognise is left to the team and marked "Unsure".
+func Parse(message string, roster []string, now time.Time) *llm.ParseResponse {
+	names := newRoster(roster)
+
+	segments := queue.Segments(message)
+	if len(segments) == 0 {
+		segments = []queue.Segment{{Text: message}}
+	}
+
+	resp := &llm.ParseResponse{OriginalMessage: message, Model: Model}
+	for i, segment := range segments {
+		task := parsePart(segment.Text, names, now)
+		if i > 0 {
+			previous := resp.Tasks[i-1]
+
+			// Parts of a sentence without a subject of their own continue
+			// the previous task, as in "Gemma to draft the brief; send it to
+			// Acme". List items stand alone.
+			inherit := !segment.Item && task.People[0] == teamAssignee && !startsWithName(segment.Text)
+			if inherit {
+				task.People = previous.People
+				task.Confidence += inheritedConfidence
+			}
+			// The steps of a chain are for the same client, and each waits
+			// on the one before
+			if (inherit || segment.Chained) && task.Client == unsure {
+				task.Client = previous.Client
+			}
+			if segment.Chained {
+				dep := i - 1
+				task.DependsOn = &dep
+			}
+		}
+		task.Confidence = round(task.Confidence)
+
+		resp.Tasks = append(resp.Tasks, task)
+	}
+	return resp
+}
+
+// parsePart parses one task
+func parsePart(part string, names roster, now time.Time) llm.Task {
+	task := llm.Task{
+		People:     []string{teamAssignee},
+		Client:     unsure,
+		DueDate:    unsure,
+		Confidence: baseConfidence,
+	}
+
+	text := strings.TrimSpace(part)
+	if people, rest, ok := assignees(text, names); ok {
+		task.People = people
+		task.Confidence += assigneeConfidence
+		text = rest
+	}
+
+	// "every Monday" says when a task repeats, so it is read before dates
+	rule, text, repeats := findRecurrence(text)
+	if repeats {
+		task.Recurrence = rule.String()
+	}
+
+	if due, rest, ok := resolveDate(text, now); ok {
+		task.DueDate = due
+		task.Confidence += dueConfidence
+		text = rest
+	} else if repeats {
+		task.DueDate = firstOccurrence(rule, now)
+	}
+
+	if client, rest, ok := findClient(text, names); ok {
+		task.Client = client
+		task.Confidence += clientConfidence
+		text = rest
+	}
+
+	task.Summary = summarize(text)
+	if task.Summary == "" {
+		task.Summary = summarize(part)
+	}
+	return task
+}
+
+// assignees reads the people a task starts by naming, in "Gemma to ...",
+// "Gemma and Lilly will ...", "@gemma: ..." or "ask Gemma to ...", returning
+// them and the rest of the text
+func assignees(text string, names roster) ([]string, string, bool) {
+	rest := text
+	asked := false
+	if loc := askPrefix.FindStringIndex(rest); loc != nil {
+		rest = rest[loc[1]:]
+		asked = true
+	}
+
+	var people []string
+	for {
+		person, after, ok := names.match(rest)
+		if !ok {
+			break
+		}
+		people = append(people, person)
+		rest = after
+
+		sep := nameSeparator.FindString(rest)
+		if sep == "" {
+			break
+		}
+		if _, _, next := names.match(rest[len(sep):]); !next {
+			break
+		}
+		rest = rest[len(sep):]
+	}
+	if len(people) == 0 {
+		return nil, text, false
+	}
+
+	marker := assignMarker.FindString(rest)
+	if marker == "" {
+		return nil, text, false
+	}
+	// "ask Gemma to" needs the "to"; "Gemma to" and "Gemma will" take any marker
+	if asked && !strings.HasPrefix(strings.ToLower(strings.TrimSpace(marker)), "to") {
+		return nil, text, false
+	}
+	return people, rest[len(marker):], true
+}
+
+// findClient looks for "for <Client>" or "ask <client> for", returning the
+// client and the text without a trailing "for <Client>"
+func findClient(text string, names roster) (string, string, bool) {
+	for _, m := range forClient.FindAllStringSubmatchIndex(text, -1) {
+		client := text[m[2]:m[3]]
+		first := strings.ToLower(strings.Fields(client)[0])
+		if notClients[first] || isDateWord(first) || names.has(first) {
+			continue
+		}
+		rest := text
+		if strings.TrimSpace(strings.Trim(text[m[1]:], ".,;!")) == "" {
+			rest = text[:m[0]]
+		}
+		return client, rest, true
+	}
+
+	if m := askClient.FindStringSubmatch(text); m != nil {
+		client := m[1]
+		lower := strings.ToLower(client)
+		if !notClients[lower] && !names.has(lower) {
+			return client, text, true
+		}
+	}
+	return "", text, false
+}
+
+// startsWithName reports whether part starts like "Bob to ..." or with an
+// @mention, naming an assignee who may not be on the roster
+func startsWithName(part string) bool {
+	part = strings.TrimSpace(part)
+	if strings.HasPrefix(part, "@") {
+		return true
+	}
+	m := leadingWord.FindStringSubmatchIndex(part)
+	if m == nil {
+		return false
+	}
+	word := []rune(part[m[2]:m[3]])
+	return unicode.IsUpper(word[0]) && assignMarker.MatchString(part[m[1]:])
+}
+
+// summarize tidies what is left of a part into a summary
+func summarize(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	text = strings.Trim(text, " ,;:-–—.!")
+	if text == "" {
+		return ""
+	}
+
+	runes := []rune(text)
+	runes[0] = unicode.ToUpper(runes[0])
+
+	if len(runes) > maxSummary {
+		return string(runes[:maxSummary-3]) + "..."
+	}
+	return string(runes)
+}
+
+// round keeps confidences to two decimals
+func round(confidence float64) float64 {
+	return float64(int(confidence*100+0.5)) / 100
+}
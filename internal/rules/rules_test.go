@@ -0,0 +1,88 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseExamples(t *testing.T) {
+	now := time.Date(2025, 3, 5, 10, 0, 0, 0, time.UTC) // a Wednesday
+	roster := []string{"gemma", "lilly", "anna"}
+
+	type want struct {
+		people     []string
+		client     string
+		summary    string
+		dueDate    string
+		recurrence string
+		dependsOn  int // -1 for none
+		confidence float64
+	}
+	tests := []struct {
+		message string
+		want    []want
+	}{
+		{
+			"Gemma to send the invoice for Acme by Friday",
+			[]want{{[]string{"gemma"}, "Acme", "Send the invoice", "2025-03-07", "", -1, 0.9}},
+		},
+		{
+			"Gemma and Lilly will draft the brief tomorrow",
+			[]want{{[]string{"gemma", "lilly"}, "Unsure", "Draft the brief", "2025-03-06", "", -1, 0.8}},
+		},
+		{
+			"ask Anna to chase the printer",
+			[]want{{[]string{"anna"}, "Unsure", "Chase the printer", "Unsure", "", -1, 0.7}},
+		},
+		{
+			"review the contract",
+			[]want{{[]string{"team"}, "Unsure", "Review the contract", "Unsure", "", -1, 0.4}},
+		},
+		{
+			"@lilly: update the website for Bravo Foods",
+			[]want{{[]string{"lilly"}, "Bravo Foods", "Update the website", "Unsure", "", -1, 0.8}},
+		},
+		{
+			"Gemma to send the weekly report every Monday",
+			[]want{{[]string{"gemma"}, "Unsure", "Send the weekly report", "2025-03-10", "FREQ=WEEKLY;BYDAY=MO", -1, 0.7}},
+		},
+		{
+			"Lilly to book the venue, then send the invites",
+			[]want{
+				{[]string{"lilly"}, "Unsure", "Book the venue", "Unsure", "", -1, 0.7},
+				{[]string{"lilly"}, "Unsure", "Send the invites", "Unsure", "", 0, 0.5},
+			},
+		},
+		{
+			"1. Gemma to call Acme\n2. Lilly to update the deck",
+			[]want{
+				{[]string{"gemma"}, "Unsure", "Call Acme", "Unsure", "", -1, 0.7},
+				{[]string{"lilly"}, "Unsure", "Update the deck", "Unsure", "", -1, 0.7},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			resp := Parse(tt.message, roster, now)
+			if resp.Model != Model || resp.OriginalMessage != tt.message {
+				t.Errorf("response model %q, message %q", resp.Model, resp.OriginalMessage)
+			}
+			if len(resp.Tasks) != len(tt.want) {
+				t.Fatalf("got %d tasks, want %d: %+v", len(resp.Tasks), len(tt.want), resp.Tasks)
+			}
+			for i, w := range tt.want {
+				task := resp.Tasks[i]
+				dependsOn := -1
+				if task.DependsOn != nil {
+					dependsOn = *task.DependsOn
+				}
+				got := want{task.People, task.Client, task.Summary, task.DueDate, task.Recurrence, dependsOn, task.Confidence}
+				if !reflect.DeepEqual(got, w) {
+					t.Errorf("task %d = %+v, want %+v", i, got, w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,492 @@
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/tracing"
+)
+
+const (
+	// DefaultAPIURL is the base URL of the Google Sheets API v4
+	DefaultAPIURL = "https://sheets.googleapis.com"
+
+	todoTab = "todo"
+	teamTab = "team"
+)
+
+// APIClient talks to the Google Sheets API v4 directly using a service
+// account, bypassing the Apps Script webhook. It offers the same operations
+// as Client.
+type APIClient struct {
+	baseURL       string
+	spreadsheetID string
+	schema        Schema
+	client        *http.Client
+
+	mu      sync.Mutex
+	header  []string // todo tab header row, discovered lazily
+	sheetID *int64   // numeric ID of the todo tab, for row deletion
+}
+
+// valueRange is the ValueRange resource of the Sheets API
+type valueRange struct {
+	Range  string          `json:"range,omitempty"`
+	Values [][]interface{} `json:"values"`
+}
+
+// batchUpdateValuesRequest is the body of values:batchUpdate
+type batchUpdateValuesRequest struct {
+	ValueInputOption string       `json:"valueInputOption"`
+	Data             []valueRange `json:"data"`
+}
+
+// spreadsheet is the subset of the Spreadsheet resource used to find tab IDs
+type spreadsheet struct {
+	Sheets []struct {
+		Properties struct {
+			SheetID int64  `json:"sheetId"`
+			Title   string `json:"title"`
+		} `json:"properties"`
+	} `json:"sheets"`
+}
+
+// apiError is the error body returned by Google APIs
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// NewAPIClient creates a Sheets API client authenticated with a service
+// account JSON key. The spreadsheet must be shared with the service account's
+// email. baseURL may point at a local stand-in; empty means DefaultAPIURL. A
+// nil schema means DefaultSchema.
+func NewAPIClient(spreadsheetID string, credentialsJSON []byte, baseURL string, schema Schema) (*APIClient, error) {
+	conf, err := google.JWTConfigFromJSON(credentialsJSON, "https://www.googleapis.com/auth/spreadsheets")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service account key: %w", err)
+	}
+
+	if baseURL == "" {
+		baseURL = DefaultAPIURL
+	}
+	if schema == nil {
+		schema = DefaultSchema
+	}
+
+	return &APIClient{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		spreadsheetID: spreadsheetID,
+		schema:        schema,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &oauth2.Transport{
+				Source: conf.TokenSource(context.Background()),
+				Base:   tracing.Transport(nil),
+			},
+		},
+	}, nil
+}
+
+// AddTasks appends all tasks to the todo tab in a single values.append call.
+// Like handleAddTasks in the Apps Script, new rows are stamped with the
+// current time and start as Not Started.
+func (c *APIClient) AddTasks(ctx context.Context, tasks []TaskRow) error {
+	log.Debug().Int("task_count", len(tasks)).Msg("Appending tasks via Sheets API")
+
+	header, err := c.loadHeader(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	rows := make([][]interface{}, 0, len(tasks))
+	for _, task := range tasks {
+		task.Timestamp = now
+		task.Status = "Not Started"
+		if task.Client == "" {
+			task.Client = "unclear"
+		}
+		if task.ID == "" {
+			task.ID = uuid.New().String()
+		}
+		rows = append(rows, toCells(c.schema.Encode(task, header, nil)))
+	}
+
+	path := fmt.Sprintf("/values/%s:append?valueInputOption=RAW&insertDataOption=INSERT_ROWS",
+		url.PathEscape(todoTab+"!A1"))
+	if err := c.do(ctx, http.MethodPost, path, valueRange{Values: rows}, nil); err != nil {
+		return fmt.Errorf("failed to add tasks: %w", err)
+	}
+
+	log.Info().
+		Int("rows_added", len(rows)).
+		Msg("Successfully added tasks via Sheets API")
+
+	return nil
+}
+
+// GetTasks returns the todo rows, skipping those whose status equals excludeStatus
+func (c *APIClient) GetTasks(ctx context.Context, excludeStatus string) ([]TaskRow, error) {
+	header, err := c.loadHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := c.getValues(ctx, todoTab)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tasks: %w", err)
+	}
+
+	var tasks []TaskRow
+	for i, row := range values {
+		if i == 0 {
+			continue // header
+		}
+		task := c.schema.Decode(fromCells(row), header)
+		if excludeStatus != "" && task.Status == excludeStatus {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// UpdateTask rewrites the row with the given ID. The row is re-read and its ID
+// checked immediately before the write, and the whole row is written in one
+// values.batchUpdate call so readers never see a half-updated row. Columns
+// outside the schema keep their current values.
+func (c *APIClient) UpdateTask(ctx context.Context, id string, update TaskUpdate) (*TaskRow, error) {
+	log.Debug().Str("task_id", id).Msg("Updating task via Sheets API")
+
+	header, err := c.loadHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rowNumber, err := c.findRow(ctx, id, header)
+	if err != nil {
+		return nil, err
+	}
+
+	rowRange := fmt.Sprintf("%s!A%d:%s%d", todoTab, rowNumber, columnLetter(len(header)-1), rowNumber)
+	values, err := c.getValues(ctx, rowRange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task row: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	existing := fromCells(values[0])
+	task := c.schema.Decode(existing, header)
+	if task.ID != id {
+		return nil, fmt.Errorf("row %d changed while updating task %s, please retry", rowNumber, id)
+	}
+
+	update.apply(&task)
+
+	body := batchUpdateValuesRequest{
+		ValueInputOption: "RAW",
+		Data: []valueRange{{
+			Range:  rowRange,
+			Values: [][]interface{}{toCells(c.schema.Encode(task, header, existing))},
+		}},
+	}
+	if err := c.do(ctx, http.MethodPost, "/values:batchUpdate", body, nil); err != nil {
+		return nil, fmt.Errorf("failed to update task: %w", err)
+	}
+
+	return &task, nil
+}
+
+// DeleteTask removes the row with the given ID using a deleteDimension request
+func (c *APIClient) DeleteTask(ctx context.Context, id string) error {
+	log.Debug().Str("task_id", id).Msg("Deleting task via Sheets API")
+
+	header, err := c.loadHeader(ctx)
+	if err != nil {
+		return err
+	}
+
+	sheetID, err := c.todoSheetID(ctx)
+	if err != nil {
+		return err
+	}
+
+	rowNumber, err := c.findRow(ctx, id, header)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"requests": []interface{}{
+			map[string]interface{}{
+				"deleteDimension": map[string]interface{}{
+					"range": map[string]interface{}{
+						"sheetId":    sheetID,
+						"dimension":  "ROWS",
+						"startIndex": rowNumber - 1,
+						"endIndex":   rowNumber,
+					},
+				},
+			},
+		},
+	}
+	if err := c.do(ctx, http.MethodPost, ":batchUpdate", body, nil); err != nil {
+		return fmt.Errorf("failed to delete task: %w", err)
+	}
+
+	return nil
+}
+
+// GetTeam reads the team tab
+func (c *APIClient) GetTeam(ctx context.Context) ([]TeamMember, error) {
+	values, err := c.getValues(ctx, teamTab)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get team: %w", err)
+	}
+
+	var team []TeamMember
+	for i, row := range values {
+		if i == 0 || len(row) < 2 {
+			continue
+		}
+		name, email := cellString(row, 0), cellString(row, 1)
+		if name == "" || email == "" {
+			continue
+		}
+		team = append(team, TeamMember{
+			Name:  strings.ToLower(strings.TrimSpace(name)),
+			Email: strings.TrimSpace(email),
+		})
+	}
+
+	return team, nil
+}
+
+// loadHeader returns the todo header row, reading it from the sheet and
+// validating it against the schema on first use
+func (c *APIClient) loadHeader(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.header != nil {
+		return c.header, nil
+	}
+
+	values, err := c.getValues(ctx, todoTab+"!1:1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read todo header row: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("todo tab has no header row")
+	}
+
+	header := fromCells(values[0])
+	if err := c.schema.Validate(header); err != nil {
+		return nil, err
+	}
+
+	c.header = header
+	return header, nil
+}
+
+// todoSheetID returns the numeric ID of the todo tab
+func (c *APIClient) todoSheetID(ctx context.Context) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sheetID != nil {
+		return *c.sheetID, nil
+	}
+
+	var resp spreadsheet
+	if err := c.do(ctx, http.MethodGet, "?fields=sheets.properties", nil, &resp); err != nil {
+		return 0, fmt.Errorf("failed to get spreadsheet metadata: %w", err)
+	}
+
+	for _, sheet := range resp.Sheets {
+		if sheet.Properties.Title == todoTab {
+			id := sheet.Properties.SheetID
+			c.sheetID = &id
+			return id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("spreadsheet has no %q tab", todoTab)
+}
+
+// findRow returns the 1-based sheet row holding the task with the given ID
+func (c *APIClient) findRow(ctx context.Context, id string, header []string) (int, error) {
+	if id == "" {
+		return 0, fmt.Errorf("%w: empty ID", ErrNotFound)
+	}
+
+	idColumn := columnLetter(headerIndex(header)[c.schema.header(FieldID)])
+	values, err := c.getValues(ctx, fmt.Sprintf("%s!%s:%s", todoTab, idColumn, idColumn))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read ID column: %w", err)
+	}
+
+	for i, row := range values {
+		if i > 0 && cellString(row, 0) == id {
+			return i + 1, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// getValues reads a range with values.get
+func (c *APIClient) getValues(ctx context.Context, a1Range string) ([][]interface{}, error) {
+	var resp valueRange
+	if err := c.do(ctx, http.MethodGet, "/values/"+url.PathEscape(a1Range), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Values, nil
+}
+
+// do sends a request to the spreadsheet resource. path is appended to
+// /v4/spreadsheets/{id}.
+func (c *APIClient) do(ctx context.Context, method, path string, body interface{}, response interface{}) error {
+	start := time.Now()
+	err := c.doRequest(ctx, method, path, body, response)
+	recordRequest("api", start, err)
+	return err
+}
+
+// doRequest performs the API round trip and decodes the response
+func (c *APIClient) doRequest(ctx context.Context, method, path string, body interface{}, response interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		reqBody, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(reqBody)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	endpoint := c.baseURL + "/v4/spreadsheets/" + url.PathEscape(c.spreadsheetID) + path
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr apiError
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("sheets API error (%s): %s", apiErr.Error.Status, apiErr.Error.Message)
+		}
+		return fmt.Errorf("HTTP request failed with status %d", resp.StatusCode)
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// apply copies the non-nil fields of the update onto row
+func (u TaskUpdate) apply(row *TaskRow) {
+	if u.People != nil {
+		row.People = u.People
+	}
+	if u.Client != nil {
+		row.Client = *u.Client
+	}
+	if u.Summary != nil {
+		row.Summary = *u.Summary
+	}
+	if u.Status != nil {
+		row.Status = *u.Status
+	}
+	if u.DueDate != nil {
+		row.DueDate = *u.DueDate
+	}
+	if u.BotNotes != nil {
+		row.BotNotes = *u.BotNotes
+	}
+	if u.BlockedBy != nil {
+		row.BlockedBy = *u.BlockedBy
+	}
+	if u.Recurrence != nil {
+		row.Recurrence = *u.Recurrence
+	}
+	for field, value := range u.Fields {
+		if row.Fields == nil {
+			row.Fields = make(map[string]string)
+		}
+		row.Fields[field] = value
+	}
+}
+
+// toCells converts string cells to JSON values
+func toCells(row []string) []interface{} {
+	cells := make([]interface{}, len(row))
+	for i, cell := range row {
+		cells[i] = cell
+	}
+	return cells
+}
+
+// fromCells converts JSON values to string cells
+func fromCells(row []interface{}) []string {
+	cells := make([]string, len(row))
+	for i := range row {
+		cells[i] = cellString(row, i)
+	}
+	return cells
+}
+
+// cellString returns the cell at index i as a string. The API omits trailing
+// empty cells, so short rows are expected.
+func cellString(row []interface{}, i int) string {
+	if i < 0 || i >= len(row) || row[i] == nil {
+		return ""
+	}
+	if s, ok := row[i].(string); ok {
+		return s
+	}
+	return fmt.Sprint(row[i])
+}
+
+// columnLetter converts a zero-based column index to its A1 letter(s)
+func columnLetter(index int) string {
+	letters := ""
+	for index >= 0 {
+		letters = string(rune('A'+index%26)) + letters
+		index = index/26 - 1
+	}
+	return letters
+}
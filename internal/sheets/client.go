@@ -4,22 +4,33 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/health"
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+	"github.com/giovannigabriele/go-todo-bot/internal/tracing"
 )
 
+// ErrNotFound is returned when no row matches the requested task ID
+var ErrNotFound = errors.New("task not found")
+
 // Client handles Google Sheets operations
 type Client struct {
 	webhookURL string
+	schema     Schema
 	client     *http.Client
 }
 
 // TaskRow represents a task row for the Google Sheet
 type TaskRow struct {
+	ID          string   `json:"id,omitempty"`
 	Timestamp   string   `json:"timestamp"`
 	People      []string `json:"people"`
 	Client      string   `json:"client"`
@@ -28,12 +39,57 @@ type TaskRow struct {
 	Status      string   `json:"status"`
 	DueDate     string   `json:"dueDate"`
 	BotNotes    string   `json:"botNotes"`
+	BlockedBy   string   `json:"blockedBy,omitempty"`
+	Recurrence  string   `json:"recurrence,omitempty"`
+
+	// Fields holds values for custom columns, keyed by schema field name
+	Fields map[string]string `json:"fields,omitempty"`
 }
 
 // AddTasksRequest represents the request to add tasks
 type AddTasksRequest struct {
-	Action string    `json:"action"`
-	Tasks  []TaskRow `json:"tasks"`
+	Action  string    `json:"action"`
+	Columns Schema    `json:"columns"`
+	Tasks   []TaskRow `json:"tasks"`
+}
+
+// GetTasksRequest represents the request to list tasks. Rows whose status
+// equals Status are excluded, matching handleGetTasks in the Apps Script.
+type GetTasksRequest struct {
+	Action  string `json:"action"`
+	Columns Schema `json:"columns"`
+	Status  string `json:"status,omitempty"`
+}
+
+// TaskUpdate holds the fields to change on an existing row. Nil fields are left
+// untouched.
+type TaskUpdate struct {
+	People     []string `json:"people,omitempty"`
+	Client     *string  `json:"client,omitempty"`
+	Summary    *string  `json:"summary,omitempty"`
+	Status     *string  `json:"status,omitempty"`
+	DueDate    *string  `json:"dueDate,omitempty"`
+	BotNotes   *string  `json:"botNotes,omitempty"`
+	BlockedBy  *string  `json:"blockedBy,omitempty"`
+	Recurrence *string  `json:"recurrence,omitempty"`
+
+	// Fields sets custom column values, keyed by schema field name
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// UpdateTaskRequest represents the request to update a single row
+type UpdateTaskRequest struct {
+	Action  string     `json:"action"`
+	Columns Schema     `json:"columns"`
+	ID      string     `json:"id"`
+	Updates TaskUpdate `json:"updates"`
+}
+
+// DeleteTaskRequest represents the request to delete a single row
+type DeleteTaskRequest struct {
+	Action  string `json:"action"`
+	Columns Schema `json:"columns"`
+	ID      string `json:"id"`
 }
 
 // GetTeamRequest represents the request to get team data
@@ -49,9 +105,11 @@ type TeamMember struct {
 
 // GetTeamResponse represents the response from getting team data
 type GetTeamResponse struct {
-	Status string       `json:"status"`
-	Team   []TeamMember `json:"team"`
-	Error  string       `json:"error,omitempty"`
+	Status    string       `json:"status"`
+	Team      []TeamMember `json:"team"`
+	Message   string       `json:"message,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	ErrorType string       `json:"errorType,omitempty"`
 }
 
 // AddTasksResponse represents the response from adding tasks
@@ -60,14 +118,49 @@ type AddTasksResponse struct {
 	RowsAdded int    `json:"rowsAdded"`
 	Message   string `json:"message,omitempty"`
 	Error     string `json:"error,omitempty"`
+	ErrorType string `json:"errorType,omitempty"`
+}
+
+// GetTasksResponse represents the response from listing tasks
+type GetTasksResponse struct {
+	Status    string    `json:"status"`
+	Tasks     []TaskRow `json:"tasks"`
+	Message   string    `json:"message,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorType string    `json:"errorType,omitempty"`
+}
+
+// UpdateTaskResponse represents the response from updating a row
+type UpdateTaskResponse struct {
+	Status    string  `json:"status"`
+	Task      TaskRow `json:"task"`
+	Message   string  `json:"message,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	ErrorType string  `json:"errorType,omitempty"`
+}
+
+// DeleteTaskResponse represents the response from deleting a row
+type DeleteTaskResponse struct {
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+	Error     string `json:"error,omitempty"`
+	ErrorType string `json:"errorType,omitempty"`
 }
 
-// NewClient creates a new Google Sheets client
-func NewClient(webhookURL string) *Client {
+// NewClient creates a new Google Sheets client. The schema is sent with every
+// request so the Apps Script knows which column holds which field; nil means
+// DefaultSchema.
+func NewClient(webhookURL string, schema Schema) *Client {
+	if schema == nil {
+		schema = DefaultSchema
+	}
+
 	return &Client{
 		webhookURL: webhookURL,
+		schema:     schema,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: tracing.Transport(nil),
 		},
 	}
 }
@@ -77,8 +170,9 @@ func (c *Client) AddTasks(ctx context.Context, tasks []TaskRow) error {
 	log.Debug().Int("task_count", len(tasks)).Msg("Adding tasks to Google Sheets")
 
 	request := AddTasksRequest{
-		Action: "add_tasks",
-		Tasks:  tasks,
+		Action:  "add_tasks",
+		Columns: c.schema,
+		Tasks:   tasks,
 	}
 
 	var response AddTasksResponse
@@ -87,7 +181,7 @@ func (c *Client) AddTasks(ctx context.Context, tasks []TaskRow) error {
 	}
 
 	if response.Status != "success" {
-		return fmt.Errorf("sheets API error: %s", response.Error)
+		return responseError(response.Error, response.Message, response.ErrorType)
 	}
 
 	log.Info().
@@ -111,7 +205,7 @@ func (c *Client) GetTeam(ctx context.Context) ([]TeamMember, error) {
 	}
 
 	if response.Status != "success" {
-		return nil, fmt.Errorf("sheets API error: %s", response.Error)
+		return nil, responseError(response.Error, response.Message, response.ErrorType)
 	}
 
 	log.Info().
@@ -121,9 +215,78 @@ func (c *Client) GetTeam(ctx context.Context) ([]TeamMember, error) {
 	return response.Team, nil
 }
 
+// GetTasks retrieves tasks from the Google Sheet, skipping rows whose status
+// equals excludeStatus (pass "" to get every row)
+func (c *Client) GetTasks(ctx context.Context, excludeStatus string) ([]TaskRow, error) {
+	log.Debug().Str("exclude_status", excludeStatus).Msg("Getting tasks from Google Sheets")
+
+	request := GetTasksRequest{
+		Action:  "get_tasks",
+		Columns: c.schema,
+		Status:  excludeStatus,
+	}
+
+	var response GetTasksResponse
+	if err := c.makeRequest(ctx, request, &response); err != nil {
+		return nil, fmt.Errorf("failed to get tasks: %w", err)
+	}
+
+	if response.Status != "success" {
+		return nil, responseError(response.Error, response.Message, response.ErrorType)
+	}
+
+	return response.Tasks, nil
+}
+
+// UpdateTask changes the given fields on the row with the given ID
+func (c *Client) UpdateTask(ctx context.Context, id string, update TaskUpdate) (*TaskRow, error) {
+	log.Debug().Str("task_id", id).Msg("Updating task in Google Sheets")
+
+	request := UpdateTaskRequest{
+		Action:  "update_task",
+		Columns: c.schema,
+		ID:      id,
+		Updates: update,
+	}
+
+	var response UpdateTaskResponse
+	if err := c.makeRequest(ctx, request, &response); err != nil {
+		return nil, fmt.Errorf("failed to update task: %w", err)
+	}
+
+	if response.Status != "success" {
+		return nil, responseError(response.Error, response.Message, response.ErrorType)
+	}
+
+	return &response.Task, nil
+}
+
+// DeleteTask removes the row with the given ID
+func (c *Client) DeleteTask(ctx context.Context, id string) error {
+	log.Debug().Str("task_id", id).Msg("Deleting task from Google Sheets")
+
+	request := DeleteTaskRequest{
+		Action:  "delete_task",
+		Columns: c.schema,
+		ID:      id,
+	}
+
+	var response DeleteTaskResponse
+	if err := c.makeRequest(ctx, request, &response); err != nil {
+		return fmt.Errorf("failed to delete task: %w", err)
+	}
+
+	if response.Status != "success" {
+		return responseError(response.Error, response.Message, response.ErrorType)
+	}
+
+	return nil
+}
+
 // CreateTaskRow creates a TaskRow from parsed task data
 func CreateTaskRow(people []string, client, summary, fullMessage, dueDate, botNotes string) TaskRow {
 	return TaskRow{
+		ID:          uuid.New().String(),
 		Timestamp:   time.Now().UTC().Format(time.RFC3339),
 		People:      people,
 		Client:      client,
@@ -137,6 +300,14 @@ func CreateTaskRow(people []string, client, summary, fullMessage, dueDate, botNo
 
 // makeRequest makes an HTTP request to the Google Apps Script webhook
 func (c *Client) makeRequest(ctx context.Context, request interface{}, response interface{}) error {
+	start := time.Now()
+	err := c.doRequest(ctx, request, response)
+	recordRequest("webhook", start, err)
+	return err
+}
+
+// doRequest performs the webhook round trip and decodes the response
+func (c *Client) doRequest(ctx context.Context, request interface{}, response interface{}) error {
 	reqBody, err := json.Marshal(request)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
@@ -166,6 +337,34 @@ func (c *Client) makeRequest(ctx context.Context, request interface{}, response
 	return nil
 }
 
+// recordRequest reports the outcome of a Sheets round trip to the metrics and
+// the readiness check. Application-level errors such as NOT_FOUND arrive in a
+// successful response and do not count as failures.
+func recordRequest(backend string, start time.Time, err error) {
+	metrics.SheetsRequestDuration.WithLabelValues(backend, metrics.Outcome(err)).Observe(metrics.Since(start))
+	if err != nil {
+		metrics.SheetsErrors.WithLabelValues(backend).Inc()
+		health.RecordFailure(health.ComponentSheets, err)
+		return
+	}
+	health.RecordSuccess(health.ComponentSheets)
+}
+
+// responseError builds an error from the Apps Script error envelope. Older
+// deployments only set "message", so it is used when "error" is empty.
+func responseError(errMsg, message, errorType string) error {
+	if errMsg == "" {
+		errMsg = message
+	}
+	if errorType == "NOT_FOUND" {
+		return fmt.Errorf("%w: %s", ErrNotFound, errMsg)
+	}
+	if errorType != "" {
+		return fmt.Errorf("sheets API error (%s): %s", errorType, errMsg)
+	}
+	return fmt.Errorf("sheets API error: %s", errMsg)
+}
+
 // BuildTeamEmailMap builds a map from team member names to emails
 func BuildTeamEmailMap(team []TeamMember) map[string]string {
 	emailMap := make(map[string]string)
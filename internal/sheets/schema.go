@@ -0,0 +1,269 @@
+package sheets
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Standard task fields. Any other field name in a schema is a custom field and
+// is read from and written to TaskRow.Fields.
+const (
+	FieldTimestamp   = "timestamp"
+	FieldPeople      = "people"
+	FieldClient      = "client"
+	FieldSummary     = "summary"
+	FieldFullMessage = "fullMessage"
+	FieldStatus      = "status"
+	FieldDueDate     = "dueDate"
+	FieldBotNotes    = "botNotes"
+	FieldID          = "id"
+	FieldBlockedBy   = "blockedBy"
+	FieldRecurrence  = "recurrence"
+)
+
+// standardFields lists the fields stored directly on TaskRow
+var standardFields = map[string]bool{
+	FieldTimestamp: true, FieldPeople: true, FieldClient: true, FieldSummary: true,
+	FieldFullMessage: true, FieldStatus: true, FieldDueDate: true, FieldBotNotes: true, FieldID: true,
+	FieldBlockedBy: true, FieldRecurrence: true,
+}
+
+// requiredFields must be mapped by every schema so rows can be found and read
+var requiredFields = []string{FieldID, FieldPeople, FieldSummary, FieldStatus}
+
+// Column maps a header in the todo tab to a task field
+type Column struct {
+	Header string `json:"header"`
+	Field  string `json:"field"`
+}
+
+// Schema is the ordered list of todo tab columns the bot reads and writes
+type Schema []Column
+
+// DefaultSchema is the layout written by initializeSheets. Sheets that want
+// task chains or recurrence rules kept add "Blocked By" or "Recurrence"
+// columns to SHEET_COLUMNS.
+var DefaultSchema = Schema{
+	{Header: "Timestamp", Field: FieldTimestamp},
+	{Header: "People", Field: FieldPeople},
+	{Header: "Client", Field: FieldClient},
+	{Header: "Summary", Field: FieldSummary},
+	{Header: "FullMessage", Field: FieldFullMessage},
+	{Header: "Status", Field: FieldStatus},
+	{Header: "DueDate", Field: FieldDueDate},
+	{Header: "BotNotes", Field: FieldBotNotes},
+	{Header: "ID", Field: FieldID},
+}
+
+// ParseSchema parses a column spec such as
+// "Timestamp,People,Priority,Summary,Status,ID,Project=project". Each entry is
+// a header, optionally followed by "=field". Without a field, the field name is
+// derived from the header ("DueDate" → "dueDate", "ID" → "id"). An empty spec
+// returns DefaultSchema.
+func ParseSchema(spec string) (Schema, error) {
+	if strings.TrimSpace(spec) == "" {
+		return DefaultSchema, nil
+	}
+
+	var schema Schema
+	for i, entry := range strings.Split(spec, ",") {
+		header, field, _ := strings.Cut(entry, "=")
+		header, field = strings.TrimSpace(header), strings.TrimSpace(field)
+		if header == "" {
+			return nil, fmt.Errorf("column %d has an empty header", i+1)
+		}
+		if field == "" {
+			field = fieldName(header)
+		}
+		schema = append(schema, Column{Header: header, Field: field})
+	}
+
+	if err := schema.check(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// CustomFields returns the fields that are not stored directly on TaskRow
+func (s Schema) CustomFields() []string {
+	var fields []string
+	for _, column := range s {
+		if !standardFields[column.Field] {
+			fields = append(fields, column.Field)
+		}
+	}
+	return fields
+}
+
+// Validate checks that every schema header is present in the sheet header row
+func (s Schema) Validate(header []string) error {
+	present := make(map[string]bool, len(header))
+	for _, h := range header {
+		present[strings.TrimSpace(h)] = true
+	}
+
+	var missing []string
+	for _, column := range s {
+		if !present[column.Header] {
+			missing = append(missing, column.Header)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("todo header row is missing column(s) %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Encode lays a task out in header order. Cells in columns the schema does not
+// map are copied from existing, which may be nil for a new row.
+func (s Schema) Encode(task TaskRow, header []string, existing []string) []string {
+	index := headerIndex(header)
+	row := make([]string, len(header))
+	copy(row, existing)
+	for _, column := range s {
+		if i, ok := index[column.Header]; ok {
+			row[i] = task.get(column.Field)
+		}
+	}
+	return row
+}
+
+// Decode reads a task from a row laid out in header order
+func (s Schema) Decode(row []string, header []string) TaskRow {
+	index := headerIndex(header)
+	var task TaskRow
+	for _, column := range s {
+		i, ok := index[column.Header]
+		if !ok || i >= len(row) {
+			continue
+		}
+		task.set(column.Field, row[i])
+	}
+	return task
+}
+
+// header returns the header of the column mapped to field, or "" if none
+func (s Schema) header(field string) string {
+	for _, column := range s {
+		if column.Field == field {
+			return column.Header
+		}
+	}
+	return ""
+}
+
+// check ensures the schema has no duplicates and maps the required fields
+func (s Schema) check() error {
+	headers := make(map[string]bool)
+	fields := make(map[string]bool)
+	for _, column := range s {
+		if headers[column.Header] {
+			return fmt.Errorf("column %q is listed twice", column.Header)
+		}
+		if fields[column.Field] {
+			return fmt.Errorf("field %q is mapped to more than one column", column.Field)
+		}
+		headers[column.Header] = true
+		fields[column.Field] = true
+	}
+
+	for _, field := range requiredFields {
+		if !fields[field] {
+			return fmt.Errorf("no column is mapped to the required %q field", field)
+		}
+	}
+	return nil
+}
+
+// get returns the value of a field as a sheet cell
+func (t TaskRow) get(field string) string {
+	switch field {
+	case FieldTimestamp:
+		return t.Timestamp
+	case FieldPeople:
+		return strings.Join(t.People, ", ")
+	case FieldClient:
+		return t.Client
+	case FieldSummary:
+		return t.Summary
+	case FieldFullMessage:
+		return t.FullMessage
+	case FieldStatus:
+		return t.Status
+	case FieldDueDate:
+		if t.DueDate == "Unsure" || t.DueDate == "unclear" {
+			return "" // Empty string passes the sheet's date validation
+		}
+		return t.DueDate
+	case FieldBotNotes:
+		return t.BotNotes
+	case FieldID:
+		return t.ID
+	case FieldBlockedBy:
+		return t.BlockedBy
+	case FieldRecurrence:
+		return t.Recurrence
+	default:
+		return t.Fields[field]
+	}
+}
+
+// set assigns a field from a sheet cell
+func (t *TaskRow) set(field, value string) {
+	switch field {
+	case FieldTimestamp:
+		t.Timestamp = value
+	case FieldPeople:
+		t.People = nil
+		for _, person := range strings.Split(value, ",") {
+			t.People = append(t.People, strings.TrimSpace(person))
+		}
+	case FieldClient:
+		t.Client = value
+	case FieldSummary:
+		t.Summary = value
+	case FieldFullMessage:
+		t.FullMessage = value
+	case FieldStatus:
+		t.Status = value
+	case FieldDueDate:
+		t.DueDate = value
+	case FieldBotNotes:
+		t.BotNotes = value
+	case FieldID:
+		t.ID = value
+	case FieldBlockedBy:
+		t.BlockedBy = value
+	case FieldRecurrence:
+		t.Recurrence = value
+	default:
+		if value == "" {
+			return
+		}
+		if t.Fields == nil {
+			t.Fields = make(map[string]string)
+		}
+		t.Fields[field] = value
+	}
+}
+
+// headerIndex maps each header to its zero-based column
+func headerIndex(header []string) map[string]int {
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[strings.TrimSpace(h)] = i
+	}
+	return index
+}
+
+// fieldName derives a field name from a header: spaces are removed, then
+// all-caps headers are lower-cased and others have their first letter
+// lower-cased ("Blocked By" → "blockedBy")
+func fieldName(header string) string {
+	name := strings.Join(strings.Fields(header), "")
+	if strings.ToUpper(name) == name {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
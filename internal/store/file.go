@@ -0,0 +1,310 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// csvHeaders is the column order used for CSV files, matching the default
+// sheet layout plus a JSON-encoded column for custom fields, the ID of the
+// blocking task and the recurrence rule
+var csvHeaders = []string{"Timestamp", "People", "Client", "Summary", "FullMessage", "Status", "DueDate", "BotNotes", "ID", "Fields", "BlockedBy", "Recurrence"}
+
+// FileStore keeps tasks in a local CSV or JSONL file. The whole file is loaded
+// into memory on open and rewritten on every update or delete, so it is meant
+// for small teams and local use.
+type FileStore struct {
+	path  string
+	csv   bool
+	team  []TeamMember
+	mu    sync.Mutex
+	tasks []Task
+}
+
+// NewFileStore opens (or creates) a task file. Files ending in .csv are stored
+// as CSV with a header row; anything else is stored as JSON lines.
+func NewFileStore(path string, team []TeamMember) (*FileStore, error) {
+	s := &FileStore{
+		path: path,
+		csv:  strings.EqualFold(filepath.Ext(path), ".csv"),
+		team: team,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("failed to load task file: %w", err)
+	}
+
+	return s, nil
+}
+
+// AddTasks appends the tasks to the file
+func (s *FileStore) AddTasks(ctx context.Context, tasks []Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := make([]Task, 0, len(s.tasks)+len(tasks))
+	next = append(append(next, s.tasks...), tasks...)
+	return s.save(next)
+}
+
+// GetTask returns the task with the given ID
+func (s *FileStore) GetTask(ctx context.Context, id string) (*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.find(id)
+	if index < 0 {
+		return nil, ErrNotFound
+	}
+
+	task := s.tasks[index]
+	return &task, nil
+}
+
+// ListTasks returns the tasks matching filter, oldest first
+func (s *FileStore) ListTasks(ctx context.Context, filter Filter) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tasks []Task
+	for _, task := range s.tasks {
+		if filter.Matches(task) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+// UpdateTask applies update to the task with the given ID
+func (s *FileStore) UpdateTask(ctx context.Context, id string, update Update) (*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.find(id)
+	if index < 0 {
+		return nil, ErrNotFound
+	}
+
+	task := s.tasks[index]
+	update.Apply(&task)
+
+	next := append([]Task(nil), s.tasks...)
+	next[index] = task
+	if err := s.save(next); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// DeleteTask removes the task with the given ID
+func (s *FileStore) DeleteTask(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.find(id)
+	if index < 0 {
+		return ErrNotFound
+	}
+
+	next := make([]Task, 0, len(s.tasks)-1)
+	next = append(append(next, s.tasks[:index]...), s.tasks[index+1:]...)
+	return s.save(next)
+}
+
+// GetTeam returns the team the store was configured with
+func (s *FileStore) GetTeam(ctx context.Context) ([]TeamMember, error) {
+	return s.team, nil
+}
+
+// find returns the index of the task with the given ID, or -1. The caller must
+// hold s.mu.
+func (s *FileStore) find(id string) int {
+	for i, task := range s.tasks {
+		if task.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// load reads every task from the file. A missing file is treated as empty.
+func (s *FileStore) load() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if s.csv {
+		s.tasks, err = readCSV(f)
+	} else {
+		s.tasks, err = readJSONL(f)
+	}
+	return err
+}
+
+// save rewrites the file with tasks atomically by writing a temporary file and
+// renaming it over the original, and only then keeps tasks in memory, so a
+// failed write leaves the store as it was. The caller must hold s.mu.
+func (s *FileStore) save(tasks []Task) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary task file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if s.csv {
+		err = writeCSV(tmp, tasks)
+	} else {
+		err = writeJSONL(tmp, tasks)
+	}
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write task file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close task file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace task file: %w", err)
+	}
+
+	s.tasks = tasks
+	return nil
+}
+
+// readJSONL decodes one task per line
+func readJSONL(r io.Reader) ([]Task, error) {
+	var tasks []Task
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var task Task
+		if err := json.Unmarshal([]byte(text), &task); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, scanner.Err()
+}
+
+// writeJSONL encodes one task per line
+func writeJSONL(w io.Writer, tasks []Task) error {
+	encoder := json.NewEncoder(w)
+	for _, task := range tasks {
+		if err := encoder.Encode(task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readCSV decodes tasks from a CSV file with a csvHeaders header row
+func readCSV(r io.Reader) ([]Task, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []Task
+	for i, record := range records {
+		if i == 0 {
+			continue // header
+		}
+		// Files written before custom fields, task chains and recurring
+		// tasks existed lack the last columns
+		if len(record) < len(csvHeaders)-3 || len(record) > len(csvHeaders) {
+			return nil, fmt.Errorf("row %d: expected %d columns, got %d", i+1, len(csvHeaders), len(record))
+		}
+
+		var fields map[string]string
+		if len(record) > 9 && record[9] != "" {
+			if err := json.Unmarshal([]byte(record[9]), &fields); err != nil {
+				return nil, fmt.Errorf("row %d: invalid Fields column: %w", i+1, err)
+			}
+		}
+
+		task := Task{
+			Timestamp:   record[0],
+			People:      splitPeople(record[1]),
+			Client:      record[2],
+			Summary:     record[3],
+			FullMessage: record[4],
+			Status:      record[5],
+			DueDate:     record[6],
+			BotNotes:    record[7],
+			ID:          record[8],
+			Fields:      fields,
+		}
+		if len(record) > 10 {
+			task.BlockedBy = record[10]
+		}
+		if len(record) > 11 {
+			task.Recurrence = record[11]
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// writeCSV encodes tasks as CSV with a csvHeaders header row
+func writeCSV(w io.Writer, tasks []Task) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeaders); err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		fields := ""
+		if len(task.Fields) > 0 {
+			data, err := json.Marshal(task.Fields)
+			if err != nil {
+				return err
+			}
+			fields = string(data)
+		}
+
+		err := writer.Write([]string{
+			task.Timestamp,
+			strings.Join(task.People, ", "),
+			task.Client,
+			task.Summary,
+			task.FullMessage,
+			task.Status,
+			task.DueDate,
+			task.BotNotes,
+			task.ID,
+			fields,
+			task.BlockedBy,
+			task.Recurrence,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
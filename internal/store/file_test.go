@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestLocalStores(t *testing.T) {
+	tests := []struct {
+		name string
+		open func(t *testing.T) TaskStore
+	}{
+		{"jsonl", func(t *testing.T) TaskStore { return openFileStore(t, "tasks.jsonl") }},
+		{"csv", func(t *testing.T) TaskStore { return openFileStore(t, "tasks.csv") }},
+		{"sqlite", func(t *testing.T) TaskStore {
+			db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "tasks.db"))
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			t.Cleanup(func() { db.Close() })
+			s, err := NewSQLiteStore(db)
+			if err != nil {
+				t.Fatalf("NewSQLiteStore: %v", err)
+			}
+			return s
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := tt.open(t)
+
+			err := s.AddTasks(ctx, []Task{
+				{ID: "t1", Summary: "Book the venue", People: []string{"Gemma"}, Status: StatusNotStarted},
+				{ID: "t2", Summary: "Send invoices", People: []string{"Lilly"}, Client: "Acme", Status: StatusComplete,
+					BlockedBy: "t1", Recurrence: "FREQ=WEEKLY;BYDAY=MO", Fields: map[string]string{"priority": "high"}},
+			})
+			if err != nil {
+				t.Fatalf("AddTasks: %v", err)
+			}
+
+			task, err := s.GetTask(ctx, "t2")
+			if err != nil {
+				t.Fatalf("GetTask: %v", err)
+			}
+			if task.Client != "Acme" || task.BlockedBy != "t1" || task.Recurrence != "FREQ=WEEKLY;BYDAY=MO" || task.Fields["priority"] != "high" {
+				t.Errorf("GetTask = %+v, want the stored row", task)
+			}
+
+			open, err := s.ListTasks(ctx, Filter{ExcludeStatus: StatusComplete})
+			if err != nil {
+				t.Fatalf("ListTasks: %v", err)
+			}
+			if len(open) != 1 || open[0].ID != "t1" {
+				t.Errorf("open tasks %+v, want t1 only", open)
+			}
+
+			status := StatusInProgress
+			updated, err := s.UpdateTask(ctx, "t1", Update{Status: &status, Fields: map[string]string{"project": "launch"}})
+			if err != nil {
+				t.Fatalf("UpdateTask: %v", err)
+			}
+			if updated.Status != StatusInProgress || updated.Summary != "Book the venue" || updated.Fields["project"] != "launch" {
+				t.Errorf("UpdateTask = %+v, want the status and field changed only", updated)
+			}
+
+			if err := s.DeleteTask(ctx, "t2"); err != nil {
+				t.Fatalf("DeleteTask: %v", err)
+			}
+			if _, err := s.GetTask(ctx, "t2"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetTask after delete = %v, want ErrNotFound", err)
+			}
+			if err := s.DeleteTask(ctx, "t2"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("second DeleteTask = %v, want ErrNotFound", err)
+			}
+			if _, err := s.UpdateTask(ctx, "missing", Update{Status: &status}); !errors.Is(err, ErrNotFound) {
+				t.Errorf("UpdateTask of a missing task = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestFileStoreReopensSavedTasks(t *testing.T) {
+	ctx := context.Background()
+	for _, name := range []string{"tasks.jsonl", "tasks.csv"} {
+		path := filepath.Join(t.TempDir(), name)
+		s, err := NewFileStore(path, nil)
+		if err != nil {
+			t.Fatalf("NewFileStore: %v", err)
+		}
+		if err := s.AddTasks(ctx, []Task{{ID: "t1", Summary: "Book the venue", People: []string{"Gemma", "Lilly"}}}); err != nil {
+			t.Fatalf("AddTasks: %v", err)
+		}
+
+		reopened, err := NewFileStore(path, nil)
+		if err != nil {
+			t.Fatalf("NewFileStore: %v", err)
+		}
+		task, err := reopened.GetTask(ctx, "t1")
+		if err != nil {
+			t.Fatalf("%s: GetTask after reopening: %v", name, err)
+		}
+		if task.Summary != "Book the venue" || len(task.People) != 2 {
+			t.Errorf("%s: reopened task %+v, want the saved row", name, task)
+		}
+	}
+}
+
+func TestFileStoreKeepsMemoryWhenSaveFails(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "tasks")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	s, err := NewFileStore(filepath.Join(dir, "tasks.jsonl"), nil)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	if err := s.AddTasks(ctx, []Task{{ID: "t1", Summary: "Book the venue"}}); err != nil {
+		t.Fatalf("AddTasks: %v", err)
+	}
+
+	// Without its directory the file can't be written
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("failed to remove directory: %v", err)
+	}
+
+	if err := s.AddTasks(ctx, []Task{{ID: "t2"}}); err == nil {
+		t.Fatal("AddTasks succeeded without a directory")
+	}
+	if _, err := s.GetTask(ctx, "t2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unsaved task is in memory: %v", err)
+	}
+
+	summary := "Cancel the venue"
+	if _, err := s.UpdateTask(ctx, "t1", Update{Summary: &summary}); err == nil {
+		t.Fatal("UpdateTask succeeded without a directory")
+	}
+	if err := s.DeleteTask(ctx, "t1"); err == nil {
+		t.Fatal("DeleteTask succeeded without a directory")
+	}
+	task, err := s.GetTask(ctx, "t1")
+	if err != nil {
+		t.Fatalf("saved task lost from memory: %v", err)
+	}
+	if task.Summary != "Book the venue" {
+		t.Errorf("summary = %q after a failed update, want the saved one", task.Summary)
+	}
+}
+
+func openFileStore(t *testing.T, name string) *FileStore {
+	t.Helper()
+	s, err := NewFileStore(filepath.Join(t.TempDir(), name), nil)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return s
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/sheets"
+)
+
+// SheetsBackend is the set of sheet operations SheetsStore relies on. Both
+// *sheets.Client (the Apps Script webhook) and *sheets.APIClient (the Sheets
+// API v4) implement it.
+type SheetsBackend interface {
+	AddTasks(ctx context.Context, tasks []sheets.TaskRow) error
+	GetTasks(ctx context.Context, excludeStatus string) ([]sheets.TaskRow, error)
+	UpdateTask(ctx context.Context, id string, update sheets.TaskUpdate) (*sheets.TaskRow, error)
+	DeleteTask(ctx context.Context, id string) error
+	GetTeam(ctx context.Context) ([]sheets.TeamMember, error)
+}
+
+// SheetsStore keeps tasks in a Google Sheet
+type SheetsStore struct {
+	client SheetsBackend
+}
+
+// NewSheetsStore creates a task store backed by a Google Sheet
+func NewSheetsStore(client SheetsBackend) *SheetsStore {
+	return &SheetsStore{client: client}
+}
+
+// AddTasks appends the tasks as new sheet rows
+func (s *SheetsStore) AddTasks(ctx context.Context, tasks []Task) error {
+	rows := make([]sheets.TaskRow, 0, len(tasks))
+	for _, task := range tasks {
+		rows = append(rows, toRow(task))
+	}
+	return s.client.AddTasks(ctx, rows)
+}
+
+// GetTask returns the row with the given ID
+func (s *SheetsStore) GetTask(ctx context.Context, id string) (*Task, error) {
+	rows, err := s.client.GetTasks(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if row.ID == id {
+			task := fromRow(row)
+			return &task, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// ListTasks returns the rows matching filter. ExcludeStatus is applied by the
+// sheet; the remaining criteria are applied locally.
+func (s *SheetsStore) ListTasks(ctx context.Context, filter Filter) ([]Task, error) {
+	rows, err := s.client.GetTasks(ctx, filter.ExcludeStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []Task
+	for _, row := range rows {
+		task := fromRow(row)
+		if filter.Matches(task) {
+			tasks = append(tasks, task)
+		}
+	}
+
+	return tasks, nil
+}
+
+// UpdateTask changes the given fields on the row with the given ID
+func (s *SheetsStore) UpdateTask(ctx context.Context, id string, update Update) (*Task, error) {
+	row, err := s.client.UpdateTask(ctx, id, sheets.TaskUpdate{
+		People:     update.People,
+		Client:     update.Client,
+		Summary:    update.Summary,
+		Status:     update.Status,
+		DueDate:    update.DueDate,
+		BotNotes:   update.BotNotes,
+		BlockedBy:  update.BlockedBy,
+		Recurrence: update.Recurrence,
+		Fields:     update.Fields,
+	})
+	if err != nil {
+		return nil, mapSheetsError(err)
+	}
+
+	task := fromRow(*row)
+	return &task, nil
+}
+
+// DeleteTask removes the row with the given ID
+func (s *SheetsStore) DeleteTask(ctx context.Context, id string) error {
+	return mapSheetsError(s.client.DeleteTask(ctx, id))
+}
+
+// GetTeam returns the members listed on the team tab
+func (s *SheetsStore) GetTeam(ctx context.Context) ([]TeamMember, error) {
+	members, err := s.client.GetTeam(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	team := make([]TeamMember, 0, len(members))
+	for _, member := range members {
+		team = append(team, TeamMember{Name: member.Name, Email: member.Email})
+	}
+
+	return team, nil
+}
+
+// mapSheetsError translates sheets.ErrNotFound into ErrNotFound
+func mapSheetsError(err error) error {
+	if errors.Is(err, sheets.ErrNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// toRow converts a Task into the sheet wire format
+func toRow(task Task) sheets.TaskRow {
+	return sheets.TaskRow{
+		ID:          task.ID,
+		Timestamp:   task.Timestamp,
+		People:      task.People,
+		Client:      task.Client,
+		Summary:     task.Summary,
+		FullMessage: task.FullMessage,
+		Status:      task.Status,
+		DueDate:     task.DueDate,
+		BotNotes:    task.BotNotes,
+		BlockedBy:   task.BlockedBy,
+		Recurrence:  task.Recurrence,
+		Fields:      task.Fields,
+	}
+}
+
+// fromRow converts a sheet row into a Task
+func fromRow(row sheets.TaskRow) Task {
+	return Task{
+		ID:          row.ID,
+		Timestamp:   row.Timestamp,
+		People:      row.People,
+		Client:      row.Client,
+		Summary:     row.Summary,
+		FullMessage: row.FullMessage,
+		Status:      row.Status,
+		DueDate:     row.DueDate,
+		BotNotes:    row.BotNotes,
+		BlockedBy:   row.BlockedBy,
+		Recurrence:  row.Recurrence,
+		Fields:      row.Fields,
+	}
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/fakesheet"
+	"github.com/giovannigabriele/go-todo-bot/internal/sheets"
+)
+
+// testSchema adds chain, recurrence and custom columns to the default layout
+const testSchema = "Timestamp,People,Client,Summary,FullMessage,Status,DueDate,BotNotes,ID,Blocked By=blockedBy,Recurrence,Priority,Project"
+
+func TestSheetsStore(t *testing.T) {
+	schema, err := sheets.ParseSchema(testSchema)
+	if err != nil {
+		t.Fatalf("ParseSchema: %v", err)
+	}
+	header := make([]string, 0, len(schema))
+	for _, column := range schema {
+		header = append(header, column.Header)
+	}
+
+	tests := []struct {
+		name string
+		open func(t *testing.T, url string) SheetsBackend
+	}{
+		{"apps script", func(t *testing.T, url string) SheetsBackend { return sheets.NewClient(url, schema) }},
+		{"sheets api", func(t *testing.T, url string) SheetsBackend { return newAPIClient(t, url, schema) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := fakesheet.NewServer([]sheets.TeamMember{
+				{Name: " Gemma ", Email: "gemma@example.com"},
+				{Name: "Lilly"},
+			})
+			fake.SetTodoHeader(header, schema)
+			server := httptest.NewServer(fake)
+			t.Cleanup(server.Close)
+			s := NewSheetsStore(tt.open(t, server.URL))
+
+			err := s.AddTasks(ctx, []Task{
+				{ID: "t1", Summary: "Book the venue", People: []string{"Gemma"}, Status: StatusComplete},
+				{ID: "t2", Summary: "Send invoices", People: []string{"Lilly"}, Client: "Acme",
+					BlockedBy: "t1", Recurrence: "FREQ=WEEKLY;BYDAY=MO", Fields: map[string]string{"priority": "high"}},
+			})
+			if err != nil {
+				t.Fatalf("AddTasks: %v", err)
+			}
+
+			// The sheet starts every new row as Not Started and fills in a missing client
+			rows := fake.Tasks()
+			if len(rows) != 2 || rows[0].Status != StatusNotStarted || rows[0].Client != "unclear" || rows[0].Timestamp == "" {
+				t.Fatalf("sheet rows %+v, want two new rows", rows)
+			}
+
+			task, err := s.GetTask(ctx, "t2")
+			if err != nil {
+				t.Fatalf("GetTask: %v", err)
+			}
+			if task.Client != "Acme" || task.BlockedBy != "t1" || task.Recurrence != "FREQ=WEEKLY;BYDAY=MO" || task.Fields["priority"] != "high" {
+				t.Errorf("GetTask = %+v, want the stored row", task)
+			}
+
+			status := StatusComplete
+			updated, err := s.UpdateTask(ctx, "t1", Update{Status: &status, Fields: map[string]string{"project": "launch"}})
+			if err != nil {
+				t.Fatalf("UpdateTask: %v", err)
+			}
+			if updated.Status != StatusComplete || updated.Summary != "Book the venue" || updated.Fields["project"] != "launch" {
+				t.Errorf("UpdateTask = %+v, want the status and field changed only", updated)
+			}
+
+			filters := []struct {
+				filter Filter
+				want   []string
+			}{
+				{Filter{}, []string{"t1", "t2"}},
+				{Filter{ExcludeStatus: StatusComplete}, []string{"t2"}},
+				{Filter{Status: "complete"}, []string{"t1"}},
+				{Filter{Person: "gemma"}, []string{"t1"}},
+				{Filter{Client: "acme", ExcludeStatus: StatusComplete}, []string{"t2"}},
+				{Filter{Client: "Bravo"}, nil},
+			}
+			for _, f := range filters {
+				tasks, err := s.ListTasks(ctx, f.filter)
+				if err != nil {
+					t.Fatalf("ListTasks(%+v): %v", f.filter, err)
+				}
+				var ids []string
+				for _, task := range tasks {
+					ids = append(ids, task.ID)
+				}
+				if !reflect.DeepEqual(ids, f.want) {
+					t.Errorf("ListTasks(%+v) = %v, want %v", f.filter, ids, f.want)
+				}
+			}
+
+			if err := s.DeleteTask(ctx, "t2"); err != nil {
+				t.Fatalf("DeleteTask: %v", err)
+			}
+			if _, err := s.GetTask(ctx, "t2"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetTask after delete = %v, want ErrNotFound", err)
+			}
+			if err := s.DeleteTask(ctx, "t2"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("second DeleteTask = %v, want ErrNotFound", err)
+			}
+			if _, err := s.UpdateTask(ctx, "missing", Update{Status: &status}); !errors.Is(err, ErrNotFound) {
+				t.Errorf("UpdateTask of a missing task = %v, want ErrNotFound", err)
+			}
+			if rows := fake.Tasks(); len(rows) != 1 || rows[0].ID != "t1" || rows[0].Fields["project"] != "launch" {
+				t.Errorf("sheet rows %+v, want the updated t1 only", rows)
+			}
+
+			// Team rows without an email are skipped and names are lower-cased
+			team, err := s.GetTeam(ctx)
+			if err != nil {
+				t.Fatalf("GetTeam: %v", err)
+			}
+			if want := []TeamMember{{Name: "gemma", Email: "gemma@example.com"}}; !reflect.DeepEqual(team, want) {
+				t.Errorf("GetTeam = %+v, want %+v", team, want)
+			}
+		})
+	}
+}
+
+func TestSheetsAPIChecksHeader(t *testing.T) {
+	schema, err := sheets.ParseSchema(testSchema)
+	if err != nil {
+		t.Fatalf("ParseSchema: %v", err)
+	}
+	server := httptest.NewServer(fakesheet.NewServer(nil))
+	t.Cleanup(server.Close)
+
+	// The fake's todo tab has the default header, without the extra columns
+	s := NewSheetsStore(newAPIClient(t, server.URL, schema))
+	_, err = s.ListTasks(context.Background(), Filter{})
+	if err == nil || !strings.Contains(err.Error(), "missing column(s) Blocked By, Recurrence, Priority, Project") {
+		t.Errorf("ListTasks = %v, want the missing columns named", err)
+	}
+}
+
+// newAPIClient creates a Sheets API client authenticated against the fake's
+// token endpoint
+func newAPIClient(t *testing.T, url string, schema sheets.Schema) *sheets.APIClient {
+	t.Helper()
+	key, err := fakesheet.ServiceAccountKey(url)
+	if err != nil {
+		t.Fatalf("ServiceAccountKey: %v", err)
+	}
+	client, err := sheets.NewAPIClient("fake-spreadsheet", key, url, schema)
+	if err != nil {
+		t.Fatalf("NewAPIClient: %v", err)
+	}
+	return client
+}
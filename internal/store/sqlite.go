@@ -0,0 +1,378 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SQLiteStore keeps tasks in the local SQLite database shared with the queue
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore creates a task store in db, creating its tables if needed
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	s := &SQLiteStore{db: db}
+	if err := s.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize task store schema: %w", err)
+	}
+	return s, nil
+}
+
+// initSchema creates the tasks and team_members tables
+func (s *SQLiteStore) initSchema() error {
+	log.Info().Msg("Initializing task store schema...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS tasks (
+			id TEXT PRIMARY KEY,
+			timestamp TEXT NOT NULL,
+			people TEXT NOT NULL,
+			client TEXT NOT NULL,
+			summary TEXT NOT NULL,
+			full_message TEXT NOT NULL,
+			status TEXT NOT NULL,
+			due_date TEXT NOT NULL,
+			bot_notes TEXT NOT NULL,
+			fields TEXT NOT NULL DEFAULT '{}',
+			blocked_by TEXT NOT NULL DEFAULT '',
+			recurrence TEXT NOT NULL DEFAULT ''
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create tasks table: %w", err)
+	}
+
+	// Databases created before custom fields existed lack the fields column
+	if err := s.ensureColumn(ctx, "tasks", "fields", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return err
+	}
+	// Databases created before task chains existed lack the blocked_by column
+	if err := s.ensureColumn(ctx, "tasks", "blocked_by", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// Databases created before recurring tasks existed lack the recurrence column
+	if err := s.ensureColumn(ctx, "tasks", "recurrence", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS team_members (
+			name TEXT PRIMARY KEY,
+			email TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create team_members table: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	return nil
+}
+
+// ensureColumn adds a column to an existing table if it is not there yet
+func (s *SQLiteStore) ensureColumn(ctx context.Context, table, column, definition string) error {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s table: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan %s columns: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating %s columns: %w", table, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add %s.%s column: %w", table, column, err)
+	}
+	return nil
+}
+
+// AddTasks inserts the tasks in a single transaction
+func (s *SQLiteStore) AddTasks(ctx context.Context, tasks []Task) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO tasks (id, timestamp, people, client, summary, full_message, status, due_date, bot_notes, fields, blocked_by, recurrence)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, task := range tasks {
+		fields, err := encodeFields(task.Fields)
+		if err != nil {
+			return err
+		}
+
+		_, err = stmt.ExecContext(ctx,
+			task.ID,
+			task.Timestamp,
+			strings.Join(task.People, ", "),
+			task.Client,
+			task.Summary,
+			task.FullMessage,
+			task.Status,
+			task.DueDate,
+			task.BotNotes,
+			fields,
+			task.BlockedBy,
+			task.Recurrence,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert task: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetTask returns the task with the given ID
+func (s *SQLiteStore) GetTask(ctx context.Context, id string) (*Task, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT id, timestamp, people, client, summary, full_message, status, due_date, bot_notes, fields, blocked_by, recurrence
+		FROM tasks
+		WHERE id = ?
+	`, id)
+
+	task, err := scanTask(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task: %w", err)
+	}
+
+	return task, nil
+}
+
+// ListTasks returns the tasks matching filter, oldest first
+func (s *SQLiteStore) ListTasks(ctx context.Context, filter Filter) ([]Task, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, timestamp, people, client, summary, full_message, status, due_date, bot_notes, fields, blocked_by, recurrence
+		FROM tasks
+		ORDER BY rowid ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task row: %w", err)
+		}
+		if filter.Matches(*task) {
+			tasks = append(tasks, *task)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating task rows: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// UpdateTask applies update to the task with the given ID inside a transaction
+func (s *SQLiteStore) UpdateTask(ctx context.Context, id string, update Update) (*Task, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT id, timestamp, people, client, summary, full_message, status, due_date, bot_notes, fields, blocked_by, recurrence
+		FROM tasks
+		WHERE id = ?
+	`, id)
+
+	task, err := scanTask(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task: %w", err)
+	}
+
+	update.Apply(task)
+
+	fields, err := encodeFields(task.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE tasks
+		SET people = ?, client = ?, summary = ?, status = ?, due_date = ?, bot_notes = ?, fields = ?, blocked_by = ?, recurrence = ?
+		WHERE id = ?
+	`, strings.Join(task.People, ", "), task.Client, task.Summary, task.Status, task.DueDate, task.BotNotes, fields,
+		task.BlockedBy, task.Recurrence, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update task: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return task, nil
+}
+
+// DeleteTask removes the task with the given ID
+func (s *SQLiteStore) DeleteTask(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM tasks WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete task: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check deleted rows: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetTeam returns the members in the team_members table
+func (s *SQLiteStore) GetTeam(ctx context.Context) ([]TeamMember, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, email
+		FROM team_members
+		ORDER BY name ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query team: %w", err)
+	}
+	defer rows.Close()
+
+	var team []TeamMember
+	for rows.Next() {
+		var member TeamMember
+		if err := rows.Scan(&member.Name, &member.Email); err != nil {
+			return nil, fmt.Errorf("failed to scan team row: %w", err)
+		}
+		team = append(team, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating team rows: %w", err)
+	}
+
+	return team, nil
+}
+
+// SetTeam inserts or updates the given team members
+func (s *SQLiteStore) SetTeam(ctx context.Context, team []TeamMember) error {
+	for _, member := range team {
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO team_members (name, email) VALUES (?, ?)
+			ON CONFLICT(name) DO UPDATE SET email = excluded.email
+		`, member.Name, member.Email)
+		if err != nil {
+			return fmt.Errorf("failed to save team member %s: %w", member.Name, err)
+		}
+	}
+	return nil
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTask reads a task from a row selected with the standard column list
+func scanTask(row rowScanner) (*Task, error) {
+	var task Task
+	var people, fields string
+
+	err := row.Scan(
+		&task.ID,
+		&task.Timestamp,
+		&people,
+		&task.Client,
+		&task.Summary,
+		&task.FullMessage,
+		&task.Status,
+		&task.DueDate,
+		&task.BotNotes,
+		&fields,
+		&task.BlockedBy,
+		&task.Recurrence,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	task.People = splitPeople(people)
+	if err := json.Unmarshal([]byte(fields), &task.Fields); err != nil {
+		return nil, fmt.Errorf("failed to decode custom fields of task %s: %w", task.ID, err)
+	}
+	return &task, nil
+}
+
+// encodeFields serializes custom fields for the fields column
+func encodeFields(fields map[string]string) (string, error) {
+	if len(fields) == 0 {
+		return "{}", nil
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode custom fields: %w", err)
+	}
+	return string(data), nil
+}
+
+// splitPeople splits a comma-separated people cell
+func splitPeople(value string) []string {
+	var people []string
+	for _, person := range strings.Split(value, ",") {
+		if person = strings.TrimSpace(person); person != "" {
+			people = append(people, person)
+		}
+	}
+	return people
+}
@@ -0,0 +1,194 @@
+// Package store defines where parsed tasks are kept. The Telegram handler only
+// talks to the TaskStore interface, so the Apps Script webhook, the local
+// SQLite database and plain files are interchangeable backends.
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned when no task matches the requested ID
+var ErrNotFound = errors.New("task not found")
+
+// Task statuses, as offered by the todo tab's status dropdown
+const (
+	StatusNotStarted = "Not Started" // default for newly created tasks
+	StatusInProgress = "In Progress"
+	StatusComplete   = "Complete"
+)
+
+// Statuses lists the valid task statuses
+var Statuses = []string{StatusNotStarted, StatusInProgress, StatusComplete}
+
+// NormalizeStatus returns the canonical spelling of status, matched case
+// insensitively, and whether it is a valid status
+func NormalizeStatus(status string) (string, bool) {
+	for _, valid := range Statuses {
+		if strings.EqualFold(strings.TrimSpace(status), valid) {
+			return valid, true
+		}
+	}
+	return "", false
+}
+
+// Task is a single task row as stored by a backend
+type Task struct {
+	ID          string   `json:"id"`
+	Timestamp   string   `json:"timestamp"`
+	People      []string `json:"people"`
+	Client      string   `json:"client"`
+	Summary     string   `json:"summary"`
+	FullMessage string   `json:"fullMessage"`
+	Status      string   `json:"status"`
+	DueDate     string   `json:"dueDate"`
+	BotNotes    string   `json:"botNotes"`
+
+	// BlockedBy is the ID of the task that must be done before this one can
+	// start, or empty
+	BlockedBy string `json:"blockedBy,omitempty"`
+	// Recurrence is the RRULE of a task that repeats, such as
+	// "FREQ=WEEKLY;BYDAY=MO", or empty
+	Recurrence string `json:"recurrence,omitempty"`
+
+	// Fields holds custom column values (for example priority or project),
+	// keyed by field name
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// TeamMember represents a team member
+type TeamMember struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Filter narrows the tasks returned by ListTasks. Empty fields match everything.
+type Filter struct {
+	Status        string
+	ExcludeStatus string
+	Person        string
+	Client        string
+}
+
+// Update holds the fields to change on an existing task. Nil fields are left
+// untouched.
+type Update struct {
+	People     []string
+	Client     *string
+	Summary    *string
+	Status     *string
+	DueDate    *string
+	BotNotes   *string
+	BlockedBy  *string
+	Recurrence *string
+	Fields     map[string]string // merged into the existing custom fields
+}
+
+// TaskStore is implemented by every task storage backend
+type TaskStore interface {
+	// AddTasks stores new tasks, in order
+	AddTasks(ctx context.Context, tasks []Task) error
+	// GetTask returns the task with the given ID, or ErrNotFound
+	GetTask(ctx context.Context, id string) (*Task, error)
+	// ListTasks returns the tasks matching filter, oldest first
+	ListTasks(ctx context.Context, filter Filter) ([]Task, error)
+	// UpdateTask applies update to the task with the given ID and returns the result
+	UpdateTask(ctx context.Context, id string, update Update) (*Task, error)
+	// DeleteTask removes the task with the given ID, or returns ErrNotFound
+	DeleteTask(ctx context.Context, id string) error
+	// GetTeam returns the known team members
+	GetTeam(ctx context.Context) ([]TeamMember, error)
+}
+
+// NewTask creates a Task from parsed task data with a fresh ID and timestamp
+func NewTask(people []string, client, summary, fullMessage, dueDate, botNotes string) Task {
+	return Task{
+		ID:          uuid.New().String(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		People:      people,
+		Client:      client,
+		Summary:     summary,
+		FullMessage: fullMessage,
+		Status:      StatusNotStarted,
+		DueDate:     dueDate,
+		BotNotes:    botNotes,
+	}
+}
+
+// Matches reports whether task satisfies the filter
+func (f Filter) Matches(task Task) bool {
+	if f.Status != "" && !strings.EqualFold(task.Status, f.Status) {
+		return false
+	}
+	if f.ExcludeStatus != "" && strings.EqualFold(task.Status, f.ExcludeStatus) {
+		return false
+	}
+	if f.Client != "" && !strings.EqualFold(task.Client, f.Client) {
+		return false
+	}
+	if f.Person != "" {
+		found := false
+		for _, person := range task.People {
+			if strings.EqualFold(strings.TrimSpace(person), f.Person) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply copies the non-nil fields of the update onto task
+func (u Update) Apply(task *Task) {
+	if u.People != nil {
+		task.People = u.People
+	}
+	if u.Client != nil {
+		task.Client = *u.Client
+	}
+	if u.Summary != nil {
+		task.Summary = *u.Summary
+	}
+	if u.Status != nil {
+		task.Status = *u.Status
+	}
+	if u.DueDate != nil {
+		task.DueDate = *u.DueDate
+	}
+	if u.BotNotes != nil {
+		task.BotNotes = *u.BotNotes
+	}
+	if u.BlockedBy != nil {
+		task.BlockedBy = *u.BlockedBy
+	}
+	if u.Recurrence != nil {
+		task.Recurrence = *u.Recurrence
+	}
+	for field, value := range u.Fields {
+		if task.Fields == nil {
+			task.Fields = make(map[string]string)
+		}
+		task.Fields[field] = value
+	}
+}
+
+// TeamFromMap builds a team list, sorted by name, from a name→email map
+func TeamFromMap(emails map[string]string) []TeamMember {
+	team := make([]TeamMember, 0, len(emails))
+	for name, email := range emails {
+		team = append(team, TeamMember{
+			Name:  strings.ToLower(strings.TrimSpace(name)),
+			Email: strings.TrimSpace(email),
+		})
+	}
+	sort.Slice(team, func(i, j int) bool { return team[i].Name < team[j].Name })
+	return team
+}
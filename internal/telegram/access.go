@@ -0,0 +1,262 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/access"
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+)
+
+// adminCommands are only available to the configured admin
+var adminCommands = map[string]bool{
+	"approve":   true,
+	"revoke":    true,
+	"allowlist": true,
+	"requests":  true,
+	"usage":     true,
+	"assign":    true,
+}
+
+// actorOf identifies the sender of message
+func actorOf(message *tgbotapi.Message) access.Actor {
+	actor := access.Actor{ChatID: message.Chat.ID}
+	if message.From != nil {
+		actor.UserID = message.From.ID
+		actor.Username = message.From.UserName
+	}
+	return actor
+}
+
+// authorize checks message against the allowlist, refusing it politely if
+// the sender is not approved. It reports whether handling may continue.
+func (h *Handler) authorize(ctx context.Context, message *tgbotapi.Message) bool {
+	actor := actorOf(message)
+
+	if h.access.IsAdmin(actor.UserID) {
+		// Remember where to reach the admin for access requests
+		if message.Chat.IsPrivate() {
+			h.adminChatID.Store(message.Chat.ID)
+		}
+		return true
+	}
+
+	allowed, err := h.access.Allowed(ctx, actor)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check access")
+		h.sendMessage(message.Chat.ID, "❌ Sorry, I couldn't check your access. Please try again later.")
+		return false
+	}
+	if allowed {
+		if message.IsCommand() && adminCommands[message.Command()] {
+			metrics.AccessDenied.WithLabelValues("not_admin").Inc()
+			h.access.RecordAdminDenied(ctx, actor, "/"+message.Command())
+			h.sendMessage(message.Chat.ID, "🔒 Sorry, only the bot's admin can use that command.")
+			return false
+		}
+		return true
+	}
+
+	metrics.AccessDenied.WithLabelValues("not_allowed").Inc()
+	first, err := h.access.RecordDenied(ctx, actor, message.Text)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to record refused message")
+	}
+
+	response := fmt.Sprintf("🙏 Sorry, I only work for approved users and chats. "+
+		"Please ask the bot's admin to approve you, mentioning your user ID (%d) and this chat's ID (%d).",
+		actor.UserID, actor.ChatID)
+	h.sendMessage(message.Chat.ID, response)
+
+	if first {
+		h.notifyAdmin(actor, message.Chat)
+	}
+	return false
+}
+
+// notifyAdmin tells the admin about a first refused message, if the admin's
+// chat is known
+func (h *Handler) notifyAdmin(actor access.Actor, chat *tgbotapi.Chat) {
+	chatID := h.adminChatID.Load()
+	if chatID == 0 {
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🔔 Access request from %s (user %d)", displayName(actor), actor.UserID))
+	if !chat.IsPrivate() {
+		text.WriteString(fmt.Sprintf(" in %s (chat %d)", escape(chat.Title), chat.ID))
+	}
+	text.WriteString(fmt.Sprintf(".\n\nApprove the user: /approve user %d", actor.UserID))
+	if !chat.IsPrivate() {
+		text.WriteString(fmt.Sprintf("\nApprove the whole chat: /approve chat %d", chat.ID))
+	}
+	h.sendMessage(chatID, text.String())
+}
+
+// handleAdminCommand runs an admin command, reporting whether command was one
+func (h *Handler) handleAdminCommand(ctx context.Context, message *tgbotapi.Message) bool {
+	command := message.Command()
+	if !adminCommands[command] {
+		return false
+	}
+
+	var response string
+	switch command {
+	case "approve":
+		response = h.changeAccess(ctx, message, true)
+	case "revoke":
+		response = h.changeAccess(ctx, message, false)
+	case "allowlist":
+		response = h.getAllowlistMessage(ctx)
+	case "requests":
+		response = h.getRequestsMessage(ctx)
+	case "usage":
+		response = h.getUsageMessage(ctx, message.CommandArguments())
+	case "assign":
+		response = h.assignUser(ctx, message.CommandArguments())
+	}
+
+	h.sendMessage(message.Chat.ID, response)
+	return true
+}
+
+// changeAccess approves or revokes the user or chat named by the command
+// arguments, "user <id>" or "chat <id>". The chat ID defaults to the current
+// chat.
+func (h *Handler) changeAccess(ctx context.Context, message *tgbotapi.Message, approve bool) string {
+	usage := "Usage: /approve user <id> or /approve chat <id>, where the chat ID defaults to this chat"
+	if !approve {
+		usage = "Usage: /revoke user <id> or /revoke chat <id>, where the chat ID defaults to this chat"
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 || len(args) > 2 {
+		return usage
+	}
+	kind, ok := access.ParseKind(args[0])
+	if !ok {
+		return usage
+	}
+
+	var id int64
+	switch {
+	case len(args) == 2:
+		parsed, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return usage
+		}
+		id = parsed
+	case kind == access.KindChat:
+		id = message.Chat.ID
+	default:
+		return usage
+	}
+
+	admin := actorOf(message)
+	if !approve {
+		removed, err := h.access.Revoke(ctx, admin, kind, id)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to revoke access")
+			return "❌ Failed to update the allowlist."
+		}
+		if !removed {
+			return fmt.Sprintf("ℹ️ %s %d was not on the allowlist.", kind, id)
+		}
+		return fmt.Sprintf("🚫 Revoked %s %d.", kind, id)
+	}
+
+	label := ""
+	if kind == access.KindChat && id == message.Chat.ID {
+		label = message.Chat.Title
+	}
+	if err := h.access.Allow(ctx, admin, kind, id, label); err != nil {
+		log.Error().Err(err).Msg("Failed to approve access")
+		return "❌ Failed to update the allowlist."
+	}
+
+	// Let an approved user know they can start
+	if kind == access.KindUser {
+		h.sendMessage(id, "✅ You've been approved! Send me a task or use /help to get started.")
+	}
+	return fmt.Sprintf("✅ Approved %s %d.", kind, id)
+}
+
+// getAllowlistMessage lists the approved users and chats
+func (h *Handler) getAllowlistMessage(ctx context.Context) string {
+	entries, err := h.access.List(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list allowlist")
+		return "❌ Failed to read the allowlist."
+	}
+	if len(entries) == 0 {
+		return "The allowlist is empty. Only you can use the bot."
+	}
+
+	var text strings.Builder
+	text.WriteString("🔐 Allowlist:\n")
+	for _, entry := range entries {
+		text.WriteString(fmt.Sprintf("• %s %d", entry.Kind, entry.ID))
+		if entry.Label != "" {
+			text.WriteString(" (" + escape(entry.Label) + ")")
+		}
+		text.WriteString(fmt.Sprintf(", added by %s on %s\n", escape(entry.AddedBy), entry.AddedAt.Format("2006-01-02")))
+	}
+	return text.String()
+}
+
+// getRequestsMessage lists users refused in the last week who are still not
+// approved
+func (h *Handler) getRequestsMessage(ctx context.Context) string {
+	attempts, err := h.access.RecentDenied(ctx, 7*24*time.Hour, 20)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list access requests")
+		return "❌ Failed to read access requests."
+	}
+	if len(attempts) == 0 {
+		return "No access requests in the last 7 days."
+	}
+
+	var text strings.Builder
+	text.WriteString("🔔 Access requests (last 7 days):\n")
+	for _, attempt := range attempts {
+		text.WriteString(fmt.Sprintf("• %s: user %d", displayName(attempt.Actor), attempt.UserID))
+		if attempt.ChatID != attempt.UserID {
+			text.WriteString(fmt.Sprintf(" in chat %d", attempt.ChatID))
+		}
+		text.WriteString(fmt.Sprintf(", %d message(s), last %s\n", attempt.Count, attempt.Last.Format("Jan 2 15:04")))
+	}
+	text.WriteString("\nApprove with /approve user <id> or /approve chat <id>.")
+	return text.String()
+}
+
+// displayName formats an actor for messages to the admin
+func displayName(actor access.Actor) string {
+	if actor.Username != "" {
+		return escape("@" + actor.Username)
+	}
+	return "someone without a username"
+}
+
+// adminHelp is appended to /help for the admin
+const adminHelp = `
+
+🔐 Admin commands:
+/approve user <id> - Approve a user in any chat
+/approve chat <id> - Approve everyone in a chat (defaults to this chat)
+/revoke user|chat <id> - Remove an approval
+/allowlist - List approved users and chats
+/requests - List recent refused users
+/usage [days] - LLM spend by day, model and chat (default 7 days)
+/assign <user id> <name> - Link a user to a team member for reminders, in place of anyone else`
+
+// escape escapes text for Markdown messages
+func escape(text string) string {
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdown, text)
+}
@@ -8,35 +8,36 @@ import (
 	"github.com/giovannigabriele/go-todo-bot/internal/config"
 	"github.com/giovannigabriele/go-todo-bot/internal/llm"
 	"github.com/giovannigabriele/go-todo-bot/internal/sheets"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/rs/zerolog/log"
 )
 
 // Bot represents the Telegram bot
 type Bot struct {
-	api          *tgbotapi.BotAPI
-	config       *config.Config
-	llmClient    *llm.Client
-	sheetsClient *sheets.Client
+	api       *tgbotapi.BotAPI
+	config    *config.Config
+	llmClient *llm.Client
+	taskStore store.TaskStore
 }
 
 // NewBot creates a new Telegram bot instance
 func NewBot(cfg *config.Config) (*Bot, error) {
-	bot, err := tgbotapi.NewBotAPI(cfg.TelegramToken)
+	bot, err := tgbotapi.NewBotAPI(cfg.Telegram.Token)
 	if err != nil {
 		return nil, err
 	}
 
 	// Set debug mode in development
-	bot.Debug = cfg.Environment == "development"
+	bot.Debug = cfg.Server.Environment == "development"
 
 	log.Info().Str("username", bot.Self.UserName).Msg("Telegram bot authorized")
 
 	return &Bot{
-		api:          bot,
-		config:       cfg,
-		llmClient:    llm.NewClient(cfg.OpenRouterAPIKey),
-		sheetsClient: sheets.NewClient(cfg.GoogleScriptURL),
+		api:       bot,
+		config:    cfg,
+		llmClient: llm.NewClient(cfg.LLM.APIKey),
+		taskStore: store.NewSheetsStore(sheets.NewClient(cfg.Sheets.ScriptURL, nil)),
 	}, nil
 }
 
@@ -98,9 +99,9 @@ func (b *Bot) handleMessage(ctx context.Context, message *tgbotapi.Message) {
 	}
 
 	// Convert to sheet tasks
-	var sheetTasks []sheets.TaskRow
+	var sheetTasks []store.Task
 	for _, task := range parseResponse.Tasks {
-		sheetTask := sheets.CreateTaskRow(
+		sheetTask := store.NewTask(
 			task.People,
 			task.Client,
 			task.Summary,
@@ -108,6 +109,7 @@ func (b *Bot) handleMessage(ctx context.Context, message *tgbotapi.Message) {
 			task.DueDate,
 			fmt.Sprintf("Confidence: %.2f, Parsed by: %s", task.Confidence, b.llmClient.GetModel()),
 		)
+		sheetTask.Fields = task.Fields
 		sheetTasks = append(sheetTasks, sheetTask)
 	}
 
@@ -117,7 +119,7 @@ func (b *Bot) handleMessage(ctx context.Context, message *tgbotapi.Message) {
 			Interface("sheet_tasks", sheetTasks).
 			Msg("About to call AddTasks with these tasks")
 
-		if err := b.sheetsClient.AddTasks(ctx, sheetTasks); err != nil {
+		if err := b.taskStore.AddTasks(ctx, sheetTasks); err != nil {
 			log.Error().Err(err).Msg("Failed to save tasks to Google Sheets")
 			b.sendErrorMessage(message.Chat.ID, "I processed your message but couldn't save it to the sheet. Please try again.")
 			return
@@ -0,0 +1,79 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/corrections"
+	"github.com/giovannigabriele/go-todo-bot/internal/llm"
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+	"github.com/giovannigabriele/go-todo-bot/internal/pipeline"
+	"github.com/giovannigabriele/go-todo-bot/internal/tracing"
+)
+
+// handleEdit re-parses an edited task message and updates the rows saved from
+// it. Edits of messages the bot did not parse on their own, such as commands
+// or batches, are ignored, as are edits from people without access.
+func (h *Handler) handleEdit(ctx context.Context, message *tgbotapi.Message) {
+	ctx, span := tracing.Start(ctx, "telegram.edit",
+		attribute.Int64("telegram.chat_id", message.Chat.ID),
+		attribute.Int("telegram.message_id", message.MessageID),
+	)
+	defer span.End()
+
+	if message.Text == "" || message.IsCommand() {
+		return
+	}
+
+	actor := actorOf(message)
+	if !h.access.IsAdmin(actor.UserID) {
+		allowed, err := h.access.Allowed(ctx, actor)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to check access")
+			return
+		}
+		if !allowed {
+			return
+		}
+	}
+	ctx = llm.WithCaller(ctx, actor.ChatID, actor.UserID)
+	metrics.MessagesReceived.WithLabelValues("edit").Inc()
+
+	var result *pipeline.Result
+	var err error
+	if limitErr := h.allow(actor); limitErr != nil {
+		result, err = h.pipeline.ReparseRuleBased(ctx, message.Chat.ID, message.MessageID, message.Text, limitErr)
+	} else {
+		result, err = h.pipeline.Reparse(ctx, message.Chat.ID, message.MessageID, message.Text)
+	}
+	if errors.Is(err, corrections.ErrNotParsed) {
+		log.Debug().Int64("chat_id", message.Chat.ID).Int("message_id", message.MessageID).Msg("Ignoring edit of a message without parsed tasks")
+		return
+	}
+	if errors.Is(err, pipeline.ErrPending) {
+		h.sendMessage(message.Chat.ID, "⏳ The tasks from this message are still waiting to be saved to the sheet, so I can't apply your edit yet. "+
+			"Please edit the message again once I've told you they're saved.")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update tasks from an edited message")
+		h.sendMessage(message.Chat.ID, "❌ I couldn't update the tasks from your edit. You can fix them in the Google Sheet.")
+		return
+	}
+	if !result.Delivered {
+		h.sendBufferedResponse(message.Chat.ID, result.Tasks)
+		return
+	}
+
+	switch {
+	case result.Degraded != nil, result.ParseError != nil && result.ParseError != pipeline.ErrLLMDisabled:
+		h.sendMessage(message.Chat.ID, "✏️ I read your edit with simple rules, so please check the assignments in the Google Sheet. "+
+			"Updated "+describeTasks(result.Tasks))
+	default:
+		h.sendMessage(message.Chat.ID, "✏️ Updated "+describeTasks(result.Tasks))
+	}
+}
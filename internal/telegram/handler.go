@@ -2,26 +2,50 @@ package telegram
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/giovannigabriele/go-todo-bot/internal/access"
+	"github.com/giovannigabriele/go-todo-bot/internal/cron"
+	"github.com/giovannigabriele/go-todo-bot/internal/health"
+	"github.com/giovannigabriele/go-todo-bot/internal/limits"
 	"github.com/giovannigabriele/go-todo-bot/internal/llm"
-	"github.com/giovannigabriele/go-todo-bot/internal/sheets"
+	"github.com/giovannigabriele/go-todo-bot/internal/metrics"
+	"github.com/giovannigabriele/go-todo-bot/internal/pipeline"
+	"github.com/giovannigabriele/go-todo-bot/internal/queue"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+	"github.com/giovannigabriele/go-todo-bot/internal/tracing"
+	"github.com/giovannigabriele/go-todo-bot/internal/usage"
 )
 
+// maxConcurrentUpdates bounds how many updates are handled at once; further
+// updates wait in Telegram's queue
+const maxConcurrentUpdates = 16
+
 // Handler handles Telegram bot interactions
 type Handler struct {
-	bot          *tgbotapi.BotAPI
-	llmClient    *llm.Client
-	sheetsClient *sheets.Client
+	bot       *tgbotapi.BotAPI
+	pipeline  *pipeline.Pipeline
+	access    *access.Store
+	limiter   *limits.MessageLimiter
+	usage     *usage.Ledger
+	recurring *cron.Recurring
+	reminders *cron.Reminders
+
+	// adminChatID is the admin's private chat, once known
+	adminChatID atomic.Int64
 }
 
-// NewHandler creates a new Telegram handler
-func NewHandler(token string, llmClient *llm.Client, sheetsClient *sheets.Client) (*Handler, error) {
+// NewHandler creates a new Telegram handler that submits messages to p from
+// the users and chats approved in acl
+func NewHandler(token string, p *pipeline.Pipeline, acl *access.Store) (*Handler, error) {
 	bot, err := tgbotapi.NewBotAPI(token)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bot: %w", err)
@@ -29,31 +53,111 @@ func NewHandler(token string, llmClient *llm.Client, sheetsClient *sheets.Client
 
 	log.Info().Str("username", bot.Self.UserName).Msg("Telegram bot authorized")
 
-	return &Handler{
-		bot:          bot,
-		llmClient:    llmClient,
-		sheetsClient: sheetsClient,
-	}, nil
+	handler := &Handler{
+		bot:      bot,
+		pipeline: p,
+		access:   acl,
+	}
+	if id := acl.AdminChatID(); id != 0 {
+		handler.adminChatID.Store(id)
+	}
+	return handler, nil
+}
+
+// SetLimiter rate limits task messages per user and chat. Messages over the
+// limit are saved with the rule-based splitter instead of the LLM.
+func (h *Handler) SetLimiter(limiter *limits.MessageLimiter) {
+	h.limiter = limiter
+}
+
+// allow checks actor's message against the rate limits and spend caps. A
+// non-nil error means the message must be parsed without the LLM.
+func (h *Handler) allow(actor access.Actor) error {
+	if h.limiter == nil {
+		return nil
+	}
+	return h.limiter.Allow(actor.UserID, actor.ChatID)
+}
+
+// SetUsage lets the admin's /usage command summarise LLM spend from ledger
+func (h *Handler) SetUsage(ledger *usage.Ledger) {
+	h.usage = ledger
 }
 
 // Start starts the bot with long polling
 func (h *Handler) Start(ctx context.Context) error {
 	log.Info().Msg("Starting Telegram bot with long polling")
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	updates := h.bot.GetUpdatesChan(u)
+	updates := make(chan tgbotapi.Update, 100)
+	go h.pollUpdates(ctx, updates)
 
+	slots := make(chan struct{}, maxConcurrentUpdates)
 	for {
 		select {
 		case <-ctx.Done():
 			log.Info().Msg("Stopping Telegram bot")
-			h.bot.StopReceivingUpdates()
 			return ctx.Err()
 		case update := <-updates:
-			if update.Message != nil {
-				go h.handleMessage(ctx, update.Message)
+			message, edited := update.Message, false
+			if message == nil && update.EditedMessage != nil {
+				message, edited = update.EditedMessage, true
+			}
+			query := update.CallbackQuery
+			if message == nil && query == nil {
+				continue
+			}
+
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				continue
+			}
+			go func(message *tgbotapi.Message, edited bool) {
+				defer func() { <-slots }()
+				if message == nil {
+					h.handleCallback(ctx, query)
+					return
+				}
+				if edited {
+					h.handleEdit(ctx, message)
+					return
+				}
+				h.handleMessage(ctx, message)
+			}(message, edited)
+		}
+	}
+}
+
+// pollUpdates long-polls Telegram until ctx is cancelled. Unlike
+// GetUpdatesChan it records every successful poll, including empty ones, for
+// the readiness check.
+func (h *Handler) pollUpdates(ctx context.Context, updates chan<- tgbotapi.Update) {
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+
+	for ctx.Err() == nil {
+		batch, err := h.bot.GetUpdates(u)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get updates, retrying in 3 seconds")
+			health.RecordFailure(health.ComponentTelegram, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(3 * time.Second):
+			}
+			continue
+		}
+		health.RecordSuccess(health.ComponentTelegram)
+
+		for _, update := range batch {
+			if update.UpdateID < u.Offset {
+				continue
+			}
+			u.Offset = update.UpdateID + 1
+
+			select {
+			case updates <- update:
+			case <-ctx.Done():
+				return
 			}
 		}
 	}
@@ -61,20 +165,42 @@ func (h *Handler) Start(ctx context.Context) error {
 
 // handleMessage processes incoming messages
 func (h *Handler) handleMessage(ctx context.Context, message *tgbotapi.Message) {
+	ctx, span := tracing.Start(ctx, "telegram.update",
+		attribute.Int64("telegram.chat_id", message.Chat.ID),
+		attribute.Int("telegram.message_id", message.MessageID),
+		attribute.Bool("telegram.command", message.IsCommand()),
+	)
+	defer span.End()
+
 	log.Debug().
 		Int64("chat_id", message.Chat.ID).
 		Str("text", message.Text).
 		Str("username", message.From.UserName).
+		Str("trace_id", tracing.TraceID(ctx)).
 		Msg("Received message")
 
+	if !h.authorize(ctx, message) {
+		return
+	}
+	actor := actorOf(message)
+	ctx = llm.WithCaller(ctx, actor.ChatID, actor.UserID)
+	ctx = pipeline.WithMessageID(ctx, message.MessageID)
+
 	// Handle commands
 	if message.IsCommand() {
+		metrics.MessagesReceived.WithLabelValues("command").Inc()
 		h.handleCommand(ctx, message)
 		return
 	}
 
 	// Process regular messages as tasks
 	if message.Text != "" {
+		metrics.MessagesReceived.WithLabelValues("task").Inc()
+		if err := h.allow(actor); err != nil {
+			result, err := h.pipeline.SaveRuleBased(ctx, message.Chat.ID, message.Text, err)
+			h.reportResult(message, result, err)
+			return
+		}
 		h.processTaskMessage(ctx, message)
 	}
 }
@@ -88,6 +214,10 @@ func (h *Handler) handleCommand(ctx context.Context, message *tgbotapi.Message)
 		Int64("chat_id", message.Chat.ID).
 		Msg("Processing command")
 
+	if h.handleAdminCommand(ctx, message) {
+		return
+	}
+
 	var response string
 
 	switch command {
@@ -95,8 +225,21 @@ func (h *Handler) handleCommand(ctx context.Context, message *tgbotapi.Message)
 		response = h.getStartMessage()
 	case "help":
 		response = h.getHelpMessage()
+		if actor := actorOf(message); h.access.IsAdmin(actor.UserID) {
+			response += adminHelp
+		}
 	case "status":
 		response = h.getStatusMessage(ctx)
+	case "recurring":
+		response = h.getRecurringMessage(ctx, message.Chat.ID)
+	case "stop":
+		response = h.stopRecurring(ctx, message.Chat.ID, message.CommandArguments())
+	case "link":
+		response = h.linkUser(ctx, message, message.CommandArguments())
+	case "unlink":
+		response = h.unlinkUser(ctx, message)
+	case "timezone", "quiet":
+		response = h.changeReminderSetting(ctx, message, command, message.CommandArguments())
 	default:
 		response = "Unknown command. Use /help to see available commands."
 	}
@@ -104,84 +247,85 @@ func (h *Handler) handleCommand(ctx context.Context, message *tgbotapi.Message)
 	h.sendMessage(message.Chat.ID, response)
 }
 
-// processTaskMessage processes a message as a potential task
+// processTaskMessage processes a message as a potential task. A single task
+// is saved straight away; several are queued as a batch whose progress is
+// reported to the chat.
 func (h *Handler) processTaskMessage(ctx context.Context, message *tgbotapi.Message) {
 	// Send immediate acknowledgment
 	h.sendMessage(message.Chat.ID, "🔖 Processing your message...")
 
-	// Parse message with LLM
-	parseResp, err := h.llmClient.ParseMessage(ctx, message.Text)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to parse message with LLM")
-		h.handleParseError(message, err)
+	result, err := h.pipeline.Submit(ctx, message.Chat.ID, message.Text)
+	if errors.Is(err, pipeline.ErrNoTasks) {
+		h.sendMessage(message.Chat.ID, "❌ No tasks could be identified in your message.")
+		return
+	}
+	if result == nil {
+		log.Error().Err(err).Msg("Failed to enqueue batch tasks")
+		h.sendMessage(message.Chat.ID, "❌ Failed to process your tasks. Please try again.")
+		return
+	}
+	if result.BatchID == "" {
+		h.reportResult(message, result, err)
 		return
 	}
 
-	// Convert to sheet rows
-	var taskRows []sheets.TaskRow
-	botNotes := ""
-
-	for i, task := range parseResp.Tasks {
-		summary := task.Summary
-		if len(parseResp.Tasks) > 1 {
-			summary = fmt.Sprintf("%s (%d/%d)", task.Summary, i+1, len(parseResp.Tasks))
-		}
+	h.sendBatchStatus(message.Chat.ID, result.BatchID, result.Queued)
+	go h.monitorBatchProgress(ctx, message.Chat.ID, result.BatchID)
+}
 
-		if task.Confidence < 0.7 {
-			botNotes = fmt.Sprintf("Low confidence parse (%.2f)", task.Confidence)
+// reportResult tells the chat what happened to the rows parsed from message
+func (h *Handler) reportResult(message *tgbotapi.Message, result *pipeline.Result, err error) {
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save tasks to the task store")
+		if result != nil && result.ParseError != nil {
+			h.sendMessage(message.Chat.ID, "❌ Sorry, I couldn't process your message. Please try again later.")
+			return
 		}
-
-		taskRow := sheets.CreateTaskRow(
-			task.People,
-			task.Client,
-			summary,
-			message.Text,
-			task.DueDate,
-			botNotes,
-		)
-		taskRows = append(taskRows, taskRow)
-	}
-
-	// Save to Google Sheets
-	if err := h.sheetsClient.AddTasks(ctx, taskRows); err != nil {
-		log.Error().Err(err).Msg("Failed to save tasks to Google Sheets")
 		h.handleSaveError(message, err)
 		return
 	}
+	if !result.Delivered {
+		h.sendBufferedResponse(message.Chat.ID, result.Tasks)
+		return
+	}
+	if result.Degraded != nil {
+		h.sendMessage(message.Chat.ID, degradedMessage(result))
+		return
+	}
+	if result.ParseError == pipeline.ErrLLMDisabled {
+		h.sendMessage(message.Chat.ID, "📝 Automatic parsing is switched off, so I read your message with simple rules. "+
+			"Saved "+describeTasks(result.Tasks))
+		return
+	}
+	if result.ParseError != nil {
+		response := "⚠️ I had trouble parsing your message, so I read it with simple rules. " +
+			"Please check the assignments in the Google Sheet. Saved " + describeTasks(result.Tasks)
+		h.sendMessage(message.Chat.ID, response)
+		return
+	}
 
 	// Send success response
-	h.sendSuccessResponse(message, taskRows)
+	h.sendSuccessResponse(message, result.Tasks)
 }
 
-// handleParseError handles LLM parsing errors
-func (h *Handler) handleParseError(message *tgbotapi.Message, err error) {
-	log.Warn().Err(err).Str("message", message.Text).Msg("Parse error, creating fallback task")
-
-	// Create fallback task assigned to "team"
-	taskRow := sheets.CreateTaskRow(
-		[]string{"team"},
-		"Internal",
-		h.extractSimpleSummary(message.Text),
-		message.Text,
-		"unclear",
-		fmt.Sprintf("Parse error: %s", err.Error()),
-	)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	if err := h.sheetsClient.AddTasks(ctx, []sheets.TaskRow{taskRow}); err != nil {
-		log.Error().Err(err).Msg("Failed to save fallback task")
-		h.sendMessage(message.Chat.ID, "❌ Sorry, I couldn't process your message. Please try again later.")
-		return
+// degradedMessage explains why a message was saved without the LLM
+func degradedMessage(result *pipeline.Result) string {
+	var reason string
+	switch {
+	case errors.Is(result.Degraded, limits.ErrUserRate), errors.Is(result.Degraded, limits.ErrChatRate):
+		reason = "⏱️ Messages are arriving faster than I parse them"
+	case errors.Is(result.Degraded, limits.ErrDailyCap):
+		reason = "💸 Today's AI budget has been used up"
+	case errors.Is(result.Degraded, limits.ErrMonthlyCap):
+		reason = "💸 This month's AI budget has been used up"
+	default:
+		reason = "⚠️ AI parsing is unavailable right now"
 	}
-
-	response := "⚠️ I had trouble parsing your message, but I've saved it as a team task. " +
-		"You can update the assignment in the Google Sheet if needed."
-	h.sendMessage(message.Chat.ID, response)
+	return fmt.Sprintf("%s, so I read your message with simple rules and saved %d task(s). "+
+		"You can fix the assignments in the Google Sheet.", reason, len(result.Tasks))
 }
 
-// handleSaveError handles Google Sheets save errors
+// handleSaveError handles task store save errors
 func (h *Handler) handleSaveError(message *tgbotapi.Message, err error) {
 	response := "❌ I understood your message but couldn't save it to the sheet. " +
 		"Please try again in a few minutes."
@@ -189,9 +333,31 @@ func (h *Handler) handleSaveError(message *tgbotapi.Message, err error) {
 }
 
 // sendSuccessResponse sends a success message after saving tasks
-func (h *Handler) sendSuccessResponse(message *tgbotapi.Message, taskRows []sheets.TaskRow) {
+func (h *Handler) sendSuccessResponse(message *tgbotapi.Message, taskRows []store.Task) {
+	h.sendMessage(message.Chat.ID, "✅ Saved "+describeTasks(taskRows))
+}
+
+// sendBufferedResponse tells the user their tasks were understood but are
+// waiting in the outbox for the sheet to come back
+func (h *Handler) sendBufferedResponse(chatID int64, taskRows []store.Task) {
+	response := fmt.Sprintf("📥 I understood your message (%d task(s)) but couldn't reach the sheet. "+
+		"They're saved locally and I'll let you know as soon as they've been added.", len(taskRows))
+	h.sendMessage(chatID, response)
+}
+
+// NotifyUnblocked tells the chat the tasks came from that the people on task
+// can start it, now blocker is complete
+func (h *Handler) NotifyUnblocked(ctx context.Context, chatID int64, task, blocker store.Task) {
+	if chatID == 0 {
+		return
+	}
+	h.sendMessage(chatID, fmt.Sprintf("🔓 %s: \"%s\" is complete, so \"%s\" can start.",
+		strings.Join(task.People, ", "), blocker.Summary, task.Summary))
+}
+
+// describeTasks lists saved tasks for a confirmation message
+func describeTasks(taskRows []store.Task) string {
 	var response strings.Builder
-	response.WriteString("✅ Saved ")
 
 	if len(taskRows) == 1 {
 		row := taskRows[0]
@@ -203,7 +369,7 @@ func (h *Handler) sendSuccessResponse(message *tgbotapi.Message, taskRows []shee
 		}
 	}
 
-	h.sendMessage(message.Chat.ID, response.String())
+	return response.String()
 }
 
 // sendMessage sends a message to a chat
@@ -243,6 +409,12 @@ func (h *Handler) getHelpMessage() string {
 /start - Show welcome message
 /help - Show this help
 /status - Check bot status
+/recurring - List this chat's recurring tasks
+/stop <id> - Stop a recurring task
+/link <name> - Get due-date reminders for your tasks on the team roster
+/unlink - Stop reminders
+/timezone <zone> - Set the time zone of your reminders
+/quiet <22:00-08:00|off> - Set the hours you get no reminders
 
 📝 How to use:
 Just send me any message describing a task or reminder. I'll automatically parse it and save it to your Google Sheet.
@@ -252,40 +424,49 @@ Examples:
 • "Jemma and Lexi to set up the meeting"
 • "Call the vendor AND review the contract"
 • "Team standup at 9am tomorrow"
+• "Send the weekly client report every Monday"
+• A list with one task per line, starting with "-" or "1."
 
 The bot will:
 • Identify who's responsible
 • Extract the task description
 • Save it with timestamp and status
-• Split multiple tasks automatically`
+• Split multiple tasks automatically and show the progress of batches`
 }
 
 // getStatusMessage returns the status message
 func (h *Handler) getStatusMessage(ctx context.Context) string {
 	// Try to get team data to test connectivity
-	_, err := h.sheetsClient.GetTeam(ctx)
+	_, err := h.pipeline.Store().GetTeam(ctx)
 	if err != nil {
 		return fmt.Sprintf("⚠️ Bot is running but Google Sheets connection failed: %s", err.Error())
 	}
 
-	return "✅ Bot is running and connected to Google Sheets!"
-}
+	stats, err := h.pipeline.Queue().GetTaskStats(ctx)
+	if err != nil {
+		return "✅ Bot is running and connected to Google Sheets!"
+	}
 
-// extractSimpleSummary creates a simple summary from text
-func (h *Handler) extractSimpleSummary(text string) string {
-	const maxLength = 80
+	var status strings.Builder
+	status.WriteString("✅ Bot is running and connected to Google Sheets!\n\n")
+	status.WriteString("📊 Current Queue Status:\n")
 
-	// Take first sentence or truncate
-	sentences := strings.Split(text, ".")
-	if len(sentences) > 0 && len(sentences[0]) > 0 {
-		summary := strings.TrimSpace(sentences[0])
-		if len(summary) <= maxLength {
-			return summary
-		}
+	if count := stats[queue.StatusPending]; count > 0 {
+		status.WriteString(fmt.Sprintf("⏳ Pending: %d tasks\n", count))
+	}
+	if count := stats[queue.StatusRunning]; count > 0 {
+		status.WriteString(fmt.Sprintf("⚙️ Processing: %d tasks\n", count))
+	}
+	if count := stats[queue.StatusComplete]; count > 0 {
+		status.WriteString(fmt.Sprintf("✅ Completed: %d tasks\n", count))
+	}
+	if count := stats[queue.StatusFailed]; count > 0 {
+		status.WriteString(fmt.Sprintf("❌ Failed: %d tasks\n", count))
 	}
 
-	if len(text) <= maxLength {
-		return text
+	if buffered, err := h.pipeline.Queue().CountPendingOutbox(ctx, ""); err == nil && buffered > 0 {
+		status.WriteString(fmt.Sprintf("📥 Waiting for the sheet: %d message(s)\n", buffered))
 	}
-	return text[:maxLength-3] + "..."
+
+	return status.String()
 }
@@ -0,0 +1,73 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/cron"
+)
+
+// shortIDLength is how much of a series ID /recurring shows
+const shortIDLength = 8
+
+// SetRecurring lets /recurring list and /stop end the chat's recurring tasks
+func (h *Handler) SetRecurring(recurring *cron.Recurring) {
+	h.recurring = recurring
+}
+
+// getRecurringMessage lists the active recurring tasks of chatID
+func (h *Handler) getRecurringMessage(ctx context.Context, chatID int64) string {
+	if h.recurring == nil {
+		return "ℹ️ Recurring tasks are not available."
+	}
+
+	list, err := h.recurring.List(ctx, chatID)
+	if err != nil {
+		log.Error().Err(err).Int64("chat_id", chatID).Msg("Failed to list recurring tasks")
+		return "❌ Failed to read recurring tasks."
+	}
+	if len(list) == 0 {
+		return "No recurring tasks in this chat. Say how a task repeats, such as \"every Monday\", to start one."
+	}
+
+	var text strings.Builder
+	text.WriteString("🔁 Recurring tasks:\n")
+	for _, series := range list {
+		text.WriteString(fmt.Sprintf("• `%s` %s: %s \"%s\"",
+			series.ID[:shortIDLength], series.Rule.Describe(),
+			escape(strings.Join(series.Template.People, ", ")), escape(series.Template.Summary)))
+		if next := h.recurring.Next(series); !next.IsZero() {
+			text.WriteString(", next due " + next.Format("2006-01-02"))
+		}
+		text.WriteString("\n")
+	}
+	text.WriteString("\nUse /stop <id> to stop one.")
+	return text.String()
+}
+
+// stopRecurring stops the recurring task of chatID named in arguments
+func (h *Handler) stopRecurring(ctx context.Context, chatID int64, arguments string) string {
+	if h.recurring == nil {
+		return "ℹ️ Recurring tasks are not available."
+	}
+
+	id := strings.TrimSpace(arguments)
+	if id == "" {
+		return "Usage: /stop <id>, with the ID shown by /recurring"
+	}
+
+	series, err := h.recurring.Stop(ctx, chatID, id)
+	if errors.Is(err, cron.ErrSeriesNotFound) {
+		return fmt.Sprintf("No recurring task %s in this chat. Use /recurring to list them.", escape(id))
+	}
+	if err != nil {
+		log.Error().Err(err).Int64("chat_id", chatID).Str("series_id", id).Msg("Failed to stop recurring task")
+		return "❌ Failed to stop the recurring task."
+	}
+	return fmt.Sprintf("⏹ Stopped \"%s\", which repeated %s. Its current row stays in the sheet.",
+		escape(series.Template.Summary), series.Rule.Describe())
+}
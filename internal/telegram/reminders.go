@@ -0,0 +1,346 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/access"
+	"github.com/giovannigabriele/go-todo-bot/internal/cron"
+	"github.com/giovannigabriele/go-todo-bot/internal/store"
+)
+
+// Callback data prefixes of the reminder buttons, followed by the task ID
+const (
+	snoozeCallback = "snooze:"
+	doneCallback   = "done:"
+)
+
+// SetReminders lets users link themselves to a team member for due-date
+// reminders and answers the reminders' buttons
+func (h *Handler) SetReminders(reminders *cron.Reminders) {
+	h.reminders = reminders
+}
+
+// SendReminder DMs userID about a task due soon or overdue, with snooze and
+// done buttons
+func (h *Handler) SendReminder(ctx context.Context, userID int64, reminder cron.Reminder) error {
+	msg := tgbotapi.NewMessage(userID, describeReminder(reminder))
+	msg.ParseMode = tgbotapi.ModeMarkdown
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("💤 Snooze "+describeDuration(h.reminders.SnoozeFor()), snoozeCallback+reminder.Task.ID),
+		tgbotapi.NewInlineKeyboardButtonData("✅ Done", doneCallback+reminder.Task.ID),
+	))
+
+	if _, err := h.bot.Send(msg); err != nil {
+		return fmt.Errorf("failed to send reminder: %w", err)
+	}
+	return nil
+}
+
+// describeReminder writes the text of a reminder, more insistent the longer
+// the task is overdue
+func describeReminder(reminder cron.Reminder) string {
+	task := reminder.Task
+	summary := fmt.Sprintf("\"%s\"", escape(task.Summary))
+	if task.Client != "" {
+		summary += " for " + escape(task.Client)
+	}
+
+	var text string
+	switch {
+	case reminder.Kind == cron.ReminderBefore:
+		text = fmt.Sprintf("📅 Reminder: %s is due tomorrow (%s).", summary, task.DueDate)
+	case reminder.Kind == cron.ReminderDue:
+		text = fmt.Sprintf("⏰ %s is due today.", summary)
+	case reminder.Days == 1:
+		text = fmt.Sprintf("⚠️ %s was due yesterday and is still open.", summary)
+	case reminder.Days < 7:
+		text = fmt.Sprintf("⚠️ %s is %d days overdue (due %s).", summary, reminder.Days, task.DueDate)
+	default:
+		text = fmt.Sprintf("🚨 %s is %d days overdue (due %s). Please finish it, or change its due date in the sheet.",
+			summary, reminder.Days, task.DueDate)
+	}
+
+	if reminder.Snoozed {
+		text = "💤 Snoozed reminder\n" + text
+	}
+	if len(task.People) > 1 {
+		text += "\nWith: " + escape(strings.Join(task.People, ", "))
+	}
+	return text
+}
+
+// describeDuration writes a snooze period as "3h", "30m" or "1 day"
+func describeDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0 && d >= 24*time.Hour:
+		if days := int(d / (24 * time.Hour)); days > 1 {
+			return fmt.Sprintf("%d days", days)
+		}
+		return "1 day"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", int(d/time.Hour))
+	}
+	return fmt.Sprintf("%dm", int(d/time.Minute))
+}
+
+// handleCallback answers a press of a reminder button
+func (h *Handler) handleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	if h.reminders == nil || query.From == nil {
+		h.answerCallback(query, "")
+		return
+	}
+
+	actor := access.Actor{UserID: query.From.ID, Username: query.From.UserName}
+	if query.Message != nil {
+		actor.ChatID = query.Message.Chat.ID
+	}
+	allowed, err := h.access.Allowed(ctx, actor)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check access")
+		h.answerCallback(query, "❌ Sorry, I couldn't check your access.")
+		return
+	}
+	if !allowed {
+		h.answerCallback(query, "🙏 Sorry, I only work for approved users.")
+		return
+	}
+
+	var answer, status string
+	switch {
+	case strings.HasPrefix(query.Data, snoozeCallback):
+		taskID := strings.TrimPrefix(query.Data, snoozeCallback)
+		until, err := h.reminders.Snooze(ctx, query.From.ID, taskID)
+		if err != nil {
+			answer = callbackError(err, taskID)
+			break
+		}
+		answer = "💤 Snoozed for " + describeDuration(h.reminders.SnoozeFor())
+		status = fmt.Sprintf("💤 Snoozed until %s UTC", until.Format("2006-01-02 15:04"))
+	case strings.HasPrefix(query.Data, doneCallback):
+		taskID := strings.TrimPrefix(query.Data, doneCallback)
+		if _, err := h.reminders.Done(ctx, query.From.ID, taskID); err != nil {
+			answer = callbackError(err, taskID)
+			break
+		}
+		answer = "✅ Marked done"
+		status = "✅ Marked done"
+	default:
+		answer = "Unknown button."
+	}
+
+	h.answerCallback(query, answer)
+	if status != "" && query.Message != nil {
+		// Replacing the text drops the buttons, so they can't be pressed twice
+		edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID,
+			query.Message.Text+"\n\n"+status)
+		if _, err := h.bot.Send(edit); err != nil {
+			log.Warn().Err(err).Msg("Failed to update reminder message")
+		}
+	}
+}
+
+// callbackError explains why a reminder button did nothing
+func callbackError(err error, taskID string) string {
+	switch {
+	case errors.Is(err, cron.ErrNotLinked):
+		return "Link yourself to the team with /link first."
+	case errors.Is(err, cron.ErrNotAssigned):
+		return "That task isn't assigned to you."
+	case errors.Is(err, store.ErrNotFound):
+		return "That task no longer exists."
+	}
+	log.Error().Err(err).Str("task_id", taskID).Msg("Failed to handle reminder button")
+	return "❌ Sorry, something went wrong. Please try again later."
+}
+
+// answerCallback acknowledges a button press, showing text if set
+func (h *Handler) answerCallback(query *tgbotapi.CallbackQuery, text string) {
+	if _, err := h.bot.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		log.Warn().Err(err).Msg("Failed to answer callback query")
+	}
+}
+
+// linkUser links the sender of message to the team member named in
+// arguments, or says who they are linked to
+func (h *Handler) linkUser(ctx context.Context, message *tgbotapi.Message, arguments string) string {
+	if h.reminders == nil {
+		return "ℹ️ Reminders are off."
+	}
+	if message.From == nil {
+		return "I can only link people, not channels."
+	}
+	userID := message.From.ID
+
+	name := strings.TrimSpace(arguments)
+	if name == "" {
+		user, err := h.reminders.User(ctx, userID)
+		if errors.Is(err, cron.ErrNotLinked) {
+			return "Usage: /link <name>, with your name as it appears in the team roster"
+		}
+		if err != nil {
+			log.Error().Err(err).Int64("user_id", userID).Msg("Failed to read link")
+			return "❌ Failed to read your link."
+		}
+		return fmt.Sprintf("🔗 You're linked to %s. Use /unlink to stop reminders.", escape(user.Name))
+	}
+
+	member, response := h.rosterName(ctx, name)
+	if member == "" {
+		return response
+	}
+
+	err := h.reminders.Link(ctx, userID, member)
+	if errors.Is(err, cron.ErrNameTaken) {
+		h.notifyLinkConflict(ctx, actorOf(message), member)
+		return fmt.Sprintf("%s is already linked to another Telegram account. I've asked the bot's admin to check, "+
+			"and they can link you with /assign.", escape(member))
+	}
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", userID).Msg("Failed to link user")
+		return "❌ Failed to link you."
+	}
+
+	response = fmt.Sprintf("🔗 Linked you to %s. I'll remind you of your tasks the day before they're due, "+
+		"on the day, and when they're overdue.", escape(member))
+	if !message.Chat.IsPrivate() {
+		response += " Reminders come as private messages, so start a chat with me if you haven't."
+	}
+	return response
+}
+
+// rosterName returns the roster spelling of name, or an empty name and the
+// reason it can't be linked to
+func (h *Handler) rosterName(ctx context.Context, name string) (string, string) {
+	team, err := h.pipeline.Store().GetTeam(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get team roster")
+		return "", "❌ Failed to read the team roster."
+	}
+	for _, m := range team {
+		if strings.EqualFold(strings.TrimSpace(m.Name), name) {
+			return strings.TrimSpace(m.Name), ""
+		}
+	}
+	return "", fmt.Sprintf("%s isn't on the team roster.", escape(name))
+}
+
+// notifyLinkConflict asks the admin to settle a user's claim to a team
+// member someone else is linked to
+func (h *Handler) notifyLinkConflict(ctx context.Context, actor access.Actor, member string) {
+	chatID := h.adminChatID.Load()
+	if chatID == 0 {
+		return
+	}
+
+	text := fmt.Sprintf("🔔 %s (user %d) wants reminders as %s", displayName(actor), actor.UserID, escape(member))
+	if owner, err := h.reminders.Owner(ctx, member); err == nil {
+		text += fmt.Sprintf(", who is linked to user %d", owner.UserID)
+	}
+	text += fmt.Sprintf(".\n\nLink them instead: /assign %d %s", actor.UserID, escape(member))
+	h.sendMessage(chatID, text)
+}
+
+// assignUser links the user named in the arguments, "<user id> <name>", to a
+// team member, unlinking whoever was linked to them
+func (h *Handler) assignUser(ctx context.Context, arguments string) string {
+	if h.reminders == nil {
+		return "ℹ️ Reminders are off."
+	}
+	usage := "Usage: /assign <user id> <name>, with the name as it appears in the team roster"
+
+	id, name, _ := strings.Cut(strings.TrimSpace(arguments), " ")
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || strings.TrimSpace(name) == "" {
+		return usage
+	}
+	member, response := h.rosterName(ctx, strings.TrimSpace(name))
+	if member == "" {
+		return response
+	}
+
+	previous, err := h.reminders.Assign(ctx, userID, member)
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", userID).Msg("Failed to assign user")
+		return "❌ Failed to link the user."
+	}
+	log.Info().Int64("user_id", userID).Int64("previous_user_id", previous).Str("name", member).Msg("Admin linked user to team member")
+
+	response = fmt.Sprintf("🔗 Linked user %d to %s.", userID, escape(member))
+	if previous != 0 {
+		response += fmt.Sprintf(" User %d is no longer linked to them.", previous)
+	}
+	return response
+}
+
+// unlinkUser stops reminders to the sender of message
+func (h *Handler) unlinkUser(ctx context.Context, message *tgbotapi.Message) string {
+	if h.reminders == nil {
+		return "ℹ️ Reminders are off."
+	}
+	if message.From == nil {
+		return "You aren't linked to anyone on the team."
+	}
+
+	err := h.reminders.Unlink(ctx, message.From.ID)
+	if errors.Is(err, cron.ErrNotLinked) {
+		return "You aren't linked to anyone on the team."
+	}
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", message.From.ID).Msg("Failed to unlink user")
+		return "❌ Failed to unlink you."
+	}
+	return "🔕 Unlinked. I won't send you reminders any more."
+}
+
+// changeReminderSetting sets the sender's time zone or quiet hours from
+// arguments, or shows the settings in effect
+func (h *Handler) changeReminderSetting(ctx context.Context, message *tgbotapi.Message, command, arguments string) string {
+	if h.reminders == nil {
+		return "ℹ️ Reminders are off."
+	}
+	if message.From == nil {
+		return "Link yourself to the team with /link first."
+	}
+	userID := message.From.ID
+
+	value := strings.TrimSpace(arguments)
+	if strings.EqualFold(value, "default") {
+		value = ""
+	}
+
+	var err error
+	switch {
+	case arguments == "":
+		_, err = h.reminders.User(ctx, userID)
+	case command == "timezone":
+		err = h.reminders.SetTimezone(ctx, userID, value)
+	default:
+		err = h.reminders.SetQuietHours(ctx, userID, value)
+	}
+	if errors.Is(err, cron.ErrNotLinked) {
+		return "Link yourself to the team with /link first."
+	}
+	if err != nil {
+		if command == "timezone" {
+			return fmt.Sprintf("%s. Use a zone such as Europe/London, or \"default\".", escape(err.Error()))
+		}
+		return fmt.Sprintf("%s. Use /quiet 22:00-08:00, /quiet off or /quiet default.", escape(err.Error()))
+	}
+
+	user, err := h.reminders.User(ctx, userID)
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", userID).Msg("Failed to read reminder settings")
+		return "❌ Failed to read your settings."
+	}
+	location, quiet := h.reminders.Settings(user)
+	return fmt.Sprintf("🔔 Reminders for %s: time zone %s, quiet hours %s.",
+		escape(user.Name), escape(location.String()), quiet)
+}
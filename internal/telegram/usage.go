@@ -0,0 +1,79 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/usage"
+)
+
+// maxUsageDays bounds the span of /usage
+const maxUsageDays = 366
+
+// getUsageMessage summarises LLM spend over the last N days, where N is the
+// command argument (7 by default)
+func (h *Handler) getUsageMessage(ctx context.Context, arguments string) string {
+	if h.usage == nil {
+		return "ℹ️ Usage accounting is off because the LLM is disabled."
+	}
+
+	days := 7
+	if arguments = strings.TrimSpace(arguments); arguments != "" {
+		n, err := strconv.Atoi(arguments)
+		if err != nil || n < 1 || n > maxUsageDays {
+			return fmt.Sprintf("Usage: /usage [days], with days between 1 and %d", maxUsageDays)
+		}
+		days = n
+	}
+
+	to := h.usage.Today()
+	toDay, _ := time.Parse(usage.DayFormat, to)
+	from := toDay.AddDate(0, 0, 1-days).Format(usage.DayFormat)
+
+	summary, err := h.usage.Summarize(ctx, from, to, 5)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to summarize LLM usage")
+		return "❌ Failed to read LLM usage."
+	}
+	if summary.Total.Calls == 0 {
+		return fmt.Sprintf("No LLM calls from %s to %s.", from, to)
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("💰 LLM usage %s to %s\n", from, to))
+	text.WriteString(fmt.Sprintf("Total: $%.4f, %s\n", summary.Total.CostUSD, describeTotals(summary.Total)))
+
+	text.WriteString("\n📅 By day:\n")
+	for _, t := range summary.ByDay {
+		text.WriteString(fmt.Sprintf("• %s: $%.4f, %d call(s)\n", t.Key, t.CostUSD, t.Calls))
+	}
+
+	text.WriteString("\n🤖 By model:\n")
+	for _, t := range summary.ByModel {
+		text.WriteString(fmt.Sprintf("• %s: $%.4f, %s\n", escape(t.Key), t.CostUSD, describeTotals(t)))
+	}
+
+	text.WriteString("\n💬 Top chats:\n")
+	for _, t := range summary.ByChat {
+		chat := t.Key
+		if chat == "0" {
+			chat = "API"
+		}
+		text.WriteString(fmt.Sprintf("• %s: $%.4f, %d call(s)\n", chat, t.CostUSD, t.Calls))
+	}
+	return text.String()
+}
+
+// describeTotals formats the call and token counts of a usage group
+func describeTotals(t usage.Totals) string {
+	description := fmt.Sprintf("%d call(s), %d+%d tokens, %dms avg", t.Calls, t.PromptTokens, t.CompletionTokens, t.AvgLatencyMs)
+	if t.Errors > 0 {
+		description += fmt.Sprintf(", %d failed", t.Errors)
+	}
+	return description
+}
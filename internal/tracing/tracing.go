@@ -0,0 +1,164 @@
+// Package tracing sets up OpenTelemetry tracing. Spans follow a message from
+// the Telegram update through the queue worker to the LLM and Sheets HTTP
+// calls; trace context is carried across the queue as a serialized string.
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/health"
+)
+
+// instrumentationName names the tracer used throughout the bot
+const instrumentationName = "github.com/giovannigabriele/go-todo-bot"
+
+// Config selects the span exporter
+type Config struct {
+	Exporter    string  // "none", "otlp", "stdout" or "file"
+	FilePath    string  // output file for the "file" exporter
+	SampleRatio float64 // fraction of new traces to record
+}
+
+// Setup installs the global tracer provider and propagator. The OTLP exporter
+// reads the standard OTEL_EXPORTER_OTLP_* variables for its endpoint and
+// headers. The returned function flushes and shuts the exporter down.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	var err error
+
+	switch cfg.Exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "file":
+		var file *os.File
+		file, err = os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		closer = file
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", "go-todo-bot"),
+		attribute.String("service.version", health.Build().Version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span with the bot's tracer
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Transport wraps base so every outgoing request gets a client span and
+// carries the trace context
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base)
+}
+
+// Handler wraps h so every incoming request gets a server span named
+// operation, continuing the caller's trace if the request carries one
+func Handler(h http.Handler, operation string) http.Handler {
+	return otelhttp.NewHandler(h, operation)
+}
+
+// Inject serializes the trace context of ctx for storage, or returns "" if
+// ctx carries none
+func Inject(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return ""
+	}
+
+	data, err := json.Marshal(carrier)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// Extract restores trace context serialized by Inject into ctx
+func Extract(ctx context.Context, serialized string) context.Context {
+	if serialized == "" {
+		return ctx
+	}
+
+	carrier := propagation.MapCarrier{}
+	if err := json.Unmarshal([]byte(serialized), &carrier); err != nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// TraceID returns the trace ID of the span in ctx, for log correlation, or ""
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,185 @@
+// Package usage records every LLM call with its tokens, cost and latency,
+// and summarises spend by day, model and chat.
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/giovannigabriele/go-todo-bot/internal/llm"
+)
+
+// DayFormat is the layout of days in the ledger and in summaries
+const DayFormat = "2006-01-02"
+
+// Ledger keeps one llm_usage row per LLM call
+type Ledger struct {
+	db       *sql.DB
+	location *time.Location
+}
+
+// NewLedger creates a ledger in db, creating its table if needed. Calls are
+// filed under their day in location.
+func NewLedger(db *sql.DB, location *time.Location) (*Ledger, error) {
+	l := &Ledger{db: db, location: location}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS llm_usage (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at DATETIME NOT NULL,
+			day TEXT NOT NULL,
+			model TEXT NOT NULL,
+			chat_id INTEGER NOT NULL DEFAULT 0,
+			user_id INTEGER NOT NULL DEFAULT 0,
+			prompt_tokens INTEGER NOT NULL DEFAULT 0,
+			completion_tokens INTEGER NOT NULL DEFAULT 0,
+			total_tokens INTEGER NOT NULL DEFAULT 0,
+			cost_usd REAL NOT NULL DEFAULT 0,
+			latency_ms INTEGER NOT NULL,
+			error TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS idx_llm_usage_day ON llm_usage(day);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create llm_usage table: %w", err)
+	}
+	return l, nil
+}
+
+// Record implements llm.Recorder. Failures are logged, never returned, so
+// accounting can't break parsing.
+func (l *Ledger) Record(ctx context.Context, call llm.Call) {
+	var callErr string
+	if call.Err != nil {
+		callErr = call.Err.Error()
+	}
+
+	_, err := l.db.ExecContext(ctx, `
+		INSERT INTO llm_usage (created_at, day, model, chat_id, user_id, prompt_tokens, completion_tokens,
+			total_tokens, cost_usd, latency_ms, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		call.Time,
+		call.Time.In(l.location).Format(DayFormat),
+		call.Model,
+		call.ChatID,
+		call.UserID,
+		call.Usage.PromptTokens,
+		call.Usage.CompletionTokens,
+		call.Usage.TotalTokens,
+		call.Usage.Cost,
+		call.Latency.Milliseconds(),
+		callErr,
+	)
+	if err != nil {
+		log.Error().Err(err).Str("model", call.Model).Msg("Failed to record LLM usage")
+	}
+}
+
+// Today returns the current day in the ledger's time zone
+func (l *Ledger) Today() string {
+	return time.Now().In(l.location).Format(DayFormat)
+}
+
+// Spent returns the spend so far today and this month, in US dollars
+func (l *Ledger) Spent(ctx context.Context) (day, month float64, err error) {
+	today := l.Today()
+	err = l.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(CASE WHEN day = ? THEN cost_usd END), 0),
+			COALESCE(SUM(cost_usd), 0)
+		FROM llm_usage
+		WHERE day LIKE ?
+	`, today, today[:len("2006-01")]+"-%").Scan(&day, &month)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read LLM spend: %w", err)
+	}
+	return day, month, nil
+}
+
+// Totals aggregates a group of calls
+type Totals struct {
+	Key              string  `json:"key,omitempty"`
+	Calls            int     `json:"calls"`
+	Errors           int     `json:"errors"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	CostUSD          float64 `json:"costUsd"`
+	AvgLatencyMs     int     `json:"avgLatencyMs"`
+}
+
+// Summary is the spend between two days, inclusive
+type Summary struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Total   Totals   `json:"total"`
+	ByDay   []Totals `json:"byDay"`
+	ByModel []Totals `json:"byModel"`
+	ByChat  []Totals `json:"byChat"`
+}
+
+// Summarize totals the calls from day from to day to, both inclusive and
+// formatted as DayFormat. Days are listed in order; models and chats by cost,
+// with at most maxChats chats.
+func (l *Ledger) Summarize(ctx context.Context, from, to string, maxChats int) (*Summary, error) {
+	summary := &Summary{From: from, To: to}
+
+	totals, err := l.group(ctx, "''", from, to, "1", 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(totals) > 0 {
+		summary.Total = totals[0]
+	}
+
+	if summary.ByDay, err = l.group(ctx, "day", from, to, "day ASC", -1); err != nil {
+		return nil, err
+	}
+	if summary.ByModel, err = l.group(ctx, "model", from, to, "cost DESC, calls DESC", -1); err != nil {
+		return nil, err
+	}
+	if summary.ByChat, err = l.group(ctx, "CAST(chat_id AS TEXT)", from, to, "cost DESC, calls DESC", maxChats); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// group totals the calls between from and to by the key expression
+func (l *Ledger) group(ctx context.Context, key, from, to, order string, limit int) ([]Totals, error) {
+	rows, err := l.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s AS k, COUNT(*) AS calls, COALESCE(SUM(error != ''), 0),
+			COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0),
+			COALESCE(SUM(cost_usd), 0) AS cost, COALESCE(AVG(latency_ms), 0)
+		FROM llm_usage
+		WHERE day >= ? AND day <= ?
+		GROUP BY k
+		ORDER BY %s
+		LIMIT ?
+	`, key, order), from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize LLM usage: %w", err)
+	}
+	defer rows.Close()
+
+	result := []Totals{}
+	for rows.Next() {
+		var t Totals
+		var latency float64
+		if err := rows.Scan(&t.Key, &t.Calls, &t.Errors, &t.PromptTokens, &t.CompletionTokens, &t.CostUSD, &latency); err != nil {
+			return nil, fmt.Errorf("failed to scan LLM usage: %w", err)
+		}
+		t.AvgLatencyMs = int(latency)
+		result = append(result, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating LLM usage: %w", err)
+	}
+	return result, nil
+}
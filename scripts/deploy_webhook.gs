@@ -142,17 +142,35 @@ function doPost(e) {
     }
     Logger.log('Sheets "todo" and "team" accessed successfully.');
     
+    // Task actions need the requested column layout to match the todo header
+    const columns = data.columns && data.columns.length ? data.columns : DEFAULT_COLUMNS;
+    let header = [];
+    if (data.action !== 'get_team') {
+      const check = readHeader(todoSheet, columns);
+      if (check.missing.length > 0) {
+        Logger.log('ERROR: todo header is missing columns - ' + check.missing.join(', '));
+        return createErrorResponse('todo header row is missing column(s) ' + check.missing.join(', '), "HEADER_MISMATCH");
+      }
+      header = check.header;
+    }
+    
     // Handle different request types
     let result;
     if (data.action === 'add_tasks') {
       Logger.log('Processing add_tasks action');
-      result = handleAddTasks(todoSheet, data.tasks);
+      result = handleAddTasks(todoSheet, columns, header, data.tasks);
     } else if (data.action === 'get_team') {
       Logger.log('Processing get_team action');
       result = handleGetTeam(teamSheet);
     } else if (data.action === 'get_tasks') {
       Logger.log('Processing get_tasks action');
-      result = handleGetTasks(todoSheet, data.status);
+      result = handleGetTasks(todoSheet, columns, header, data.status);
+    } else if (data.action === 'update_task') {
+      Logger.log('Processing update_task action');
+      result = handleUpdateTask(todoSheet, columns, header, data.id, data.updates || {});
+    } else if (data.action === 'delete_task') {
+      Logger.log('Processing delete_task action');
+      result = handleDeleteTask(todoSheet, columns, header, data.id);
     } else {
       Logger.log('ERROR: Unknown action received - ' + data.action);
       return createErrorResponse('Unknown action: ' + data.action, "UNKNOWN_ACTION", { receivedAction: data.action });
@@ -184,6 +202,7 @@ function doPost(e) {
 function createErrorResponse(message, errorType, additionalData) {
   const errorResponse = {
     status: 'error',
+    error: message,
     message: message,
     errorType: errorType || 'UNKNOWN_ERROR',
     timestamp: new Date().toISOString()
@@ -217,36 +236,108 @@ function parseFormData(formString) {
   return result;
 }
 
+/**
+ * Column layout used when a request does not send one. Must match the
+ * DefaultSchema in internal/sheets/schema.go.
+ */
+const DEFAULT_COLUMNS = [
+  { header: 'Timestamp', field: 'timestamp' },
+  { header: 'People', field: 'people' },
+  { header: 'Client', field: 'client' },
+  { header: 'Summary', field: 'summary' },
+  { header: 'FullMessage', field: 'fullMessage' },
+  { header: 'Status', field: 'status' },
+  { header: 'DueDate', field: 'dueDate' },
+  { header: 'BotNotes', field: 'botNotes' },
+  { header: 'ID', field: 'id' }
+];
+
+/**
+ * Fields stored directly on the task JSON; anything else lives in task.fields
+ */
+const STANDARD_FIELDS = ['timestamp', 'people', 'client', 'summary', 'fullMessage', 'status', 'dueDate', 'botNotes', 'id', 'blockedBy', 'recurrence'];
+
+/**
+ * Reads the todo header row and checks every column in the schema is present.
+ * Returns the header, or null and the missing headers.
+ */
+function readHeader(sheet, columns) {
+  const lastColumn = Math.max(sheet.getLastColumn(), 1);
+  const header = sheet.getRange(1, 1, 1, lastColumn).getValues()[0].map(h => h.toString().trim());
+  const missing = columns.filter(c => header.indexOf(c.header) < 0).map(c => c.header);
+  return { header: header, missing: missing };
+}
+
+/**
+ * Returns the value of a field from the task JSON as a sheet cell
+ */
+function fieldValue(task, field) {
+  if (field === 'people') {
+    return task.people ? task.people.join(', ') : '';
+  }
+  if (field === 'dueDate') {
+    // Convert "Unsure" to empty string for date validation
+    const dueDate = task.dueDate || '';
+    return (dueDate === 'Unsure' || dueDate === 'unclear') ? '' : dueDate;
+  }
+  if (STANDARD_FIELDS.indexOf(field) >= 0) {
+    return task[field] || '';
+  }
+  return (task.fields && task.fields[field]) || '';
+}
+
+/**
+ * Writes the schema columns of a task into row, laid out in header order.
+ * Cells in columns the schema does not map are left as they are.
+ */
+function taskToRow(task, columns, header, row) {
+  columns.forEach(c => {
+    row[header.indexOf(c.header)] = fieldValue(task, c.field);
+  });
+  return row;
+}
+
+/**
+ * Converts a todo sheet row into the task JSON shape used by the bot
+ */
+function rowToTask(row, columns, header) {
+  const task = {};
+  columns.forEach(c => {
+    const cell = row[header.indexOf(c.header)];
+    const value = (cell === undefined || cell === null) ? '' : cell.toString();
+    if (c.field === 'people') {
+      task.people = value.split(',').map(p => p.trim());
+    } else if (STANDARD_FIELDS.indexOf(c.field) >= 0) {
+      task[c.field] = c.field === 'timestamp' || c.field === 'dueDate' ? cell : value;
+    } else if (value !== '') {
+      task.fields = task.fields || {};
+      task.fields[c.field] = value;
+    }
+  });
+  return task;
+}
+
 /**
  * Handles adding new tasks to the todo sheet
  */
-function handleAddTasks(sheet, tasks) {
+function handleAddTasks(sheet, columns, header, tasks) {
   const rows = [];
   
   // Process each task
   tasks.forEach(task => {
-    // Handle dueDate - convert "Unsure" to empty string for date validation
-    let dueDate = task.dueDate || '';
-    if (dueDate === 'Unsure' || dueDate === 'unclear') {
-      dueDate = ''; // Empty string passes date validation
-    }
-    
-    rows.push([
-      new Date().toISOString(),                    // Timestamp
-      task.people ? task.people.join(', ') : '',   // People (comma-separated)
-      task.client || 'unclear',                    // Client (default to unclear)
-      task.summary || '',                          // Summary
-      task.fullMessage || '',                      // FullMessage
-      'Not Started',                               // Status (default)
-      dueDate,                                     // DueDate (empty if "Unsure")
-      task.botNotes || ''                          // BotNotes
-    ]);
+    const row = taskToRow(Object.assign({}, task, {
+      timestamp: new Date().toISOString(),
+      client: task.client || 'unclear',   // Client (default to unclear)
+      status: 'Not Started',              // Status (default)
+      id: task.id || Utilities.getUuid()
+    }), columns, header, header.map(() => ''));
+    rows.push(row);
   });
   
   // Append all rows at once
   if (rows.length > 0) {
     const lastRow = sheet.getLastRow();
-    sheet.getRange(lastRow + 1, 1, rows.length, 8).setValues(rows);
+    sheet.getRange(lastRow + 1, 1, rows.length, header.length).setValues(rows);
   }
   
   return ContentService
@@ -286,26 +377,17 @@ function handleGetTeam(sheet) {
 /**
  * Gets tasks filtered by status
  */
-function handleGetTasks(sheet, statusFilter) {
+function handleGetTasks(sheet, columns, header, statusFilter) {
   const data = sheet.getDataRange().getValues();
   const tasks = [];
   
   // Skip header row
   for (let i = 1; i < data.length; i++) {
-    const status = data[i][5]; // Status column (now at index 5)
+    const task = rowToTask(data[i], columns, header);
     
     // Filter by status if provided
-    if (!statusFilter || status !== statusFilter) {
-      tasks.push({
-        timestamp: data[i][0],
-        people: data[i][1].toString().split(',').map(p => p.trim()),
-        client: data[i][2],
-        summary: data[i][3],
-        fullMessage: data[i][4],
-        status: data[i][5],
-        dueDate: data[i][6],
-        botNotes: data[i][7]
-      });
+    if (!statusFilter || task.status !== statusFilter) {
+      tasks.push(task);
     }
   }
   
@@ -317,6 +399,75 @@ function handleGetTasks(sheet, statusFilter) {
     .setMimeType(ContentService.MimeType.JSON);
 }
 
+/**
+ * Updates the given fields on the row whose ID column matches id
+ */
+function handleUpdateTask(sheet, columns, header, id, updates) {
+  const rowIndex = findRowById(sheet, columns, header, id);
+  if (rowIndex < 0) {
+    return createErrorResponse('Task not found: ' + id, 'NOT_FOUND');
+  }
+  
+  const range = sheet.getRange(rowIndex, 1, 1, header.length);
+  const row = range.getValues()[0];
+  const task = rowToTask(row, columns, header);
+  
+  if (updates.people) task.people = updates.people;
+  ['client', 'summary', 'status', 'dueDate', 'botNotes', 'blockedBy', 'recurrence'].forEach(field => {
+    if (updates[field] !== undefined) task[field] = updates[field];
+  });
+  if (updates.fields) {
+    task.fields = Object.assign(task.fields || {}, updates.fields);
+  }
+  
+  taskToRow(task, columns, header, row);
+  range.setValues([row]);
+  
+  return ContentService
+    .createTextOutput(JSON.stringify({
+      status: 'success',
+      task: rowToTask(row, columns, header)
+    }))
+    .setMimeType(ContentService.MimeType.JSON);
+}
+
+/**
+ * Deletes the row whose ID column matches id
+ */
+function handleDeleteTask(sheet, columns, header, id) {
+  const rowIndex = findRowById(sheet, columns, header, id);
+  if (rowIndex < 0) {
+    return createErrorResponse('Task not found: ' + id, 'NOT_FOUND');
+  }
+  
+  sheet.deleteRow(rowIndex);
+  
+  return ContentService
+    .createTextOutput(JSON.stringify({
+      status: 'success',
+      message: 'Deleted task ' + id
+    }))
+    .setMimeType(ContentService.MimeType.JSON);
+}
+
+/**
+ * Returns the 1-based sheet row holding the task with the given ID, or -1
+ */
+function findRowById(sheet, columns, header, id) {
+  if (!id) {
+    return -1;
+  }
+  
+  const idColumn = header.indexOf(columns.find(c => c.field === 'id').header);
+  const data = sheet.getDataRange().getValues();
+  for (let i = 1; i < data.length; i++) {
+    if (data[i][idColumn] && data[i][idColumn].toString() === id) {
+      return i + 1;
+    }
+  }
+  return -1;
+}
+
 /**
  * Initialize sheets with proper headers and data validation
  * Run this once after creating the spreadsheet
@@ -331,7 +482,7 @@ function initializeSheets() {
   }
   
   // Set headers for todo sheet
-  const todoHeaders = ['Timestamp', 'People', 'Client', 'Summary', 'FullMessage', 'Status', 'DueDate', 'BotNotes'];
+  const todoHeaders = ['Timestamp', 'People', 'Client', 'Summary', 'FullMessage', 'Status', 'DueDate', 'BotNotes', 'ID'];
   todoSheet.getRange(1, 1, 1, todoHeaders.length).setValues([todoHeaders]);
   todoSheet.getRange(1, 1, 1, todoHeaders.length).setFontWeight('bold');
   